@@ -25,9 +25,26 @@ type ServerProperties struct {
 	AutoAofRewritePercentage int64  `mapstructure:"auto_aof_rewrite_percentage"` // 触发重写所需要的 aof 文件体积百分比，增量大于这个值时才进行重写
 	AutoAofRewriteMinSize    int64  `mapstructure:"auto_aov_rewrite_min_size"`   // 表示触发AOF重写的最小文件体积，单位mb
 
+	/* 内存配置 */
+	Maxmemory        int64  `mapstructure:"maxmemory"`         // 最大使用内存的字节数，为 0 时不限制
+	MaxmemoryPolicy  string `mapstructure:"maxmemory_policy"`  // 超过最大使用内存时的淘汰策略
+	MaxmemorySamples int    `mapstructure:"maxmemory_samples"` // 每次淘汰时采样的 key 数量
+
+	/* 数据结构配置 */
+	HllSparseMaxBytes      int `mapstructure:"hll_sparse_max_bytes"`      // HyperLogLog 使用 sparse 编码的最大字节数，超过时转为 dense 编码
+	HashMaxListpackEntries int `mapstructure:"hash_max_listpack_entries"` // hash 使用 listpack 编码的最大元素数量
+	HashMaxListpackValue   int `mapstructure:"hash_max_listpack_value"`   // hash 使用 listpack 编码时 field 和 value 的最大字节数
+	SetMaxIntsetEntries    int `mapstructure:"set_max_intset_entries"`    // set 使用 intset 编码的最大元素数量
+	SetMaxListpackEntries  int `mapstructure:"set_max_listpack_entries"`  // set 使用 listpack 编码的最大元素数量
+	SetMaxListpackValue    int `mapstructure:"set_max_listpack_value"`    // set 使用 listpack 编码时元素的最大字节数
+	ZsetMaxListpackEntries int `mapstructure:"zset_max_listpack_entries"` // zset 使用 listpack 编码的最大元素数量
+	ZsetMaxListpackValue   int `mapstructure:"zset_max_listpack_value"`   // zset 使用 listpack 编码时成员的最大字节数
+	ListCompressDepth      int `mapstructure:"list_compress_depth"`       // list 头尾各有多少个 page 不压缩，中间的 page 使用 flate 压缩，为 0 时不压缩
+
 	/* 集群配置 */
-	Self  string   `mapstructure:"self"`
-	Peers []string `mapstructure:"peers"`
+	Self   string   `mapstructure:"self"`
+	Peers  []string `mapstructure:"peers"`
+	NodeID int      `mapstructure:"node_id"` // snowflake 节点 ID（0~1023），小于 0 时根据 self 计算
 }
 
 var Properties *ServerProperties
@@ -50,6 +67,22 @@ func init() {
 		AutoAofRewrite:           false,
 		AutoAofRewritePercentage: 100,
 		AutoAofRewriteMinSize:    64,
+
+		Maxmemory:        0,
+		MaxmemoryPolicy:  "noeviction",
+		MaxmemorySamples: 5,
+
+		HllSparseMaxBytes:      3000,
+		HashMaxListpackEntries: 128,
+		HashMaxListpackValue:   64,
+		SetMaxIntsetEntries:    512,
+		SetMaxListpackEntries:  128,
+		SetMaxListpackValue:    64,
+		ZsetMaxListpackEntries: 128,
+		ZsetMaxListpackValue:   64,
+		ListCompressDepth:      0,
+
+		NodeID: -1,
 	}
 }
 
@@ -86,6 +119,22 @@ func setDefault() {
 	viper.SetDefault("auto_aof_rewrite", true)
 	viper.SetDefault("auto_aof_rewrite_percentage", int64(100))
 	viper.SetDefault("auto_aov_rewrite_min_size", int64(64))
+
+	viper.SetDefault("maxmemory", int64(0))
+	viper.SetDefault("maxmemory_policy", "noeviction")
+	viper.SetDefault("maxmemory_samples", 5)
+
+	viper.SetDefault("hll_sparse_max_bytes", 3000)
+	viper.SetDefault("hash_max_listpack_entries", 128)
+	viper.SetDefault("hash_max_listpack_value", 64)
+	viper.SetDefault("set_max_intset_entries", 512)
+	viper.SetDefault("set_max_listpack_entries", 128)
+	viper.SetDefault("set_max_listpack_value", 64)
+	viper.SetDefault("zset_max_listpack_entries", 128)
+	viper.SetDefault("zset_max_listpack_value", 64)
+	viper.SetDefault("list_compress_depth", 0)
+
+	viper.SetDefault("node_id", -1)
 }
 
 func fileExists(filename string) bool {
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBigKeysTop = 5  // ANALYZE BIGKEYS 每种类型默认返回的 key 数量
+	defaultHotKeysTop = 10 // ANALYZE HOTKEYS 默认返回的 key 数量
+	maxAnalyzeTop     = 1000
+)
+
+// keyStat 一个 key 的统计信息
+type keyStat struct {
+	db       int
+	key      string
+	elements int64
+	bytes    int64
+}
+
+// bigger 按照估算的字节数、元素数量从大到小排序
+func (k *keyStat) bigger(other *keyStat) bool {
+	if k.bytes != other.bytes {
+		return k.bytes > other.bytes
+	}
+	if k.elements != other.elements {
+		return k.elements > other.elements
+	}
+	if k.db != other.db {
+		return k.db < other.db
+	}
+	return k.key < other.key
+}
+
+// typeStat 一种类型的统计信息，top 中保存最大的若干个 key
+type typeStat struct {
+	keys     int64
+	elements int64
+	bytes    int64
+	top      []*keyStat
+}
+
+// add 统计一个 key，top 保持有序并且最多保存 limit 个
+func (t *typeStat) add(k *keyStat, limit int) {
+	t.keys++
+	t.elements += k.elements
+	t.bytes += k.bytes
+	i := sort.Search(len(t.top), func(i int) bool {
+		return k.bigger(t.top[i])
+	})
+	if i >= limit {
+		return
+	}
+	if len(t.top) < limit {
+		t.top = append(t.top, nil)
+	}
+	copy(t.top[i+1:], t.top[i:])
+	t.top[i] = k
+}
+
+// Analyze ANALYZE BIGKEYS|HOTKEYS ...，分析当前节点所有数据库中的大 key 和热点 key
+func Analyze(s *Server, args [][]byte) redis.Reply {
+	if len(args) < 1 {
+		return reply.MakeArgNumErrReply("analyze")
+	}
+	subCommand := strings.ToLower(string(args[0]))
+	switch subCommand {
+	case "bigkeys":
+		return analyzeBigKeys(s, args[1:])
+	case "hotkeys":
+		return analyzeHotKeys(s, args[1:])
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'")
+}
+
+// parseAnalyzeTop 解析 TOP count
+func parseAnalyzeTop(arg []byte) (int, redis.Reply) {
+	top, err := strconv.Atoi(string(arg))
+	if err != nil || top <= 0 || top > maxAnalyzeTop {
+		return 0, reply.MakeErrReply("ERR TOP must be between 1 and " + strconv.Itoa(maxAnalyzeTop))
+	}
+	return top, nil
+}
+
+// analyzeBigKeys ANALYZE BIGKEYS [TYPE type] [TOP count]，遍历所有数据库，按照类型统计 key 的数量、元素数量、
+// 估算的字节数，以及估算字节数最大的 count 个 key（默认为 5）。字符串的元素数量为字节数
+func analyzeBigKeys(s *Server, args [][]byte) redis.Reply {
+	typeName, top := "", defaultBigKeysTop
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply()
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "TYPE":
+			typeName = strings.ToLower(string(args[i+1]))
+		case "TOP":
+			var errReply redis.Reply
+			if top, errReply = parseAnalyzeTop(args[i+1]); errReply != nil {
+				return errReply
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	stats := make(map[string]*typeStat)
+	for i, holder := range s.dbSet {
+		db := holder.Load().(*engine.DB)
+		db.ForEach(func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			t := utils.EntityType(entity)
+			if typeName != "" && t != typeName {
+				return true
+			}
+			stat, ok := stats[t]
+			if !ok {
+				stat = &typeStat{}
+				stats[t] = stat
+			}
+			stat.add(&keyStat{
+				db:       i,
+				key:      key,
+				elements: utils.EntityLen(entity),
+				bytes:    utils.EntitySize(key, entity, defaultMemorySamples),
+			}, top)
+			return true
+		})
+	}
+
+	types := make([]string, 0, len(stats))
+	for t := range stats {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	result := make([]redis.Reply, 0, 2*len(types))
+	for _, t := range types {
+		stat := stats[t]
+		topKeys := make([]redis.Reply, len(stat.top))
+		for i, k := range stat.top {
+			topKeys[i] = reply.MakeMultiRawReply([]redis.Reply{
+				reply.MakeBulkStringReply([]byte("db")), reply.MakeIntReply(int64(k.db)),
+				reply.MakeBulkStringReply([]byte("key")), reply.MakeBulkStringReply([]byte(k.key)),
+				reply.MakeBulkStringReply([]byte("elements")), reply.MakeIntReply(k.elements),
+				reply.MakeBulkStringReply([]byte("bytes")), reply.MakeIntReply(k.bytes),
+			})
+		}
+		result = append(result, reply.MakeBulkStringReply([]byte(t)), reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkStringReply([]byte("keys")), reply.MakeIntReply(stat.keys),
+			reply.MakeBulkStringReply([]byte("elements")), reply.MakeIntReply(stat.elements),
+			reply.MakeBulkStringReply([]byte("bytes")), reply.MakeIntReply(stat.bytes),
+			reply.MakeBulkStringReply([]byte("top")), reply.MakeMultiRawReply(topKeys),
+		}))
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// analyzeHotKeys ANALYZE HOTKEYS [TOP count] | ANALYZE HOTKEYS RESET，返回所有数据库中访问最频繁的 count 个 key
+// （默认为 10）以及估计的访问次数，访问次数由执行命令时的 HeavyKeeper 统计，每个数据库最多统计 100 个 key。
+// 同时返回记录的访问总数，集群模式下可以在各个节点上执行，比较各个节点的负载
+func analyzeHotKeys(s *Server, args [][]byte) redis.Reply {
+	top := defaultHotKeysTop
+	switch {
+	case len(args) == 1 && strings.ToUpper(string(args[0])) == "RESET":
+		for _, holder := range s.dbSet {
+			holder.Load().(*engine.DB).ResetHotKeys()
+		}
+		return reply.MakeOkReply()
+	case len(args) == 2 && strings.ToUpper(string(args[0])) == "TOP":
+		var errReply redis.Reply
+		if top, errReply = parseAnalyzeTop(args[1]); errReply != nil {
+			return errReply
+		}
+	case len(args) != 0:
+		return reply.MakeSyntaxErrReply()
+	}
+
+	type hotKey struct {
+		db    int
+		key   string
+		count uint32
+	}
+	var accesses int64
+	var hotKeys []hotKey
+	for i, holder := range s.dbSet {
+		items, n := holder.Load().(*engine.DB).HotKeys()
+		accesses += n
+		for _, item := range items {
+			hotKeys = append(hotKeys, hotKey{db: i, key: item.Item, count: item.Count})
+		}
+	}
+	sort.Slice(hotKeys, func(i, j int) bool {
+		if hotKeys[i].count != hotKeys[j].count {
+			return hotKeys[i].count > hotKeys[j].count
+		}
+		if hotKeys[i].db != hotKeys[j].db {
+			return hotKeys[i].db < hotKeys[j].db
+		}
+		return hotKeys[i].key < hotKeys[j].key
+	})
+	if len(hotKeys) > top {
+		hotKeys = hotKeys[:top]
+	}
+
+	result := make([]redis.Reply, len(hotKeys))
+	for i, k := range hotKeys {
+		result[i] = reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkStringReply([]byte("db")), reply.MakeIntReply(int64(k.db)),
+			reply.MakeBulkStringReply([]byte("key")), reply.MakeBulkStringReply([]byte(k.key)),
+			reply.MakeBulkStringReply([]byte("count")), reply.MakeIntReply(int64(k.count)),
+		})
+	}
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte("accesses")), reply.MakeIntReply(accesses),
+		reply.MakeBulkStringReply([]byte("hotkeys")), reply.MakeMultiRawReply(result),
+	})
+}
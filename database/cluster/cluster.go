@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"github.com/bwmarrin/snowflake"
+	"github.com/dawnzzz/simple-redis/config"
 	"github.com/dawnzzz/simple-redis/database/engine"
 	"github.com/dawnzzz/simple-redis/datastruct/dict"
 	"github.com/dawnzzz/simple-redis/interface/cluster"
@@ -26,24 +27,32 @@ type Cluster struct {
 	coordinatorMap *dict.SimpleDict // 记录事务协调者
 }
 
-func NewCluster(self string) *Cluster {
+// NewCluster 创建集群，idGenerator 为本机的 snowflake id 生成器，与 IDGEN 命令共用
+func NewCluster(self string, idGenerator *snowflake.Node) *Cluster {
 	if self == "" {
 		return nil
 	}
 
-	node, _ := snowflake.NewNode(int64(crc32.ChecksumIEEE([]byte(self))) % 1024)
-
 	return &Cluster{
 		self:    self,
 		peers:   consistenthash.New(replicasNum, nil),
 		getters: make(map[string]cluster.PeerGetter),
 
-		idGenerator:    node,
+		idGenerator:    idGenerator,
 		transactionMap: dict.MakeSimpleDict(),
 		coordinatorMap: dict.MakeSimpleDict(),
 	}
 }
 
+// NewSnowflakeNode 创建 snowflake id 生成器，配置的 node_id 小于 0 时根据本机地址计算节点 ID
+func NewSnowflakeNode(self string) (*snowflake.Node, error) {
+	nodeID := int64(config.Properties.NodeID)
+	if nodeID < 0 {
+		nodeID = int64(crc32.ChecksumIEEE([]byte(self))) % 1024
+	}
+	return snowflake.NewNode(nodeID)
+}
+
 // AddPeers 添加节点
 func (cluster *Cluster) AddPeers(peers ...string) {
 	for _, peer := range peers {
@@ -66,7 +75,7 @@ func (cluster *Cluster) Exec(client redis.Connection, dbIndex int, db *engine.DB
 		return db.Exec(client, cmdLine)
 	}
 
-	key := string(cmdLine[1])
+	key := routeKey(cmdLine)
 	peer, ok := cluster.peers.PickNode(key)
 	if !ok || peer == cluster.self {
 		// 在本地执行
@@ -92,6 +101,19 @@ func (cluster *Cluster) Close() {
 	}
 }
 
+// 获取用于选择节点的key，优先使用命令声明的第一个读写key（如 ZMPOP numkeys key ... 中的key）
+func routeKey(cmdLine [][]byte) string {
+	write, read := engine.GetWriteReadKeys(cmdLine)
+	if len(write) > 0 {
+		return write[0]
+	}
+	if len(read) > 0 {
+		return read[0]
+	}
+
+	return string(cmdLine[1])
+}
+
 // 判断这条命令是否一定在本地执行
 // TODO: 后面进行修改，这里只是进行简单的判断
 func mustLocal(cmdLine [][]byte) bool {
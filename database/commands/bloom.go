@@ -0,0 +1,401 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/bloom"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/* ---- Bloom Filter ---- */
+
+// BF.RESERVE key error_rate capacity [EXPANSION expansion] [NONSCALING]
+func execBFReserve(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR bad error rate"), nil
+	}
+	if errorRate <= 0 || errorRate >= 1 {
+		return reply.MakeErrReply("ERR (0 < error rate range < 1)"), nil
+	}
+	capacity, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil || capacity == 0 {
+		return reply.MakeErrReply("ERR (capacity should be larger than 0)"), nil
+	}
+
+	expansion := uint64(bloom.DefaultExpansion)
+	hasExpansion, nonScaling := false, false
+	for i := 3; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "NONSCALING" {
+			nonScaling = true
+		} else if option == "EXPANSION" && i+1 < len(args) {
+			expansion, err = strconv.ParseUint(string(args[i+1]), 10, 32)
+			if err != nil || expansion == 0 {
+				return reply.MakeErrReply("ERR expansion should be greater or equal to 1"), nil
+			}
+			hasExpansion = true
+			i++
+		} else {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+	}
+	if hasExpansion && nonScaling {
+		return reply.MakeErrReply("ERR Nonscaling filters cannot expand"), nil
+	}
+
+	if _, exists := db.GetEntity(key); exists {
+		return reply.MakeErrReply("ERR item exists"), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: bloom.MakeScalableBloomFilter(errorRate, capacity, uint32(expansion), nonScaling),
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// BF.ADD key item
+func execBFAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	bf, errReply := getOrInitBloomFilter(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	added, err := bf.Add(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	if !added {
+		return reply.MakeIntReply(0), nil
+	}
+
+	return reply.MakeIntReply(1), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// BF.MADD key item [item ...]
+func execBFMAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	bf, errReply := getOrInitBloomFilter(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	anyAdded := false
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		added, err := bf.Add(item)
+		if err != nil {
+			result[i] = reply.MakeErrReply(err.Error())
+		} else if added {
+			result[i] = reply.MakeIntReply(1)
+			anyAdded = true
+		} else {
+			result[i] = reply.MakeIntReply(0)
+		}
+	}
+	if !anyAdded {
+		return reply.MakeMultiRawReply(result), nil
+	}
+
+	return reply.MakeMultiRawReply(result), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// BF.EXISTS key item
+func execBFExists(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	bf, errReply := getAsBloomFilter(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if bf == nil || !bf.Exists(args[1]) {
+		return reply.MakeIntReply(0), nil
+	}
+
+	return reply.MakeIntReply(1), nil
+}
+
+// BF.MEXISTS key item [item ...]
+func execBFMExists(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	bf, errReply := getAsBloomFilter(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		if bf != nil && bf.Exists(item) {
+			result[i] = reply.MakeIntReply(1)
+		} else {
+			result[i] = reply.MakeIntReply(0)
+		}
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// BF.INFO key [CAPACITY|SIZE|FILTERS|ITEMS|EXPANSION]
+func execBFInfo(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	bf, errReply := getAsBloomFilter(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if bf == nil {
+		return reply.MakeErrReply("ERR not found"), nil
+	}
+
+	var expansion redis.Reply = reply.MakeIntReply(int64(bf.Expansion()))
+	if bf.Expansion() == 0 {
+		expansion = reply.MakeNullBulkStringReply()
+	}
+	fields := []struct {
+		option string
+		name   string
+		value  redis.Reply
+	}{
+		{"CAPACITY", "Capacity", reply.MakeIntReply(int64(bf.Capacity()))},
+		{"SIZE", "Size", reply.MakeIntReply(int64(bf.Size()))},
+		{"FILTERS", "Number of filters", reply.MakeIntReply(int64(bf.NumFilters()))},
+		{"ITEMS", "Number of items inserted", reply.MakeIntReply(int64(bf.Items()))},
+		{"EXPANSION", "Expansion rate", expansion},
+	}
+
+	if len(args) == 2 {
+		option := strings.ToUpper(string(args[1]))
+		for _, field := range fields {
+			if field.option == option {
+				return reply.MakeMultiRawReply([]redis.Reply{field.value}), nil
+			}
+		}
+		return reply.MakeErrReply("ERR Invalid information value"), nil
+	}
+
+	result := make([]redis.Reply, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, reply.MakeBulkStringReply([]byte(field.name)), field.value)
+	}
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// BF.RESTORE key dump 用于 AOF 重写，恢复整个布隆过滤器
+func execBFRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	bf, err := bloom.Restore(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: bf,
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+func getAsBloomFilter(db *engine.DB, key string) (*bloom.ScalableBloomFilter, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	bf, ok := entity.Data.(*bloom.ScalableBloomFilter)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return bf, nil
+}
+
+// getOrInitBloomFilter 获取布隆过滤器，不存在时使用默认参数创建
+func getOrInitBloomFilter(db *engine.DB, key string) (*bloom.ScalableBloomFilter, reply.ErrorReply) {
+	bf, errReply := getAsBloomFilter(db, key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if bf == nil {
+		bf = bloom.MakeScalableBloomFilter(bloom.DefaultErrorRate, bloom.DefaultCapacity, bloom.DefaultExpansion, false)
+		db.PutEntity(key, &database.DataEntity{
+			Data: bf,
+		})
+	}
+	return bf, nil
+}
+
+/* ---- Cuckoo Filter ---- */
+
+// CF.RESERVE key capacity [BUCKETSIZE bucketsize] [MAXITERATIONS maxiterations] [EXPANSION expansion]
+func execCFReserve(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	capacity, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil || capacity == 0 {
+		return reply.MakeErrReply("ERR Bad capacity"), nil
+	}
+
+	bucketSize := uint64(bloom.DefaultCuckooBucketSize)
+	maxIterations := uint64(bloom.DefaultCuckooMaxIterations)
+	expansion := uint64(bloom.DefaultCuckooExpansion)
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		value, err := strconv.ParseUint(string(args[i+1]), 10, 64)
+		switch {
+		case option == "BUCKETSIZE":
+			if err != nil || value == 0 || value > math.MaxUint8 {
+				return reply.MakeErrReply("ERR Bad bucket size"), nil
+			}
+			bucketSize = value
+		case option == "MAXITERATIONS":
+			if err != nil || value == 0 || value > math.MaxUint16 {
+				return reply.MakeErrReply("ERR Bad maxIterations"), nil
+			}
+			maxIterations = value
+		case option == "EXPANSION":
+			if err != nil || value > math.MaxInt16 {
+				return reply.MakeErrReply("ERR Bad expansion"), nil
+			}
+			expansion = value
+		default:
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		i++
+	}
+
+	if _, exists := db.GetEntity(key); exists {
+		return reply.MakeErrReply("ERR item exists"), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: bloom.MakeCuckooFilter(capacity, uint16(bucketSize), uint16(maxIterations), uint16(expansion)),
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// CF.ADD key item
+func execCFAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	cf, errReply := getAsCuckooFilter(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if cf == nil {
+		cf = bloom.MakeCuckooFilter(bloom.DefaultCuckooCapacity, bloom.DefaultCuckooBucketSize,
+			bloom.DefaultCuckooMaxIterations, bloom.DefaultCuckooExpansion)
+		db.PutEntity(key, &database.DataEntity{
+			Data: cf,
+		})
+	}
+
+	if err := cf.Add(args[1]); err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+
+	return reply.MakeIntReply(1), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// CF.EXISTS key item
+func execCFExists(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	cf, errReply := getAsCuckooFilter(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if cf == nil || !cf.Exists(args[1]) {
+		return reply.MakeIntReply(0), nil
+	}
+
+	return reply.MakeIntReply(1), nil
+}
+
+// CF.DEL key item
+func execCFDel(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	cf, errReply := getAsCuckooFilter(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if cf == nil {
+		return reply.MakeErrReply("ERR Not found"), nil
+	}
+	if !cf.Delete(args[1]) {
+		return reply.MakeIntReply(0), nil
+	}
+
+	return reply.MakeIntReply(1), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// CF.COUNT key item
+func execCFCount(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	cf, errReply := getAsCuckooFilter(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if cf == nil {
+		return reply.MakeIntReply(0), nil
+	}
+
+	return reply.MakeIntReply(int64(cf.Count(args[1]))), nil
+}
+
+// CF.RESTORE key dump 用于 AOF 重写，恢复整个布谷鸟过滤器
+func execCFRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	cf, err := bloom.RestoreCuckooFilter(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: cf,
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+func getAsCuckooFilter(db *engine.DB, key string) (*bloom.CuckooFilter, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	cf, ok := entity.Data.(*bloom.CuckooFilter)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return cf, nil
+}
+
+func init() {
+	engine.RegisterCommand("BF.Reserve", execBFReserve, writeFirstKey, -4, engine.FlagWrite)
+	engine.RegisterCommand("BF.Add", execBFAdd, writeFirstKey, 3, engine.FlagWrite)
+	engine.RegisterCommand("BF.MAdd", execBFMAdd, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("BF.Exists", execBFExists, readFirstKey, 3, engine.FlagReadOnly)
+	engine.RegisterCommand("BF.MExists", execBFMExists, readFirstKey, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("BF.Info", execBFInfo, readFirstKey, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("BF.Restore", execBFRestore, writeFirstKey, 3, engine.FlagWrite|engine.FlagInternal)
+
+	engine.RegisterCommand("CF.Reserve", execCFReserve, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("CF.Add", execCFAdd, writeFirstKey, 3, engine.FlagWrite)
+	engine.RegisterCommand("CF.Exists", execCFExists, readFirstKey, 3, engine.FlagReadOnly)
+	engine.RegisterCommand("CF.Del", execCFDel, writeFirstKey, 3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("CF.Count", execCFCount, readFirstKey, 3, engine.FlagReadOnly)
+	engine.RegisterCommand("CF.Restore", execCFRestore, writeFirstKey, 3, engine.FlagWrite|engine.FlagInternal)
+}
@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+	"time"
+)
+
+// 条件写入的命令执行成功之后自行增加版本号（FlagNoVersion），版本号不匹配时返回空，匹配时返回新的版本号
+
+// KEYVERSION.SET key version [key version ...]，设置 key 的版本号，用于在 AOF 中恢复版本号，客户端不能调用
+func execKeyVersionSet(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	if len(args)%2 != 0 {
+		return reply.MakeArgNumErrReply("keyversion.set"), nil
+	}
+	versions := make([]uint32, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		version, errReply := parseKeyVersion(args[i])
+		if errReply != nil {
+			return errReply, nil
+		}
+		versions = append(versions, version)
+	}
+	for i, version := range versions {
+		db.SetVersion(string(args[2*i]), version)
+	}
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// SETIFVERSION key expected_version value
+func execSetIfVersion(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	expected, errReply := parseKeyVersion(args[1])
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	if db.GetVersion(key) != expected {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+	db.PutEntity(key, makeStringEntity(args[2]))
+	db.AddAof(utils.StringsToCmdLine("SET", key, string(args[2])))
+	if raw, ok := db.TTLMap().Get(key); ok {
+		// 保留原来的过期时间，同时写入 AOF，使得 AOF 中的 SET 不依赖之前的过期时间
+		db.AddAof(utils.ExpireToCmdLine(key, raw.(time.Time)))
+	}
+	db.AddVersion(key)
+	return reply.MakeIntReply(int64(db.GetVersion(key))), nil
+}
+
+// DELIFVERSION key expected_version，key 不存在时不增加版本号
+func execDelIfVersion(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	expected, errReply := parseKeyVersion(args[1])
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	if db.GetVersion(key) != expected {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+	if db.Removes(key) > 0 {
+		db.AddAof(utils.StringsToCmdLine("DEL", key))
+		db.AddVersion(key)
+	}
+	return reply.MakeIntReply(int64(db.GetVersion(key))), nil
+}
+
+// CAS key expected_version command [arg ...]，版本号匹配时执行写命令，命令需要写入 key
+func execCAS(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	expected, errReply := parseKeyVersion(args[1])
+	if errReply != nil {
+		return errReply, nil
+	}
+	cmdLine := args[2:]
+	if errReply := db.CheckSyntaxErr(cmdLine); errReply != nil {
+		return errReply, nil
+	}
+	cmdName := string(cmdLine[0])
+	if engine.IsReadOnlyCommand(cmdName) {
+		return reply.MakeErrReply("ERR CAS only supports write commands"), nil
+	}
+	if engine.IsNoVersionCommand(cmdName) {
+		return reply.MakeErrReply("ERR CAS does not support conditional commands"), nil
+	}
+	write, _ := engine.GetWriteReadKeys(cmdLine)
+	if !containsString(write, key) {
+		return reply.MakeErrReply("ERR command '" + cmdName + "' does not write key '" + key + "'"), nil
+	}
+
+	// 命令涉及的 key 已经由 prepareCAS 加锁
+	if db.GetVersion(key) != expected {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+	r := db.ExecWithLock(cmdLine)
+	if _, blocked := r.(*engine.BlockedReply); blocked {
+		return reply.MakeErrReply("ERR CAS does not support blocking commands"), nil
+	}
+	if reply.IsErrorReply(r) {
+		return r, nil
+	}
+	db.AddVersion(append(write, db.ResolveKeys(cmdLine)...)...)
+	return reply.MakeIntReply(int64(db.GetVersion(key))), nil
+}
+
+// WAITKEY key known_version timeout，key 的版本号与 known_version 不同时立即返回当前的版本号，
+// 否则阻塞直到 key 被写入，超时返回空，timeout 为 0 时一直阻塞
+func execWaitKey(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	known, errReply := parseKeyVersion(args[1])
+	if errReply != nil {
+		return errReply, nil
+	}
+	timeout, errReply := parseBlockingTimeout(args[2])
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	if version := db.GetVersion(key); version != known {
+		return reply.MakeIntReply(int64(version)), nil
+	}
+	// 版本号没有变化，等待 AddVersion 唤醒后重新执行
+	return engine.MakeBlockedReply([]string{key}, timeout), nil
+}
+
+func parseKeyVersion(arg []byte) (uint32, redis.Reply) {
+	version, err := strconv.ParseUint(string(arg), 10, 32)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR version is not an integer or out of range")
+	}
+	return uint32(version), nil
+}
+
+func init() {
+	// 只修改版本号，不再增加版本号，只在加载 AOF 时执行
+	engine.RegisterCommand("KeyVersion.Set", execKeyVersionSet, writeKeyVersionPairs, -3, engine.FlagWrite|engine.FlagNoVersion|engine.FlagInternal)
+	engine.RegisterCommand("SetIfVersion", execSetIfVersion, writeFirstKey, 4, engine.FlagWrite|engine.FlagNoVersion)
+	engine.RegisterCommand("DelIfVersion", execDelIfVersion, writeFirstKey, 3, engine.FlagWrite|engine.FlagAllowOOM|engine.FlagNoVersion)
+	engine.RegisterCommand("CAS", execCAS, prepareCAS, -4, engine.FlagWrite|engine.FlagNoVersion)
+	engine.RegisterKeyResolver("CAS", resolveCAS)
+	engine.RegisterCommand("WaitKey", execWaitKey, readFirstKey, 4, engine.FlagReadOnly)
+}
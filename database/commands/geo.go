@@ -0,0 +1,464 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/dawnzzz/simple-redis/config"
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/sortedset"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/geohash"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+func execGeoAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := args[0]
+
+	// 解析选项
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option != "NX" && option != "XX" && option != "CH" {
+			break
+		}
+	}
+	options := args[1:i]
+	elements := args[i:]
+	if len(elements) == 0 || len(elements)%3 != 0 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	// 将经纬度转换为 geohash 作为有序集合的分数，交给 ZADD 执行
+	zAddArgs := make([][]byte, 0, 1+len(options)+len(elements)/3*2)
+	zAddArgs = append(zAddArgs, key)
+	zAddArgs = append(zAddArgs, options...)
+	for j := 0; j < len(elements); j += 3 {
+		longitude, err1 := strconv.ParseFloat(string(elements[j]), 64)
+		latitude, err2 := strconv.ParseFloat(string(elements[j+1]), 64)
+		if err1 != nil || err2 != nil {
+			return reply.MakeErrReply("ERR value is not a valid float"), nil
+		}
+		if !geohash.Valid(longitude, latitude) {
+			return reply.MakeErrReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", longitude, latitude)), nil
+		}
+		score := geohash.Encode(longitude, latitude)
+		zAddArgs = append(zAddArgs, []byte(strconv.FormatUint(score, 10)), elements[j+2])
+	}
+
+	return execZAdd(db, zAddArgs)
+}
+
+// GEOPOS key [member ...]
+func execGeoPos(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	sortedSet, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		longitude, latitude, ok := getGeoPos(sortedSet, string(member))
+		if !ok {
+			result[i] = reply.MakeNullBulkStringReply()
+			continue
+		}
+		result[i] = makeCoordReply(longitude, latitude)
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// GEODIST key member1 member2 [M|KM|FT|MI]
+func execGeoDist(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	if len(args) > 4 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var errReply reply.ErrorReply
+		unit, errReply = parseGeoUnit(args[3])
+		if errReply != nil {
+			return errReply, nil
+		}
+	}
+
+	sortedSet, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	long1, lat1, ok1 := getGeoPos(sortedSet, string(args[1]))
+	long2, lat2, ok2 := getGeoPos(sortedSet, string(args[2]))
+	if !ok1 || !ok2 {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+
+	dist := geohash.Distance(long1, lat1, long2, lat2) / unit
+	return reply.MakeBulkStringReply([]byte(formatGeoDist(dist))), nil
+}
+
+// GEOHASH key [member ...]
+func execGeoHash(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	sortedSet, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([][]byte, len(args)-1)
+	for i, member := range args[1:] {
+		if sortedSet == nil {
+			continue
+		}
+		element, ok := sortedSet.Get(string(member))
+		if !ok {
+			continue
+		}
+		result[i] = []byte(geohash.ToString(uint64(element.Score)))
+	}
+
+	return reply.MakeMultiBulkStringReply(result), nil
+}
+
+// GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude BYRADIUS radius unit|BYBOX width height unit
+// [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func execGeoSearch(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	opts, errReply := parseGeoSearchArgs(args[1:], false)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	sortedSet, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if sortedSet == nil {
+		return reply.MakeEmptyMultiBulkStringReply(), nil
+	}
+
+	points, errReply := geoSearch(sortedSet, opts)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	if !opts.withCoord && !opts.withDist && !opts.withHash {
+		members := make([][]byte, len(points))
+		for i, point := range points {
+			members[i] = []byte(point.member)
+		}
+		return reply.MakeMultiBulkStringReply(members), nil
+	}
+
+	result := make([]redis.Reply, len(points))
+	for i, point := range points {
+		item := make([]redis.Reply, 0, 4)
+		item = append(item, reply.MakeBulkStringReply([]byte(point.member)))
+		if opts.withDist {
+			item = append(item, reply.MakeBulkStringReply([]byte(formatGeoDist(point.dist/opts.unit))))
+		}
+		if opts.withHash {
+			item = append(item, reply.MakeIntReply(int64(point.hash)))
+		}
+		if opts.withCoord {
+			item = append(item, makeCoordReply(point.longitude, point.latitude))
+		}
+		result[i] = reply.MakeMultiRawReply(item)
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// GEOSEARCHSTORE destination source FROMMEMBER member|FROMLONLAT longitude latitude BYRADIUS radius unit|BYBOX width height unit
+// [ASC|DESC] [COUNT count [ANY]] [STOREDIST]
+func execGeoSearchStore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	destKey := string(args[0])
+	srcKey := string(args[1])
+	opts, errReply := parseGeoSearchArgs(args[2:], true)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	sortedSet, errReply := getAsSortedSet(db, srcKey)
+	if errReply != nil {
+		return errReply, nil
+	}
+	var points []*geoPoint
+	if sortedSet != nil {
+		points, errReply = geoSearch(sortedSet, opts)
+		if errReply != nil {
+			return errReply, nil
+		}
+	}
+
+	if len(points) == 0 {
+		// 结果为空时删除目标 key
+		db.Remove(destKey)
+		return reply.MakeIntReply(0), &engine.AofExpireCtx{NeedAof: true}
+	}
+
+	dest := sortedset.MakeCompactSortedSet(config.Properties.ZsetMaxListpackEntries, config.Properties.ZsetMaxListpackValue)
+	for _, point := range points {
+		score := float64(point.hash)
+		if opts.storeDist {
+			score = point.dist / opts.unit
+		}
+		dest.Add(point.member, score)
+	}
+	db.PutEntity(destKey, &database.DataEntity{
+		Data: dest,
+	})
+
+	return reply.MakeIntReply(int64(len(points))), &engine.AofExpireCtx{NeedAof: true}
+}
+
+type geoSearchArgs struct {
+	fromMember    bool
+	member        string
+	longitude     float64
+	latitude      float64
+	hasFrom       bool
+	byRadius      bool
+	radius        float64 // 单位 m
+	width, height float64 // 单位 m
+	hasBy         bool
+	unit          float64
+	desc          bool
+	sorted        bool
+	count         int
+	any           bool
+	withCoord     bool
+	withDist      bool
+	withHash      bool
+	storeDist     bool
+}
+
+// parseGeoSearchArgs 解析 GEOSEARCH 与 GEOSEARCHSTORE 中 key 之后的参数
+func parseGeoSearchArgs(args [][]byte, store bool) (*geoSearchArgs, reply.ErrorReply) {
+	opts := &geoSearchArgs{unit: 1}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "FROMMEMBER" && i+1 < len(args):
+			if opts.hasFrom {
+				return nil, reply.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+			}
+			opts.hasFrom, opts.fromMember = true, true
+			opts.member = string(args[i+1])
+			i++
+		case option == "FROMLONLAT" && i+2 < len(args):
+			if opts.hasFrom {
+				return nil, reply.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+			}
+			longitude, err1 := strconv.ParseFloat(string(args[i+1]), 64)
+			latitude, err2 := strconv.ParseFloat(string(args[i+2]), 64)
+			if err1 != nil || err2 != nil {
+				return nil, reply.MakeErrReply("ERR value is not a valid float")
+			}
+			if !geohash.Valid(longitude, latitude) {
+				return nil, reply.MakeErrReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", longitude, latitude))
+			}
+			opts.hasFrom = true
+			opts.longitude, opts.latitude = longitude, latitude
+			i += 2
+		case option == "BYRADIUS" && i+2 < len(args):
+			if opts.hasBy {
+				return nil, reply.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+			}
+			radius, err := strconv.ParseFloat(string(args[i+1]), 64)
+			if err != nil || radius < 0 {
+				return nil, reply.MakeErrReply("ERR radius cannot be negative")
+			}
+			unit, errReply := parseGeoUnit(args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.hasBy, opts.byRadius = true, true
+			opts.radius = radius * unit
+			opts.unit = unit
+			i += 2
+		case option == "BYBOX" && i+3 < len(args):
+			if opts.hasBy {
+				return nil, reply.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+			}
+			width, err1 := strconv.ParseFloat(string(args[i+1]), 64)
+			height, err2 := strconv.ParseFloat(string(args[i+2]), 64)
+			if err1 != nil || err2 != nil || width < 0 || height < 0 {
+				return nil, reply.MakeErrReply("ERR height or width cannot be negative")
+			}
+			unit, errReply := parseGeoUnit(args[i+3])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.hasBy = true
+			opts.width, opts.height = width*unit, height*unit
+			opts.unit = unit
+			i += 3
+		case option == "ASC" || option == "DESC":
+			opts.sorted = true
+			opts.desc = option == "DESC"
+		case option == "COUNT" && i+1 < len(args):
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || count <= 0 {
+				return nil, reply.MakeErrReply("ERR COUNT must be > 0")
+			}
+			opts.count = count
+			i++
+			if i+1 < len(args) && strings.ToUpper(string(args[i+1])) == "ANY" {
+				opts.any = true
+				i++
+			}
+		case option == "WITHCOORD" && !store:
+			opts.withCoord = true
+		case option == "WITHDIST" && !store:
+			opts.withDist = true
+		case option == "WITHHASH" && !store:
+			opts.withHash = true
+		case option == "STOREDIST" && store:
+			opts.storeDist = true
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+
+	if !opts.hasFrom {
+		return nil, reply.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	}
+	if !opts.hasBy {
+		return nil, reply.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	}
+	if opts.any && opts.count == 0 {
+		return nil, reply.MakeErrReply("ERR the ANY argument requires COUNT argument")
+	}
+	// 指定了 COUNT 但是没有 ANY 时，返回距离最近的 count 个成员
+	if opts.count > 0 && !opts.any && !opts.sorted {
+		opts.sorted = true
+	}
+
+	return opts, nil
+}
+
+type geoPoint struct {
+	member    string
+	hash      uint64
+	longitude float64
+	latitude  float64
+	dist      float64 // 到中心点的距离，单位 m
+}
+
+// geoSearch 在有序集合中搜索范围内的成员
+func geoSearch(sortedSet *sortedset.SortedSet, opts *geoSearchArgs) ([]*geoPoint, reply.ErrorReply) {
+	longitude, latitude := opts.longitude, opts.latitude
+	if opts.fromMember {
+		var ok bool
+		longitude, latitude, ok = getGeoPos(sortedSet, opts.member)
+		if !ok {
+			return nil, reply.MakeErrReply("ERR could not decode requested zset member")
+		}
+	}
+
+	width, height := opts.width, opts.height
+	if opts.byRadius {
+		width, height = opts.radius*2, opts.radius*2
+	}
+
+	points := make([]*geoPoint, 0)
+	for _, r := range geohash.SearchRanges(longitude, latitude, width, height) {
+		min := &sortedset.ScoreBorder{Value: float64(r.Min)}
+		max := &sortedset.ScoreBorder{Value: float64(r.Max), Exclude: true}
+		stop := false
+		sortedSet.ForEachByScore(min, max, 0, -1, false, func(element *sortedset.Element) bool {
+			hash := uint64(element.Score)
+			pointLong, pointLat := geohash.Decode(hash)
+			dist := geohash.Distance(longitude, latitude, pointLong, pointLat)
+			if opts.byRadius {
+				if dist > opts.radius {
+					return true
+				}
+			} else if !geohash.InRectangle(width, height, longitude, latitude, pointLong, pointLat) {
+				return true
+			}
+			points = append(points, &geoPoint{
+				member:    element.Member,
+				hash:      hash,
+				longitude: pointLong,
+				latitude:  pointLat,
+				dist:      dist,
+			})
+			// ANY 时找到足够的成员之后立即返回
+			stop = opts.any && len(points) >= opts.count
+			return !stop
+		})
+		if stop {
+			break
+		}
+	}
+
+	if opts.sorted {
+		sort.SliceStable(points, func(i, j int) bool {
+			if opts.desc {
+				return points[i].dist > points[j].dist
+			}
+			return points[i].dist < points[j].dist
+		})
+	}
+	if opts.count > 0 && len(points) > opts.count {
+		points = points[:opts.count]
+	}
+
+	return points, nil
+}
+
+func getGeoPos(sortedSet *sortedset.SortedSet, member string) (float64, float64, bool) {
+	if sortedSet == nil {
+		return 0, 0, false
+	}
+	element, ok := sortedSet.Get(member)
+	if !ok {
+		return 0, 0, false
+	}
+	longitude, latitude := geohash.Decode(uint64(element.Score))
+	return longitude, latitude, true
+}
+
+// parseGeoUnit 返回单位对应的米数
+func parseGeoUnit(arg []byte) (float64, reply.ErrorReply) {
+	switch strings.ToLower(string(arg)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, reply.MakeErrReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+func formatGeoDist(dist float64) string {
+	return strconv.FormatFloat(dist, 'f', 4, 64)
+}
+
+func makeCoordReply(longitude, latitude float64) redis.Reply {
+	return reply.MakeMultiBulkStringReply([][]byte{
+		[]byte(strconv.FormatFloat(longitude, 'f', -1, 64)),
+		[]byte(strconv.FormatFloat(latitude, 'f', -1, 64)),
+	})
+}
+
+func init() {
+	engine.RegisterCommand("GeoAdd", execGeoAdd, writeFirstKey, -5, engine.FlagWrite)
+	engine.RegisterCommand("GeoPos", execGeoPos, readFirstKey, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("GeoDist", execGeoDist, readFirstKey, -4, engine.FlagReadOnly)
+	engine.RegisterCommand("GeoHash", execGeoHash, readFirstKey, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("GeoSearch", execGeoSearch, readFirstKey, -7, engine.FlagReadOnly)
+	engine.RegisterCommand("GeoSearchStore", execGeoSearchStore, prepareGeoSearchStore, -8, engine.FlagWrite)
+}
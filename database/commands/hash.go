@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"github.com/dawnzzz/simple-redis/config"
 	"github.com/dawnzzz/simple-redis/database/engine"
 	Dict "github.com/dawnzzz/simple-redis/datastruct/dict"
 	"github.com/dawnzzz/simple-redis/interface/database"
@@ -27,6 +28,8 @@ func execHSet(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx)
 		value := args[i+1]
 		result += dict.Put(field, value)
 	}
+	// 更新二级索引
+	db.Reindex(key)
 
 	return reply.MakeIntReply(int64(result)), &engine.AofExpireCtx{
 		NeedAof:  true,
@@ -48,6 +51,7 @@ func execHSetNX(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx
 	if result == 0 {
 		return reply.MakeIntReply(int64(result)), nil
 	}
+	db.Reindex(key)
 
 	return reply.MakeIntReply(int64(result)), &engine.AofExpireCtx{
 		NeedAof:  true,
@@ -151,6 +155,7 @@ func execHIncrBy(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCt
 
 	// 改变值
 	dict.Put(field, []byte(strconv.FormatInt(valueInt+by, 10)))
+	db.Reindex(key)
 
 	return reply.MakeIntReply(valueInt + by), &engine.AofExpireCtx{
 		NeedAof:  true,
@@ -238,7 +243,7 @@ func getOrInitDict(db *engine.DB, key string) (dict Dict.Dict, inited bool, errR
 	}
 	inited = false
 	if dict == nil {
-		dict = Dict.MakeSimpleDict()
+		dict = Dict.MakeCompactDict(config.Properties.HashMaxListpackEntries, config.Properties.HashMaxListpackValue)
 		db.PutEntity(key, &database.DataEntity{
 			Data: dict,
 		})
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/history"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+	"strings"
+)
+
+// HISTORY.ENABLE key count，为 key 开启历史记录，最多保存最近 count 个版本，count 为 0 时关闭。
+// 字符串总是保存值本身，其他类型估算的大小超过 64KB 时只记录版本号，不保存值
+func execHistoryEnable(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil || count < 0 {
+		return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+	}
+
+	if count == 0 {
+		db.DisableHistory(key)
+	} else {
+		db.EnableHistory(key, count)
+	}
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// GETVERSION key version，返回 key 在指定版本的值，版本没有被保存或者 key 在该版本被删除时返回空
+func execGetVersion(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	version, err := strconv.ParseUint(string(args[1]), 10, 32)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+	}
+
+	ring, errReply := getHistory(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	entry, ok := ring.Get(uint32(version))
+	if !ok {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+	return historyValueToReply(entry), nil
+}
+
+// HISTORY key [COUNT count]，按照从新到旧的顺序返回保存的版本，每一项为 [版本号, 毫秒时间戳, 值]
+func execHistory(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	count := -1
+	if len(args) == 3 && strings.ToUpper(string(args[1])) == "COUNT" {
+		var err error
+		count, err = strconv.Atoi(string(args[2]))
+		if err != nil || count < 0 {
+			return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+		}
+	} else if len(args) != 1 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	ring, errReply := getHistory(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	entries := ring.Latest(count)
+	result := make([]redis.Reply, len(entries))
+	for i, entry := range entries {
+		result[i] = reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeIntReply(int64(entry.Version)),
+			reply.MakeIntReply(entry.Time.UnixMilli()),
+			historyValueToReply(entry),
+		})
+	}
+	return reply.MakeMultiRawReply(result), nil
+}
+
+func getHistory(db *engine.DB, key string) (*history.Ring, redis.Reply) {
+	ring, ok := db.GetHistory(key)
+	if !ok {
+		return nil, reply.MakeErrReply("ERR history is not enabled for this key")
+	}
+	return ring, nil
+}
+
+var historyOmittedReply = reply.MakeErrReply("ERR value is too large to be kept in history")
+
+// historyValueToReply 字符串返回值本身，其他类型返回重建该值的命令，被删除时返回空，值过大没有保存时返回错误
+func historyValueToReply(entry *history.Entry) redis.Reply {
+	if entry.Omitted {
+		return historyOmittedReply
+	}
+	switch val := entry.Value.(type) {
+	case []byte:
+		return reply.MakeBulkStringReply(val)
+	case [][]byte:
+		return reply.MakeMultiBulkStringReply(val)
+	}
+	return reply.MakeNullBulkStringReply()
+}
+
+func init() {
+	// 开启历史记录不修改数据，不增加版本号，但是需要与写入互斥，并且写入 AOF
+	engine.RegisterCommand("History.Enable", execHistoryEnable, writeFirstKey, 3, engine.FlagWrite|engine.FlagNoVersion)
+	engine.RegisterCommand("GetVersion", execGetVersion, readFirstKey, 3, engine.FlagReadOnly)
+	engine.RegisterCommand("History", execHistory, readFirstKey, -2, engine.FlagReadOnly)
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/config"
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/hyperloglog"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+)
+
+// PFADD key [element ...]
+func execPFAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	hll, errReply := getAsHyperLogLog(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	created := false
+	if hll == nil {
+		hll = hyperloglog.Make()
+		created = true
+	}
+
+	changed, err := hll.Add(args[1:], config.Properties.HllSparseMaxBytes)
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	if !created && !changed {
+		return reply.MakeIntReply(0), nil
+	}
+
+	db.PutEntity(key, &database.DataEntity{
+		Data: hll.Bytes(),
+	})
+
+	return reply.MakeIntReply(1), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// PFCOUNT key [key ...]
+func execPFCount(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	if len(args) == 1 {
+		hll, errReply := getAsHyperLogLog(db, string(args[0]))
+		if errReply != nil {
+			return errReply, nil
+		}
+		if hll == nil {
+			return reply.MakeIntReply(0), nil
+		}
+		count, err := hll.Count()
+		if err != nil {
+			return reply.MakeErrReply(err.Error()), nil
+		}
+		return reply.MakeIntReply(int64(count)), nil
+	}
+
+	// 多个 key 时，合并之后再估计基数
+	registers, errReply := mergeHyperLogLogs(db, args)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	return reply.MakeIntReply(int64(hyperloglog.Count(registers))), nil
+}
+
+// PFMERGE destkey [sourcekey ...]
+func execPFMerge(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	destKey := string(args[0])
+
+	// 目标 key 也参与合并
+	registers, errReply := mergeHyperLogLogs(db, args)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	hll, _ := getAsHyperLogLog(db, destKey)
+	if hll == nil {
+		hll = hyperloglog.Make()
+	}
+	hll.SetRegisters(registers, config.Properties.HllSparseMaxBytes)
+	db.PutEntity(destKey, &database.DataEntity{
+		Data: hll.Bytes(),
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// getAsHyperLogLog 获取 HyperLogLog，返回的是数据的拷贝，修改之后需要重新放入数据库
+func getAsHyperLogLog(db *engine.DB, key string) (*hyperloglog.HyperLogLog, reply.ErrorReply) {
+	bytes, errReply := GetAsString(db, key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if bytes == nil {
+		return nil, nil
+	}
+
+	data := make([]byte, len(bytes))
+	copy(data, bytes)
+	hll, err := hyperloglog.FromBytes(data)
+	if err != nil {
+		return nil, reply.MakeErrReply(err.Error())
+	}
+	return hll, nil
+}
+
+// mergeHyperLogLogs 按照最大值合并多个 HyperLogLog 的寄存器，不存在的 key 被忽略
+func mergeHyperLogLogs(db *engine.DB, keys [][]byte) ([]uint8, reply.ErrorReply) {
+	registers := make([]uint8, hyperloglog.Registers)
+	for _, key := range keys {
+		hll, errReply := getAsHyperLogLog(db, string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if hll == nil {
+			continue
+		}
+		if err := hll.MergeInto(registers); err != nil {
+			return nil, reply.MakeErrReply(err.Error())
+		}
+	}
+	return registers, nil
+}
+
+func init() {
+	engine.RegisterCommand("PFAdd", execPFAdd, writeFirstKey, -2, engine.FlagWrite)
+	engine.RegisterCommand("PFCount", execPFCount, prepareSetCalculate, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("PFMerge", execPFMerge, prepareSetCalculateStore, -2, engine.FlagWrite)
+}
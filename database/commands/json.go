@@ -0,0 +1,458 @@
+package commands
+
+import (
+	"encoding/json"
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/jsondoc"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strings"
+)
+
+// JSON.SET key path value [NX|XX]
+func execJSONSet(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply, nil
+	}
+	value, err := jsondoc.Parse(args[2])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	nx, xx := false, false
+	if len(args) == 4 {
+		switch strings.ToUpper(string(args[3])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return reply.MakeSyntaxErrReply(), nil
+		}
+	} else if len(args) > 4 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	doc, errReply := getAsJSON(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if doc == nil {
+		if !path.IsRoot() {
+			return reply.MakeErrReply("ERR new objects must be created at the root"), nil
+		}
+		if xx {
+			return reply.MakeNullBulkStringReply(), nil
+		}
+		db.PutEntity(key, &database.DataEntity{
+			Data: jsondoc.MakeDocument(value),
+		})
+		return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+	}
+
+	if !doc.Set(path, value, nx, xx) {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// JSON.GET key [INDENT indent] [NEWLINE newline] [SPACE space] [path ...]
+func execJSONGet(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	var indent, newline, space string
+	i := 1
+	for ; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(string(args[i])) {
+		case "INDENT":
+			indent = string(args[i+1])
+		case "NEWLINE":
+			newline = string(args[i+1])
+		case "SPACE":
+			space = string(args[i+1])
+		default:
+			goto parsePaths
+		}
+	}
+parsePaths:
+	rawPaths := args[i:]
+	if len(rawPaths) == 0 {
+		rawPaths = [][]byte{[]byte(".")}
+	}
+	paths := make([]*jsondoc.Path, len(rawPaths))
+	legacy := true
+	for j, rawPath := range rawPaths {
+		var errReply redis.Reply
+		paths[j], errReply = parseJSONPath(rawPath)
+		if errReply != nil {
+			return errReply, nil
+		}
+		legacy = legacy && paths[j].IsLegacy()
+	}
+
+	doc, errReply := getAsJSON(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if doc == nil {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+
+	marshal := func(v interface{}) []byte {
+		return jsondoc.MarshalIndent(v, indent, newline, space)
+	}
+	if len(paths) == 1 {
+		result, errReply := findJSONValue(doc, paths[0], legacy)
+		if errReply != nil {
+			return errReply, nil
+		}
+		return reply.MakeBulkStringReply(marshal(result)), nil
+	}
+
+	// 多个路径时返回以路径为 key 的对象
+	result := jsondoc.MakeObject()
+	for _, path := range paths {
+		value, errReply := findJSONValue(doc, path, legacy)
+		if errReply != nil {
+			return errReply, nil
+		}
+		result.Set(path.String(), value)
+	}
+	return reply.MakeBulkStringReply(marshal(result)), nil
+}
+
+// findJSONValue 旧版路径返回第一个匹配的值，JSONPath 返回所有匹配的值组成的数组
+func findJSONValue(doc *jsondoc.Document, path *jsondoc.Path, legacy bool) (interface{}, reply.ErrorReply) {
+	refs := doc.Find(path)
+	if legacy {
+		if len(refs) == 0 {
+			return nil, makeJSONPathNotExistErr(path)
+		}
+		return refs[0].Value(), nil
+	}
+	values := jsondoc.MakeArray()
+	for _, ref := range refs {
+		values.Append(ref.Value())
+	}
+	return values, nil
+}
+
+// JSON.MGET key [key ...] path
+func execJSONMGet(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	path, errReply := parseJSONPath(args[len(args)-1])
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([][]byte, len(args)-1)
+	for i, key := range args[:len(args)-1] {
+		doc, errReply := getAsJSON(db, string(key))
+		if errReply != nil || doc == nil {
+			continue
+		}
+		value, errReply := findJSONValue(doc, path, path.IsLegacy())
+		if errReply != nil {
+			continue
+		}
+		result[i] = jsondoc.Marshal(value)
+	}
+
+	return reply.MakeMultiBulkStringReply(result), nil
+}
+
+// JSON.DEL key [path]
+func execJSONDel(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	rawPath := []byte("$")
+	if len(args) > 1 {
+		rawPath = args[1]
+	}
+	path, errReply := parseJSONPath(rawPath)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	doc, errReply := getAsJSON(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if doc == nil {
+		return reply.MakeIntReply(0), nil
+	}
+	if path.IsRoot() {
+		db.Remove(key)
+		return reply.MakeIntReply(1), &engine.AofExpireCtx{NeedAof: true}
+	}
+
+	deleted := doc.Delete(path)
+	if deleted == 0 {
+		return reply.MakeIntReply(0), nil
+	}
+	return reply.MakeIntReply(int64(deleted)), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// JSON.NUMINCRBY key path value
+func execJSONNumIncrBy(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply, nil
+	}
+	v, err := jsondoc.Parse(args[2])
+	delta, ok := v.(json.Number)
+	if err != nil || !ok {
+		return reply.MakeErrReply("ERR expected a number"), nil
+	}
+
+	doc, errReply := getAsJSONOrErr(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	refs := doc.Find(path)
+	if path.IsLegacy() && len(refs) == 0 {
+		return makeJSONPathNotExistErr(path), nil
+	}
+	// 先检查再修改，出错时不修改文档
+	results := jsondoc.MakeArray()
+	sums := make([]json.Number, len(refs))
+	for i, ref := range refs {
+		n, ok := ref.Value().(json.Number)
+		if !ok {
+			if path.IsLegacy() {
+				return makeJSONWrongTypeErr("a number", ref.Value()), nil
+			}
+			continue
+		}
+		if sums[i], err = jsondoc.NumIncrBy(n, delta); err != nil {
+			return reply.MakeErrReply(err.Error()), nil
+		}
+	}
+	for i, ref := range refs {
+		if sums[i] == "" {
+			results.Append(nil)
+			continue
+		}
+		ref.Set(sums[i])
+		results.Append(sums[i])
+	}
+
+	if path.IsLegacy() {
+		return reply.MakeBulkStringReply([]byte(sums[0])), &engine.AofExpireCtx{NeedAof: true}
+	}
+	return reply.MakeBulkStringReply(jsondoc.Marshal(results)), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// JSON.ARRAPPEND key path value [value ...]
+func execJSONArrAppend(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply, nil
+	}
+	values := make([]interface{}, len(args)-2)
+	for i, arg := range args[2:] {
+		v, err := jsondoc.Parse(arg)
+		if err != nil {
+			return reply.MakeErrReply(err.Error()), nil
+		}
+		values[i] = v
+	}
+
+	doc, errReply := getAsJSONOrErr(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	refs := doc.Find(path)
+	if path.IsLegacy() {
+		if len(refs) == 0 {
+			return makeJSONPathNotExistErr(path), nil
+		}
+		arr, ok := refs[0].Value().(*jsondoc.Array)
+		if !ok {
+			return makeJSONWrongTypeErr("array", refs[0].Value()), nil
+		}
+		appendJSONValues(arr, values)
+		return reply.MakeIntReply(int64(arr.Len())), &engine.AofExpireCtx{NeedAof: true}
+	}
+
+	result := make([]redis.Reply, len(refs))
+	appended := false
+	for i, ref := range refs {
+		arr, ok := ref.Value().(*jsondoc.Array)
+		if !ok {
+			result[i] = reply.MakeNullBulkStringReply()
+			continue
+		}
+		appendJSONValues(arr, values)
+		appended = true
+		result[i] = reply.MakeIntReply(int64(arr.Len()))
+	}
+	if !appended {
+		return reply.MakeMultiRawReply(result), nil
+	}
+	return reply.MakeMultiRawReply(result), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// appendJSONValues 追加值的拷贝，避免多个数组共享同一个值
+func appendJSONValues(arr *jsondoc.Array, values []interface{}) {
+	for _, v := range values {
+		arr.Append(jsondoc.Copy(v))
+	}
+}
+
+// JSON.ARRLEN key [path]
+func execJSONArrLen(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return jsonInspect(db, args, func(v interface{}) (redis.Reply, bool) {
+		arr, ok := v.(*jsondoc.Array)
+		if !ok {
+			return makeJSONWrongTypeErr("array", v), false
+		}
+		return reply.MakeIntReply(int64(arr.Len())), true
+	})
+}
+
+// JSON.OBJKEYS key [path]
+func execJSONObjKeys(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return jsonInspect(db, args, func(v interface{}) (redis.Reply, bool) {
+		obj, ok := v.(*jsondoc.Object)
+		if !ok {
+			return makeJSONWrongTypeErr("object", v), false
+		}
+		keys := make([][]byte, obj.Len())
+		for i, key := range obj.Keys() {
+			keys[i] = []byte(key)
+		}
+		return reply.MakeMultiBulkStringReply(keys), true
+	})
+}
+
+// JSON.TYPE key [path]
+func execJSONType(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	rawPath := []byte(".")
+	if len(args) > 1 {
+		rawPath = args[1]
+	}
+	path, errReply := parseJSONPath(rawPath)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	doc, errReply := getAsJSON(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if doc == nil {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+
+	refs := doc.Find(path)
+	if path.IsLegacy() {
+		if len(refs) == 0 {
+			return reply.MakeNullBulkStringReply(), nil
+		}
+		return reply.MakeStatusReply(jsondoc.TypeOf(refs[0].Value())), nil
+	}
+	types := make([][]byte, len(refs))
+	for i, ref := range refs {
+		types[i] = []byte(jsondoc.TypeOf(ref.Value()))
+	}
+	return reply.MakeMultiBulkStringReply(types), nil
+}
+
+// jsonInspect JSON.ARRLEN、JSON.OBJKEYS 的公共逻辑，旧版路径只检查第一个匹配的值，类型不符时返回错误；
+// JSONPath 对每个匹配的值返回结果，类型不符时返回 nil
+func jsonInspect(db *engine.DB, args [][]byte, inspect func(v interface{}) (redis.Reply, bool)) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	rawPath := []byte(".")
+	if len(args) > 1 {
+		rawPath = args[1]
+	}
+	path, errReply := parseJSONPath(rawPath)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	doc, errReply := getAsJSON(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if doc == nil {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+
+	refs := doc.Find(path)
+	if path.IsLegacy() {
+		if len(refs) == 0 {
+			return makeJSONPathNotExistErr(path), nil
+		}
+		r, _ := inspect(refs[0].Value())
+		return r, nil
+	}
+	result := make([]redis.Reply, len(refs))
+	for i, ref := range refs {
+		r, ok := inspect(ref.Value())
+		if !ok {
+			r = reply.MakeNullBulkStringReply()
+		}
+		result[i] = r
+	}
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// getAsJSON 获取 JSON 文档，key 不存在时返回 nil
+func getAsJSON(db *engine.DB, key string) (*jsondoc.Document, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	doc, ok := entity.Data.(*jsondoc.Document)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return doc, nil
+}
+
+// getAsJSONOrErr 获取 JSON 文档，key 不存在时返回错误
+func getAsJSONOrErr(db *engine.DB, key string) (*jsondoc.Document, reply.ErrorReply) {
+	doc, errReply := getAsJSON(db, key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if doc == nil {
+		return nil, reply.MakeErrReply("ERR could not perform this operation on a key that doesn't exist")
+	}
+	return doc, nil
+}
+
+func parseJSONPath(arg []byte) (*jsondoc.Path, redis.Reply) {
+	path, err := jsondoc.ParsePath(string(arg))
+	if err != nil {
+		return nil, reply.MakeErrReply(err.Error())
+	}
+	return path, nil
+}
+
+func makeJSONPathNotExistErr(path *jsondoc.Path) reply.ErrorReply {
+	return reply.MakeErrReply("ERR Path '" + path.String() + "' does not exist")
+}
+
+func makeJSONWrongTypeErr(expected string, v interface{}) reply.ErrorReply {
+	return reply.MakeErrReply("ERR wrong type of path value - expected " + expected + " but found " + jsondoc.TypeOf(v))
+}
+
+func init() {
+	engine.RegisterCommand("JSON.Set", execJSONSet, writeFirstKey, -4, engine.FlagWrite)
+	engine.RegisterCommand("JSON.Get", execJSONGet, readFirstKey, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("JSON.MGet", execJSONMGet, readAllKeysExceptLast, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("JSON.Del", execJSONDel, writeFirstKey, -2, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("JSON.Forget", execJSONDel, writeFirstKey, -2, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("JSON.NumIncrBy", execJSONNumIncrBy, writeFirstKey, 4, engine.FlagWrite)
+	engine.RegisterCommand("JSON.ArrAppend", execJSONArrAppend, writeFirstKey, -4, engine.FlagWrite)
+	engine.RegisterCommand("JSON.ArrLen", execJSONArrLen, readFirstKey, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("JSON.ObjKeys", execJSONObjKeys, readFirstKey, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("JSON.Type", execJSONType, readFirstKey, -2, engine.FlagReadOnly)
+}
@@ -52,6 +52,25 @@ func execExpireAt(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireC
 	}
 }
 
+// execPExpireAt 设置毫秒时间戳的过期时间，AOF 中的过期时间都以 PEXPIREAT 的形式写入
+func execPExpireAt(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	raw, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+	}
+	expireAt := time.UnixMilli(raw)
+
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(0), nil
+	}
+
+	db.Expire(key, expireAt)
+	return reply.MakeIntReply(1), &engine.AofExpireCtx{NeedAof: true}
+}
+
 func execExpire(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
 	key := string(args[0])
 
@@ -114,10 +133,11 @@ func execPersist(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCt
 }
 
 func init() {
-	engine.RegisterCommand("Del", execDel, writeFirstKey, 2, engine.FlagWrite)
-	engine.RegisterCommand("ExpireAt", execExpireAt, writeFirstKey, 3, engine.FlagWrite)
-	engine.RegisterCommand("Expire", execExpire, writeFirstKey, 3, engine.FlagWrite)
+	engine.RegisterCommand("Del", execDel, writeFirstKey, 2, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("ExpireAt", execExpireAt, writeFirstKey, 3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("PExpireAt", execPExpireAt, writeFirstKey, 3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("Expire", execExpire, writeFirstKey, 3, engine.FlagWrite|engine.FlagAllowOOM)
 	engine.RegisterCommand("KeyVersion", execKeyVersion, writeFirstKey, 2, engine.FlagReadOnly)
 	engine.RegisterCommand("Exist", execExist, readFirstKey, 2, engine.FlagReadOnly)
-	engine.RegisterCommand("Persist", execPersist, writeFirstKey, 2, engine.FlagWrite)
+	engine.RegisterCommand("Persist", execPersist, writeFirstKey, 2, engine.FlagWrite|engine.FlagAllowOOM)
 }
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"github.com/dawnzzz/simple-redis/config"
 	"github.com/dawnzzz/simple-redis/database/engine"
 	List "github.com/dawnzzz/simple-redis/datastruct/list"
 	"github.com/dawnzzz/simple-redis/interface/database"
@@ -371,7 +372,7 @@ func getOrInitList(db *engine.DB, key string) (list List.List, inited bool, errR
 	}
 	inited = false
 	if list == nil {
-		list = List.MakeQuickList()
+		list = List.MakeCompressedQuickList(config.Properties.ListCompressDepth)
 		db.PutEntity(key, &database.DataEntity{
 			Data: list,
 		})
@@ -410,12 +411,12 @@ func init() {
 	engine.RegisterCommand("LPushX", execLPushX, writeFirstKey, 3, engine.FlagWrite)
 	engine.RegisterCommand("RPush", execRPush, writeFirstKey, -3, engine.FlagWrite)
 	engine.RegisterCommand("RPushX", execRPushX, writeFirstKey, 3, engine.FlagWrite)
-	engine.RegisterCommand("LPop", execLPop, writeFirstKey, 2, engine.FlagWrite)
-	engine.RegisterCommand("RPop", execRPop, writeFirstKey, 2, engine.FlagWrite)
+	engine.RegisterCommand("LPop", execLPop, writeFirstKey, 2, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("RPop", execRPop, writeFirstKey, 2, engine.FlagWrite|engine.FlagAllowOOM)
 	engine.RegisterCommand("LIndex", execLIndex, readFirstKey, 3, engine.FlagReadOnly)
 	engine.RegisterCommand("LLen", execLLen, readFirstKey, 2, engine.FlagReadOnly)
-	engine.RegisterCommand("LRem", execLRem, writeFirstKey, 4, engine.FlagWrite)
-	engine.RegisterCommand("LTrim", execLTrim, writeFirstKey, 4, engine.FlagWrite)
+	engine.RegisterCommand("LRem", execLRem, writeFirstKey, 4, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("LTrim", execLTrim, writeFirstKey, 4, engine.FlagWrite|engine.FlagAllowOOM)
 	engine.RegisterCommand("LRange", execLRange, readFirstKey, 4, engine.FlagReadOnly)
 	engine.RegisterCommand("LSet", execLSet, writeFirstKey, 4, engine.FlagWrite)
 }
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMemorySamples MEMORY USAGE 默认采样的元素数量
+const defaultMemorySamples = 5
+
+// MEMORY USAGE key [SAMPLES count]，估算 key 占用的内存字节数，集合类型按照前 count 个元素的平均大小估算，
+// count 为 0 时计算全部元素，key 不存在时返回 nil。MEMORY STATS 由服务器处理
+func execMemory(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	subCommand := strings.ToUpper(string(args[0]))
+	if subCommand != "USAGE" {
+		return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'"), nil
+	}
+	if len(args) != 2 && len(args) != 4 {
+		return reply.MakeArgNumErrReply("memory usage"), nil
+	}
+	samples := defaultMemorySamples
+	if len(args) == 4 {
+		if strings.ToUpper(string(args[2])) != "SAMPLES" {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		n, err := strconv.Atoi(string(args[3]))
+		if err != nil || n < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive"), nil
+		}
+		samples = n
+	}
+
+	key := string(args[1])
+	entity, exists := db.PeekEntity(key)
+	if !exists {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+	return reply.MakeIntReply(utils.EntitySize(key, entity, samples)), nil
+}
+
+// OBJECT ENCODING|IDLETIME|FREQ|REFCOUNT key，查看 key 的底层数据结构、空闲秒数、
+// LFU 访问计数器以及引用计数（没有共享对象，始终为 1），查看时不会更新 key 的访问时间
+func execObject(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	subCommand := strings.ToUpper(string(args[0]))
+	switch subCommand {
+	case "ENCODING", "IDLETIME", "FREQ", "REFCOUNT":
+	default:
+		return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'"), nil
+	}
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("object " + strings.ToLower(subCommand)), nil
+	}
+
+	entity, exists := db.PeekEntity(string(args[1]))
+	if !exists {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+	now := time.Now()
+	switch subCommand {
+	case "ENCODING":
+		return reply.MakeBulkStringReply([]byte(utils.EntityEncoding(entity))), nil
+	case "IDLETIME":
+		return reply.MakeIntReply(int64(entity.IdleTime(now) / time.Second)), nil
+	case "FREQ":
+		return reply.MakeIntReply(int64(entity.Freq(now))), nil
+	default:
+		return reply.MakeIntReply(1), nil
+	}
+}
+
+func init() {
+	engine.RegisterCommand("Memory", execMemory, readSecondKey, -2, engine.FlagReadOnly|engine.FlagNoStats)
+	engine.RegisterCommand("Object", execObject, readSecondKey, -2, engine.FlagReadOnly|engine.FlagNoStats)
+}
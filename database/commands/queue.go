@@ -0,0 +1,271 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/queue"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/timewheel"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 队列的状态变化只依赖执行时间，修改队列的命令写入 AOF 时带上 AT 执行时间（毫秒时间戳），重放时得到相同的状态。
+// 延迟消息到期、租约超时由时间轮移回就绪队列，时间轮的处理不写入 AOF，重放下一条命令时会得到相同的结果
+
+// Q.CREATE queue [MAXDELIVERIES n]，创建队列，消息投递 n 次仍然没有被确认时进入死信队列，n 为 0 时不限制
+func execQCreate(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	maxDeliveries := 0
+	if len(args) == 3 && strings.ToUpper(string(args[1])) == "MAXDELIVERIES" {
+		var err error
+		maxDeliveries, err = strconv.Atoi(string(args[2]))
+		if err != nil || maxDeliveries < 0 {
+			return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+		}
+	} else if len(args) != 1 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	if _, exists := db.GetEntity(key); exists {
+		return reply.MakeErrReply("ERR queue already exists"), nil
+	}
+	db.PutEntity(key, &database.DataEntity{Data: queue.MakeQueue(maxDeliveries)})
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// Q.PUSH queue payload [DELAY ms] [AT unix_ms]，添加消息，返回消息 ID，队列不存在时创建
+func execQPush(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	delay, now, errReply := parseQueueOptions(args[2:], true)
+	if errReply != nil {
+		return errReply, nil
+	}
+	q, errReply := getAsQueue(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if q == nil {
+		q = queue.MakeQueue(0)
+		db.PutEntity(key, &database.DataEntity{Data: q})
+	}
+
+	id := q.Push(args[1], delay, now)
+	saveQueue(db, key, q, now, "Q.PUSH", key, string(args[1]), "DELAY", strconv.FormatInt(delay.Milliseconds(), 10))
+	return reply.MakeIntReply(id), nil
+}
+
+// Q.POP queue visibility_ms [AT unix_ms]，取出最早就绪的消息，返回 [租约 ID, 消息, 投递次数]，
+// visibility_ms 之内没有确认时重新投递，队列为空时返回空
+func execQPop(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	visibility, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || visibility <= 0 {
+		return reply.MakeErrReply("ERR visibility timeout must be a positive integer"), nil
+	}
+	_, now, errReply := parseQueueOptions(args[2:], false)
+	if errReply != nil {
+		return errReply, nil
+	}
+	q, errReply := getAsQueue(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if q == nil {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+
+	m, ok := q.Pop(time.Duration(visibility)*time.Millisecond, now)
+	if !ok {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+	saveQueue(db, key, q, now, "Q.POP", key, string(args[1]))
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte(m.LeaseID())),
+		reply.MakeBulkStringReply(m.Payload),
+		reply.MakeIntReply(int64(m.Deliveries)),
+	}), nil
+}
+
+// Q.ACK queue lease_id [AT unix_ms]，确认消息并删除，成功返回 1，租约不存在或者已经超时时返回 0
+func execQAck(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	_, now, errReply := parseQueueOptions(args[2:], false)
+	if errReply != nil {
+		return errReply, nil
+	}
+	q, errReply := getAsQueue(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if q == nil || !q.Ack(string(args[1]), now) {
+		return reply.MakeIntReply(0), nil
+	}
+	saveQueue(db, key, q, now, "Q.ACK", key, string(args[1]))
+	return reply.MakeIntReply(1), nil
+}
+
+// Q.NACK queue lease_id [DELAY ms] [AT unix_ms]，放弃处理消息，消息立即或者延迟之后重新投递，
+// 投递次数达到上限时进入死信队列，成功返回 1，租约不存在或者已经超时时返回 0
+func execQNack(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	delay, now, errReply := parseQueueOptions(args[2:], true)
+	if errReply != nil {
+		return errReply, nil
+	}
+	q, errReply := getAsQueue(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if q == nil || !q.Nack(string(args[1]), delay, now) {
+		return reply.MakeIntReply(0), nil
+	}
+	saveQueue(db, key, q, now, "Q.NACK", key, string(args[1]), "DELAY", strconv.FormatInt(delay.Milliseconds(), 10))
+	return reply.MakeIntReply(1), nil
+}
+
+// Q.STATS queue，返回就绪、延迟、租约中、死信的消息数量以及累计添加、确认的消息数量
+func execQStats(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	q, errReply := getAsQueue(db, string(args[0]))
+	if errReply != nil {
+		return errReply, nil
+	}
+	if q == nil {
+		return reply.MakeErrReply("ERR no such queue"), nil
+	}
+	stats := q.Stats()
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte("ready")), reply.MakeIntReply(int64(stats.Ready)),
+		reply.MakeBulkStringReply([]byte("delayed")), reply.MakeIntReply(int64(stats.Delayed)),
+		reply.MakeBulkStringReply([]byte("leased")), reply.MakeIntReply(int64(stats.Leased)),
+		reply.MakeBulkStringReply([]byte("dead")), reply.MakeIntReply(int64(stats.Dead)),
+		reply.MakeBulkStringReply([]byte("pushed")), reply.MakeIntReply(stats.Pushed),
+		reply.MakeBulkStringReply([]byte("acked")), reply.MakeIntReply(stats.Acked),
+		reply.MakeBulkStringReply([]byte("max_deliveries")), reply.MakeIntReply(int64(stats.MaxDeliveries)),
+	}), nil
+}
+
+// Q.DEAD queue [COUNT count]，返回死信队列中最早的消息，每一项为 [消息 ID, 消息, 投递次数]
+func execQDead(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	count := -1
+	if len(args) == 3 && strings.ToUpper(string(args[1])) == "COUNT" {
+		var err error
+		count, err = strconv.Atoi(string(args[2]))
+		if err != nil || count < 0 {
+			return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+		}
+	} else if len(args) != 1 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+	q, errReply := getAsQueue(db, string(args[0]))
+	if errReply != nil {
+		return errReply, nil
+	}
+	if q == nil {
+		return reply.MakeEmptyMultiBulkStringReply(), nil
+	}
+	dead := q.Dead(count)
+	result := make([]redis.Reply, len(dead))
+	for i, m := range dead {
+		result[i] = reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeIntReply(m.ID),
+			reply.MakeBulkStringReply(m.Payload),
+			reply.MakeIntReply(int64(m.Deliveries)),
+		})
+	}
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// Q.RESTORE queue dump，用于 AOF 重写恢复队列
+func execQRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	q, err := queue.Restore(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{Data: q})
+	scheduleQueueTick(db, key, q)
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// getAsQueue 获取队列，key 不存在时返回 nil
+func getAsQueue(db *engine.DB, key string) (*queue.Queue, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	q, ok := entity.Data.(*queue.Queue)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return q, nil
+}
+
+// parseQueueOptions 解析 [DELAY ms] [AT unix_ms]，没有 AT 时使用当前时间，时间精确到毫秒
+func parseQueueOptions(args [][]byte, allowDelay bool) (time.Duration, time.Time, redis.Reply) {
+	var delay time.Duration
+	now := time.UnixMilli(time.Now().UnixMilli())
+	for i := 0; i < len(args); i += 2 {
+		option := strings.ToUpper(string(args[i]))
+		if i+1 >= len(args) || (option != "AT" && (option != "DELAY" || !allowDelay)) {
+			return 0, now, reply.MakeSyntaxErrReply()
+		}
+		ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil || ms < 0 {
+			return 0, now, reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if option == "DELAY" {
+			delay = time.Duration(ms) * time.Millisecond
+		} else {
+			now = time.UnixMilli(ms)
+		}
+	}
+	return delay, now, nil
+}
+
+// saveQueue 将带有执行时间的命令写入 AOF 并重新安排到期处理
+func saveQueue(db *engine.DB, key string, q *queue.Queue, now time.Time, cmdLine ...string) {
+	cmdLine = append(cmdLine, "AT", strconv.FormatInt(now.UnixMilli(), 10))
+	db.AddAof(utils.StringsToCmdLine(cmdLine...))
+	scheduleQueueTick(db, key, q)
+}
+
+// scheduleQueueTick 在最早的延迟消息到期或者租约超时时将消息移回就绪队列，并增加版本号
+func scheduleQueueTick(db *engine.DB, key string, q *queue.Queue) {
+	next, ok := q.NextDeadline()
+	if !ok {
+		return
+	}
+	delay := time.Until(next)
+	if delay < 0 {
+		delay = 0
+	}
+	timewheel.Delay(delay, fmt.Sprintf("queue:%p", q), func() {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		defer db.RWUnLocks(keys, nil)
+		entity, exists := db.GetEntity(key)
+		if !exists || entity.Data != q {
+			return
+		}
+		if q.Tick(time.UnixMilli(time.Now().UnixMilli())) > 0 {
+			db.AddVersion(key)
+		}
+		scheduleQueueTick(db, key, q)
+	})
+}
+
+func init() {
+	engine.RegisterCommand("Q.Create", execQCreate, writeFirstKey, -2, engine.FlagWrite)
+	engine.RegisterCommand("Q.Push", execQPush, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("Q.Pop", execQPop, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("Q.Ack", execQAck, writeFirstKey, -3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("Q.Nack", execQNack, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("Q.Stats", execQStats, readFirstKey, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("Q.Dead", execQDead, readFirstKey, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("Q.Restore", execQRestore, writeFirstKey, 3, engine.FlagWrite|engine.FlagInternal)
+}
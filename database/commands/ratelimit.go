@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/ratelimit"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 限流命令返回 [是否通过, 剩余数量, 重试等待毫秒数, 恢复满额的毫秒数]，通过或者永远不会通过时重试等待毫秒数为 -1。
+// 只有请求通过时才会修改状态，写入 AOF 的是与执行时间无关的命令
+
+// RATELIMIT key max_burst count_per_period period [quantity]，使用 GCRA 限流，period 的单位为秒，
+// key 保存的是理论到达时间的纳秒时间戳，在该时间过期
+func execRateLimit(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	params := make([]int64, 4)
+	params[3] = 1
+	if len(args) > 5 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+	for i, arg := range args[1:] {
+		n, err := strconv.ParseInt(string(arg), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+		}
+		params[i] = n
+	}
+	maxBurst, count, period, quantity := params[0], params[1], params[2], params[3]
+	if period <= 0 || period > int64(time.Duration(1<<63-1)/time.Second) {
+		return reply.MakeErrReply(ratelimit.ErrOutOfRange.Error()), nil
+	}
+
+	value, errReply := GetAsString(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	var tat time.Time
+	if value != nil {
+		ns, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR rate limit state is not an integer"), nil
+		}
+		tat = time.Unix(0, ns)
+	}
+
+	result, newTat, err := ratelimit.GCRA(tat, time.Now(), maxBurst, count, time.Duration(period)*time.Second, quantity)
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	if result.Allowed && quantity > 0 {
+		entity := &database.DataEntity{Data: newTat.UnixNano()}
+		db.PutEntity(key, entity)
+		db.Expire(key, newTat)
+		db.AddAof(utils.EntityToCmdLine(key, entity))
+		db.AddAof(utils.ExpireToCmdLine(key, newTat))
+	}
+	return rateLimitReply(result), nil
+}
+
+// RATELIMIT.SLIDING key limit window [quantity] [AT unix_ms]，使用滑动窗口日志限流，window 的单位为秒，
+// 指定 AT 时按照该时间计算（用于 AOF 重放），key 在最新的记录滑出窗口之后过期
+func execRateLimitSliding(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	limit, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+	}
+	window, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+	}
+	if window <= 0 || window > int64(time.Duration(1<<63-1)/time.Second) {
+		return reply.MakeErrReply(ratelimit.ErrOutOfRange.Error()), nil
+	}
+	quantity := int64(1)
+	now := time.Now()
+	rest := args[3:]
+	if len(rest)%2 == 1 {
+		if quantity, err = strconv.ParseInt(string(rest[0]), 10, 64); err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+		}
+		rest = rest[1:]
+	}
+	if len(rest) == 2 && strings.ToUpper(string(rest[0])) == "AT" {
+		ms, err := strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+		}
+		now = time.UnixMilli(ms)
+	} else if len(rest) != 0 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	l, errReply := getAsSlidingLog(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	exists := l != nil
+	if !exists {
+		l = ratelimit.MakeSlidingLog()
+	}
+	result, err := l.Allow(now, limit, time.Duration(window)*time.Second, quantity)
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	if result.Allowed && quantity > 0 {
+		if !exists {
+			db.PutEntity(key, &database.DataEntity{Data: l})
+		}
+		newest, _ := l.Newest()
+		expireAt := newest.Add(time.Duration(window) * time.Second)
+		db.Expire(key, expireAt)
+		db.AddAof(utils.StringsToCmdLine("RATELIMIT.SLIDING", key, string(args[1]), string(args[2]),
+			strconv.FormatInt(quantity, 10), "AT", strconv.FormatInt(newest.UnixMilli(), 10)))
+		db.AddAof(utils.ExpireToCmdLine(key, expireAt))
+	}
+	return rateLimitReply(result), nil
+}
+
+// RATELIMIT.RESTORE key dump，用于 AOF 重写恢复滑动窗口日志
+func execRateLimitRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	l, err := ratelimit.RestoreSlidingLog(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{Data: l})
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// getAsSlidingLog 获取滑动窗口日志，key 不存在时返回 nil
+func getAsSlidingLog(db *engine.DB, key string) (*ratelimit.SlidingLog, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	l, ok := entity.Data.(*ratelimit.SlidingLog)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return l, nil
+}
+
+func rateLimitReply(result *ratelimit.Result) redis.Reply {
+	allowed := int64(0)
+	if result.Allowed {
+		allowed = 1
+	}
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeIntReply(allowed),
+		reply.MakeIntReply(result.Remaining),
+		reply.MakeIntReply(ceilMillis(result.RetryAfter)),
+		reply.MakeIntReply(ceilMillis(result.ResetAfter)),
+	})
+}
+
+// ceilMillis 向上取整为毫秒，保证客户端等待足够的时间，负数表示没有
+func ceilMillis(d time.Duration) int64 {
+	if d < 0 {
+		return -1
+	}
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+func init() {
+	engine.RegisterCommand("RateLimit", execRateLimit, writeFirstKey, -5, engine.FlagWrite)
+	engine.RegisterCommand("RateLimit.Sliding", execRateLimitSliding, writeFirstKey, -4, engine.FlagWrite)
+	engine.RegisterCommand("RateLimit.Restore", execRateLimitRestore, writeFirstKey, 3, engine.FlagWrite|engine.FlagInternal)
+}
@@ -0,0 +1,663 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	Dict "github.com/dawnzzz/simple-redis/datastruct/dict"
+	"github.com/dawnzzz/simple-redis/datastruct/search"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultSearchLimit = 10
+
+// FT.CREATE index [ON HASH] [PREFIX count prefix ...] [STOPWORDS count word ...]
+// SCHEMA field type [WEIGHT weight] [SEPARATOR sep] [SORTABLE] ...
+// VECTOR 字段的格式为 field VECTOR FLAT|HNSW count attribute value ...
+func execFTCreate(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	name := string(args[0])
+	prefixes := make([]string, 0)
+	var stopwords []string
+	i := 1
+	for ; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		if arg == "SCHEMA" {
+			break
+		}
+		switch arg {
+		case "ON":
+			if i+1 >= len(args) || strings.ToUpper(string(args[i+1])) != "HASH" {
+				return reply.MakeErrReply("ERR only HASH is supported"), nil
+			}
+			i++
+		case "PREFIX":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply(), nil
+			}
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 0 || i+1+count >= len(args) {
+				return reply.MakeSyntaxErrReply(), nil
+			}
+			for _, prefix := range args[i+2 : i+2+count] {
+				prefixes = append(prefixes, string(prefix))
+			}
+			i += 1 + count
+		case "STOPWORDS":
+			words, next, errReply := parseCountedArgs(args, i+1)
+			if errReply != nil {
+				return errReply, nil
+			}
+			stopwords = words
+			i = next - 1
+		default:
+			return reply.MakeSyntaxErrReply(), nil
+		}
+	}
+	if i >= len(args) {
+		return reply.MakeErrReply("ERR No schema found"), nil
+	}
+
+	fields, errReply := parseSearchSchema(args[i+1:])
+	if errReply != nil {
+		return errReply, nil
+	}
+	idx, err := search.MakeIndex(name, prefixes, fields)
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	if stopwords != nil {
+		idx.SetStopwords(stopwords)
+	}
+	if err := db.Indexes().Create(idx); err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+
+	// 先注册索引，之后的 hash 写入会自动更新索引，再为已有的数据建立索引
+	keys := make([]string, 0)
+	db.ForEach(func(key string, entity *database.DataEntity, _ *time.Time) bool {
+		if _, ok := entity.Data.(Dict.Dict); ok && idx.Match(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	db.RWLocks(nil, keys)
+	defer db.RWUnLocks(nil, keys)
+	for _, key := range keys {
+		db.IndexKey(idx, key)
+	}
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+func parseSearchSchema(args [][]byte) ([]*search.Field, redis.Reply) {
+	fields := make([]*search.Field, 0)
+	for i := 0; i < len(args); {
+		if i+1 >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		fieldType, ok := search.ParseFieldType(string(args[i+1]))
+		if !ok {
+			return nil, reply.MakeErrReply("ERR Invalid field type for field `" + string(args[i]) + "`")
+		}
+		field := &search.Field{Name: string(args[i]), Type: fieldType}
+		i += 2
+		if fieldType == search.FieldVector {
+			if i >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			attributes, next, errReply := parseCountedArgs(args, i+1)
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts, err := search.ParseVectorOptions(string(args[i]), attributes)
+			if err != nil {
+				return nil, reply.MakeErrReply(err.Error())
+			}
+			field.Vector = opts
+			fields = append(fields, field)
+			i = next
+			continue
+		}
+		// 字段的可选参数
+	options:
+		for i < len(args) {
+			switch strings.ToUpper(string(args[i])) {
+			case "SORTABLE":
+				field.Sortable = true
+				i++
+			case "SEPARATOR":
+				if fieldType != search.FieldTag || i+1 >= len(args) || len(args[i+1]) != 1 {
+					return nil, reply.MakeSyntaxErrReply()
+				}
+				field.Separator = args[i+1][0]
+				i += 2
+			case "WEIGHT":
+				if fieldType != search.FieldText || i+1 >= len(args) {
+					return nil, reply.MakeSyntaxErrReply()
+				}
+				weight, err := strconv.ParseFloat(string(args[i+1]), 64)
+				if err != nil || weight <= 0 {
+					return nil, reply.MakeErrReply("ERR Invalid weight for field `" + field.Name + "`")
+				}
+				field.Weight = weight
+				i += 2
+			case "NOSTEM":
+				// 不支持词干提取，忽略
+				i++
+			default:
+				break options
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// FT.DROPINDEX index [DD]
+func execFTDropIndex(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	deleteDocs := false
+	if len(args) == 2 {
+		if strings.ToUpper(string(args[1])) != "DD" {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		deleteDocs = true
+	} else if len(args) > 2 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	idx, errReply := getSearchIndex(db, string(args[0]))
+	if errReply != nil {
+		return errReply, nil
+	}
+	db.Indexes().Drop(idx.Name())
+
+	if deleteDocs {
+		// 同时删除索引中的所有文档
+		keys := idx.Keys()
+		db.RWLocks(keys, nil)
+		defer db.RWUnLocks(keys, nil)
+		db.Removes(keys...)
+		db.AddVersion(keys...)
+	}
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// FT.INFO index
+func execFTInfo(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	idx, errReply := getSearchIndex(db, string(args[0]))
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	prefixes := make([][]byte, len(idx.Prefixes()))
+	for i, prefix := range idx.Prefixes() {
+		prefixes[i] = []byte(prefix)
+	}
+	attributes := make([]redis.Reply, 0, len(idx.Fields()))
+	for _, f := range idx.Fields() {
+		attribute := [][]byte{[]byte("identifier"), []byte(f.Name), []byte("type"), []byte(f.Type.String())}
+		if f.Type == search.FieldTag {
+			attribute = append(attribute, []byte("SEPARATOR"), []byte{f.Separator})
+		} else if f.Type == search.FieldText {
+			attribute = append(attribute, []byte("WEIGHT"), []byte(strconv.FormatFloat(f.Weight, 'f', -1, 64)))
+		} else if f.Type == search.FieldVector {
+			attribute = append(attribute, []byte("algorithm"), []byte(f.Vector.Algorithm.String()))
+			for _, value := range f.Vector.Attributes() {
+				attribute = append(attribute, []byte(value))
+			}
+		}
+		if f.Sortable {
+			attribute = append(attribute, []byte("SORTABLE"))
+		}
+		attributes = append(attributes, reply.MakeMultiBulkStringReply(attribute))
+	}
+
+	result := []redis.Reply{
+		reply.MakeBulkStringReply([]byte("index_name")),
+		reply.MakeBulkStringReply([]byte(idx.Name())),
+		reply.MakeBulkStringReply([]byte("index_definition")),
+		reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkStringReply([]byte("key_type")),
+			reply.MakeBulkStringReply([]byte("HASH")),
+			reply.MakeBulkStringReply([]byte("prefixes")),
+			reply.MakeMultiBulkStringReply(prefixes),
+		}),
+		reply.MakeBulkStringReply([]byte("attributes")),
+		reply.MakeMultiRawReply(attributes),
+		reply.MakeBulkStringReply([]byte("num_docs")),
+		reply.MakeIntReply(int64(idx.Len())),
+	}
+	if words, ok := idx.Stopwords(); ok {
+		stopwords := make([][]byte, len(words))
+		for i, word := range words {
+			stopwords[i] = []byte(word)
+		}
+		result = append(result, reply.MakeBulkStringReply([]byte("stopwords_list")), reply.MakeMultiBulkStringReply(stopwords))
+	}
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// FT.SEARCH index query [NOCONTENT] [WITHSCORES] [SCORER BM25|TFIDF] [RETURN count field ...]
+// [SORTBY field [ASC|DESC]] [LIMIT offset num] [PARAMS count name value ...] [DIALECT dialect]
+func execFTSearch(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	noContent, withScores := false, false
+	scorer := search.ScorerBM25
+	var params map[string]string
+	var returnFields []string
+	sortBy, desc := "", false
+	offset, num := 0, defaultSearchLimit
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NOCONTENT":
+			noContent = true
+		case "WITHSCORES":
+			withScores = true
+		case "SCORER":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply(), nil
+			}
+			var ok bool
+			scorer, ok = search.ParseScorer(string(args[i+1]))
+			if !ok {
+				return reply.MakeErrReply("ERR Could not find scorer " + string(args[i+1])), nil
+			}
+			i++
+		case "RETURN":
+			fields, next, errReply := parseCountedArgs(args, i+1)
+			if errReply != nil {
+				return errReply, nil
+			}
+			returnFields = fields
+			i = next - 1
+		case "SORTBY":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply(), nil
+			}
+			sortBy = strings.TrimPrefix(string(args[i+1]), "@")
+			i++
+			if i+1 < len(args) {
+				switch strings.ToUpper(string(args[i+1])) {
+				case "ASC":
+					i++
+				case "DESC":
+					desc = true
+					i++
+				}
+			}
+		case "LIMIT":
+			var errReply redis.Reply
+			offset, num, errReply = parseSearchLimit(args, i+1)
+			if errReply != nil {
+				return errReply, nil
+			}
+			i += 2
+		case "PARAMS":
+			next, errReply := parseSearchParams(args, i+1, &params)
+			if errReply != nil {
+				return errReply, nil
+			}
+			i = next - 1
+		case "DIALECT":
+			// 只支持一种查询语法，忽略
+			i++
+		default:
+			return reply.MakeSyntaxErrReply(), nil
+		}
+	}
+
+	idx, q, results, errReply := searchIndex(db, args[0], args[1], params, scorer)
+	if errReply != nil {
+		return errReply, nil
+	}
+	keys := resultKeys(results)
+	scoreField, isKNN := q.KNN()
+
+	db.RWLocks(nil, keys)
+	defer db.RWUnLocks(nil, keys)
+	hashes := make(map[string]Dict.Dict, len(keys))
+	scores := make(map[string]float64, len(keys))
+	matched := make([]string, 0, len(keys))
+	for _, r := range results {
+		// 跳过已经过期的 key，默认按照得分排序
+		if hash, _ := getAsDict(db, r.Key); hash != nil {
+			hashes[r.Key] = hash
+			scores[r.Key] = r.Score
+			matched = append(matched, r.Key)
+		}
+	}
+	if isKNN && sortBy == scoreField {
+		// 向量查询的结果已经按照距离从小到大排列
+		if desc {
+			for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+				matched[i], matched[j] = matched[j], matched[i]
+			}
+		}
+	} else if sortBy != "" {
+		if err := idx.SortBy(matched, sortBy, desc); err != nil {
+			return reply.MakeErrReply(err.Error()), nil
+		}
+	}
+
+	result := []redis.Reply{reply.MakeIntReply(int64(len(matched)))}
+	start, end := pageRange(len(matched), offset, num)
+	for _, key := range matched[start:end] {
+		result = append(result, reply.MakeBulkStringReply([]byte(key)))
+		if withScores {
+			result = append(result, reply.MakeBulkStringReply([]byte(strconv.FormatFloat(scores[key], 'f', -1, 64))))
+		}
+		if noContent {
+			continue
+		}
+		fieldValues := hashToFieldValues(hashes[key], returnFields)
+		if isKNN && (returnFields == nil || containsString(returnFields, scoreField)) {
+			// 向量查询时返回与查询向量之间的距离
+			fieldValues = append(fieldValues, []byte(scoreField), []byte(strconv.FormatFloat(scores[key], 'f', -1, 64)))
+		}
+		result = append(result, reply.MakeMultiBulkStringReply(fieldValues))
+	}
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// hashToFieldValues 返回 hash 中的字段与值，fields 为空时返回所有的字段（按照字段名排序）
+func hashToFieldValues(hash Dict.Dict, fields []string) [][]byte {
+	if fields == nil {
+		fields = hash.Keys()
+		sort.Strings(fields)
+	}
+	result := make([][]byte, 0, 2*len(fields))
+	for _, field := range fields {
+		raw, ok := hash.Get(field)
+		if !ok {
+			continue
+		}
+		value, _ := raw.([]byte)
+		result = append(result, []byte(field), value)
+	}
+	return result
+}
+
+// FT.AGGREGATE index query [LOAD count field ... | LOAD *]
+// [GROUPBY count field ... [REDUCE function count arg ... [AS name]] ...]
+// [SORTBY count field [ASC|DESC] ... [MAX max]] [LIMIT offset num] [PARAMS count name value ...] [DIALECT dialect]
+func execFTAggregate(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	var params map[string]string
+	var loadFields []string
+	loadAll, grouped := false, false
+	var groupFields []string
+	reducers := make([]*search.Reducer, 0)
+	sortKeys := make([]search.SortKey, 0)
+	max := -1
+	offset, num := 0, -1
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "LOAD":
+			if i+1 < len(args) && string(args[i+1]) == "*" {
+				loadAll = true
+				i++
+				continue
+			}
+			fields, next, errReply := parseCountedArgs(args, i+1)
+			if errReply != nil {
+				return errReply, nil
+			}
+			loadFields = trimFieldPrefix(fields)
+			i = next - 1
+		case "GROUPBY":
+			if grouped {
+				return reply.MakeErrReply("ERR only one GROUPBY is supported"), nil
+			}
+			fields, next, errReply := parseCountedArgs(args, i+1)
+			if errReply != nil {
+				return errReply, nil
+			}
+			grouped = true
+			groupFields = trimFieldPrefix(fields)
+			i = next - 1
+		case "REDUCE":
+			if !grouped || i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply(), nil
+			}
+			fn := string(args[i+1])
+			fnArgs, next, errReply := parseCountedArgs(args, i+2)
+			if errReply != nil {
+				return errReply, nil
+			}
+			alias := ""
+			if next+1 < len(args) && strings.ToUpper(string(args[next])) == "AS" {
+				alias = string(args[next+1])
+				next += 2
+			}
+			reducer, err := search.MakeReducer(fn, fnArgs, alias)
+			if err != nil {
+				return reply.MakeErrReply(err.Error()), nil
+			}
+			reducers = append(reducers, reducer)
+			i = next - 1
+		case "SORTBY":
+			fields, next, errReply := parseCountedArgs(args, i+1)
+			if errReply != nil {
+				return errReply, nil
+			}
+			for j := 0; j < len(fields); j++ {
+				key := search.SortKey{Field: strings.TrimPrefix(fields[j], "@")}
+				if j+1 < len(fields) {
+					switch strings.ToUpper(fields[j+1]) {
+					case "ASC":
+						j++
+					case "DESC":
+						key.Desc = true
+						j++
+					}
+				}
+				sortKeys = append(sortKeys, key)
+			}
+			if next+1 < len(args) && strings.ToUpper(string(args[next])) == "MAX" {
+				var err error
+				max, err = strconv.Atoi(string(args[next+1]))
+				if err != nil || max < 0 {
+					return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+				}
+				next += 2
+			}
+			i = next - 1
+		case "LIMIT":
+			var errReply redis.Reply
+			offset, num, errReply = parseSearchLimit(args, i+1)
+			if errReply != nil {
+				return errReply, nil
+			}
+			i += 2
+		case "PARAMS":
+			next, errReply := parseSearchParams(args, i+1, &params)
+			if errReply != nil {
+				return errReply, nil
+			}
+			i = next - 1
+		case "DIALECT":
+			i++
+		default:
+			return reply.MakeSyntaxErrReply(), nil
+		}
+	}
+
+	_, q, results, errReply := searchIndex(db, args[0], args[1], params, search.ScorerBM25)
+	if errReply != nil {
+		return errReply, nil
+	}
+	keys := resultKeys(results)
+	scoreField, isKNN := q.KNN()
+
+	db.RWLocks(nil, keys)
+	rows := make([]*search.Row, 0, len(keys))
+	for _, r := range results {
+		hash, _ := getAsDict(db, r.Key)
+		if hash == nil {
+			continue
+		}
+		row := search.MakeRow()
+		fieldValues := hashToFieldValues(hash, nil)
+		for j := 0; j < len(fieldValues); j += 2 {
+			row.Set(string(fieldValues[j]), string(fieldValues[j+1]))
+		}
+		if isKNN {
+			row.Set(scoreField, strconv.FormatFloat(r.Score, 'f', -1, 64))
+		}
+		rows = append(rows, row)
+	}
+	db.RWUnLocks(nil, keys)
+
+	// 没有分组时只输出 LOAD 的字段
+	outputFields := loadFields
+	if grouped {
+		rows = search.GroupBy(rows, groupFields, reducers)
+		outputFields = nil
+	} else if loadAll {
+		outputFields = nil
+	} else if outputFields == nil {
+		outputFields = []string{}
+	}
+	if len(sortKeys) > 0 {
+		search.SortRows(rows, sortKeys)
+		if max >= 0 && max < len(rows) {
+			rows = rows[:max]
+		}
+	}
+
+	result := []redis.Reply{reply.MakeIntReply(int64(len(rows)))}
+	start, end := pageRange(len(rows), offset, num)
+	for _, row := range rows[start:end] {
+		fields := outputFields
+		if fields == nil {
+			fields = row.Fields()
+		}
+		values := make([][]byte, 0, 2*len(fields))
+		for _, field := range fields {
+			if value, ok := row.Get(field); ok {
+				values = append(values, []byte(field), []byte(value))
+			}
+		}
+		result = append(result, reply.MakeMultiBulkStringReply(values))
+	}
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// searchIndex 执行查询，返回索引、解析后的查询以及排序之后的结果
+func searchIndex(db *engine.DB, name, rawQuery []byte, params map[string]string, scorer search.Scorer) (*search.Index, *search.Query, []*search.Result, redis.Reply) {
+	idx, errReply := getSearchIndex(db, string(name))
+	if errReply != nil {
+		return nil, nil, nil, errReply
+	}
+	q, err := search.ParseQueryWithParams(string(rawQuery), params)
+	if err != nil {
+		return nil, nil, nil, reply.MakeErrReply(err.Error())
+	}
+	results, err := idx.Search(q, scorer)
+	if err != nil {
+		return nil, nil, nil, reply.MakeErrReply(err.Error())
+	}
+	return idx, q, results, nil
+}
+
+func resultKeys(results []*search.Result) []string {
+	keys := make([]string, len(results))
+	for i, r := range results {
+		keys[i] = r.Key
+	}
+	return keys
+}
+
+func getSearchIndex(db *engine.DB, name string) (*search.Index, redis.Reply) {
+	idx, ok := db.Indexes().Get(name)
+	if !ok {
+		return nil, reply.MakeErrReply("ERR Unknown Index name")
+	}
+	return idx, nil
+}
+
+// parseCountedArgs 解析形如 count arg ... 的参数，返回参数以及下一个参数的位置
+func parseCountedArgs(args [][]byte, start int) ([]string, int, redis.Reply) {
+	if start >= len(args) {
+		return nil, 0, reply.MakeSyntaxErrReply()
+	}
+	count, err := strconv.Atoi(string(args[start]))
+	if err != nil || count < 0 || start+count >= len(args) {
+		return nil, 0, reply.MakeSyntaxErrReply()
+	}
+	result := make([]string, count)
+	for i := 0; i < count; i++ {
+		result[i] = string(args[start+1+i])
+	}
+	return result, start + 1 + count, nil
+}
+
+// parseSearchParams 解析 PARAMS count name value ...，返回下一个参数的位置
+func parseSearchParams(args [][]byte, start int, params *map[string]string) (int, redis.Reply) {
+	values, next, errReply := parseCountedArgs(args, start)
+	if errReply != nil {
+		return 0, errReply
+	}
+	if len(values)%2 != 0 {
+		return 0, reply.MakeErrReply("ERR Parameters must be specified in PARAM VALUE pairs")
+	}
+	if *params == nil {
+		*params = make(map[string]string, len(values)/2)
+	}
+	for i := 0; i < len(values); i += 2 {
+		(*params)[values[i]] = values[i+1]
+	}
+	return next, nil
+}
+
+func parseSearchLimit(args [][]byte, start int) (int, int, redis.Reply) {
+	if start+1 >= len(args) {
+		return 0, 0, reply.MakeSyntaxErrReply()
+	}
+	offset, err1 := strconv.Atoi(string(args[start]))
+	num, err2 := strconv.Atoi(string(args[start+1]))
+	if err1 != nil || err2 != nil || offset < 0 || num < 0 {
+		return 0, 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return offset, num, nil
+}
+
+func trimFieldPrefix(fields []string) []string {
+	for i := range fields {
+		fields[i] = strings.TrimPrefix(fields[i], "@")
+	}
+	return fields
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+// pageRange 返回从 offset 开始的 num 个元素的下标范围，num 为负数时返回 offset 之后所有的元素
+func pageRange(n, offset, num int) (int, int) {
+	if offset >= n {
+		return n, n
+	}
+	end := n
+	if num >= 0 && offset+num < n {
+		end = offset + num
+	}
+	return offset, end
+}
+
+func init() {
+	// 索引涉及的 key 需要遍历数据库或者查询索引才能确定，在执行时自行加锁，所以 prepare 为空，不能在事务中使用
+	engine.RegisterCommand("FT.Create", execFTCreate, nil, -5, engine.FlagWrite)
+	engine.RegisterCommand("FT.DropIndex", execFTDropIndex, nil, -2, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("FT.Info", execFTInfo, nil, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("FT.Search", execFTSearch, nil, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("FT.Aggregate", execFTAggregate, nil, -3, engine.FlagReadOnly)
+}
@@ -0,0 +1,230 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/semaphore"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/timewheel"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 锁和信号量的状态变化以 SEM.RESTORE 的形式写入 AOF，过期时间为绝对时间，重放时不受执行时间影响。
+// 持有者过期或者等待者超时时由时间轮清理并唤醒等待者，访问时也会检查是否过期
+
+// LOCK.ACQUIRE name owner ttl_ms [WAIT ms]
+func execLockAcquire(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return acquireSemaphore(db, string(args[0]), string(args[1]), 0, args[2:])
+}
+
+// SEM.ACQUIRE name owner limit ttl_ms [WAIT ms]
+func execSemAcquire(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	limit, err := strconv.Atoi(string(args[2]))
+	if err != nil || limit < 1 {
+		return reply.MakeErrReply("ERR limit must be a positive integer"), nil
+	}
+	return acquireSemaphore(db, string(args[0]), string(args[1]), limit, args[3:])
+}
+
+// acquireSemaphore 获取锁（limit 为 0）或者信号量，成功时返回 fencing token。
+// 获取失败并且指定了 WAIT 时加入等待队列并阻塞，被唤醒后按照排队的顺序重新尝试，超时返回空
+func acquireSemaphore(db *engine.DB, key, owner string, limit int, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	ttl, errReply := parseSemaphoreTTL(args[0])
+	if errReply != nil {
+		return errReply, nil
+	}
+	var wait time.Duration
+	if len(args) == 3 && strings.ToUpper(string(args[1])) == "WAIT" {
+		if wait, errReply = parseSemaphoreWait(args[2]); errReply != nil {
+			return errReply, nil
+		}
+	} else if len(args) != 1 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	s, errReply := getAsSemaphore(db, key, limit == 0)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		if limit == 0 {
+			s = semaphore.MakeLock()
+		} else {
+			s = semaphore.Make(limit)
+		}
+		db.PutEntity(key, &database.DataEntity{Data: s})
+	}
+	limitChanged := limit > 0 && s.Limit() != limit
+	s.SetLimit(limit)
+
+	now := time.Now()
+	token, ok := s.Acquire(owner, ttl, now)
+	if ok {
+		saveSemaphore(db, key, s)
+		return reply.MakeIntReply(token), nil
+	}
+	if limitChanged {
+		saveSemaphore(db, key, s)
+	}
+	if wait == 0 {
+		return reply.MakeNullBulkStringReply(), nil
+	}
+	s.Wait(owner, now.Add(wait))
+	scheduleSemaphoreExpire(db, key, s)
+	blocked := engine.MakeBlockedReply([]string{key}, wait)
+	blocked.Cancel = func(db *engine.DB) {
+		// 放弃等待的客户端不能继续占用队列，排在后面的等待者可能可以获取
+		if s, _ := getAsSemaphore(db, key, limit == 0); s != nil && s.CancelWait(owner) {
+			db.NotifyKeys(key)
+		}
+	}
+	return blocked, nil
+}
+
+// LOCK.RELEASE name owner
+func execLockRelease(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return releaseSemaphore(db, args, true)
+}
+
+// SEM.RELEASE name owner
+func execSemRelease(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return releaseSemaphore(db, args, false)
+}
+
+// releaseSemaphore 释放 owner 持有的锁或者信号量，释放成功返回 1，owner 没有持有时返回 0
+func releaseSemaphore(db *engine.DB, args [][]byte, isLock bool) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	s, errReply := getAsSemaphore(db, key, isLock)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil || !s.Release(string(args[1]), time.Now()) {
+		return reply.MakeIntReply(0), nil
+	}
+	saveSemaphore(db, key, s)
+	return reply.MakeIntReply(1), nil
+}
+
+// LOCK.EXTEND name owner ttl_ms
+func execLockExtend(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return extendSemaphore(db, args, true)
+}
+
+// SEM.EXTEND name owner ttl_ms
+func execSemExtend(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return extendSemaphore(db, args, false)
+}
+
+// extendSemaphore 将 owner 的过期时间修改为 ttl 之后，成功返回 1，owner 没有持有或者已经过期时返回 0
+func extendSemaphore(db *engine.DB, args [][]byte, isLock bool) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	ttl, errReply := parseSemaphoreTTL(args[2])
+	if errReply != nil {
+		return errReply, nil
+	}
+	s, errReply := getAsSemaphore(db, key, isLock)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil || !s.Extend(string(args[1]), ttl, time.Now()) {
+		return reply.MakeIntReply(0), nil
+	}
+	saveSemaphore(db, key, s)
+	return reply.MakeIntReply(1), nil
+}
+
+// SEM.RESTORE name dump，用于 AOF 恢复锁和信号量
+func execSemRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	s, err := semaphore.Restore(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{Data: s})
+	scheduleSemaphoreExpire(db, key, s)
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// getAsSemaphore 获取锁或者信号量，key 不存在时返回 nil，类型不匹配时返回错误
+func getAsSemaphore(db *engine.DB, key string, isLock bool) (*semaphore.Semaphore, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*semaphore.Semaphore)
+	if !ok || s.IsLock() != isLock {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return s, nil
+}
+
+// saveSemaphore 将状态写入 AOF 并重新安排过期任务
+func saveSemaphore(db *engine.DB, key string, s *semaphore.Semaphore) {
+	db.AddAof(utils.EntityToCmdLine(key, &database.DataEntity{Data: s}))
+	scheduleSemaphoreExpire(db, key, s)
+}
+
+// scheduleSemaphoreExpire 在最早的持有者过期或者等待者超时时清理，
+// 持有者过期时写入 AOF 并增加版本号，等待者超时时唤醒排在后面的等待者
+func scheduleSemaphoreExpire(db *engine.DB, key string, s *semaphore.Semaphore) {
+	next, ok := s.NextDeadline()
+	if !ok {
+		return
+	}
+	delay := time.Until(next)
+	if delay < 0 {
+		delay = 0
+	}
+	timewheel.Delay(delay, fmt.Sprintf("sem-expire:%p", s), func() {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		defer db.RWUnLocks(keys, nil)
+		entity, exists := db.GetEntity(key)
+		if !exists || entity.Data != s {
+			return
+		}
+		now := time.Now()
+		if s.ExpireHolders(now) > 0 {
+			s.ExpireWaiters(now)
+			saveSemaphore(db, key, s)
+			db.AddVersion(key)
+			return
+		}
+		if s.ExpireWaiters(now) > 0 {
+			db.NotifyKeys(key)
+		}
+		scheduleSemaphoreExpire(db, key, s)
+	})
+}
+
+func parseSemaphoreTTL(arg []byte) (time.Duration, redis.Reply) {
+	ms, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, reply.MakeErrReply("ERR ttl must be a positive integer")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// parseSemaphoreWait 解析等待的毫秒数，为 0 时不等待
+func parseSemaphoreWait(arg []byte) (time.Duration, redis.Reply) {
+	ms, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || ms < 0 {
+		return 0, reply.MakeErrReply("ERR wait is not an integer or out of range")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func init() {
+	engine.RegisterCommand("Lock.Acquire", execLockAcquire, writeFirstKey, -4, engine.FlagWrite)
+	engine.RegisterCommand("Lock.Release", execLockRelease, writeFirstKey, 3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("Lock.Extend", execLockExtend, writeFirstKey, 4, engine.FlagWrite)
+	engine.RegisterCommand("Sem.Acquire", execSemAcquire, writeFirstKey, -5, engine.FlagWrite)
+	engine.RegisterCommand("Sem.Release", execSemRelease, writeFirstKey, 3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("Sem.Extend", execSemExtend, writeFirstKey, 4, engine.FlagWrite)
+	engine.RegisterCommand("Sem.Restore", execSemRestore, writeFirstKey, 3, engine.FlagWrite|engine.FlagInternal)
+}
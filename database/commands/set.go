@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"github.com/dawnzzz/simple-redis/config"
 	"github.com/dawnzzz/simple-redis/database/engine"
 	Set "github.com/dawnzzz/simple-redis/datastruct/set"
 	"github.com/dawnzzz/simple-redis/interface/database"
@@ -319,7 +320,7 @@ func getOrInitSet(db *engine.DB, key string) (set Set.Set, inited bool, errReply
 	}
 	inited = false
 	if set == nil {
-		set = Set.MakeSimpleSet()
+		set = Set.MakeCompactSet(config.Properties.SetMaxIntsetEntries, config.Properties.SetMaxListpackEntries, config.Properties.SetMaxListpackValue)
 		db.PutEntity(key, &database.DataEntity{
 			Data: set,
 		})
@@ -335,8 +336,8 @@ func init() {
 	engine.RegisterCommand("SInter", execSInter, prepareSetCalculate, -2, engine.FlagReadOnly)
 	engine.RegisterCommand("SIsMember", execSIsMember, readFirstKey, 3, engine.FlagReadOnly)
 	engine.RegisterCommand("SMembers", execSMembers, readFirstKey, 2, engine.FlagReadOnly)
-	engine.RegisterCommand("SPop", execSPop, writeFirstKey, -2, engine.FlagWrite)
+	engine.RegisterCommand("SPop", execSPop, writeFirstKey, -2, engine.FlagWrite|engine.FlagAllowOOM)
 	engine.RegisterCommand("SRandMember", execSRandMember, readFirstKey, -2, engine.FlagReadOnly)
-	engine.RegisterCommand("SRem", execSRem, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("SRem", execSRem, writeFirstKey, -3, engine.FlagWrite|engine.FlagAllowOOM)
 	engine.RegisterCommand("SUnion", execSUnion, prepareSetCalculate, -2, engine.FlagReadOnly)
 }
@@ -0,0 +1,394 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/bloom"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+	"strings"
+)
+
+const topKMaxIncrement = 100000 // TOPK.INCRBY 单次增加的最大值
+
+/* ---- Count-Min Sketch ---- */
+
+// CMS.INITBYDIM key width depth
+func execCMSInitByDim(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	width, err := strconv.ParseUint(string(args[1]), 10, 32)
+	if err != nil || width == 0 {
+		return reply.MakeErrReply("ERR CMS: invalid width"), nil
+	}
+	depth, err := strconv.ParseUint(string(args[2]), 10, 32)
+	if err != nil || depth == 0 {
+		return reply.MakeErrReply("ERR CMS: invalid depth"), nil
+	}
+
+	return initCMS(db, key, bloom.MakeCountMinSketch(uint32(width), uint32(depth)))
+}
+
+// CMS.INITBYPROB key error probability
+func execCMSInitByProb(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || errorRate <= 0 || errorRate >= 1 {
+		return reply.MakeErrReply("ERR CMS: invalid overestimation value"), nil
+	}
+	probability, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || probability <= 0 || probability >= 1 {
+		return reply.MakeErrReply("ERR CMS: invalid prob value"), nil
+	}
+
+	return initCMS(db, key, bloom.MakeCountMinSketchByProb(errorRate, probability))
+}
+
+func initCMS(db *engine.DB, key string, cms *bloom.CountMinSketch) (redis.Reply, *engine.AofExpireCtx) {
+	if _, exists := db.GetEntity(key); exists {
+		return reply.MakeErrReply("ERR CMS: key already exists"), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: cms,
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// CMS.INCRBY key item increment [item increment ...]
+func execCMSIncrBy(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("cms.incrby"), nil
+	}
+	increments := make([]uint64, 0, len(args)/2)
+	for i := 2; i < len(args); i += 2 {
+		increment, err := strconv.ParseUint(string(args[i]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR CMS: Cannot parse number"), nil
+		}
+		increments = append(increments, increment)
+	}
+
+	cms, errReply := getAsCMS(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([]redis.Reply, len(increments))
+	for i, increment := range increments {
+		result[i] = reply.MakeIntReply(int64(cms.IncrBy(args[2*i+1], increment)))
+	}
+
+	return reply.MakeMultiRawReply(result), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// CMS.QUERY key item [item ...]
+func execCMSQuery(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	cms, errReply := getAsCMS(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		result[i] = reply.MakeIntReply(int64(cms.Query(item)))
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// CMS.MERGE destination numKeys source [source ...] [WEIGHTS weight [weight ...]]
+func execCMSMerge(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	destKey := string(args[0])
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys <= 0 || numKeys > len(args)-2 {
+		return reply.MakeErrReply("ERR CMS: invalid numkeys"), nil
+	}
+
+	srcKeys := args[2 : 2+numKeys]
+	weights := make([]int64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	rest := args[2+numKeys:]
+	if len(rest) > 0 {
+		if strings.ToUpper(string(rest[0])) != "WEIGHTS" || len(rest)-1 != numKeys {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		for i, arg := range rest[1:] {
+			weights[i], err = strconv.ParseInt(string(arg), 10, 64)
+			if err != nil {
+				return reply.MakeErrReply("ERR CMS: invalid weight value"), nil
+			}
+		}
+	}
+
+	dest, errReply := getAsCMS(db, destKey)
+	if errReply != nil {
+		return errReply, nil
+	}
+	sources := make([]*bloom.CountMinSketch, numKeys)
+	for i, srcKey := range srcKeys {
+		sources[i], errReply = getAsCMS(db, string(srcKey))
+		if errReply != nil {
+			return errReply, nil
+		}
+	}
+	if err := dest.Merge(sources, weights); err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// CMS.INFO key
+func execCMSInfo(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	cms, errReply := getAsCMS(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte("width")), reply.MakeIntReply(int64(cms.Width())),
+		reply.MakeBulkStringReply([]byte("depth")), reply.MakeIntReply(int64(cms.Depth())),
+		reply.MakeBulkStringReply([]byte("count")), reply.MakeIntReply(int64(cms.Count())),
+	}), nil
+}
+
+// CMS.RESTORE key dump 用于 AOF 重写，恢复整个 Count-Min Sketch
+func execCMSRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	cms, err := bloom.RestoreCountMinSketch(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: cms,
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// getAsCMS 获取 Count-Min Sketch，key 不存在时返回错误
+func getAsCMS(db *engine.DB, key string) (*bloom.CountMinSketch, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, reply.MakeErrReply("ERR CMS: key does not exist")
+	}
+	cms, ok := entity.Data.(*bloom.CountMinSketch)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return cms, nil
+}
+
+/* ---- Top-K ---- */
+
+// TOPK.RESERVE key topk [width depth decay]
+func execTopKReserve(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	if len(args) != 2 && len(args) != 5 {
+		return reply.MakeArgNumErrReply("topk.reserve"), nil
+	}
+	k, err := strconv.ParseUint(string(args[1]), 10, 32)
+	if err != nil || k == 0 {
+		return reply.MakeErrReply("ERR TopK: invalid k"), nil
+	}
+
+	width, depth, decay := uint64(bloom.DefaultTopKWidth), uint64(bloom.DefaultTopKDepth), bloom.DefaultTopKDecay
+	if len(args) == 5 {
+		width, err = strconv.ParseUint(string(args[2]), 10, 32)
+		if err != nil || width == 0 {
+			return reply.MakeErrReply("ERR TopK: invalid width"), nil
+		}
+		depth, err = strconv.ParseUint(string(args[3]), 10, 32)
+		if err != nil || depth == 0 {
+			return reply.MakeErrReply("ERR TopK: invalid depth"), nil
+		}
+		decay, err = strconv.ParseFloat(string(args[4]), 64)
+		if err != nil || decay <= 0 || decay > 1 {
+			return reply.MakeErrReply("ERR TopK: invalid decay value. must be '<= 1' & '> 0'"), nil
+		}
+	}
+
+	if _, exists := db.GetEntity(key); exists {
+		return reply.MakeErrReply("ERR TopK: key already exists"), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: bloom.MakeTopK(uint32(k), uint32(width), uint32(depth), decay),
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// TOPK.ADD key item [item ...]
+func execTopKAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	topK, errReply := getAsTopK(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		result[i] = makeExpelledReply(topK.IncrBy(item, 1))
+	}
+
+	return reply.MakeMultiRawReply(result), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// TOPK.INCRBY key item increment [item increment ...]
+func execTopKIncrBy(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("topk.incrby"), nil
+	}
+	increments := make([]uint32, 0, len(args)/2)
+	for i := 2; i < len(args); i += 2 {
+		increment, err := strconv.ParseUint(string(args[i]), 10, 32)
+		if err != nil || increment == 0 || increment > topKMaxIncrement {
+			return reply.MakeErrReply("ERR TopK: increment must be an integer greater or equal to 1 and less than or equal to 100000"), nil
+		}
+		increments = append(increments, uint32(increment))
+	}
+
+	topK, errReply := getAsTopK(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([]redis.Reply, len(increments))
+	for i, increment := range increments {
+		result[i] = makeExpelledReply(topK.IncrBy(args[2*i+1], increment))
+	}
+
+	return reply.MakeMultiRawReply(result), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// TOPK.QUERY key item [item ...]
+func execTopKQuery(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	topK, errReply := getAsTopK(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([]redis.Reply, len(args)-1)
+	for i, item := range args[1:] {
+		if topK.Query(item) {
+			result[i] = reply.MakeIntReply(1)
+		} else {
+			result[i] = reply.MakeIntReply(0)
+		}
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// TOPK.LIST key [WITHCOUNT]
+func execTopKList(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	withCount := false
+	if len(args) == 2 {
+		if strings.ToUpper(string(args[1])) != "WITHCOUNT" {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		withCount = true
+	} else if len(args) > 2 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	topK, errReply := getAsTopK(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	items := topK.List()
+	result := make([]redis.Reply, 0, len(items)*2)
+	for _, item := range items {
+		result = append(result, reply.MakeBulkStringReply([]byte(item.Item)))
+		if withCount {
+			result = append(result, reply.MakeIntReply(int64(item.Count)))
+		}
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// TOPK.INFO key
+func execTopKInfo(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	topK, errReply := getAsTopK(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte("k")), reply.MakeIntReply(int64(topK.K())),
+		reply.MakeBulkStringReply([]byte("width")), reply.MakeIntReply(int64(topK.Width())),
+		reply.MakeBulkStringReply([]byte("depth")), reply.MakeIntReply(int64(topK.Depth())),
+		reply.MakeBulkStringReply([]byte("decay")), reply.MakeBulkStringReply([]byte(strconv.FormatFloat(topK.Decay(), 'f', -1, 64))),
+	}), nil
+}
+
+// TOPK.RESTORE key dump 用于 AOF 重写，恢复整个 Top-K
+func execTopKRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	topK, err := bloom.RestoreTopK(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: topK,
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// getAsTopK 获取 Top-K，key 不存在时返回错误
+func getAsTopK(db *engine.DB, key string) (*bloom.TopK, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, reply.MakeErrReply("ERR TopK: key does not exist")
+	}
+	topK, ok := entity.Data.(*bloom.TopK)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return topK, nil
+}
+
+func makeExpelledReply(expelled string, hasExpelled bool) redis.Reply {
+	if !hasExpelled {
+		return reply.MakeNullBulkStringReply()
+	}
+	return reply.MakeBulkStringReply([]byte(expelled))
+}
+
+func init() {
+	engine.RegisterCommand("CMS.InitByDim", execCMSInitByDim, writeFirstKey, 4, engine.FlagWrite)
+	engine.RegisterCommand("CMS.InitByProb", execCMSInitByProb, writeFirstKey, 4, engine.FlagWrite)
+	engine.RegisterCommand("CMS.IncrBy", execCMSIncrBy, writeFirstKey, -4, engine.FlagWrite)
+	engine.RegisterCommand("CMS.Query", execCMSQuery, readFirstKey, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("CMS.Merge", execCMSMerge, prepareDestNumKeys, -4, engine.FlagWrite)
+	engine.RegisterCommand("CMS.Info", execCMSInfo, readFirstKey, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("CMS.Restore", execCMSRestore, writeFirstKey, 3, engine.FlagWrite|engine.FlagInternal)
+
+	engine.RegisterCommand("TopK.Reserve", execTopKReserve, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("TopK.Add", execTopKAdd, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("TopK.IncrBy", execTopKIncrBy, writeFirstKey, -4, engine.FlagWrite)
+	engine.RegisterCommand("TopK.Query", execTopKQuery, readFirstKey, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("TopK.List", execTopKList, readFirstKey, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("TopK.Info", execTopKInfo, readFirstKey, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("TopK.Restore", execTopKRestore, writeFirstKey, 3, engine.FlagWrite|engine.FlagInternal)
+}
@@ -1,29 +1,68 @@
 package commands
 
 import (
+	"github.com/dawnzzz/simple-redis/config"
 	"github.com/dawnzzz/simple-redis/database/engine"
 	"github.com/dawnzzz/simple-redis/datastruct/sortedset"
 	"github.com/dawnzzz/simple-redis/interface/database"
 	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
 	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 )
 
+const zRandMemberMaxCount = 1 << 20 // ZRANDMEMBER 的 count 为负数时最多返回的成员数量
+
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
 func execZAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
-	if len(args)%2 != 1 {
+	key := string(args[0])
+
+	// 解析选项
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+	for ; i < len(args); i++ {
+		flag := strings.ToUpper(string(args[i]))
+		if flag == "NX" {
+			nx = true
+		} else if flag == "XX" {
+			xx = true
+		} else if flag == "GT" {
+			gt = true
+		} else if flag == "LT" {
+			lt = true
+		} else if flag == "CH" {
+			ch = true
+		} else if flag == "INCR" {
+			incr = true
+		} else {
+			break
+		}
+	}
+	if nx && xx {
+		return reply.MakeErrReply("ERR XX and NX options at the same time are not compatible"), nil
+	}
+	if (gt && lt) || (gt && nx) || (lt && nx) {
+		return reply.MakeErrReply("ERR GT, LT, and/or NX options at the same time are not compatible"), nil
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
 		return reply.MakeSyntaxErrReply(), nil
 	}
+	if incr && len(pairs) != 2 {
+		return reply.MakeErrReply("ERR INCR option supports a single increment-element pair"), nil
+	}
 
-	key := string(args[0])
-	size := (len(args) - 1) / 2
+	size := len(pairs) / 2
 	elements := make([]*sortedset.Element, size)
-
 	for i := 0; i < size; i++ {
-		scoreValue := args[2*i+1]
-		member := string(args[2*i+2])
+		scoreValue := pairs[2*i]
+		member := string(pairs[2*i+1])
 		score, err := strconv.ParseFloat(string(scoreValue), 64)
-		if err != nil {
+		if err != nil || math.IsNaN(score) {
 			return reply.MakeErrReply("ERR value is not a valid float"), nil
 		}
 		elements[i] = &sortedset.Element{
@@ -32,22 +71,77 @@ func execZAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx)
 		}
 	}
 
-	sortedSet, _, errReply := getOrInitSortedSet(db, key)
-	if errReply != nil {
-		return errReply, nil
+	var sortedSet *sortedset.SortedSet
+	var errReply reply.ErrorReply
+	if xx {
+		// XX 只更新已经存在的成员，key 不存在时不需要创建
+		sortedSet, errReply = getAsSortedSet(db, key)
+		if errReply != nil {
+			return errReply, nil
+		}
+		if sortedSet == nil {
+			if incr {
+				return reply.MakeNullBulkStringReply(), nil
+			}
+			return reply.MakeIntReply(0), nil
+		}
+	} else {
+		sortedSet, _, errReply = getOrInitSortedSet(db, key)
+		if errReply != nil {
+			return errReply, nil
+		}
 	}
 
-	i := 0
+	var added, changed int64
+	var incrScore float64
+	incrAborted := false
 	for _, e := range elements {
-		if sortedSet.Add(e.Member, e.Score) {
-			i++
+		score := e.Score
+		old, exists := sortedSet.Get(e.Member)
+		if (nx && exists) || (xx && !exists) {
+			incrAborted = true
+			continue
+		}
+		if incr && exists {
+			score = old.Score + score
+			if math.IsNaN(score) {
+				return reply.MakeErrReply("ERR resulting score is not a number (NaN)"), nil
+			}
+		}
+		if exists && ((gt && score <= old.Score) || (lt && score >= old.Score)) {
+			incrAborted = true
+			continue
+		}
+
+		if !exists {
+			added++
+		} else if old.Score != score {
+			changed++
 		}
+		sortedSet.Add(e.Member, score)
+		incrScore = score
+	}
+
+	if sortedSet.Len() == 0 {
+		// 没有添加任何成员，不保留空的有序集合
+		db.Remove(key)
 	}
 
-	return reply.MakeIntReply(int64(i)), &engine.AofExpireCtx{
-		NeedAof:  true,
-		ExpireAt: nil,
+	var aofExpireCtx *engine.AofExpireCtx
+	if added > 0 || changed > 0 {
+		aofExpireCtx = &engine.AofExpireCtx{NeedAof: true}
 	}
+
+	if incr {
+		if incrAborted {
+			return reply.MakeNullBulkStringReply(), aofExpireCtx
+		}
+		return reply.MakeBulkStringReply([]byte(strconv.FormatFloat(incrScore, 'f', -1, 64))), aofExpireCtx
+	}
+	if ch {
+		return reply.MakeIntReply(added + changed), aofExpireCtx
+	}
+	return reply.MakeIntReply(added), aofExpireCtx
 }
 
 func execZCard(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
@@ -430,6 +524,323 @@ func execRemRangeByScore(db *engine.DB, args [][]byte) (redis.Reply, *engine.Aof
 	return reply.MakeIntReply(removed), &engine.AofExpireCtx{NeedAof: true}
 }
 
+// ZMSCORE key member [member ...]
+func execZMScore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	sortedSet, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([][]byte, len(args)-1)
+	for i, member := range args[1:] {
+		if sortedSet == nil {
+			continue
+		}
+		element, ok := sortedSet.Get(string(member))
+		if !ok {
+			continue // nil 表示成员不存在
+		}
+		result[i] = []byte(strconv.FormatFloat(element.Score, 'f', -1, 64))
+	}
+
+	return reply.MakeMultiBulkStringReply(result), nil
+}
+
+// ZRANDMEMBER key [count [WITHSCORES]]
+func execZRandMember(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	if len(args) > 3 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	key := string(args[0])
+	count := 1
+	if len(args) >= 2 {
+		var err error
+		count, err = strconv.Atoi(string(args[1]))
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+		}
+		if count < -zRandMemberMaxCount {
+			// 成员可以重复，返回的数量不受集合大小的限制，需要限制上限
+			return reply.MakeErrReply("ERR value is out of range"), nil
+		}
+	}
+	withScores := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORES" {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		withScores = true
+	}
+
+	sortedSet, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	if len(args) == 1 {
+		// 没有 count 参数时返回单个成员
+		if sortedSet == nil {
+			return reply.MakeNullBulkStringReply(), nil
+		}
+		elements := sortedSet.RandomMembers(1)
+		return reply.MakeBulkStringReply([]byte(elements[0].Member)), nil
+	}
+
+	if sortedSet == nil || count == 0 {
+		return reply.MakeEmptyMultiBulkStringReply(), nil
+	}
+
+	// count 为正数时返回不重复的成员，为负数时成员可能重复
+	var elements []*sortedset.Element
+	if count > 0 {
+		elements = sortedSet.RandomDistinctMembers(count)
+	} else {
+		elements = sortedSet.RandomMembers(-count)
+	}
+
+	if withScores {
+		return reply.MakeMultiBulkStringReply(elementsToArgs(elements)), nil
+	}
+	result := make([][]byte, len(elements))
+	for i, element := range elements {
+		result[i] = []byte(element.Member)
+	}
+	return reply.MakeMultiBulkStringReply(result), nil
+}
+
+func execZPopMin(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return zPop0(db, args, false)
+}
+
+func execZPopMax(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return zPop0(db, args, true)
+}
+
+// ZMPOP numkeys key [key ...] MIN|MAX [COUNT count]
+func execZMPop(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	keys, max, count, errReply := parseZMPopArgs(args)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	key, elements, errReply := popFirstNonEmpty(db, keys, count, max)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if key == "" {
+		// 所有有序集合都为空时与 BZMPOP 超时一样返回空数组
+		return reply.MakeNullMultiBulkStringReply(), nil
+	}
+
+	return makeZMPopReply(key, elements), nil
+}
+
+// BZPOPMIN key [key ...] timeout
+func execBZPopMin(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return bzPop0(db, args, false)
+}
+
+// BZPOPMAX key [key ...] timeout
+func execBZPopMax(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return bzPop0(db, args, true)
+}
+
+// BZMPOP timeout numkeys key [key ...] MIN|MAX [COUNT count]
+func execBZMPop(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	timeout, errReply := parseBlockingTimeout(args[0])
+	if errReply != nil {
+		return errReply, nil
+	}
+	keys, max, count, errReply := parseZMPopArgs(args[1:])
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	key, elements, errReply := popFirstNonEmpty(db, keys, count, max)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if key == "" {
+		// 所有的有序集合都为空，阻塞等待，超时返回空数组
+		blocked := engine.MakeBlockedReply(keys, timeout)
+		blocked.TimeoutReply = reply.MakeNullMultiBulkStringReply()
+		return blocked, nil
+	}
+
+	return makeZMPopReply(key, elements), nil
+}
+
+func zPop0(db *engine.DB, args [][]byte, max bool) (redis.Reply, *engine.AofExpireCtx) {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+	key := string(args[0])
+	count := 1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(string(args[1]))
+		if err != nil || count < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive"), nil
+		}
+	}
+
+	sortedSet, errReply := getAsSortedSet(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if sortedSet == nil || count == 0 {
+		return reply.MakeEmptyMultiBulkStringReply(), nil
+	}
+
+	elements := popSortedSet(db, key, sortedSet, count, max)
+
+	return reply.MakeMultiBulkStringReply(elementsToArgs(elements)), &engine.AofExpireCtx{NeedAof: true}
+}
+
+func bzPop0(db *engine.DB, args [][]byte, max bool) (redis.Reply, *engine.AofExpireCtx) {
+	timeout, errReply := parseBlockingTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply, nil
+	}
+	keys := make([]string, len(args)-1)
+	for i := range keys {
+		keys[i] = string(args[i])
+	}
+
+	key, elements, errReply := popFirstNonEmpty(db, keys, 1, max)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if key == "" {
+		// 所有的有序集合都为空，阻塞等待，超时返回空数组
+		blocked := engine.MakeBlockedReply(keys, timeout)
+		blocked.TimeoutReply = reply.MakeNullMultiBulkStringReply()
+		return blocked, nil
+	}
+
+	result := make([][]byte, 0, 3)
+	result = append(result, []byte(key))
+	result = append(result, elementsToArgs(elements)...)
+	return reply.MakeMultiBulkStringReply(result), nil
+}
+
+// popFirstNonEmpty 从第一个非空的有序集合中弹出 count 个元素，并以 ZPOPMIN/ZPOPMAX 的形式写入 AOF
+// 所有有序集合都为空时返回的 key 为空字符串
+func popFirstNonEmpty(db *engine.DB, keys []string, count int, max bool) (string, []*sortedset.Element, reply.ErrorReply) {
+	for _, key := range keys {
+		sortedSet, errReply := getAsSortedSet(db, key)
+		if errReply != nil {
+			return "", nil, errReply
+		}
+		if sortedSet == nil || sortedSet.Len() == 0 {
+			continue
+		}
+
+		elements := popSortedSet(db, key, sortedSet, count, max)
+		// 阻塞命令不能直接写入 AOF，否则重放时可能阻塞，所以记录实际执行的弹出操作
+		popCmd := "ZPOPMIN"
+		if max {
+			popCmd = "ZPOPMAX"
+		}
+		db.AddAof(utils.StringsToCmdLine(popCmd, key, strconv.Itoa(len(elements))))
+		return key, elements, nil
+	}
+
+	return "", nil, nil
+}
+
+// popSortedSet 弹出 count 个元素，有序集合为空时删除 key
+func popSortedSet(db *engine.DB, key string, sortedSet *sortedset.SortedSet, count int, max bool) []*sortedset.Element {
+	var elements []*sortedset.Element
+	if max {
+		elements = sortedSet.PopMax(count)
+	} else {
+		elements = sortedSet.PopMin(count)
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	return elements
+}
+
+// parseZMPopArgs 解析 numkeys key [key ...] MIN|MAX [COUNT count]
+func parseZMPopArgs(args [][]byte) (keys []string, max bool, count int, errReply reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, reply.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	if len(args) < numKeys+2 {
+		return nil, false, 0, reply.MakeSyntaxErrReply()
+	}
+	keys = make([]string, numKeys)
+	for i := 0; i < numKeys; i++ {
+		keys[i] = string(args[i+1])
+	}
+
+	switch strings.ToUpper(string(args[numKeys+1])) {
+	case "MIN":
+		max = false
+	case "MAX":
+		max = true
+	default:
+		return nil, false, 0, reply.MakeSyntaxErrReply()
+	}
+
+	count = 1
+	rest := args[numKeys+2:]
+	if len(rest) == 0 {
+		return keys, max, count, nil
+	}
+	if len(rest) != 2 || strings.ToUpper(string(rest[0])) != "COUNT" {
+		return nil, false, 0, reply.MakeSyntaxErrReply()
+	}
+	count, err = strconv.Atoi(string(rest[1]))
+	if err != nil || count <= 0 {
+		return nil, false, 0, reply.MakeErrReply("ERR count should be greater than 0")
+	}
+
+	return keys, max, count, nil
+}
+
+// parseBlockingTimeout 解析阻塞命令的超时时间（单位为秒，可以是小数），0 表示一直阻塞
+func parseBlockingTimeout(arg []byte) (time.Duration, reply.ErrorReply) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, reply.MakeErrReply("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// makeZMPopReply 返回 [key, [[member, score], ...]]
+func makeZMPopReply(key string, elements []*sortedset.Element) redis.Reply {
+	members := make([]redis.Reply, len(elements))
+	for i, element := range elements {
+		score := strconv.FormatFloat(element.Score, 'f', -1, 64)
+		members[i] = reply.MakeMultiBulkStringReply([][]byte{[]byte(element.Member), []byte(score)})
+	}
+
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte(key)),
+		reply.MakeMultiRawReply(members),
+	})
+}
+
+// elementsToArgs 将元素转为 member score member score ... 的形式
+func elementsToArgs(elements []*sortedset.Element) [][]byte {
+	result := make([][]byte, 0, 2*len(elements))
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		result = append(result, []byte(strconv.FormatFloat(element.Score, 'f', -1, 64)))
+	}
+	return result
+}
+
 func getAsSortedSet(db *engine.DB, key string) (sortedSet *sortedset.SortedSet, errorReply reply.ErrorReply) {
 	entity, exists := db.GetEntity(key)
 	if !exists {
@@ -449,7 +860,7 @@ func getOrInitSortedSet(db *engine.DB, key string) (sortedSet *sortedset.SortedS
 	}
 	inited = false
 	if sortedSet == nil {
-		sortedSet = sortedset.MakeSortedSet()
+		sortedSet = sortedset.MakeCompactSortedSet(config.Properties.ZsetMaxListpackEntries, config.Properties.ZsetMaxListpackValue)
 		db.PutEntity(key, &database.DataEntity{
 			Data: sortedSet,
 		})
@@ -557,7 +968,15 @@ func init() {
 	engine.RegisterCommand("ZRevRangeByScore", execZRevRangeByScore, readFirstKey, -4, engine.FlagReadOnly)
 	engine.RegisterCommand("ZRank", execZRank, readFirstKey, 3, engine.FlagReadOnly)
 	engine.RegisterCommand("ZRevRank", execZRevRank, readFirstKey, 3, engine.FlagReadOnly)
-	engine.RegisterCommand("ZRem", execZRem, writeFirstKey, -3, engine.FlagWrite)
-	engine.RegisterCommand("ZRemRangeByRank", execRemRangeByRank, writeFirstKey, 4, engine.FlagWrite)
-	engine.RegisterCommand("ZRemRangeByScore", execRemRangeByScore, writeFirstKey, 4, engine.FlagWrite)
+	engine.RegisterCommand("ZRem", execZRem, writeFirstKey, -3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("ZRemRangeByRank", execRemRangeByRank, writeFirstKey, 4, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("ZRemRangeByScore", execRemRangeByScore, writeFirstKey, 4, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("ZMScore", execZMScore, readFirstKey, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("ZRandMember", execZRandMember, readFirstKey, -2, engine.FlagReadOnly)
+	engine.RegisterCommand("ZPopMin", execZPopMin, writeFirstKey, -2, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("ZPopMax", execZPopMax, writeFirstKey, -2, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("ZMPop", execZMPop, writeNumKeys, -4, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("BZPopMin", execBZPopMin, writeAllKeysExceptLast, -3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("BZPopMax", execBZPopMax, writeAllKeysExceptLast, -3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("BZMPop", execBZMPop, writeBZMPopKeys, -5, engine.FlagWrite|engine.FlagAllowOOM)
 }
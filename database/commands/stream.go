@@ -0,0 +1,1070 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/stream"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func execXAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	// 解析选项
+	noMkStream := false
+	var trim *streamTrim
+	i := 1
+	for i < len(args) {
+		option := strings.ToUpper(string(args[i]))
+		if option == "NOMKSTREAM" {
+			noMkStream = true
+			i++
+		} else if option == "MAXLEN" || option == "MINID" {
+			var errReply reply.ErrorReply
+			trim, i, errReply = parseStreamTrim(args, i)
+			if errReply != nil {
+				return errReply, nil
+			}
+		} else {
+			break
+		}
+	}
+
+	idIndex := i
+	fields := args[idIndex+1:]
+	if idIndex >= len(args) || len(fields) == 0 || len(fields)%2 != 0 {
+		return reply.MakeArgNumErrReply("xadd"), nil
+	}
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	inited := false
+	if s == nil {
+		if noMkStream {
+			return reply.MakeNullBulkStringReply(), nil
+		}
+		s = stream.MakeStream()
+		inited = true
+	}
+
+	// 生成 ID
+	rawID := string(args[idIndex])
+	var id stream.ID
+	var err error
+	if rawID == "*" {
+		id, err = s.NextID(time.Now())
+	} else if strings.HasSuffix(rawID, "-*") {
+		var ms uint64
+		ms, err = strconv.ParseUint(strings.TrimSuffix(rawID, "-*"), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR Invalid stream ID specified as stream command argument"), nil
+		}
+		id, err = s.NextSeqID(ms)
+	} else {
+		id, err = stream.ParseID(rawID, 0)
+	}
+	if err == nil {
+		err = s.Add(id, copyArgs(fields))
+	}
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+
+	if inited {
+		db.PutEntity(key, &database.DataEntity{
+			Data: s,
+		})
+	}
+	if trim != nil {
+		trim.apply(s)
+	}
+
+	// 自动生成的 ID 与时间相关，AOF 中需要记录实际的 ID
+	aofCmdLine := make([][]byte, 0, len(args)+1)
+	aofCmdLine = append(aofCmdLine, []byte("XADD"))
+	aofCmdLine = append(aofCmdLine, args[:idIndex]...)
+	aofCmdLine = append(aofCmdLine, []byte(id.String()))
+	aofCmdLine = append(aofCmdLine, fields...)
+	db.AddAof(aofCmdLine)
+
+	return reply.MakeBulkStringReply([]byte(id.String())), nil
+}
+
+// XRANGE key start end [COUNT count]
+func execXRange(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return xRange0(db, args, false)
+}
+
+// XREVRANGE key end start [COUNT count]
+func execXRevRange(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return xRange0(db, args, true)
+}
+
+func xRange0(db *engine.DB, args [][]byte, rev bool) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	startArg, endArg := string(args[1]), string(args[2])
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, err := stream.ParseRangeID(startArg, true)
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	end, err := stream.ParseRangeID(endArg, false)
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+
+	count := 0
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToUpper(string(args[3])) != "COUNT" {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		count, err = strconv.Atoi(string(args[4]))
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+		}
+		if count <= 0 {
+			return reply.MakeEmptyMultiBulkStringReply(), nil
+		}
+	}
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		return reply.MakeEmptyMultiBulkStringReply(), nil
+	}
+
+	return entriesToReply(s.Range(start, end, count, rev)), nil
+}
+
+// XLEN key
+func execXLen(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		return reply.MakeIntReply(0), nil
+	}
+
+	return reply.MakeIntReply(int64(s.Len())), nil
+}
+
+// XDEL key id [id ...]
+func execXDel(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	ids := make([]stream.ID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, err := stream.ParseID(string(arg), 0)
+		if err != nil {
+			return reply.MakeErrReply(err.Error()), nil
+		}
+		ids[i] = id
+	}
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		return reply.MakeIntReply(0), nil
+	}
+
+	var deleted int64 = 0
+	for _, id := range ids {
+		if s.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted == 0 {
+		return reply.MakeIntReply(0), nil
+	}
+
+	return reply.MakeIntReply(deleted), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func execXTrim(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	trim, next, errReply := parseStreamTrim(args, 1)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if next != len(args) {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		return reply.MakeIntReply(0), nil
+	}
+
+	removed := trim.apply(s)
+	if removed == 0 {
+		return reply.MakeIntReply(0), nil
+	}
+
+	return reply.MakeIntReply(int64(removed)), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func execXRead(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	opts, errReply := parseXReadArgs(args, false)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	results := make([]redis.Reply, 0, len(opts.keys))
+	ids := make([][]byte, len(opts.keys)) // $ 替换为具体 ID 之后的 ID，用于阻塞之后重新执行
+	for i, key := range opts.keys {
+		s, errReply := getAsStream(db, key)
+		if errReply != nil {
+			return errReply, nil
+		}
+
+		var id stream.ID
+		if opts.ids[i] == "$" {
+			if s != nil {
+				id = s.LastID()
+			}
+		} else {
+			var err error
+			id, err = stream.ParseID(opts.ids[i], 0)
+			if err != nil {
+				return reply.MakeErrReply(err.Error()), nil
+			}
+		}
+		ids[i] = []byte(id.String())
+
+		if s == nil {
+			continue
+		}
+		entries := s.After(id, opts.count)
+		if len(entries) > 0 {
+			results = append(results, reply.MakeMultiRawReply([]redis.Reply{
+				reply.MakeBulkStringReply([]byte(key)),
+				entriesToReply(entries),
+			}))
+		}
+	}
+
+	if len(results) > 0 {
+		return reply.MakeMultiRawReply(results), nil
+	}
+	if opts.block {
+		// 没有新消息，阻塞等待
+		blocked := engine.MakeBlockedReply(opts.keys, opts.timeout)
+		blocked.CmdLine = make([][]byte, 0, len(args)+1)
+		blocked.CmdLine = append(blocked.CmdLine, []byte("XREAD"))
+		blocked.CmdLine = append(blocked.CmdLine, args[:opts.keysIndex+len(opts.keys)]...)
+		blocked.CmdLine = append(blocked.CmdLine, ids...)
+		return blocked, nil
+	}
+
+	return reply.MakeNullBulkStringReply(), nil
+}
+
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func execXReadGroup(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	opts, errReply := parseXReadArgs(args, true)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	// 先检查所有的消费者组是否存在，防止读取到一半出错
+	groups := make([]*stream.Group, len(opts.keys))
+	streams := make([]*stream.Stream, len(opts.keys))
+	for i, key := range opts.keys {
+		s, errReply := getAsStream(db, key)
+		if errReply != nil {
+			return errReply, nil
+		}
+		var group *stream.Group
+		ok := false
+		if s != nil {
+			group, ok = s.GetGroup(opts.group)
+		}
+		if !ok {
+			return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + opts.group + "' in XREADGROUP with GROUP option"), nil
+		}
+		if opts.ids[i] != ">" {
+			if _, err := stream.ParseID(opts.ids[i], 0); err != nil {
+				return reply.MakeErrReply(err.Error()), nil
+			}
+		}
+		streams[i] = s
+		groups[i] = group
+	}
+
+	now := time.Now()
+	results := make([]redis.Reply, 0, len(opts.keys))
+	blockable := true
+	for i, key := range opts.keys {
+		s, group := streams[i], groups[i]
+		if _, created := group.CreateConsumer(opts.consumer); created {
+			db.AddAof(utils.StringsToCmdLine("XGROUP", "CREATECONSUMER", key, group.Name, opts.consumer))
+		}
+
+		if opts.ids[i] == ">" {
+			// 读取从未投递给组内消费者的新消息
+			entries := s.After(group.LastID, opts.count)
+			for _, entry := range entries {
+				group.LastID = entry.ID
+				if !opts.noAck {
+					pe := group.Deliver(entry.ID, opts.consumer, now)
+					db.AddAof(claimToCmdLine(key, group, pe))
+				}
+			}
+			if opts.noAck && len(entries) > 0 {
+				db.AddAof(utils.StringsToCmdLine("XGROUP", "SETID", key, group.Name, group.LastID.String()))
+			}
+			if len(entries) > 0 {
+				results = append(results, reply.MakeMultiRawReply([]redis.Reply{
+					reply.MakeBulkStringReply([]byte(key)),
+					entriesToReply(entries),
+				}))
+			}
+			continue
+		}
+
+		// 读取消费者未确认的历史消息，不会阻塞
+		blockable = false
+		id, _ := stream.ParseID(opts.ids[i], 0)
+		entryReplies := make([]redis.Reply, 0)
+		if start, ok := id.Next(); ok {
+			for _, pe := range group.Pending(start, stream.MaxID, opts.count, opts.consumer) {
+				entry, exists := s.Get(pe.ID)
+				if !exists {
+					// 消息已经被删除
+					entryReplies = append(entryReplies, reply.MakeMultiRawReply([]redis.Reply{
+						reply.MakeBulkStringReply([]byte(pe.ID.String())),
+						reply.MakeNullBulkStringReply(),
+					}))
+					continue
+				}
+				group.Claim(pe, opts.consumer, now, true)
+				db.AddAof(claimToCmdLine(key, group, pe))
+				entryReplies = append(entryReplies, entryToReply(entry))
+			}
+		}
+		results = append(results, reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkStringReply([]byte(key)),
+			reply.MakeMultiRawReply(entryReplies),
+		}))
+	}
+
+	if len(results) > 0 {
+		return reply.MakeMultiRawReply(results), nil
+	}
+	if opts.block && blockable {
+		// 没有新消息，阻塞等待
+		return engine.MakeBlockedReply(opts.keys, opts.timeout), nil
+	}
+
+	return reply.MakeNullBulkStringReply(), nil
+}
+
+// XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key group ...
+func execXGroup(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	subCommand := strings.ToUpper(string(args[0]))
+	if len(args) < 3 {
+		return reply.MakeArgNumErrReply("xgroup " + strings.ToLower(subCommand)), nil
+	}
+	key := string(args[1])
+	groupName := string(args[2])
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	if subCommand == "CREATE" {
+		// XGROUP CREATE key group id|$ [MKSTREAM]
+		if len(args) != 4 && len(args) != 5 {
+			return reply.MakeArgNumErrReply("xgroup create"), nil
+		}
+		mkStream := false
+		if len(args) == 5 {
+			if strings.ToUpper(string(args[4])) != "MKSTREAM" {
+				return reply.MakeSyntaxErrReply(), nil
+			}
+			mkStream = true
+		}
+		if s == nil && !mkStream {
+			return reply.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."), nil
+		}
+		inited := false
+		if s == nil {
+			s = stream.MakeStream()
+			inited = true
+		}
+		id, errReply := parseGroupID(s, string(args[3]))
+		if errReply != nil {
+			return errReply, nil
+		}
+		if _, ok := s.CreateGroup(groupName, id); !ok {
+			return reply.MakeErrReply("BUSYGROUP Consumer Group name already exists"), nil
+		}
+		if inited {
+			db.PutEntity(key, &database.DataEntity{
+				Data: s,
+			})
+		}
+
+		aofCmdLine := utils.StringsToCmdLine("XGROUP", "CREATE", key, groupName, id.String())
+		if mkStream {
+			aofCmdLine = append(aofCmdLine, []byte("MKSTREAM"))
+		}
+		db.AddAof(aofCmdLine)
+		return reply.MakeOkReply(), nil
+	}
+
+	if s == nil {
+		return reply.MakeErrReply("ERR The XGROUP subcommand requires the key to exist"), nil
+	}
+
+	switch subCommand {
+	case "SETID":
+		// XGROUP SETID key group id|$
+		if len(args) != 4 {
+			return reply.MakeArgNumErrReply("xgroup setid"), nil
+		}
+		group, ok := s.GetGroup(groupName)
+		if !ok {
+			return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + groupName + "'"), nil
+		}
+		id, errReply := parseGroupID(s, string(args[3]))
+		if errReply != nil {
+			return errReply, nil
+		}
+		group.LastID = id
+		db.AddAof(utils.StringsToCmdLine("XGROUP", "SETID", key, groupName, id.String()))
+		return reply.MakeOkReply(), nil
+	case "DESTROY":
+		// XGROUP DESTROY key group
+		if len(args) != 3 {
+			return reply.MakeArgNumErrReply("xgroup destroy"), nil
+		}
+		if !s.DestroyGroup(groupName) {
+			return reply.MakeIntReply(0), nil
+		}
+		return reply.MakeIntReply(1), &engine.AofExpireCtx{NeedAof: true}
+	case "CREATECONSUMER", "DELCONSUMER":
+		// XGROUP CREATECONSUMER|DELCONSUMER key group consumer
+		if len(args) != 4 {
+			return reply.MakeArgNumErrReply("xgroup " + strings.ToLower(subCommand)), nil
+		}
+		group, ok := s.GetGroup(groupName)
+		if !ok {
+			return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + groupName + "'"), nil
+		}
+		consumer := string(args[3])
+		if subCommand == "CREATECONSUMER" {
+			if _, created := group.CreateConsumer(consumer); !created {
+				return reply.MakeIntReply(0), nil
+			}
+			return reply.MakeIntReply(1), &engine.AofExpireCtx{NeedAof: true}
+		}
+		pending, ok := group.DeleteConsumer(consumer)
+		if !ok {
+			return reply.MakeIntReply(0), nil
+		}
+		return reply.MakeIntReply(int64(pending)), &engine.AofExpireCtx{NeedAof: true}
+	}
+
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'"), nil
+}
+
+// XACK key group id [id ...]
+func execXAck(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	groupName := string(args[1])
+	ids := make([]stream.ID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, err := stream.ParseID(string(arg), 0)
+		if err != nil {
+			return reply.MakeErrReply(err.Error()), nil
+		}
+		ids[i] = id
+	}
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		return reply.MakeIntReply(0), nil
+	}
+	group, ok := s.GetGroup(groupName)
+	if !ok {
+		return reply.MakeIntReply(0), nil
+	}
+
+	var acked int64 = 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	if acked == 0 {
+		return reply.MakeIntReply(0), nil
+	}
+
+	return reply.MakeIntReply(acked), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func execXPending(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	groupName := string(args[1])
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	var group *stream.Group
+	ok := false
+	if s != nil {
+		group, ok = s.GetGroup(groupName)
+	}
+	if !ok {
+		return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + groupName + "'"), nil
+	}
+
+	if len(args) == 2 {
+		// 概要形式：未确认消息的数量、最小 ID、最大 ID 以及每个消费者未确认的数量
+		pending := group.Pending(stream.MinID, stream.MaxID, 0, "")
+		if len(pending) == 0 {
+			return reply.MakeMultiRawReply([]redis.Reply{
+				reply.MakeIntReply(0),
+				reply.MakeNullBulkStringReply(),
+				reply.MakeNullBulkStringReply(),
+				reply.MakeNullBulkStringReply(),
+			}), nil
+		}
+		consumers := make([]redis.Reply, 0)
+		for _, consumer := range group.Consumers() {
+			if consumer.PendingLen() == 0 {
+				continue
+			}
+			consumers = append(consumers, reply.MakeMultiBulkStringReply([][]byte{
+				[]byte(consumer.Name),
+				[]byte(strconv.Itoa(consumer.PendingLen())),
+			}))
+		}
+		return reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeIntReply(int64(len(pending))),
+			reply.MakeBulkStringReply([]byte(pending[0].ID.String())),
+			reply.MakeBulkStringReply([]byte(pending[len(pending)-1].ID.String())),
+			reply.MakeMultiRawReply(consumers),
+		}), nil
+	}
+
+	// 扩展形式
+	rest := args[2:]
+	var minIdle time.Duration
+	if strings.ToUpper(string(rest[0])) == "IDLE" {
+		if len(rest) < 2 {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		ms, err := strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+		}
+		minIdle = time.Duration(ms) * time.Millisecond
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+	start, err := stream.ParseRangeID(string(rest[0]), true)
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	end, err := stream.ParseRangeID(string(rest[1]), false)
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	count, err := strconv.Atoi(string(rest[2]))
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range"), nil
+	}
+	if count <= 0 {
+		return reply.MakeEmptyMultiBulkStringReply(), nil
+	}
+	consumer := ""
+	if len(rest) == 4 {
+		consumer = string(rest[3])
+	}
+
+	now := time.Now()
+	result := make([]redis.Reply, 0)
+	for _, pe := range group.Pending(start, end, 0, consumer) {
+		idle := now.Sub(pe.DeliveryTime)
+		if idle < minIdle {
+			continue
+		}
+		result = append(result, reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkStringReply([]byte(pe.ID.String())),
+			reply.MakeBulkStringReply([]byte(pe.Consumer)),
+			reply.MakeIntReply(idle.Milliseconds()),
+			reply.MakeIntReply(pe.DeliveryCount),
+		}))
+		if len(result) == count {
+			break
+		}
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func execXClaim(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	groupName := string(args[1])
+	consumer := string(args[2])
+	minIdleMs, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil || minIdleMs < 0 {
+		return reply.MakeErrReply("ERR Invalid min-idle-time argument for XCLAIM"), nil
+	}
+	minIdle := time.Duration(minIdleMs) * time.Millisecond
+
+	// 解析 ID，遇到第一个不是 ID 的参数时开始解析选项
+	i := 4
+	ids := make([]stream.ID, 0)
+	for ; i < len(args); i++ {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	now := time.Now()
+	deliveryTime := now
+	retryCount := int64(-1)
+	force, justID := false, false
+	var lastID *stream.ID
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch option {
+		case "FORCE":
+			force = true
+			continue
+		case "JUSTID":
+			justID = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+		value := string(args[i+1])
+		i++
+		switch option {
+		case "IDLE", "TIME", "RETRYCOUNT":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return reply.MakeErrReply("ERR Invalid " + option + " option argument for XCLAIM"), nil
+			}
+			if option == "IDLE" {
+				deliveryTime = now.Add(-time.Duration(n) * time.Millisecond)
+			} else if option == "TIME" {
+				deliveryTime = time.UnixMilli(n)
+			} else {
+				retryCount = n
+			}
+		case "LASTID":
+			id, err := stream.ParseID(value, 0)
+			if err != nil {
+				return reply.MakeErrReply(err.Error()), nil
+			}
+			lastID = &id
+		default:
+			return reply.MakeErrReply("ERR Unrecognized XCLAIM option '" + string(args[i-1]) + "'"), nil
+		}
+	}
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	var group *stream.Group
+	ok := false
+	if s != nil {
+		group, ok = s.GetGroup(groupName)
+	}
+	if !ok {
+		return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + groupName + "'"), nil
+	}
+
+	if lastID != nil && group.LastID.Less(*lastID) {
+		group.LastID = *lastID
+	}
+
+	result := make([]redis.Reply, 0, len(ids))
+	for _, id := range ids {
+		entry, exists := s.Get(id)
+		pe, pending := group.GetPending(id)
+		if !pending {
+			if !force || !exists {
+				continue
+			}
+			// FORCE 时为存在于 stream 中的消息创建 PEL
+			pe = group.Deliver(id, consumer, deliveryTime)
+			pe.DeliveryCount = 0
+		} else if !exists {
+			// 消息已经被删除，从 PEL 中移除
+			group.Ack(id)
+			db.AddAof(utils.StringsToCmdLine("XACK", key, groupName, id.String()))
+			continue
+		} else if minIdle > 0 && now.Sub(pe.DeliveryTime) < minIdle {
+			continue
+		}
+
+		group.Claim(pe, consumer, deliveryTime, !justID && retryCount < 0)
+		if retryCount >= 0 {
+			pe.DeliveryCount = retryCount
+		}
+		db.AddAof(claimToCmdLine(key, group, pe))
+
+		if justID {
+			result = append(result, reply.MakeBulkStringReply([]byte(id.String())))
+		} else {
+			result = append(result, entryToReply(entry))
+		}
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func execXAutoClaim(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	groupName := string(args[1])
+	consumer := string(args[2])
+	minIdleMs, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil || minIdleMs < 0 {
+		return reply.MakeErrReply("ERR Invalid min-idle-time argument for XAUTOCLAIM"), nil
+	}
+	minIdle := time.Duration(minIdleMs) * time.Millisecond
+	start, err := stream.ParseRangeID(string(args[4]), true)
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "JUSTID" {
+			justID = true
+		} else if option == "COUNT" && i+1 < len(args) {
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count <= 0 {
+				return reply.MakeErrReply("ERR COUNT must be > 0"), nil
+			}
+			i++
+		} else {
+			return reply.MakeSyntaxErrReply(), nil
+		}
+	}
+
+	s, errReply := getAsStream(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	var group *stream.Group
+	ok := false
+	if s != nil {
+		group, ok = s.GetGroup(groupName)
+	}
+	if !ok {
+		return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + groupName + "'"), nil
+	}
+
+	// 多取一条用于计算下一次扫描的起点
+	now := time.Now()
+	pending := group.Pending(start, stream.MaxID, count+1, "")
+	next := stream.MinID
+	if len(pending) > count {
+		next = pending[count].ID
+		pending = pending[:count]
+	}
+
+	claimed := make([]redis.Reply, 0, len(pending))
+	deleted := make([][]byte, 0)
+	for _, pe := range pending {
+		entry, exists := s.Get(pe.ID)
+		if !exists {
+			group.Ack(pe.ID)
+			db.AddAof(utils.StringsToCmdLine("XACK", key, groupName, pe.ID.String()))
+			deleted = append(deleted, []byte(pe.ID.String()))
+			continue
+		}
+		if now.Sub(pe.DeliveryTime) < minIdle {
+			continue
+		}
+
+		group.Claim(pe, consumer, now, !justID)
+		db.AddAof(claimToCmdLine(key, group, pe))
+		if justID {
+			claimed = append(claimed, reply.MakeBulkStringReply([]byte(pe.ID.String())))
+		} else {
+			claimed = append(claimed, entryToReply(entry))
+		}
+	}
+
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte(next.String())),
+		reply.MakeMultiRawReply(claimed),
+		reply.MakeMultiBulkStringReply(deleted),
+	}), nil
+}
+
+// XRESTORE key dump... 用于 AOF 重写，恢复整个 stream（包括消费者组）
+func execXRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	s, err := stream.Restore(copyArgs(args[1:]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: s,
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+func getAsStream(db *engine.DB, key string) (*stream.Stream, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return s, nil
+}
+
+// streamTrim XADD 与 XTRIM 中的裁剪选项，~ 近似裁剪时也进行精确裁剪
+type streamTrim struct {
+	byLen  bool
+	maxLen int
+	minID  stream.ID
+	limit  int
+}
+
+func (trim *streamTrim) apply(s *stream.Stream) int {
+	if trim.byLen {
+		return s.TrimByLen(trim.maxLen, trim.limit)
+	}
+	return s.TrimByMinID(trim.minID, trim.limit)
+}
+
+// parseStreamTrim 从 args[i] 开始解析 MAXLEN|MINID [=|~] threshold [LIMIT count]，返回下一个参数的下标
+func parseStreamTrim(args [][]byte, i int) (*streamTrim, int, reply.ErrorReply) {
+	trim := &streamTrim{
+		byLen: strings.ToUpper(string(args[i])) == "MAXLEN",
+	}
+	i++
+	approx := false
+	if i < len(args) && (string(args[i]) == "~" || string(args[i]) == "=") {
+		approx = string(args[i]) == "~"
+		i++
+	}
+	if i >= len(args) {
+		return nil, 0, reply.MakeSyntaxErrReply()
+	}
+	if trim.byLen {
+		maxLen, err := strconv.Atoi(string(args[i]))
+		if err != nil || maxLen < 0 {
+			return nil, 0, reply.MakeErrReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.maxLen = maxLen
+	} else {
+		minID, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			return nil, 0, reply.MakeErrReply(err.Error())
+		}
+		trim.minID = minID
+	}
+	i++
+
+	if i+1 < len(args) && strings.ToUpper(string(args[i])) == "LIMIT" {
+		if !approx {
+			return nil, 0, reply.MakeErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		limit, err := strconv.Atoi(string(args[i+1]))
+		if err != nil || limit < 0 {
+			return nil, 0, reply.MakeErrReply("ERR The LIMIT argument must be >= 0.")
+		}
+		trim.limit = limit
+		i += 2
+	}
+
+	return trim, i, nil
+}
+
+type xReadArgs struct {
+	group     string
+	consumer  string
+	count     int
+	block     bool
+	timeout   time.Duration
+	noAck     bool
+	keysIndex int // 第一个 key 在参数中的下标
+	keys      []string
+	ids       []string
+}
+
+// parseXReadArgs 解析 XREAD 与 XREADGROUP 的参数
+func parseXReadArgs(args [][]byte, withGroup bool) (*xReadArgs, reply.ErrorReply) {
+	opts := &xReadArgs{}
+	i := 0
+	if withGroup {
+		if len(args) < 3 || strings.ToUpper(string(args[0])) != "GROUP" {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		opts.group = string(args[1])
+		opts.consumer = string(args[2])
+		i = 3
+	}
+
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "STREAMS" {
+			break
+		}
+		if option == "NOACK" && withGroup {
+			opts.noAck = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		if option == "COUNT" {
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			opts.count = count
+		} else if option == "BLOCK" {
+			ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, reply.MakeErrReply("ERR timeout is negative")
+			}
+			opts.block = true
+			opts.timeout = time.Duration(ms) * time.Millisecond
+		} else {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		i++
+	}
+
+	rest := len(args) - i - 1
+	if i >= len(args) || rest <= 0 || rest%2 != 0 {
+		return nil, reply.MakeErrReply("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	opts.keysIndex = i + 1
+	n := rest / 2
+	opts.keys = make([]string, n)
+	opts.ids = make([]string, n)
+	for j := 0; j < n; j++ {
+		opts.keys[j] = string(args[opts.keysIndex+j])
+		opts.ids[j] = string(args[opts.keysIndex+n+j])
+		if withGroup && opts.ids[j] == "$" {
+			return nil, reply.MakeErrReply("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		}
+		if !withGroup && opts.ids[j] == ">" {
+			return nil, reply.MakeErrReply("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		}
+	}
+
+	return opts, nil
+}
+
+// parseGroupID 解析消费者组的 ID，$ 表示 stream 的最后一个 ID
+func parseGroupID(s *stream.Stream, rawID string) (stream.ID, reply.ErrorReply) {
+	if rawID == "$" {
+		return s.LastID(), nil
+	}
+	id, err := stream.ParseID(rawID, 0)
+	if err != nil {
+		return stream.ID{}, reply.MakeErrReply(err.Error())
+	}
+	return id, nil
+}
+
+// claimToCmdLine 将消息的投递状态转为确定性的 XCLAIM 命令，用于 AOF 持久化
+func claimToCmdLine(key string, group *stream.Group, pe *stream.PendingEntry) [][]byte {
+	return utils.StringsToCmdLine("XCLAIM", key, group.Name, pe.Consumer, "0", pe.ID.String(),
+		"TIME", strconv.FormatInt(pe.DeliveryTime.UnixMilli(), 10),
+		"RETRYCOUNT", strconv.FormatInt(pe.DeliveryCount, 10),
+		"FORCE", "JUSTID", "LASTID", group.LastID.String())
+}
+
+func entryToReply(entry *stream.Entry) redis.Reply {
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte(entry.ID.String())),
+		reply.MakeMultiBulkStringReply(entry.Fields),
+	})
+}
+
+func entriesToReply(entries []*stream.Entry) redis.Reply {
+	if len(entries) == 0 {
+		return reply.MakeEmptyMultiBulkStringReply()
+	}
+	replies := make([]redis.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = entryToReply(entry)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// copyArgs 复制参数，防止保存的数据引用命令的缓冲区
+func copyArgs(args [][]byte) [][]byte {
+	result := make([][]byte, len(args))
+	for i, arg := range args {
+		result[i] = make([]byte, len(arg))
+		copy(result[i], arg)
+	}
+	return result
+}
+
+func init() {
+	engine.RegisterCommand("XAdd", execXAdd, writeFirstKey, -5, engine.FlagWrite)
+	engine.RegisterCommand("XRange", execXRange, readFirstKey, -4, engine.FlagReadOnly)
+	engine.RegisterCommand("XRevRange", execXRevRange, readFirstKey, -4, engine.FlagReadOnly)
+	engine.RegisterCommand("XLen", execXLen, readFirstKey, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("XDel", execXDel, writeFirstKey, -3, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("XTrim", execXTrim, writeFirstKey, -4, engine.FlagWrite|engine.FlagAllowOOM)
+	engine.RegisterCommand("XRead", execXRead, prepareXRead, -4, engine.FlagReadOnly)
+	engine.RegisterCommand("XReadGroup", execXReadGroup, prepareXReadGroup, -7, engine.FlagWrite)
+	engine.RegisterCommand("XGroup", execXGroup, writeSecondKey, -2, engine.FlagWrite)
+	engine.RegisterCommand("XAck", execXAck, writeFirstKey, -4, engine.FlagWrite)
+	engine.RegisterCommand("XPending", execXPending, readFirstKey, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("XClaim", execXClaim, writeFirstKey, -6, engine.FlagWrite)
+	engine.RegisterCommand("XAutoClaim", execXAutoClaim, writeFirstKey, -6, engine.FlagWrite)
+	engine.RegisterCommand("XRestore", execXRestore, writeFirstKey, -5, engine.FlagWrite|engine.FlagInternal)
+}
@@ -21,9 +21,7 @@ func execSet(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
 	key := string(args[0])
 	value := args[1]
 
-	entity := &database.DataEntity{
-		Data: value,
-	}
+	entity := makeStringEntity(value)
 
 	db.PutEntity(key, entity)
 
@@ -38,9 +36,7 @@ func execSetNX(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx)
 	key := string(args[0])
 	value := args[1]
 
-	entity := &database.DataEntity{
-		Data: value,
-	}
+	entity := makeStringEntity(value)
 
 	result := db.PutIfAbsent(key, entity)
 
@@ -63,9 +59,7 @@ func execSetEX(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx)
 		}
 	}
 
-	entity := &database.DataEntity{
-		Data: value,
-	}
+	entity := makeStringEntity(value)
 
 	db.PutEntity(key, entity)
 	expireTime := time.Now().Add(time.Second * time.Duration(ttl))
@@ -87,9 +81,7 @@ func execPSetEX(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx
 		return &reply.SyntaxErrReply{}, nil
 	}
 
-	entity := &database.DataEntity{
-		Data: value,
-	}
+	entity := makeStringEntity(value)
 
 	db.PutEntity(key, entity)
 	expireTime := time.Now().Add(time.Millisecond * time.Duration(ttl))
@@ -212,11 +204,23 @@ func GetAsString(db *engine.DB, key string) ([]byte, reply.ErrorReply) {
 	if !ok {
 		return nil, nil
 	}
-	bytes, ok := entity.Data.([]byte)
-	if !ok {
-		return nil, &reply.WrongTypeErrReply{}
+	switch val := entity.Data.(type) {
+	case []byte:
+		return val, nil
+	case int64:
+		return []byte(strconv.FormatInt(val, 10)), nil
+	}
+	return nil, &reply.WrongTypeErrReply{}
+}
+
+// makeStringEntity 值是可以用 int64 表示的整数（没有前导 0、+ 号等）时使用 int 编码保存，否则保存原始的字节
+func makeStringEntity(value []byte) *database.DataEntity {
+	if len(value) <= 20 {
+		if v, err := strconv.ParseInt(string(value), 10, 64); err == nil && strconv.FormatInt(v, 10) == string(value) {
+			return &database.DataEntity{Data: v}
+		}
 	}
-	return bytes, nil
+	return &database.DataEntity{Data: value}
 }
 
 func doIncrBy(db *engine.DB, key string, by int64) (redis.Reply, *engine.AofExpireCtx) {
@@ -245,7 +249,7 @@ func doIncrBy(db *engine.DB, key string, by int64) (redis.Reply, *engine.AofExpi
 			}
 		}
 		db.PutEntity(key, &database.DataEntity{
-			Data: []byte(strconv.FormatInt(valueInt+by, 10)),
+			Data: valueInt + by,
 		})
 		return reply.MakeIntReply(valueInt + by), &engine.AofExpireCtx{
 			NeedAof:  true,
@@ -255,7 +259,7 @@ func doIncrBy(db *engine.DB, key string, by int64) (redis.Reply, *engine.AofExpi
 
 	// 数据不存在，设置为by
 	db.PutEntity(key, &database.DataEntity{
-		Data: []byte(strconv.FormatInt(by, 10)),
+		Data: by,
 	})
 	return reply.MakeIntReply(by), &engine.AofExpireCtx{
 		NeedAof:  true,
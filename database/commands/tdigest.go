@@ -0,0 +1,304 @@
+package commands
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/tdigest"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TDIGEST.CREATE key [COMPRESSION compression]
+func execTDigestCreate(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	compression := float64(tdigest.DefaultCompression)
+	if len(args) == 3 && strings.ToUpper(string(args[1])) == "COMPRESSION" {
+		var errReply redis.Reply
+		compression, errReply = parseCompression(args[2])
+		if errReply != nil {
+			return errReply, nil
+		}
+	} else if len(args) != 1 {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+
+	if _, exists := db.GetEntity(key); exists {
+		return reply.MakeErrReply("ERR T-Digest: key already exists"), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: tdigest.Make(compression),
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// TDIGEST.ADD key value [value ...]
+func execTDigestAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	values, errReply := parseTDigestValues(args[1:])
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	td, errReply := getAsTDigest(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	td.Add(values...)
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// TDIGEST.QUANTILE key quantile [quantile ...]
+func execTDigestQuantile(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	quantiles, errReply := parseTDigestValues(args[1:])
+	if errReply != nil {
+		return errReply, nil
+	}
+	for _, q := range quantiles {
+		if q < 0 || q > 1 {
+			return reply.MakeErrReply("ERR T-Digest: quantile should be in [0,1]"), nil
+		}
+	}
+
+	td, errReply := getAsTDigest(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([][]byte, len(quantiles))
+	for i, q := range quantiles {
+		result[i] = formatTDigestFloat(td.Quantile(q))
+	}
+
+	return reply.MakeMultiBulkStringReply(result), nil
+}
+
+// TDIGEST.CDF key value [value ...]
+func execTDigestCDF(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	values, errReply := parseTDigestValues(args[1:])
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	td, errReply := getAsTDigest(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([][]byte, len(values))
+	for i, v := range values {
+		result[i] = formatTDigestFloat(td.CDF(v))
+	}
+
+	return reply.MakeMultiBulkStringReply(result), nil
+}
+
+// TDIGEST.RANK key value [value ...]
+func execTDigestRank(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	values, errReply := parseTDigestValues(args[1:])
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	td, errReply := getAsTDigest(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	result := make([]redis.Reply, len(values))
+	for i, v := range values {
+		result[i] = reply.MakeIntReply(td.Rank(v))
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// TDIGEST.MIN key
+func execTDigestMin(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	td, errReply := getAsTDigest(db, string(args[0]))
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	return reply.MakeBulkStringReply(formatTDigestFloat(td.Min())), nil
+}
+
+// TDIGEST.MAX key
+func execTDigestMax(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	td, errReply := getAsTDigest(db, string(args[0]))
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	return reply.MakeBulkStringReply(formatTDigestFloat(td.Max())), nil
+}
+
+// TDIGEST.MERGE destination numKeys source [source ...] [COMPRESSION compression] [OVERRIDE]
+// destination 已经存在且没有指定 OVERRIDE 时，destination 原有的观测值也会参与合并
+func execTDigestMerge(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	destKey := string(args[0])
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys <= 0 || numKeys > len(args)-2 {
+		return reply.MakeErrReply("ERR T-Digest: invalid numkeys"), nil
+	}
+
+	var compression float64
+	override := false
+	for i := 2 + numKeys; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COMPRESSION":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply(), nil
+			}
+			var errReply redis.Reply
+			compression, errReply = parseCompression(args[i+1])
+			if errReply != nil {
+				return errReply, nil
+			}
+			i++
+		case "OVERRIDE":
+			override = true
+		default:
+			return reply.MakeSyntaxErrReply(), nil
+		}
+	}
+
+	sources := make([]*tdigest.TDigest, 0, numKeys+1)
+	for _, srcKey := range args[2 : 2+numKeys] {
+		src, errReply := getAsTDigest(db, string(srcKey))
+		if errReply != nil {
+			return errReply, nil
+		}
+		sources = append(sources, src)
+	}
+	if entity, exists := db.GetEntity(destKey); exists {
+		dest, ok := entity.Data.(*tdigest.TDigest)
+		if !ok {
+			return &reply.WrongTypeErrReply{}, nil
+		}
+		if !override {
+			sources = append(sources, dest)
+		}
+	}
+
+	// 没有指定压缩参数时使用所有参与合并的 t-digest 中最大的压缩参数
+	if compression == 0 {
+		for _, src := range sources {
+			compression = math.Max(compression, src.Compression())
+		}
+	}
+	merged := tdigest.Make(compression)
+	merged.Merge(sources...)
+	db.PutEntity(destKey, &database.DataEntity{
+		Data: merged,
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// TDIGEST.RESET key
+func execTDigestReset(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	td, errReply := getAsTDigest(db, string(args[0]))
+	if errReply != nil {
+		return errReply, nil
+	}
+	td.Reset()
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// TDIGEST.INFO key
+func execTDigestInfo(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	td, errReply := getAsTDigest(db, string(args[0]))
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte("Compression")), reply.MakeIntReply(int64(td.Compression())),
+		reply.MakeBulkStringReply([]byte("Merged nodes")), reply.MakeIntReply(int64(td.NumCentroids())),
+		reply.MakeBulkStringReply([]byte("Observations")), reply.MakeIntReply(int64(td.Observations())),
+	}), nil
+}
+
+// TDIGEST.RESTORE key dump 用于 AOF 重写，恢复整个 t-digest
+func execTDigestRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	td, err := tdigest.Restore(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: td,
+	})
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// getAsTDigest 获取 t-digest，key 不存在时返回错误
+func getAsTDigest(db *engine.DB, key string) (*tdigest.TDigest, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, reply.MakeErrReply("ERR T-Digest: key does not exist")
+	}
+	td, ok := entity.Data.(*tdigest.TDigest)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return td, nil
+}
+
+func parseCompression(arg []byte) (float64, redis.Reply) {
+	compression, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || compression <= 0 {
+		return 0, reply.MakeErrReply("ERR T-Digest: compression parameter needs to be a positive integer")
+	}
+	return float64(compression), nil
+}
+
+func parseTDigestValues(args [][]byte) ([]float64, redis.Reply) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		v, err := strconv.ParseFloat(string(arg), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, reply.MakeErrReply("ERR T-Digest: error parsing val parameter")
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// formatTDigestFloat 格式化浮点数，NaN 与无穷大的格式与 Redis 相同
+func formatTDigestFloat(v float64) []byte {
+	switch {
+	case math.IsNaN(v):
+		return []byte("nan")
+	case math.IsInf(v, 1):
+		return []byte("inf")
+	case math.IsInf(v, -1):
+		return []byte("-inf")
+	}
+	return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+func init() {
+	engine.RegisterCommand("TDigest.Create", execTDigestCreate, writeFirstKey, -2, engine.FlagWrite)
+	engine.RegisterCommand("TDigest.Add", execTDigestAdd, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("TDigest.Quantile", execTDigestQuantile, readFirstKey, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("TDigest.CDF", execTDigestCDF, readFirstKey, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("TDigest.Rank", execTDigestRank, readFirstKey, -3, engine.FlagReadOnly)
+	engine.RegisterCommand("TDigest.Min", execTDigestMin, readFirstKey, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("TDigest.Max", execTDigestMax, readFirstKey, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("TDigest.Merge", execTDigestMerge, prepareDestNumKeys, -4, engine.FlagWrite)
+	engine.RegisterCommand("TDigest.Reset", execTDigestReset, writeFirstKey, 2, engine.FlagWrite)
+	engine.RegisterCommand("TDigest.Info", execTDigestInfo, readFirstKey, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("TDigest.Restore", execTDigestRestore, writeFirstKey, 3, engine.FlagWrite|engine.FlagInternal)
+}
@@ -0,0 +1,734 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/timeseries"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/timewheel"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tsMinTrimInterval = time.Second // 保留期裁剪任务的最小、最大执行间隔
+	tsMaxTrimInterval = time.Minute
+)
+
+// resolveTSRuleDests 写入时间序列时 compaction 规则的目标 key 也会被写入，
+// 规则保存在源序列上，需要在源 key 加锁之后读取
+func resolveTSRuleDests(db *engine.DB, args [][]byte) []string {
+	return tsRuleDestsOf(db, string(args[0]))
+}
+
+// resolveTSMAddRuleDests 参数形如 key timestamp value [key timestamp value ...]
+func resolveTSMAddRuleDests(db *engine.DB, args [][]byte) []string {
+	var dests []string
+	for i := 0; i < len(args); i += 3 {
+		dests = append(dests, tsRuleDestsOf(db, string(args[i]))...)
+	}
+	return dests
+}
+
+func tsRuleDestsOf(db *engine.DB, srcKey string) []string {
+	s, _ := getAsSeries(db, srcKey)
+	if s == nil {
+		return nil
+	}
+	dests := make([]string, 0, len(s.Rules()))
+	for _, rule := range s.Rules() {
+		dests = append(dests, rule.DestKey)
+	}
+	return dests
+}
+
+// tsOptions TS.CREATE、TS.ADD、TS.INCRBY 中的公共选项
+type tsOptions struct {
+	retention int64
+	labels    []timeseries.Label
+	timestamp string // 仅用于 TS.INCRBY/TS.DECRBY
+}
+
+// parseTSOptions 解析 [RETENTION retention] [TIMESTAMP timestamp] [LABELS label value ...]，LABELS 必须是最后一个选项
+func parseTSOptions(args [][]byte, allowTimestamp bool) (*tsOptions, redis.Reply) {
+	opts := &tsOptions{timestamp: "*"}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "RETENTION" && i+1 < len(args):
+			retention, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || retention < 0 {
+				return nil, reply.MakeErrReply("ERR TSDB: invalid RETENTION value")
+			}
+			opts.retention = retention
+			i++
+		case option == "TIMESTAMP" && allowTimestamp && i+1 < len(args):
+			opts.timestamp = string(args[i+1])
+			i++
+		case option == "LABELS":
+			rest := args[i+1:]
+			if len(rest)%2 != 0 {
+				return nil, reply.MakeErrReply("ERR TSDB: invalid LABELS")
+			}
+			for j := 0; j < len(rest); j += 2 {
+				opts.labels = append(opts.labels, timeseries.Label{Name: string(rest[j]), Value: string(rest[j+1])})
+			}
+			return opts, nil
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// parseTSTimestamp 解析时间戳，* 表示当前时间
+func parseTSTimestamp(arg string) (int64, redis.Reply) {
+	if arg == "*" {
+		return time.Now().UnixMilli(), nil
+	}
+	timestamp, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || timestamp < 0 {
+		return 0, reply.MakeErrReply("ERR TSDB: invalid timestamp")
+	}
+	return timestamp, nil
+}
+
+func parseTSValue(arg []byte) (float64, redis.Reply) {
+	value, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(value) {
+		return 0, reply.MakeErrReply("ERR TSDB: invalid value")
+	}
+	return value, nil
+}
+
+// parseTSRangeBound 解析范围查询的边界，- 与 + 分别表示最小与最大的时间戳
+func parseTSRangeBound(arg []byte) (int64, redis.Reply) {
+	switch string(arg) {
+	case "-":
+		return 0, nil
+	case "+":
+		return math.MaxInt64, nil
+	}
+	timestamp, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR TSDB: invalid timestamp")
+	}
+	return timestamp, nil
+}
+
+// TS.CREATE key [RETENTION retention] [LABELS label value ...]
+func execTSCreate(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	opts, errReply := parseTSOptions(args[1:], false)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	if _, exists := db.GetEntity(key); exists {
+		return reply.MakeErrReply("ERR TSDB: key already exists"), nil
+	}
+	createSeries(db, key, opts)
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+func createSeries(db *engine.DB, key string, opts *tsOptions) *timeseries.Series {
+	s := timeseries.Make(opts.retention, opts.labels)
+	db.PutEntity(key, &database.DataEntity{
+		Data: s,
+	})
+	scheduleTSTrim(db, key, s)
+	return s
+}
+
+// scheduleTSTrim 使用时间轮定期删除超出保留期的样本，key 被删除或者覆盖之后停止
+func scheduleTSTrim(db *engine.DB, key string, s *timeseries.Series) {
+	if s.Retention() == 0 {
+		return
+	}
+	interval := time.Duration(s.Retention()) * time.Millisecond
+	if interval < tsMinTrimInterval {
+		interval = tsMinTrimInterval
+	} else if interval > tsMaxTrimInterval {
+		interval = tsMaxTrimInterval
+	}
+	timewheel.Delay(interval, fmt.Sprintf("ts-trim:%p", s), func() {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		defer db.RWUnLocks(keys, nil)
+		entity, exists := db.GetEntity(key)
+		if !exists || entity.Data != s {
+			return
+		}
+		s.Trim()
+		scheduleTSTrim(db, key, s)
+	})
+}
+
+// TS.ADD key timestamp value [RETENTION retention] [LABELS label value ...]
+func execTSAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	timestamp, errReply := parseTSTimestamp(string(args[1]))
+	if errReply != nil {
+		return errReply, nil
+	}
+	value, errReply := parseTSValue(args[2])
+	if errReply != nil {
+		return errReply, nil
+	}
+	opts, errReply := parseTSOptions(args[3:], false)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	s, errReply := getAsSeries(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		s = createSeries(db, key, opts)
+	}
+	if err := s.Add(timestamp, value); err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	applyCompactions(db, key, s.Compact(timestamp))
+
+	// * 表示的时间戳与执行时间相关，AOF 中需要记录实际的时间戳
+	aofCmdLine := make([][]byte, 0, len(args)+1)
+	aofCmdLine = append(aofCmdLine, []byte("TS.ADD"), args[0], []byte(strconv.FormatInt(timestamp, 10)))
+	aofCmdLine = append(aofCmdLine, args[2:]...)
+	db.AddAof(aofCmdLine)
+
+	return reply.MakeIntReply(timestamp), nil
+}
+
+// TS.MADD key timestamp value [key timestamp value ...]
+func execTSMAdd(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	if len(args)%3 != 0 {
+		return reply.MakeArgNumErrReply("ts.madd"), nil
+	}
+
+	result := make([]redis.Reply, 0, len(args)/3)
+	aofCmdLine := [][]byte{[]byte("TS.MADD")}
+	for i := 0; i < len(args); i += 3 {
+		key := string(args[i])
+		timestamp, errReply := parseTSTimestamp(string(args[i+1]))
+		if errReply != nil {
+			result = append(result, errReply)
+			continue
+		}
+		value, errReply := parseTSValue(args[i+2])
+		if errReply != nil {
+			result = append(result, errReply)
+			continue
+		}
+		s, errReply := getAsSeries(db, key)
+		if errReply != nil {
+			result = append(result, errReply)
+			continue
+		}
+		if s == nil {
+			result = append(result, reply.MakeErrReply("ERR TSDB: the key does not exist"))
+			continue
+		}
+		if err := s.Add(timestamp, value); err != nil {
+			result = append(result, reply.MakeErrReply(err.Error()))
+			continue
+		}
+		applyCompactions(db, key, s.Compact(timestamp))
+		result = append(result, reply.MakeIntReply(timestamp))
+		aofCmdLine = append(aofCmdLine, args[i], []byte(strconv.FormatInt(timestamp, 10)), args[i+2])
+	}
+
+	if len(aofCmdLine) > 1 {
+		db.AddAof(aofCmdLine)
+	}
+	return reply.MakeMultiRawReply(result), nil
+}
+
+// TS.INCRBY key value [TIMESTAMP timestamp] [RETENTION retention] [LABELS label value ...]
+func execTSIncrBy(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return tsIncrBy(db, args, "TS.INCRBY", 1)
+}
+
+// TS.DECRBY key value [TIMESTAMP timestamp] [RETENTION retention] [LABELS label value ...]
+func execTSDecrBy(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return tsIncrBy(db, args, "TS.DECRBY", -1)
+}
+
+func tsIncrBy(db *engine.DB, args [][]byte, cmdName string, sign float64) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	delta, errReply := parseTSValue(args[1])
+	if errReply != nil {
+		return errReply, nil
+	}
+	opts, errReply := parseTSOptions(args[2:], true)
+	if errReply != nil {
+		return errReply, nil
+	}
+	timestamp, errReply := parseTSTimestamp(opts.timestamp)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	s, errReply := getAsSeries(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	value := sign * delta
+	if s != nil {
+		if last, ok := s.Last(); ok {
+			if timestamp < last.Timestamp {
+				return reply.MakeErrReply("ERR TSDB: timestamp must be equal to or higher than the maximum existing timestamp"), nil
+			}
+			value += last.Value
+		}
+	} else {
+		s = createSeries(db, key, opts)
+	}
+	if err := s.Upsert(timestamp, value); err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	applyCompactions(db, key, s.Compact(timestamp))
+
+	// AOF 中记录实际的时间戳
+	aofCmdLine := [][]byte{[]byte(cmdName), args[0], args[1], []byte("TIMESTAMP"), []byte(strconv.FormatInt(timestamp, 10))}
+	if opts.retention > 0 {
+		aofCmdLine = append(aofCmdLine, []byte("RETENTION"), []byte(strconv.FormatInt(opts.retention, 10)))
+	}
+	if len(opts.labels) > 0 {
+		aofCmdLine = append(aofCmdLine, []byte("LABELS"))
+		for _, l := range opts.labels {
+			aofCmdLine = append(aofCmdLine, []byte(l.Name), []byte(l.Value))
+		}
+	}
+	db.AddAof(aofCmdLine)
+
+	return reply.MakeIntReply(timestamp), nil
+}
+
+// applyCompactions 将 compaction 的结果写入目标序列，目标 key 已经在执行前加锁
+func applyCompactions(db *engine.DB, srcKey string, compactions []timeseries.Compaction) {
+	for _, c := range compactions {
+		dest, _ := getAsSeries(db, c.DestKey)
+		if dest == nil || dest.SrcKey() != srcKey {
+			// 目标序列已经被删除或者覆盖
+			continue
+		}
+		_ = dest.Upsert(c.Sample.Timestamp, c.Sample.Value)
+	}
+}
+
+// TS.GET key
+func execTSGet(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	s, errReply := getAsSeries(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		return reply.MakeErrReply("ERR TSDB: the key does not exist"), nil
+	}
+
+	last, ok := s.Last()
+	if !ok {
+		return reply.MakeEmptyMultiBulkStringReply(), nil
+	}
+	return sampleToReply(last), nil
+}
+
+// tsRangeArgs TS.RANGE、TS.MRANGE 中的查询参数
+type tsRangeArgs struct {
+	from, to       int64
+	count          int // 0 表示不限制
+	aggregation    timeseries.Aggregation
+	bucketDuration int64
+	withLabels     bool
+	filters        []tsFilter
+}
+
+// parseTSRangeArgs 解析 from to [WITHLABELS] [COUNT count] [AGGREGATION aggregator bucketDuration] [FILTER filter ...]
+func parseTSRangeArgs(args [][]byte, multi bool) (*tsRangeArgs, redis.Reply) {
+	rangeArgs := &tsRangeArgs{}
+	var errReply redis.Reply
+	if rangeArgs.from, errReply = parseTSRangeBound(args[0]); errReply != nil {
+		return nil, errReply
+	}
+	if rangeArgs.to, errReply = parseTSRangeBound(args[1]); errReply != nil {
+		return nil, errReply
+	}
+
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "WITHLABELS" && multi:
+			rangeArgs.withLabels = true
+		case option == "COUNT" && i+1 < len(args):
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || count <= 0 {
+				return nil, reply.MakeErrReply("ERR TSDB: invalid COUNT value")
+			}
+			rangeArgs.count = count
+			i++
+		case option == "AGGREGATION" && i+2 < len(args):
+			agg, ok := timeseries.ParseAggregation(string(args[i+1]))
+			if !ok {
+				return nil, reply.MakeErrReply("ERR TSDB: unknown aggregation type")
+			}
+			bucketDuration, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil || bucketDuration <= 0 {
+				return nil, reply.MakeErrReply("ERR TSDB: bucketDuration must be greater than zero")
+			}
+			rangeArgs.aggregation, rangeArgs.bucketDuration = agg, bucketDuration
+			i += 2
+		case option == "FILTER" && multi:
+			filters, errReply := parseTSFilters(args[i+1:])
+			if errReply != nil {
+				return nil, errReply
+			}
+			rangeArgs.filters = filters
+			return rangeArgs, nil
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	if multi {
+		// TS.MRANGE 必须指定 FILTER
+		return nil, reply.MakeSyntaxErrReply()
+	}
+	return rangeArgs, nil
+}
+
+// query 查询一个序列，reverse 为 true 时按照时间戳从大到小返回
+func (rangeArgs *tsRangeArgs) query(s *timeseries.Series, reverse bool) []timeseries.Sample {
+	samples := s.Range(rangeArgs.from, rangeArgs.to)
+	if rangeArgs.aggregation != "" {
+		samples = timeseries.Aggregate(samples, rangeArgs.aggregation, rangeArgs.bucketDuration)
+	}
+	if reverse {
+		for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+			samples[i], samples[j] = samples[j], samples[i]
+		}
+	}
+	if rangeArgs.count > 0 && len(samples) > rangeArgs.count {
+		samples = samples[:rangeArgs.count]
+	}
+	return samples
+}
+
+// TS.RANGE key from to [COUNT count] [AGGREGATION aggregator bucketDuration]
+func execTSRange(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return tsRange(db, args, false)
+}
+
+// TS.REVRANGE key from to [COUNT count] [AGGREGATION aggregator bucketDuration]
+func execTSRevRange(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return tsRange(db, args, true)
+}
+
+func tsRange(db *engine.DB, args [][]byte, reverse bool) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	rangeArgs, errReply := parseTSRangeArgs(args[1:], false)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	s, errReply := getAsSeries(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		return reply.MakeErrReply("ERR TSDB: the key does not exist"), nil
+	}
+
+	return samplesToReply(rangeArgs.query(s, reverse)), nil
+}
+
+// tsFilter 标签过滤条件 label=value 或 label!=value，value 为空表示标签不存在
+type tsFilter struct {
+	name  string
+	value string
+	equal bool
+}
+
+func parseTSFilters(args [][]byte) ([]tsFilter, redis.Reply) {
+	filters := make([]tsFilter, 0, len(args))
+	hasMatcher := false
+	for _, arg := range args {
+		expr := string(arg)
+		var f tsFilter
+		if i := strings.Index(expr, "!="); i > 0 {
+			f = tsFilter{name: expr[:i], value: expr[i+2:]}
+		} else if i := strings.Index(expr, "="); i > 0 {
+			f = tsFilter{name: expr[:i], value: expr[i+1:], equal: true}
+		} else {
+			return nil, reply.MakeErrReply("ERR TSDB: failed parsing labels")
+		}
+		if f.equal && f.value != "" {
+			hasMatcher = true
+		}
+		filters = append(filters, f)
+	}
+	if !hasMatcher {
+		return nil, reply.MakeErrReply("ERR TSDB: please provide at least one matcher")
+	}
+	return filters, nil
+}
+
+func (f tsFilter) match(s *timeseries.Series) bool {
+	value, ok := s.Label(f.name)
+	if f.value == "" {
+		// label= 表示标签不存在，label!= 表示标签存在
+		return ok != f.equal
+	}
+	return (ok && value == f.value) == f.equal
+}
+
+// TS.MRANGE from to [WITHLABELS] [COUNT count] [AGGREGATION aggregator bucketDuration] FILTER filter ...
+func execTSMRange(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return tsMRange(db, args, false)
+}
+
+// TS.MREVRANGE from to [WITHLABELS] [COUNT count] [AGGREGATION aggregator bucketDuration] FILTER filter ...
+func execTSMRevRange(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	return tsMRange(db, args, true)
+}
+
+// tsMRange 需要遍历整个数据库，先找出所有的时间序列，加读锁之后再按照标签过滤
+func tsMRange(db *engine.DB, args [][]byte, reverse bool) (redis.Reply, *engine.AofExpireCtx) {
+	rangeArgs, errReply := parseTSRangeArgs(args, true)
+	if errReply != nil {
+		return errReply, nil
+	}
+
+	keys := make([]string, 0)
+	db.ForEach(func(key string, entity *database.DataEntity, _ *time.Time) bool {
+		if _, ok := entity.Data.(*timeseries.Series); ok {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	sort.Strings(keys)
+	db.RWLocks(nil, keys)
+	defer db.RWUnLocks(nil, keys)
+
+	result := make([]redis.Reply, 0, len(keys))
+	for _, key := range keys {
+		s, _ := getAsSeries(db, key)
+		if s == nil || !matchTSFilters(s, rangeArgs.filters) {
+			continue
+		}
+		labels := make([]redis.Reply, 0)
+		if rangeArgs.withLabels {
+			for _, l := range s.Labels() {
+				labels = append(labels, reply.MakeMultiBulkStringReply([][]byte{[]byte(l.Name), []byte(l.Value)}))
+			}
+		}
+		result = append(result, reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkStringReply([]byte(key)),
+			reply.MakeMultiRawReply(labels),
+			samplesToReply(rangeArgs.query(s, reverse)),
+		}))
+	}
+
+	return reply.MakeMultiRawReply(result), nil
+}
+
+func matchTSFilters(s *timeseries.Series, filters []tsFilter) bool {
+	for _, f := range filters {
+		if !f.match(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// TS.CREATERULE sourceKey destKey AGGREGATION aggregator bucketDuration
+func execTSCreateRule(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	srcKey, destKey := string(args[0]), string(args[1])
+	if strings.ToUpper(string(args[2])) != "AGGREGATION" {
+		return reply.MakeSyntaxErrReply(), nil
+	}
+	agg, ok := timeseries.ParseAggregation(string(args[3]))
+	if !ok {
+		return reply.MakeErrReply("ERR TSDB: unknown aggregation type"), nil
+	}
+	bucketDuration, err := strconv.ParseInt(string(args[4]), 10, 64)
+	if err != nil || bucketDuration <= 0 {
+		return reply.MakeErrReply("ERR TSDB: bucketDuration must be greater than zero"), nil
+	}
+	if srcKey == destKey {
+		return reply.MakeErrReply("ERR TSDB: the source key and destination key should be different"), nil
+	}
+
+	src, dest, errReply := getTSRuleSeries(db, srcKey, destKey)
+	if errReply != nil {
+		return errReply, nil
+	}
+	// 不支持链式的 compaction，写入源序列时只需要对源序列和目标序列加锁
+	if src.SrcKey() != "" {
+		return reply.MakeErrReply("ERR TSDB: the source key is a compaction destination"), nil
+	}
+	if dest.SrcKey() != "" {
+		return reply.MakeErrReply("ERR TSDB: the destination key already has a src rule"), nil
+	}
+	if len(dest.Rules()) > 0 {
+		return reply.MakeErrReply("ERR TSDB: the destination key already has a dst rule"), nil
+	}
+
+	src.AddRule(destKey, agg, bucketDuration)
+	dest.SetSrcKey(srcKey)
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// TS.DELETERULE sourceKey destKey
+func execTSDeleteRule(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	srcKey, destKey := string(args[0]), string(args[1])
+	src, errReply := getAsSeries(db, srcKey)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if src == nil {
+		return reply.MakeErrReply("ERR TSDB: the key does not exist"), nil
+	}
+	if !src.DeleteRule(destKey) {
+		return reply.MakeErrReply("ERR TSDB: compaction rule does not exist"), nil
+	}
+	if dest, _ := getAsSeries(db, destKey); dest != nil && dest.SrcKey() == srcKey {
+		dest.SetSrcKey("")
+	}
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+func getTSRuleSeries(db *engine.DB, srcKey, destKey string) (*timeseries.Series, *timeseries.Series, redis.Reply) {
+	src, errReply := getAsSeries(db, srcKey)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	dest, errReply := getAsSeries(db, destKey)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if src == nil || dest == nil {
+		return nil, nil, reply.MakeErrReply("ERR TSDB: the key does not exist")
+	}
+	return src, dest, nil
+}
+
+// TS.INFO key
+func execTSInfo(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+	s, errReply := getAsSeries(db, key)
+	if errReply != nil {
+		return errReply, nil
+	}
+	if s == nil {
+		return reply.MakeErrReply("ERR TSDB: the key does not exist"), nil
+	}
+
+	var firstTimestamp, lastTimestamp int64
+	if first, ok := s.First(); ok {
+		firstTimestamp = first.Timestamp
+	}
+	if last, ok := s.Last(); ok {
+		lastTimestamp = last.Timestamp
+	}
+	labels := make([]redis.Reply, 0, len(s.Labels()))
+	for _, l := range s.Labels() {
+		labels = append(labels, reply.MakeMultiBulkStringReply([][]byte{[]byte(l.Name), []byte(l.Value)}))
+	}
+	var sourceKey redis.Reply = reply.MakeNullBulkStringReply()
+	if s.SrcKey() != "" {
+		sourceKey = reply.MakeBulkStringReply([]byte(s.SrcKey()))
+	}
+	rules := make([]redis.Reply, 0, len(s.Rules()))
+	for _, rule := range s.Rules() {
+		rules = append(rules, reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkStringReply([]byte(rule.DestKey)),
+			reply.MakeIntReply(rule.BucketDuration),
+			reply.MakeBulkStringReply([]byte(strings.ToUpper(string(rule.Aggregation)))),
+		}))
+	}
+
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkStringReply([]byte("totalSamples")), reply.MakeIntReply(int64(len(s.Range(0, math.MaxInt64)))),
+		reply.MakeBulkStringReply([]byte("firstTimestamp")), reply.MakeIntReply(firstTimestamp),
+		reply.MakeBulkStringReply([]byte("lastTimestamp")), reply.MakeIntReply(lastTimestamp),
+		reply.MakeBulkStringReply([]byte("retentionTime")), reply.MakeIntReply(s.Retention()),
+		reply.MakeBulkStringReply([]byte("labels")), reply.MakeMultiRawReply(labels),
+		reply.MakeBulkStringReply([]byte("sourceKey")), sourceKey,
+		reply.MakeBulkStringReply([]byte("rules")), reply.MakeMultiRawReply(rules),
+	}), nil
+}
+
+// TS.RESTORE key dump 用于 AOF 重写，恢复整个时间序列
+func execTSRestore(db *engine.DB, args [][]byte) (redis.Reply, *engine.AofExpireCtx) {
+	key := string(args[0])
+
+	s, err := timeseries.Restore(args[1])
+	if err != nil {
+		return reply.MakeErrReply(err.Error()), nil
+	}
+	db.PutEntity(key, &database.DataEntity{
+		Data: s,
+	})
+	scheduleTSTrim(db, key, s)
+
+	return reply.MakeOkReply(), &engine.AofExpireCtx{NeedAof: true}
+}
+
+// getAsSeries 获取时间序列，key 不存在时返回 nil
+func getAsSeries(db *engine.DB, key string) (*timeseries.Series, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*timeseries.Series)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return s, nil
+}
+
+func sampleToReply(sample timeseries.Sample) redis.Reply {
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeIntReply(sample.Timestamp),
+		reply.MakeBulkStringReply([]byte(strconv.FormatFloat(sample.Value, 'f', -1, 64))),
+	})
+}
+
+func samplesToReply(samples []timeseries.Sample) redis.Reply {
+	result := make([]redis.Reply, len(samples))
+	for i, sample := range samples {
+		result[i] = sampleToReply(sample)
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+func init() {
+	engine.RegisterCommand("TS.Create", execTSCreate, writeFirstKey, -2, engine.FlagWrite)
+	engine.RegisterCommand("TS.Add", execTSAdd, writeFirstKey, -4, engine.FlagWrite)
+	engine.RegisterCommand("TS.MAdd", execTSMAdd, prepareTSMAdd, -4, engine.FlagWrite)
+	engine.RegisterCommand("TS.IncrBy", execTSIncrBy, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterCommand("TS.DecrBy", execTSDecrBy, writeFirstKey, -3, engine.FlagWrite)
+	engine.RegisterKeyResolver("TS.Add", resolveTSRuleDests)
+	engine.RegisterKeyResolver("TS.MAdd", resolveTSMAddRuleDests)
+	engine.RegisterKeyResolver("TS.IncrBy", resolveTSRuleDests)
+	engine.RegisterKeyResolver("TS.DecrBy", resolveTSRuleDests)
+	engine.RegisterCommand("TS.Get", execTSGet, readFirstKey, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("TS.Range", execTSRange, readFirstKey, -4, engine.FlagReadOnly)
+	engine.RegisterCommand("TS.RevRange", execTSRevRange, readFirstKey, -4, engine.FlagReadOnly)
+	engine.RegisterCommand("TS.MRange", execTSMRange, nil, -5, engine.FlagReadOnly)
+	engine.RegisterCommand("TS.MRevRange", execTSMRevRange, nil, -5, engine.FlagReadOnly)
+	engine.RegisterCommand("TS.CreateRule", execTSCreateRule, writeFirstTwoKeys, 6, engine.FlagWrite)
+	engine.RegisterCommand("TS.DeleteRule", execTSDeleteRule, writeFirstTwoKeys, 3, engine.FlagWrite)
+	engine.RegisterCommand("TS.Info", execTSInfo, readFirstKey, 2, engine.FlagReadOnly)
+	engine.RegisterCommand("TS.Restore", execTSRestore, writeFirstKey, 3, engine.FlagWrite|engine.FlagInternal)
+}
@@ -1,5 +1,11 @@
 package commands
 
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"strconv"
+	"strings"
+)
+
 func readFirstKey(args [][]byte) ([]string, []string) {
 	// assert len(args) > 0
 	key := string(args[0])
@@ -28,3 +34,139 @@ func prepareSetCalculateStore(args [][]byte) ([]string, []string) {
 	}
 	return []string{dest}, keys
 }
+
+// writeNumKeys 参数形如 numkeys key [key ...] ...，所有的 key 都需要加写锁
+func writeNumKeys(args [][]byte) ([]string, []string) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 || numKeys > len(args)-1 {
+		return nil, nil
+	}
+	keys := make([]string, numKeys)
+	for i := 0; i < numKeys; i++ {
+		keys[i] = string(args[i+1])
+	}
+	return keys, nil
+}
+
+// writeAllKeysExceptLast 参数形如 key [key ...] timeout，除最后一个参数外都是需要加写锁的 key
+func writeAllKeysExceptLast(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args))
+	for i := 0; i < len(args)-1; i++ {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
+
+// readAllKeysExceptLast 参数形如 key [key ...] path，除最后一个参数外都是需要加读锁的 key
+func readAllKeysExceptLast(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args))
+	for i := 0; i < len(args)-1; i++ {
+		keys = append(keys, string(args[i]))
+	}
+	return nil, keys
+}
+
+// writeBZMPopKeys 参数形如 timeout numkeys key [key ...] ...
+func writeBZMPopKeys(args [][]byte) ([]string, []string) {
+	return writeNumKeys(args[1:])
+}
+
+// writeSecondKey 参数形如 subcommand key ...
+func writeSecondKey(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return []string{string(args[1])}, nil
+}
+
+// readSecondKey 参数形如 subcommand key ...
+func readSecondKey(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
+}
+
+// streamKeys 返回 XREAD/XREADGROUP 中 STREAMS 之后的 key
+func streamKeys(args [][]byte) []string {
+	for i, arg := range args {
+		if strings.ToUpper(string(arg)) != "STREAMS" {
+			continue
+		}
+		rest := args[i+1:]
+		if len(rest) == 0 || len(rest)%2 != 0 {
+			return nil
+		}
+		keys := make([]string, len(rest)/2)
+		for j := range keys {
+			keys[j] = string(rest[j])
+		}
+		return keys
+	}
+	return nil
+}
+
+func prepareXRead(args [][]byte) ([]string, []string) {
+	return nil, streamKeys(args)
+}
+
+func prepareXReadGroup(args [][]byte) ([]string, []string) {
+	return streamKeys(args), nil
+}
+
+// prepareGeoSearchStore 参数形如 destination source ...
+func prepareGeoSearchStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+// prepareDestNumKeys destination numKeys source [source ...] [options ...]，用于 CMS.MERGE、TDIGEST.MERGE
+func prepareDestNumKeys(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys < 0 || numKeys > len(args)-2 {
+		return []string{dest}, nil
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[2+i])
+	}
+	return []string{dest}, keys
+}
+
+// writeFirstTwoKeys 参数形如 key1 key2 ...，两个 key 都需要加写锁
+func writeFirstTwoKeys(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+// prepareTSMAdd 参数形如 key timestamp value [key timestamp value ...]
+func prepareTSMAdd(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)/3)
+	for i := 0; i < len(args); i += 3 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
+
+// prepareCAS 参数形如 key expected_version command [arg ...]，对执行的命令涉及的 key 加锁，key 本身需要加写锁
+func prepareCAS(args [][]byte) ([]string, []string) {
+	key := string(args[0])
+	write, read := engine.GetWriteReadKeys(args[2:])
+	if !containsString(write, key) {
+		write = append(write, key)
+	}
+	return write, read
+}
+
+// resolveCAS 执行的命令需要在加锁之后确定的写入 key
+func resolveCAS(db *engine.DB, args [][]byte) []string {
+	return db.ResolveKeys(args[2:])
+}
+
+// writeKeyVersionPairs 参数形如 key version [key version ...]
+func writeKeyVersionPairs(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
@@ -0,0 +1,316 @@
+package engine_test
+
+import (
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/datastruct/semaphore"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/connection"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	_ "github.com/dawnzzz/simple-redis/database/commands"
+)
+
+// 通过注册的命令测试数据库的行为
+
+func execCmd(db *engine.DB, c redis.Connection, args ...string) redis.Reply {
+	return db.Exec(c, utils.StringsToCmdLine(args...))
+}
+
+// waitFor 等待 cond 成立，超时时测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+	}
+}
+
+// replyWithin 等待阻塞命令返回
+func replyWithin(t *testing.T, ch <-chan redis.Reply, timeout time.Duration) redis.Reply {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(timeout):
+		t.Fatal("blocked command did not return")
+	}
+	return nil
+}
+
+func semaphoreWaiting(db *engine.DB, key string) int {
+	db.RWLocks(nil, []string{key})
+	defer db.RWUnLocks(nil, []string{key})
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return 0
+	}
+	return entity.Data.(*semaphore.Semaphore).Waiting()
+}
+
+// 排在队首的等待者断开连接之后离开等待队列，不再阻挡排在后面的等待者
+func TestLockWaiterDisconnect(t *testing.T) {
+	db := engine.MakeDB()
+	if r := execCmd(db, connection.NewFakeConn(), "LOCK.ACQUIRE", "lock", "a", "60000"); string(r.ToBytes()) != ":1\r\n" {
+		t.Fatalf("acquire: %q", r.ToBytes())
+	}
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	head := connection.NewConn(local)
+	headDone := make(chan redis.Reply, 1)
+	go func() {
+		headDone <- execCmd(db, head, "LOCK.ACQUIRE", "lock", "b", "60000", "WAIT", "60000")
+	}()
+	waitFor(t, "b queued", func() bool { return semaphoreWaiting(db, "lock") == 1 })
+
+	nextDone := make(chan redis.Reply, 1)
+	go func() {
+		nextDone <- execCmd(db, connection.NewFakeConn(), "LOCK.ACQUIRE", "lock", "c", "60000", "WAIT", "60000")
+	}()
+	waitFor(t, "c queued", func() bool { return semaphoreWaiting(db, "lock") == 2 })
+
+	head.Disconnect()
+	if r := replyWithin(t, headDone, time.Second); string(r.ToBytes()) != "$-1\r\n" {
+		t.Errorf("disconnected waiter: %q", r.ToBytes())
+	}
+	if n := semaphoreWaiting(db, "lock"); n != 1 {
+		t.Errorf("waiting after disconnect: %d", n)
+	}
+
+	execCmd(db, connection.NewFakeConn(), "LOCK.RELEASE", "lock", "a")
+	if r := replyWithin(t, nextDone, time.Second); string(r.ToBytes()) != ":2\r\n" {
+		t.Errorf("next waiter: %q", r.ToBytes())
+	}
+}
+
+// 超时的等待者同样离开等待队列
+func TestLockWaiterTimeout(t *testing.T) {
+	db := engine.MakeDB()
+	execCmd(db, connection.NewFakeConn(), "SEM.ACQUIRE", "sem", "a", "1", "60000")
+	// 等待的时间比阻塞的时间长时，只有阻塞超时才能让等待者离开队列
+	if r := execCmd(db, connection.NewFakeConn(), "SEM.ACQUIRE", "sem", "b", "1", "60000", "WAIT", "20"); string(r.ToBytes()) != "$-1\r\n" {
+		t.Fatalf("timeout: %q", r.ToBytes())
+	}
+	if n := semaphoreWaiting(db, "sem"); n != 0 {
+		t.Errorf("waiting after timeout: %d", n)
+	}
+}
+
+// expectReplies 依次执行命令，检查每个命令的回复
+func expectReplies(t *testing.T, db *engine.DB, cases [][2]interface{}) {
+	t.Helper()
+	c := connection.NewFakeConn()
+	for _, tc := range cases {
+		args, expected := tc[0].([]string), tc[1].(string)
+		if r := execCmd(db, c, args...); string(r.ToBytes()) != expected {
+			t.Errorf("%v: %q, expected %q", args, r.ToBytes(), expected)
+		}
+	}
+}
+
+func TestSetIfVersion(t *testing.T) {
+	db := engine.MakeDB()
+	expectReplies(t, db, [][2]interface{}{
+		// 不存在的 key 版本号为 0
+		{[]string{"SETIFVERSION", "k", "1", "v"}, "$-1\r\n"},
+		{[]string{"SETIFVERSION", "k", "0", "v"}, ":1\r\n"},
+		{[]string{"SETIFVERSION", "k", "0", "v2"}, "$-1\r\n"},
+		{[]string{"GET", "k"}, "$1\r\nv\r\n"},
+		{[]string{"SET", "k", "v2"}, "+OK\r\n"},
+		{[]string{"SETIFVERSION", "k", "1", "v3"}, "$-1\r\n"},
+		{[]string{"SETIFVERSION", "k", "2", "v3"}, ":3\r\n"},
+		{[]string{"KEYVERSION", "k"}, ":3\r\n"},
+		{[]string{"GET", "k"}, "$2\r\nv3\r\n"},
+		{[]string{"SETIFVERSION", "k", "x", "v"}, "-ERR version is not an integer or out of range\r\n"},
+		// 保留原来的过期时间
+		{[]string{"SETEX", "ttl", "100", "v"}, "+OK\r\n"},
+		{[]string{"SETIFVERSION", "ttl", "1", "w"}, ":2\r\n"},
+	})
+	if _, ok := db.TTLMap().Get("ttl"); !ok {
+		t.Error("ttl lost after SETIFVERSION")
+	}
+}
+
+func TestDelIfVersion(t *testing.T) {
+	db := engine.MakeDB()
+	expectReplies(t, db, [][2]interface{}{
+		// key 不存在时不增加版本号
+		{[]string{"DELIFVERSION", "k", "0"}, ":0\r\n"},
+		{[]string{"DELIFVERSION", "k", "1"}, "$-1\r\n"},
+		{[]string{"SET", "k", "v"}, "+OK\r\n"},
+		{[]string{"DELIFVERSION", "k", "0"}, "$-1\r\n"},
+		{[]string{"EXIST", "k"}, ":1\r\n"},
+		{[]string{"DELIFVERSION", "k", "1"}, ":2\r\n"},
+		{[]string{"EXIST", "k"}, ":0\r\n"},
+		{[]string{"KEYVERSION", "k"}, ":2\r\n"},
+	})
+}
+
+func TestCAS(t *testing.T) {
+	db := engine.MakeDB()
+	expectReplies(t, db, [][2]interface{}{
+		{[]string{"CAS", "k", "0", "SET", "k", "v"}, ":1\r\n"},
+		{[]string{"CAS", "k", "0", "SET", "k", "v2"}, "$-1\r\n"},
+		{[]string{"GET", "k"}, "$1\r\nv\r\n"},
+		{[]string{"CAS", "k", "1", "APPEND", "k", "2"}, ":2\r\n"},
+		{[]string{"GET", "k"}, "$2\r\nv2\r\n"},
+		// 命令执行失败时不增加版本号
+		{[]string{"CAS", "k", "2", "LPUSH", "k", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"KEYVERSION", "k"}, ":2\r\n"},
+		{[]string{"CAS", "k", "2", "GET", "k"}, "-ERR CAS only supports write commands\r\n"},
+		{[]string{"CAS", "k", "2", "SETIFVERSION", "k", "2", "v"}, "-ERR CAS does not support conditional commands\r\n"},
+		{[]string{"CAS", "k", "2", "SET", "other", "v"}, "-ERR command 'SET' does not write key 'k'\r\n"},
+		{[]string{"EXIST", "other"}, ":0\r\n"},
+		{[]string{"CAS", "k", "2", "DEL", "k"}, ":3\r\n"},
+	})
+}
+
+func TestWaitKey(t *testing.T) {
+	db := engine.MakeDB()
+	c := connection.NewFakeConn()
+	execCmd(db, c, "SET", "k", "v")
+	// 版本号已经变化时立即返回
+	if r := execCmd(db, c, "WAITKEY", "k", "0", "0"); string(r.ToBytes()) != ":1\r\n" {
+		t.Errorf("changed: %q", r.ToBytes())
+	}
+
+	done := make(chan redis.Reply, 1)
+	go func() {
+		done <- execCmd(db, connection.NewFakeConn(), "WAITKEY", "k", "1", "10")
+	}()
+	select {
+	case r := <-done:
+		t.Fatalf("returned before change: %q", r.ToBytes())
+	case <-time.After(50 * time.Millisecond):
+	}
+	execCmd(db, c, "SET", "k", "v2")
+	if r := replyWithin(t, done, time.Second); string(r.ToBytes()) != ":2\r\n" {
+		t.Errorf("woken: %q", r.ToBytes())
+	}
+
+	// 不存在的 key 被写入时同样唤醒
+	go func() {
+		done <- execCmd(db, connection.NewFakeConn(), "WAITKEY", "missing", "0", "10")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	execCmd(db, c, "SET", "missing", "v")
+	if r := replyWithin(t, done, time.Second); string(r.ToBytes()) != ":1\r\n" {
+		t.Errorf("woken by create: %q", r.ToBytes())
+	}
+}
+
+func TestWaitKeyTimeout(t *testing.T) {
+	db := engine.MakeDB()
+	start := time.Now()
+	if r := execCmd(db, connection.NewFakeConn(), "WAITKEY", "k", "0", "0.05"); string(r.ToBytes()) != "$-1\r\n" {
+		t.Errorf("timeout: %q", r.ToBytes())
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("returned after %v", elapsed)
+	}
+	if r := execCmd(db, connection.NewFakeConn(), "WAITKEY", "k", "0", "-1"); string(r.ToBytes()) != "-ERR timeout is negative\r\n" {
+		t.Errorf("negative timeout: %q", r.ToBytes())
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	db := engine.MakeDB()
+	c := connection.NewFakeConn()
+	execCmd(db, c, "SET", "small", "v")
+	execCmd(db, c, "SET", "large", string(make([]byte, 1024)))
+	small := execCmd(db, c, "MEMORY", "USAGE", "small").(*reply.IntReply).Code
+	large := execCmd(db, c, "MEMORY", "USAGE", "large").(*reply.IntReply).Code
+	if small <= 0 || large < small+1023 {
+		t.Errorf("usage: small %d, large %d", small, large)
+	}
+
+	// 集合类型按照采样的元素估算，SAMPLES 0 计算全部元素
+	for i := 0; i < 1000; i++ {
+		execCmd(db, c, "RPUSH", "list", strconv.Itoa(i))
+	}
+	execCmd(db, c, "RPUSH", "list", string(make([]byte, 100000)))
+	sampled := execCmd(db, c, "MEMORY", "USAGE", "list").(*reply.IntReply).Code
+	full := execCmd(db, c, "MEMORY", "USAGE", "list", "SAMPLES", "0").(*reply.IntReply).Code
+	if sampled <= 0 || full < sampled+100000-1000 {
+		t.Errorf("usage: sampled %d, full %d", sampled, full)
+	}
+
+	expectReplies(t, db, [][2]interface{}{
+		{[]string{"MEMORY", "USAGE", "missing"}, "$-1\r\n"},
+		{[]string{"MEMORY", "USAGE", "small", "SAMPLES", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+		{[]string{"MEMORY", "USAGE", "small", "COUNT", "1"}, "-Err syntax error\r\n"},
+		{[]string{"MEMORY", "DOCTOR"}, "-ERR unknown subcommand 'DOCTOR'\r\n"},
+	})
+}
+
+func TestObject(t *testing.T) {
+	db := engine.MakeDB()
+	c := connection.NewFakeConn()
+	execCmd(db, c, "SET", "int", "123")
+	execCmd(db, c, "SET", "raw", "hello")
+	execCmd(db, c, "RPUSH", "list", "a")
+	execCmd(db, c, "ZADD", "zset", "1", "a")
+	expectReplies(t, db, [][2]interface{}{
+		{[]string{"OBJECT", "ENCODING", "int"}, "$3\r\nint\r\n"},
+		{[]string{"OBJECT", "ENCODING", "raw"}, "$3\r\nraw\r\n"},
+		{[]string{"OBJECT", "ENCODING", "list"}, "$9\r\nquicklist\r\n"},
+		// 元素较少的有序集合使用 listpack
+		{[]string{"OBJECT", "ENCODING", "zset"}, "$8\r\nlistpack\r\n"},
+		{[]string{"OBJECT", "ENCODING", "missing"}, "$-1\r\n"},
+		{[]string{"OBJECT", "IDLETIME", "raw"}, ":0\r\n"},
+		{[]string{"OBJECT", "REFCOUNT", "raw"}, ":1\r\n"},
+		{[]string{"OBJECT", "FREQ", "raw", "x"}, "-ERR wrong number of arguments for 'object freq' command\r\n"},
+		{[]string{"OBJECT", "HELP2", "raw"}, "-ERR unknown subcommand 'HELP2'\r\n"},
+	})
+
+	// OBJECT 不会更新访问计数器，读写命令会增加访问计数器
+	initial := execCmd(db, c, "OBJECT", "FREQ", "raw").(*reply.IntReply).Code
+	for i := 0; i < 100; i++ {
+		execCmd(db, c, "OBJECT", "FREQ", "raw")
+	}
+	if freq := execCmd(db, c, "OBJECT", "FREQ", "raw").(*reply.IntReply).Code; freq != initial {
+		t.Errorf("freq after OBJECT: %d, expected %d", freq, initial)
+	}
+	for i := 0; i < 100; i++ {
+		execCmd(db, c, "GET", "raw")
+	}
+	if freq := execCmd(db, c, "OBJECT", "FREQ", "raw").(*reply.IntReply).Code; freq <= initial {
+		t.Errorf("freq after GET: %d, initial %d", freq, initial)
+	}
+}
+
+func TestHistorySnapshotLimit(t *testing.T) {
+	db := engine.MakeDB()
+	c := connection.NewFakeConn()
+	large := string(make([]byte, 1024))
+	execCmd(db, c, "HISTORY.ENABLE", "list", "200")
+	execCmd(db, c, "HISTORY.ENABLE", "str", "10")
+	execCmd(db, c, "RPUSH", "list", "a")
+	for i := 0; i < 100; i++ {
+		execCmd(db, c, "RPUSH", "list", large)
+	}
+	execCmd(db, c, "SET", "str", string(make([]byte, 100*1024)))
+	expectReplies(t, db, [][2]interface{}{
+		{[]string{"GETVERSION", "list", "1"}, "*3\r\n$5\r\nRPUSH\r\n$4\r\nlist\r\n$1\r\na\r\n"},
+		// 集合过大时只记录版本号
+		{[]string{"GETVERSION", "list", "101"}, "-ERR value is too large to be kept in history\r\n"},
+		{[]string{"HISTORY", "list", "COUNT", "0"}, "*0\r\n"},
+	})
+	if r := execCmd(db, c, "GETVERSION", "str", "1"); len(r.ToBytes()) < 100*1024 {
+		t.Errorf("large string not kept: %q", r.ToBytes())
+	}
+	entries := execCmd(db, c, "HISTORY", "list").(*reply.MultiRawReply).Replies
+	if len(entries) != 101 {
+		t.Fatalf("history entries: %d", len(entries))
+	}
+	if !reply.IsErrorReply(entries[0].(*reply.MultiRawReply).Replies[2]) {
+		t.Errorf("latest entry: %q", entries[0].ToBytes())
+	}
+}
@@ -3,11 +3,13 @@ package engine
 import (
 	"github.com/dawnzzz/simple-redis/datastruct/dict"
 	"github.com/dawnzzz/simple-redis/datastruct/lock"
+	"github.com/dawnzzz/simple-redis/datastruct/search"
 	"github.com/dawnzzz/simple-redis/interface/database"
 	"github.com/dawnzzz/simple-redis/interface/redis"
 	"github.com/dawnzzz/simple-redis/lib/utils"
 	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,8 +24,15 @@ type DB struct {
 	data       dict.Dict
 	ttlMap     dict.Dict
 	versionMap dict.Dict
+	histories  dict.Dict // 开启历史记录的 key -> *history.Ring
 	locker     *lock.Locks
+	waiters    *keyWaiters      // 阻塞在 key 上的客户端
+	indexes    *search.Registry // hash 上的二级索引
 	addAof     func(line CmdLine)
+	loading    atomic.Bool // 正在加载 AOF，写命令不增加版本号，版本号由 KEYVERSION.SET 恢复
+
+	memoryGuard func() redis.Reply // 写命令执行之前的内存检查，为 nil 时不限制内存
+	hotKeys     *hotKeys           // 访问频率统计，为 nil 时不统计
 }
 
 // CmdLine is alias for [][]byte, represents a command line
@@ -34,25 +43,41 @@ func MakeDB() *DB {
 		data:       dict.MakeConcurrentDict(dataDictSize),
 		ttlMap:     dict.MakeConcurrentDict(ttlDictSize),
 		versionMap: dict.MakeConcurrentDict(dataDictSize),
+		histories:  dict.MakeConcurrentDict(ttlDictSize),
 		locker:     lock.Make(lockSize),
+		waiters:    makeKeyWaiters(),
+		indexes:    search.MakeRegistry(),
 		addAof:     func(line CmdLine) {},
+		hotKeys:    makeHotKeys(),
 	}
 }
 
 func MakeBasicDB() *DB {
 	return &DB{
-		data:   dict.MakeSimpleDict(),
-		ttlMap: dict.MakeSimpleDict(),
-		locker: lock.Make(1),
-		addAof: func(line CmdLine) {},
+		data:       dict.MakeSimpleDict(),
+		ttlMap:     dict.MakeSimpleDict(),
+		versionMap: dict.MakeSimpleDict(),
+		histories:  dict.MakeSimpleDict(),
+		locker:     lock.Make(1),
+		waiters:    makeKeyWaiters(),
+		indexes:    search.MakeRegistry(),
+		addAof:     func(line CmdLine) {},
 	}
 }
 
+// SetLoading 设置是否正在加载 AOF
+func (db *DB) SetLoading(loading bool) {
+	db.loading.Store(loading)
+}
+
 // Flush Warning! clean all db data
 func (db *DB) Flush() {
 	db.data.Clear()
 	db.ttlMap.Clear()
+	db.indexes.Clear()
+	db.histories.Clear()
 	db.locker = lock.Make(lockSize)
+	db.ResetHotKeys()
 }
 
 // Exec executes command within one database
@@ -68,6 +93,11 @@ func (db *DB) Exec(c redis.Connection, cmdLine [][]byte) redis.Reply {
 			c.EnqueueSyntaxErrQueue(errReply) // 语法有错误
 			return errReply
 		}
+		// 超过 maxmemory 时拒绝写命令入队
+		if errReply := db.checkMemory(cmdLine); errReply != nil {
+			c.EnqueueSyntaxErrQueue(errReply)
+			return errReply
+		}
 
 		// 语法没有错误，则进入队列等待执行
 		c.EnqueueCmdLine(cmdLine)
@@ -75,8 +105,19 @@ func (db *DB) Exec(c redis.Connection, cmdLine [][]byte) redis.Reply {
 		return reply.MakeStatusReply("QUEUED")
 	}
 
+	// 超过 maxmemory 时拒绝执行写命令
+	if errReply := db.checkMemory(cmdLine); errReply != nil {
+		return errReply
+	}
+
 	// 正常执行的命令
-	return db.execNormalCommand(cmdLine)
+	r := db.execNormalCommand(cmdLine)
+	if blocked, ok := r.(*BlockedReply); ok {
+		// 阻塞命令没有可用的数据，挂起等待
+		return db.execBlocking(c, blocked, cmdLine)
+	}
+
+	return r
 }
 
 func (db *DB) execNormalCommand(cmdLine [][]byte) redis.Reply {
@@ -88,17 +129,26 @@ func (db *DB) execNormalCommand(cmdLine [][]byte) redis.Reply {
 	// 获取命令
 	cmd, _ := cmdTable[cmdName]
 
-	// 执行前的加锁
-	prepare := cmd.prepare
-	write, read := prepare(cmdLine[1:])
-	db.RWLocks(write, read)
-	defer db.RWUnLocks(write, read)
+	// 执行前的加锁，prepare 为空的命令（如需要遍历整个数据库的命令）在执行时自行加锁
+	var write, read []string
+	if prepare := cmd.prepare; prepare != nil {
+		write, read = prepare(cmdLine[1:])
+		var resolve func() []string
+		if cmd.resolve != nil {
+			resolve = func() []string { return cmd.resolve(db, cmdLine[1:]) }
+		}
+		write = db.lockKeys(write, read, resolve)
+		defer db.RWUnLocks(write, read)
+	}
+	if cmd.recordsAccess() {
+		db.recordAccess(write, read)
+	}
 	// 执行
 	fun := cmd.executor
 	r, aofExpireCtx := fun(db, cmdLine[1:])
 	db.afterExec(r, aofExpireCtx, cmdLine)
-	// 写命令、执行成功增加版本
-	if !IsReadOnlyCommand(cmdName) && !reply.IsErrorReply(r) {
+	// 写命令、执行成功增加版本（阻塞命令没有数据可用时没有写入）
+	if _, blocked := r.(*BlockedReply); !blocked && cmd.addsVersion() && !reply.IsErrorReply(r) {
 		db.AddVersion(write...)
 	}
 
@@ -114,8 +164,12 @@ func (db *DB) ExecWithLock(cmdLine CmdLine) redis.Reply {
 	// 执行
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmd, _ := cmdTable[cmdName]
+	if cmd.recordsAccess() {
+		db.recordAccess(GetWriteReadKeys(cmdLine))
+	}
 	fun := cmd.executor
 	r, aofExpireCtx := fun(db, cmdLine[1:])
+	db.cancelBlocked(r)
 	db.afterExec(r, aofExpireCtx, cmdLine)
 
 	return r
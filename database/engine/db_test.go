@@ -2,6 +2,9 @@ package engine
 
 import (
 	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
 	"testing"
 	"time"
 )
@@ -82,3 +85,90 @@ func TestDB(t *testing.T) {
 	}
 	t.Log("k1=", k1, "v1=", e)
 }
+
+func TestEviction(t *testing.T) {
+	db := MakeDB()
+	var aofLines []CmdLine
+	db.SetAddAof(func(line CmdLine) {
+		aofLines = append(aofLines, line)
+	})
+
+	now := time.Now()
+	for i, key := range []string{"a", "b", "c"} {
+		entity := &database.DataEntity{Data: []byte("value")}
+		db.PutEntity(key, entity)
+		// a 最久没有访问，c 最近访问
+		entity.Touch(now.Add(time.Duration(i-3) * time.Minute))
+	}
+	db.ExpireAfter("b", time.Hour)
+	db.ExpireAfter("c", time.Minute)
+
+	if key, _, ok := db.EvictionCandidate(PolicyAllKeysLRU, 10); !ok || key != "a" {
+		t.Errorf("allkeys-lru candidate: %s", key)
+	}
+	if key, _, ok := db.EvictionCandidate(PolicyVolatileLRU, 10); !ok || key != "b" {
+		t.Errorf("volatile-lru candidate: %s", key)
+	}
+	if key, _, ok := db.EvictionCandidate(PolicyVolatileTTL, 10); !ok || key != "c" {
+		t.Errorf("volatile-ttl candidate: %s", key)
+	}
+	if _, _, ok := db.EvictionCandidate(PolicyAllKeysRandom, 10); !ok {
+		t.Error("allkeys-random candidate not found")
+	}
+
+	if freed := db.Evict("a"); freed <= 0 {
+		t.Errorf("evict freed: %d", freed)
+	}
+	if _, ok := db.GetEntity("a"); ok {
+		t.Error("evicted key still exists")
+	}
+	if len(aofLines) == 0 || string(aofLines[0][0]) != "DEL" || string(aofLines[0][1]) != "a" {
+		t.Errorf("evict aof: %q", aofLines)
+	}
+	if freed := db.Evict("a"); freed != 0 {
+		t.Errorf("evict missing key freed: %d", freed)
+	}
+
+	// 超过 maxmemory 时只拒绝会占用内存的写命令
+	RegisterCommand("test.write", nil, nil, 1, FlagWrite)
+	RegisterCommand("test.free", nil, nil, 1, FlagWrite|FlagAllowOOM)
+	RegisterCommand("test.read", nil, nil, 1, FlagReadOnly)
+	defer func() {
+		// 测试命令不能留在全局命令表中
+		for _, name := range []string{"test.write", "test.free", "test.read"} {
+			delete(cmdTable, name)
+		}
+	}()
+	oom := reply.MakeErrReply("OOM")
+	db.SetMemoryGuard(func() redis.Reply { return oom })
+	if r := db.checkMemory(utils.StringsToCmdLine("TEST.WRITE")); r != oom {
+		t.Error("write command allowed when out of memory")
+	}
+	if db.checkMemory(utils.StringsToCmdLine("test.free")) != nil || db.checkMemory(utils.StringsToCmdLine("test.read")) != nil {
+		t.Error("command rejected when out of memory")
+	}
+}
+
+func TestHotKeys(t *testing.T) {
+	db := MakeDB()
+	// 每 hotKeysSampleRate 次访问记录一次
+	for i := 0; i < 10*hotKeysSampleRate; i++ {
+		db.recordAccess([]string{"hot"}, nil)
+	}
+	for i := 0; i < hotKeysSampleRate; i++ {
+		db.recordAccess(nil, []string{"cold"})
+	}
+
+	items, accesses := db.HotKeys()
+	if accesses != 11*hotKeysSampleRate {
+		t.Errorf("accesses: %d", accesses)
+	}
+	if len(items) != 2 || items[0].Item != "hot" || items[0].Count != 10*hotKeysSampleRate || items[1].Item != "cold" {
+		t.Errorf("hot keys: %+v", items)
+	}
+
+	db.Flush()
+	if items, accesses := db.HotKeys(); len(items) != 0 || accesses != 0 {
+		t.Errorf("hot keys after flush: %+v, %d", items, accesses)
+	}
+}
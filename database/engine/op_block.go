@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"sync"
+	"time"
+)
+
+/* ---- Blocking Functions ---- */
+
+// BlockedReply 阻塞命令在没有可用数据时返回 BlockedReply，
+// DB 在释放锁之后挂起客户端，直到 Keys 中的任意一个 key 被写入后重新执行命令，或者超时
+type BlockedReply struct {
+	Keys    []string
+	Timeout time.Duration // 为 0 时一直阻塞
+	CmdLine [][]byte      // 被唤醒后重新执行的命令，为空时重新执行原命令（如 XREAD 需要将 $ 替换为具体的 ID）
+	// 超时时的回复，为空时返回空字符串（如 BZPOPMIN 超时需要返回空数组）
+	TimeoutReply redis.Reply
+	// 放弃等待时（超时、客户端断开连接或者在 multi 中无法阻塞）调用，用于清理命令在阻塞之前保存的状态
+	// （如信号量的等待队列），调用时持有 Keys 的写锁，可以为空
+	Cancel func(db *DB)
+}
+
+// MakeBlockedReply creates BlockedReply
+func MakeBlockedReply(keys []string, timeout time.Duration) *BlockedReply {
+	return &BlockedReply{
+		Keys:    keys,
+		Timeout: timeout,
+	}
+}
+
+// timeoutReply 返回超时时的回复
+func (r *BlockedReply) timeoutReply() redis.Reply {
+	if r.TimeoutReply != nil {
+		return r.TimeoutReply
+	}
+	return reply.MakeNullBulkStringReply()
+}
+
+// cancelBlocked 命令在无法阻塞的场景下（如 multi 中）返回 BlockedReply 时放弃等待，需要持有 key 的写锁
+func (db *DB) cancelBlocked(r redis.Reply) {
+	if blocked, ok := r.(*BlockedReply); ok && blocked.Cancel != nil {
+		blocked.Cancel(db)
+	}
+}
+
+// abandon 超时或者客户端断开连接时放弃等待，返回超时时的回复
+func (db *DB) abandon(blocked *BlockedReply) redis.Reply {
+	if blocked.Cancel != nil {
+		db.RWLocks(blocked.Keys, nil)
+		blocked.Cancel(db)
+		db.RWUnLocks(blocked.Keys, nil)
+	}
+	return blocked.timeoutReply()
+}
+
+// ToBytes 在无法阻塞的场景下（如 multi 中），等同于超时返回空值
+func (r *BlockedReply) ToBytes() []byte {
+	return r.timeoutReply().ToBytes()
+}
+
+func (r *BlockedReply) DataString() string {
+	return r.timeoutReply().DataString()
+}
+
+// keyWaiters 记录等待 key 被写入的客户端
+type keyWaiters struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+func makeKeyWaiters() *keyWaiters {
+	return &keyWaiters{
+		waiters: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// wait 在 keys 上注册一个等待者，任意一个 key 被写入时 channel 会被关闭
+func (w *keyWaiters) wait(keys []string) chan struct{} {
+	ch := make(chan struct{})
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		set, ok := w.waiters[key]
+		if !ok {
+			set = make(map[chan struct{}]struct{})
+			w.waiters[key] = set
+		}
+		set[ch] = struct{}{}
+	}
+	return ch
+}
+
+// cancel 取消在 keys 上注册的等待者
+func (w *keyWaiters) cancel(keys []string, ch chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		set, ok := w.waiters[key]
+		if !ok {
+			continue
+		}
+		delete(set, ch)
+		if len(set) == 0 {
+			delete(w.waiters, key)
+		}
+	}
+}
+
+// notify 唤醒所有等待 keys 的客户端
+func (w *keyWaiters) notify(keys ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		set, ok := w.waiters[key]
+		if !ok {
+			continue
+		}
+		for ch := range set {
+			select {
+			case <-ch: // 已经被其他 key 唤醒
+			default:
+				close(ch)
+			}
+		}
+		delete(w.waiters, key)
+	}
+}
+
+// NotifyKeys 唤醒阻塞在 keys 上的客户端
+func (db *DB) NotifyKeys(keys ...string) {
+	db.waiters.notify(keys...)
+}
+
+// WaitKeys 在 keys 上注册一个等待者，返回的 channel 在任意 key 被写入时关闭，不再等待时需要调用 CancelWaitKeys
+func (db *DB) WaitKeys(keys []string) chan struct{} {
+	return db.waiters.wait(keys)
+}
+
+// CancelWaitKeys 取消在 keys 上的等待
+func (db *DB) CancelWaitKeys(keys []string, ch chan struct{}) {
+	db.waiters.cancel(keys, ch)
+}
+
+// execBlocking 执行阻塞命令，命令返回 BlockedReply 时挂起客户端，等待 key 被写入后重新执行，
+// 超时或者客户端断开连接时不再等待
+func (db *DB) execBlocking(c redis.Connection, blocked *BlockedReply, cmdLine [][]byte) redis.Reply {
+	var deadline <-chan time.Time
+	if blocked.Timeout > 0 {
+		timer := time.NewTimer(blocked.Timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	if blocked.CmdLine != nil {
+		cmdLine = blocked.CmdLine
+	}
+
+	for {
+		// 先注册再执行，防止在两次执行之间的写入被遗漏
+		ch := db.WaitKeys(blocked.Keys)
+		r := db.execNormalCommand(cmdLine)
+		if _, ok := r.(*BlockedReply); !ok {
+			db.CancelWaitKeys(blocked.Keys, ch)
+			return r
+		}
+
+		select {
+		case <-ch:
+			// key 被写入，重新执行
+			db.CancelWaitKeys(blocked.Keys, ch)
+		case <-deadline:
+			db.CancelWaitKeys(blocked.Keys, ch)
+			return db.abandon(blocked)
+		case <-c.Disconnected():
+			db.CancelWaitKeys(blocked.Keys, ch)
+			return db.abandon(blocked)
+		}
+	}
+}
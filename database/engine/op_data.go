@@ -3,6 +3,7 @@ package engine
 import (
 	"github.com/dawnzzz/simple-redis/interface/database"
 	"github.com/dawnzzz/simple-redis/lib/timewheel"
+	"time"
 )
 
 /* ---- Data Access ----- */
@@ -20,29 +21,55 @@ func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 		return nil, false
 	}
 
+	entity, _ := raw.(*database.DataEntity)
+	entity.Touch(time.Now())
+	return entity, true
+}
+
+// PeekEntity returns DataEntity bind to given key without updating its access clock
+func (db *DB) PeekEntity(key string) (*database.DataEntity, bool) {
+	raw, ok := db.data.Get(key)
+	if !ok || db.IsExpired(key) {
+		return nil, false
+	}
+
 	entity, _ := raw.(*database.DataEntity)
 	return entity, true
 }
 
 // PutEntity a DataEntity into DB
 func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
-	return db.data.Put(key, entity)
+	entity.Touch(time.Now())
+	result := db.data.Put(key, entity)
+	db.indexEntity(key, entity)
+	return result
 }
 
 // PutIfExists put a DataEntity into DB if key exists (update)
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
-	return db.data.PutIfExists(key, entity)
+	entity.Touch(time.Now())
+	result := db.data.PutIfExists(key, entity)
+	if result > 0 {
+		db.indexEntity(key, entity)
+	}
+	return result
 }
 
 // PutIfAbsent put a DataEntity into DB if key not exists
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, entity)
+	entity.Touch(time.Now())
+	result := db.data.PutIfAbsent(key, entity)
+	if result > 0 {
+		db.indexEntity(key, entity)
+	}
+	return result
 }
 
 // Remove the given key from db
 func (db *DB) Remove(key string) {
 	db.data.Remove(key)
 	db.ttlMap.Remove(key)
+	db.indexes.Remove(key)
 	// 取消定时任务
 	expireTaskKey := db.genExpireTaskKey(key)
 	timewheel.Cancel(expireTaskKey)
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+/* ---- Memory Eviction ----- */
+
+// 内存淘汰策略
+const (
+	PolicyNoEviction    = "noeviction"     // 不淘汰，超过 maxmemory 时拒绝写命令
+	PolicyAllKeysLRU    = "allkeys-lru"    // 在所有 key 中淘汰最久没有访问的
+	PolicyAllKeysLFU    = "allkeys-lfu"    // 在所有 key 中淘汰访问频率最低的
+	PolicyAllKeysRandom = "allkeys-random" // 在所有 key 中随机淘汰
+	PolicyVolatileLRU   = "volatile-lru"   // 在设置了过期时间的 key 中淘汰最久没有访问的
+	PolicyVolatileLFU   = "volatile-lfu"   // 在设置了过期时间的 key 中淘汰访问频率最低的
+	PolicyVolatileTTL   = "volatile-ttl"   // 在设置了过期时间的 key 中淘汰最先过期的
+)
+
+// evictSizeSamples 估算被淘汰的 key 释放的内存时，集合类型采样的元素数量
+const evictSizeSamples = 16
+
+// IsEvictionPolicy 返回是否是支持的内存淘汰策略
+func IsEvictionPolicy(policy string) bool {
+	switch policy {
+	case PolicyNoEviction, PolicyAllKeysLRU, PolicyAllKeysLFU, PolicyAllKeysRandom,
+		PolicyVolatileLRU, PolicyVolatileLFU, PolicyVolatileTTL:
+		return true
+	}
+	return false
+}
+
+// SetMemoryGuard 设置写命令执行之前的内存检查，guard 返回不为 nil 时拒绝执行命令并返回该回复
+func (db *DB) SetMemoryGuard(guard func() redis.Reply) {
+	db.memoryGuard = guard
+}
+
+// checkMemory 超过 maxmemory 并且无法释放足够的内存时，拒绝执行会占用内存的写命令
+func (db *DB) checkMemory(cmdLine CmdLine) redis.Reply {
+	if db.memoryGuard == nil || !isDenyOOMCommand(string(cmdLine[0])) {
+		return nil
+	}
+	return db.memoryGuard()
+}
+
+// EvictionCandidate 按照淘汰策略从随机选取的 samples 个 key 中选出最应该被淘汰的 key，
+// score 越大越应该被淘汰，用于在多个数据库之间比较，没有可以淘汰的 key 时返回 false
+func (db *DB) EvictionCandidate(policy string, samples int) (key string, score float64, ok bool) {
+	var keys []string
+	if strings.HasPrefix(policy, "volatile-") {
+		if db.ttlMap.Len() == 0 {
+			return "", 0, false
+		}
+		keys = db.ttlMap.RandomKeys(samples)
+	} else {
+		if db.data.Len() == 0 {
+			return "", 0, false
+		}
+		if policy == PolicyAllKeysRandom {
+			samples = 1
+		}
+		keys = db.data.RandomKeys(samples)
+	}
+
+	now := time.Now()
+	for _, k := range keys {
+		raw, exists := db.data.Get(k)
+		if !exists {
+			continue
+		}
+		entity, _ := raw.(*database.DataEntity)
+		var s float64
+		switch policy {
+		case PolicyAllKeysLRU, PolicyVolatileLRU:
+			s = float64(entity.IdleTime(now))
+		case PolicyAllKeysLFU, PolicyVolatileLFU:
+			s = float64(255 - int(entity.Freq(now)))
+		case PolicyVolatileTTL:
+			rawExpireTime, ok := db.ttlMap.Get(k)
+			if !ok {
+				continue
+			}
+			expireTime, _ := rawExpireTime.(time.Time)
+			s = -float64(expireTime.UnixMilli())
+		case PolicyAllKeysRandom:
+			s = rand.Float64()
+		default:
+			return "", 0, false
+		}
+		if !ok || s > score {
+			key, score, ok = k, s, true
+		}
+	}
+	return key, score, ok
+}
+
+// Evict 淘汰 key，删除以 DEL 命令写入 AOF，返回估算释放的内存字节数
+func (db *DB) Evict(key string) int64 {
+	db.RWLocks([]string{key}, nil)
+	defer db.RWUnLocks([]string{key}, nil)
+
+	raw, ok := db.data.Get(key)
+	if !ok {
+		return 0
+	}
+	entity, _ := raw.(*database.DataEntity)
+	size := utils.EntitySize(key, entity, evictSizeSamples)
+	db.Remove(key)
+	db.addAof(utils.StringsToCmdLine("DEL", key))
+	db.AddVersion(key)
+	return size
+}
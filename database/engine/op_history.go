@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"github.com/dawnzzz/simple-redis/datastruct/history"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"strconv"
+	"time"
+)
+
+/* ---- Key History ---- */
+
+// maxHistoryValueSize 非字符串类型的值估算的大小超过该值时不保存，只记录版本号，
+// 避免每次写入大集合时复制整个集合
+const maxHistoryValueSize = 64 * 1024
+
+// historySizeSamples 估算值的大小时采样的元素数量
+const historySizeSamples = 5
+
+// EnableHistory 为 key 开启历史记录，最多保存最近 capacity 个版本，已经开启时修改保存的数量。
+// 开启时会记录 key 当前的值，需要持有 key 的写锁
+func (db *DB) EnableHistory(key string, capacity int) {
+	if raw, ok := db.histories.Get(key); ok {
+		raw.(*history.Ring).Resize(capacity)
+		return
+	}
+	ring := history.MakeRing(capacity)
+	db.histories.Put(key, ring)
+	if _, exists := db.GetEntity(key); exists {
+		db.recordHistory(key, db.GetVersion(key))
+	}
+}
+
+// DisableHistory 关闭 key 的历史记录并删除已经保存的版本
+func (db *DB) DisableHistory(key string) bool {
+	return db.histories.Remove(key) > 0
+}
+
+// GetHistory 返回 key 的历史记录，没有开启时返回 false，需要持有 key 的读锁
+func (db *DB) GetHistory(key string) (*history.Ring, bool) {
+	raw, ok := db.histories.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return raw.(*history.Ring), true
+}
+
+// ForEachHistory 遍历所有开启历史记录的 key 以及保存的版本数量
+func (db *DB) ForEachHistory(cb func(key string, capacity int) bool) {
+	db.histories.ForEach(func(key string, val interface{}) bool {
+		return cb(key, val.(*history.Ring).Cap())
+	})
+}
+
+// recordHistory key 被写入之后记录新的版本，key 不存在时记录为删除
+func (db *DB) recordHistory(key string, version uint32) {
+	if db.histories.Len() == 0 {
+		return
+	}
+	ring, ok := db.GetHistory(key)
+	if !ok {
+		return
+	}
+	entry := &history.Entry{Version: version, Time: time.Now()}
+	if entity, exists := db.GetEntity(key); exists {
+		entry.Value, entry.Omitted = snapshotEntity(key, entity)
+	}
+	ring.Add(entry)
+}
+
+// snapshotEntity 保存值的副本，字符串保存为 []byte，其他类型保存为重建该值的命令，
+// 估算的大小超过 maxHistoryValueSize 时不保存，返回 true
+func snapshotEntity(key string, entity *database.DataEntity) (interface{}, bool) {
+	switch val := entity.Data.(type) {
+	case []byte:
+		value := make([]byte, len(val))
+		copy(value, val)
+		return value, false
+	case int64:
+		return []byte(strconv.FormatInt(val, 10)), false
+	}
+	if utils.EntitySize(key, entity, historySizeSamples) > maxHistoryValueSize {
+		return nil, true
+	}
+	if cmd := utils.EntityToReply(key, entity); cmd != nil {
+		return cmd.Args, false
+	}
+	return [][]byte{}, false
+}
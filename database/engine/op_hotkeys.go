@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"github.com/dawnzzz/simple-redis/datastruct/bloom"
+	"sync"
+	"sync/atomic"
+)
+
+/* ---- Hot Keys ----- */
+
+// 统计热点 key 使用的 HeavyKeeper 参数
+const (
+	hotKeysSize  = 100
+	hotKeysWidth = 2048
+	hotKeysDepth = 4
+	// 每 hotKeysSampleRate 次访问记录一次，记录时访问次数乘以采样率，避免每次访问都竞争锁
+	hotKeysSampleRate = 8
+)
+
+// hotKeys 使用 HeavyKeeper 统计访问最频繁的 key
+type hotKeys struct {
+	mu       sync.Mutex
+	topK     *bloom.TopK
+	accesses int64  // 记录的访问总数
+	counter  uint64 // 访问计数，用于采样
+}
+
+func makeHotKeys() *hotKeys {
+	return &hotKeys{
+		topK: bloom.MakeTopK(hotKeysSize, hotKeysWidth, hotKeysDepth, bloom.DefaultTopKDecay),
+	}
+}
+
+// recordAccess 采样记录命令访问的 key
+func (db *DB) recordAccess(write, read []string) {
+	if db.hotKeys == nil || len(write)+len(read) == 0 {
+		return
+	}
+	if atomic.AddUint64(&db.hotKeys.counter, 1)%hotKeysSampleRate != 0 {
+		return
+	}
+	db.hotKeys.mu.Lock()
+	defer db.hotKeys.mu.Unlock()
+	for _, keys := range [][]string{write, read} {
+		for _, key := range keys {
+			db.hotKeys.topK.IncrBy([]byte(key), hotKeysSampleRate)
+			db.hotKeys.accesses += hotKeysSampleRate
+		}
+	}
+}
+
+// HotKeys 返回访问最频繁的 key 以及估计的访问次数（按照访问次数从大到小排序），以及记录的访问总数
+func (db *DB) HotKeys() ([]bloom.TopKItem, int64) {
+	if db.hotKeys == nil {
+		return nil, 0
+	}
+	db.hotKeys.mu.Lock()
+	defer db.hotKeys.mu.Unlock()
+	list := db.hotKeys.topK.List()
+	items := make([]bloom.TopKItem, len(list))
+	for i, item := range list {
+		items[i] = bloom.TopKItem{Item: item.Item, Count: item.Count}
+	}
+	return items, db.hotKeys.accesses
+}
+
+// ResetHotKeys 清空热点 key 的统计
+func (db *DB) ResetHotKeys() {
+	if db.hotKeys == nil {
+		return
+	}
+	db.hotKeys.mu.Lock()
+	defer db.hotKeys.mu.Unlock()
+	db.hotKeys.topK = bloom.MakeTopK(hotKeysSize, hotKeysWidth, hotKeysDepth, bloom.DefaultTopKDecay)
+	db.hotKeys.accesses = 0
+}
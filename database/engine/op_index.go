@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"github.com/dawnzzz/simple-redis/datastruct/dict"
+	"github.com/dawnzzz/simple-redis/datastruct/search"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"time"
+)
+
+/* ---- Secondary Index ---- */
+
+// Indexes 返回数据库中所有的二级索引
+func (db *DB) Indexes() *search.Registry {
+	return db.indexes
+}
+
+// Reindex 在 hash 写入之后更新 key 在二级索引中的文档，key 不存在或者不是 hash 时从索引中删除
+func (db *DB) Reindex(key string) {
+	if db.indexes.Len() == 0 {
+		return
+	}
+	raw, ok := db.data.Get(key)
+	if !ok {
+		db.indexes.Remove(key)
+		return
+	}
+	entity, _ := raw.(*database.DataEntity)
+	db.indexEntity(key, entity)
+}
+
+// RebuildIndexes 清空所有索引中的文档，并根据数据库中的数据重新建立索引，用于加载 AOF 之后
+func (db *DB) RebuildIndexes() {
+	if db.indexes.Len() == 0 {
+		return
+	}
+	db.indexes.Clear()
+	db.ForEach(func(key string, entity *database.DataEntity, _ *time.Time) bool {
+		db.indexEntity(key, entity)
+		return true
+	})
+}
+
+// IndexKey 将 key 加入到指定的索引中，用于创建索引时为已有的数据建立索引
+func (db *DB) IndexKey(idx *search.Index, key string) {
+	entity, ok := db.GetEntity(key)
+	if !ok || !idx.Match(key) {
+		return
+	}
+	if hash, ok := entity.Data.(dict.Dict); ok {
+		idx.Add(key, hashFieldGetter(hash))
+	}
+}
+
+func (db *DB) indexEntity(key string, entity *database.DataEntity) {
+	if db.indexes.Len() == 0 {
+		return
+	}
+	hash, ok := entity.Data.(dict.Dict)
+	if !ok {
+		// 类型被覆盖，不再是 hash
+		db.indexes.Remove(key)
+		return
+	}
+	db.indexes.Update(key, hashFieldGetter(hash))
+}
+
+func hashFieldGetter(hash dict.Dict) func(field string) ([]byte, bool) {
+	return func(field string) ([]byte, bool) {
+		raw, ok := hash.Get(field)
+		if !ok {
+			return nil, false
+		}
+		value, _ := raw.([]byte)
+		return value, true
+	}
+}
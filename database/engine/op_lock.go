@@ -11,3 +11,40 @@ func (db *DB) RWLocks(writeKeys []string, readKeys []string) {
 func (db *DB) RWUnLocks(writeKeys []string, readKeys []string) {
 	db.locker.RWUnlocks(writeKeys, readKeys)
 }
+
+// lockKeys 对 key 加锁，返回加锁的写 key。resolve 返回的写入 key 只能在加锁之后读取数据确定，
+// 没有全部加锁时释放锁，对全部 key 重新加锁之后再次检查，直到需要的 key 全部加锁
+func (db *DB) lockKeys(writeKeys []string, readKeys []string, resolve func() []string) []string {
+	db.RWLocks(writeKeys, readKeys)
+	if resolve == nil {
+		return writeKeys
+	}
+	for {
+		missing := missingKeys(writeKeys, resolve())
+		if len(missing) == 0 {
+			return writeKeys
+		}
+		db.RWUnLocks(writeKeys, readKeys)
+		writeKeys = append(writeKeys[:len(writeKeys):len(writeKeys)], missing...)
+		db.RWLocks(writeKeys, readKeys)
+	}
+}
+
+// missingKeys 返回 keys 中不在 locked 中的 key
+func missingKeys(locked []string, keys []string) []string {
+	if len(keys) == 0 {
+		return nil
+	}
+	lockedSet := make(map[string]struct{}, len(locked))
+	for _, key := range locked {
+		lockedSet[key] = struct{}{}
+	}
+	var missing []string
+	for _, key := range keys {
+		if _, ok := lockedSet[key]; !ok {
+			lockedSet[key] = struct{}{}
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
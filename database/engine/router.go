@@ -19,18 +19,27 @@ type ExecFunc func(db *DB, args [][]byte) (redis.Reply, *AofExpireCtx)
 // PreFunc returns related write keys and read keys
 type PreFunc func(args [][]byte) ([]string, []string)
 
+// KeyResolver 返回命令除了 prepare 返回的 key 之外还会写入的 key，这些 key 需要读取数据才能确定
+// （如时间序列 compaction 规则的目标 key），调用时 prepare 返回的 key 已经加锁
+type KeyResolver func(db *DB, args [][]byte) []string
+
 var cmdTable = make(map[string]*command)
 
 type command struct {
 	executor ExecFunc
-	prepare  PreFunc // return related keys command
-	arity    int     // allow number of args, arity < 0 means len(args) >= -arity
-	flags    int     // flagWrite or flagReadOnly
+	prepare  PreFunc     // return related keys command
+	resolve  KeyResolver // return write keys known only after the keys above are locked
+	arity    int         // allow number of args, arity < 0 means len(args) >= -arity
+	flags    int         // flagWrite or flagReadOnly, may be combined with FlagAllowOOM, FlagNoVersion, FlagInternal and FlagNoStats
 }
 
 const (
-	FlagWrite    = 0
-	FlagReadOnly = 1
+	FlagWrite     = 0
+	FlagReadOnly  = 1
+	FlagAllowOOM  = 2  // 只会释放内存的写命令，超过 maxmemory 时仍然可以执行
+	FlagNoVersion = 4  // 自行增加版本号的写命令（如条件写入），执行之后不自动增加版本号
+	FlagInternal  = 8  // 只在加载 AOF 时执行的内部命令，拒绝来自客户端的调用
+	FlagNoStats   = 16 // 查看 key 本身信息的命令（如 OBJECT、MEMORY），不计入热点 key 统计
 )
 
 // RegisterCommand registers a new command
@@ -46,6 +55,19 @@ func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, arity int,
 	}
 }
 
+// RegisterKeyResolver 为已经注册的命令设置 KeyResolver
+func RegisterKeyResolver(name string, resolver KeyResolver) {
+	cmdTable[strings.ToLower(name)].resolve = resolver
+}
+
+// resolveKeys 返回命令需要在加锁之后确定的写入 key
+func (cmd *command) resolveKeys(db *DB, args [][]byte) []string {
+	if cmd.resolve == nil {
+		return nil
+	}
+	return cmd.resolve(db, args)
+}
+
 func IsReadOnlyCommand(name string) bool {
 	name = strings.ToLower(name)
 	if cmd, ok := cmdTable[name]; ok && (cmd.flags&FlagReadOnly > 0) {
@@ -54,17 +76,58 @@ func IsReadOnlyCommand(name string) bool {
 
 	return false
 }
+
+// IsInternalCommand 返回是否是只在加载 AOF 时执行的内部命令
+func IsInternalCommand(name string) bool {
+	cmd, ok := cmdTable[strings.ToLower(name)]
+	return ok && cmd.flags&FlagInternal > 0
+}
+
+// addsVersion 返回命令执行成功之后是否需要自动增加写入的 key 的版本号
+func (cmd *command) addsVersion() bool {
+	return cmd.flags&(FlagReadOnly|FlagNoVersion) == 0
+}
+
+// recordsAccess 返回命令访问的 key 是否计入热点 key 统计
+func (cmd *command) recordsAccess() bool {
+	return cmd.flags&FlagNoStats == 0
+}
+
+// IsNoVersionCommand 返回是否是自行增加版本号的写命令
+func IsNoVersionCommand(name string) bool {
+	cmd, ok := cmdTable[strings.ToLower(name)]
+	return ok && cmd.flags&FlagNoVersion > 0
+}
+
+// isDenyOOMCommand 返回超过 maxmemory 时是否拒绝执行该命令
+func isDenyOOMCommand(name string) bool {
+	cmd, ok := cmdTable[strings.ToLower(name)]
+	return ok && cmd.flags&(FlagReadOnly|FlagAllowOOM) == 0
+}
+
 func GetWriteReadKeys(cmdLine [][]byte) ([]string, []string) {
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmdName = strings.ToLower(cmdName)
 
 	cmd, ok := cmdTable[cmdName]
-	if !ok {
+	if !ok || !validateArity(cmd.arity, cmdLine) {
 		return nil, nil
 	}
 
 	prepare := cmd.prepare
+	if prepare == nil {
+		return nil, nil
+	}
 	write, read := prepare(cmdLine[1:])
 
 	return write, read
 }
+
+// ResolveKeys 返回命令需要在加锁之后确定的写入 key，用于执行其他命令的命令（如 CAS）
+func (db *DB) ResolveKeys(cmdLine [][]byte) []string {
+	cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !ok || !validateArity(cmd.arity, cmdLine) {
+		return nil
+	}
+	return cmd.resolveKeys(db, cmdLine[1:])
+}
@@ -20,6 +20,7 @@ func (db *DB) ExecMultiCommand(cmdLines [][][]byte, watching map[string]uint32)
 	// // 获取所有需要加锁的key
 	writeKeys := make([]string, len(cmdLines))
 	readKeys := make([]string, len(cmdLines)+len(watching))
+	versionKeys := make([]string, 0, len(cmdLines)) // 执行之后需要增加版本号的 key
 	for _, cmdLine := range cmdLines {
 		cmdName := strings.ToLower(string(cmdLine[0]))
 		// 获取命令
@@ -30,6 +31,9 @@ func (db *DB) ExecMultiCommand(cmdLines [][][]byte, watching map[string]uint32)
 		write, read := prepare(cmdLine[1:])
 		writeKeys = append(writeKeys, write...)
 		readKeys = append(readKeys, read...)
+		if cmd.addsVersion() {
+			versionKeys = append(versionKeys, write...)
+		}
 	}
 
 	// 获取需要watch的key
@@ -39,9 +43,24 @@ func (db *DB) ExecMultiCommand(cmdLines [][][]byte, watching map[string]uint32)
 	}
 	readKeys = append(readKeys, watchingKeys...)
 
-	// 执行前的加锁
-	db.RWLocks(writeKeys, readKeys)
+	// 执行前的加锁，需要读取数据才能确定的写入 key 在加锁之后确定
+	var resolvedVersionKeys []string
+	resolve := func() []string {
+		resolved := make([]string, 0)
+		resolvedVersionKeys = resolvedVersionKeys[:0]
+		for _, cmdLine := range cmdLines {
+			cmd, _ := cmdTable[strings.ToLower(string(cmdLine[0]))]
+			keys := cmd.resolveKeys(db, cmdLine[1:])
+			resolved = append(resolved, keys...)
+			if cmd.addsVersion() {
+				resolvedVersionKeys = append(resolvedVersionKeys, keys...)
+			}
+		}
+		return resolved
+	}
+	writeKeys = db.lockKeys(writeKeys, readKeys, resolve)
 	defer db.RWUnLocks(writeKeys, readKeys)
+	versionKeys = append(versionKeys, resolvedVersionKeys...)
 
 	// 执行前检查version是否变化
 	versionChanged := db.checkVersionChanged(watching)
@@ -60,9 +79,14 @@ func (db *DB) ExecMultiCommand(cmdLines [][][]byte, watching map[string]uint32)
 		cmd, _ := cmdTable[cmdName]
 
 		if config.Properties.OpenAtomicTx {
-			// 开启原子性事务，记录undo日志
-			key := string(cmdLine[1])
-			undoLogs = append(undoLogs, db.GetUndoLog(key))
+			// 开启原子性事务，为命令写入的每一个key记录undo日志
+			write, _ := cmd.prepare(cmdLine[1:])
+			write = append(write, cmd.resolveKeys(db, cmdLine[1:])...)
+			undoLog := make([]CmdLine, 0, 3*len(write))
+			for _, key := range write {
+				undoLog = append(undoLog, db.GetUndoLog(key)...)
+			}
+			undoLogs = append(undoLogs, undoLog)
 		}
 
 		// 执行命令
@@ -76,6 +100,7 @@ func (db *DB) ExecMultiCommand(cmdLines [][][]byte, watching map[string]uint32)
 			break
 		}
 
+		db.cancelBlocked(r)
 		results = append(results, []byte(r.DataString()))
 		db.afterExec(r, aofExpireCtx, cmdLine)
 	}
@@ -100,7 +125,7 @@ func (db *DB) ExecMultiCommand(cmdLines [][][]byte, watching map[string]uint32)
 
 	// 未开启原子性事务，或者执行成功
 	// 写命令增加版本
-	db.AddVersion(writeKeys...)
+	db.AddVersion(versionKeys...)
 
 	return reply.MakeMultiBulkStringReply(results)
 }
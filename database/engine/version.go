@@ -1,11 +1,23 @@
 package engine
 
-// AddVersion 为指定的keys版本号+1
+import "github.com/dawnzzz/simple-redis/lib/utils"
+
+// AddVersion 为指定的keys版本号+1，记录开启了历史记录的key的新值，并唤醒阻塞在这些key上的客户端。
+// 新的版本号以 KEYVERSION.SET 写入 AOF。重放的命令与执行时增加版本号的次数不一定相同（如 SETEX 写入 SET 和 PEXPIREAT 两条命令，
+// 时间轮中的写入不会写入命令），所以加载 AOF 时不增加版本号，由 KEYVERSION.SET 恢复
 func (db *DB) AddVersion(keys ...string) {
-	for _, key := range keys {
-		versionCode := db.GetVersion(key)
-		db.versionMap.Put(key, versionCode+1)
+	if len(keys) == 0 || db.loading.Load() {
+		return
+	}
+	versions := make([]uint32, len(keys))
+	for i, key := range keys {
+		versionCode := db.GetVersion(key) + 1
+		db.versionMap.Put(key, versionCode)
+		db.recordHistory(key, versionCode)
+		versions[i] = versionCode
 	}
+	db.addAof(utils.VersionsToCmdLine(keys, versions))
+	db.NotifyKeys(keys...)
 }
 
 // GetVersion 获取指定key值的版本号
@@ -17,6 +29,23 @@ func (db *DB) GetVersion(key string) uint32 {
 	return entity.(uint32)
 }
 
+// SetVersion 直接设置 key 的版本号，用于加载 AOF 时恢复版本号，开启了历史记录的 key 以该版本号记录当前的值
+func (db *DB) SetVersion(key string, version uint32) {
+	if version == db.GetVersion(key) {
+		return
+	}
+	db.versionMap.Put(key, version)
+	db.recordHistory(key, version)
+	db.NotifyKeys(key)
+}
+
+// ForEachVersion 遍历所有版本号不为 0 的 key，包括已经被删除的 key
+func (db *DB) ForEachVersion(cb func(key string, version uint32) bool) {
+	db.versionMap.ForEach(func(key string, val interface{}) bool {
+		return cb(key, val.(uint32))
+	})
+}
+
 func (db *DB) checkVersionChanged(watching map[string]uint32) bool {
 	for key, ver := range watching {
 		currentVersion := db.GetVersion(key)
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"github.com/bwmarrin/snowflake"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+)
+
+// maxIDGenCount IDGEN 一次最多生成的 id 数量
+const maxIDGenCount = 10000
+
+// IDGen IDGEN [count]，生成全局唯一、按时间递增的 64 位 id，
+// 不指定 count 时返回一个 id，否则返回包含 count 个 id 的数组
+func IDGen(s *Server, args [][]byte) redis.Reply {
+	if len(args) > 1 {
+		return reply.MakeArgNumErrReply("idgen")
+	}
+	if len(args) == 0 {
+		return reply.MakeIntReply(s.idGenerator.Generate().Int64())
+	}
+
+	count, err := strconv.Atoi(string(args[0]))
+	if err != nil || count <= 0 || count > maxIDGenCount {
+		return reply.MakeErrReply("ERR count must be between 1 and " + strconv.Itoa(maxIDGenCount))
+	}
+	ids := make([]redis.Reply, count)
+	for i := range ids {
+		ids[i] = reply.MakeIntReply(s.idGenerator.Generate().Int64())
+	}
+	return reply.MakeMultiRawReply(ids)
+}
+
+// IDParse IDPARSE id，返回 id 的 [毫秒时间戳, 节点 ID, 序列号]
+func IDParse(args [][]byte) redis.Reply {
+	if len(args) != 1 {
+		return reply.MakeArgNumErrReply("idparse")
+	}
+	raw, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || raw < 0 {
+		return reply.MakeErrReply("ERR invalid id")
+	}
+	id := snowflake.ParseInt64(raw)
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeIntReply(id.Time()),
+		reply.MakeIntReply(id.Node()),
+		reply.MakeIntReply(id.Step()),
+	})
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"github.com/bwmarrin/snowflake"
+	"github.com/dawnzzz/simple-redis/redis/connection"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIDGen(t *testing.T) {
+	useAof(t, false)
+	s := NewStandaloneServer()
+	defer s.Close()
+	c := connection.NewFakeConn()
+
+	before := time.Now().UnixMilli()
+	first := execCmd(s, c, "IDGEN").(*reply.IntReply).Code
+	ids := execCmd(s, c, "IDGEN", "1000").(*reply.MultiRawReply).Replies
+	if len(ids) != 1000 {
+		t.Fatalf("count: %d", len(ids))
+	}
+	// id 严格递增
+	last := first
+	for i, r := range ids {
+		id := r.(*reply.IntReply).Code
+		if id <= last {
+			t.Fatalf("id %d: %d is not greater than %d", i, id, last)
+		}
+		last = id
+	}
+	after := time.Now().UnixMilli()
+
+	// IDPARSE 解析出的时间戳在生成 id 的时间范围内，节点 ID 与序列号可以还原出原来的 id
+	for _, id := range []int64{first, last} {
+		parts := execCmd(s, c, "IDPARSE", strconv.FormatInt(id, 10)).(*reply.MultiRawReply).Replies
+		if len(parts) != 3 {
+			t.Fatalf("idparse %d: %d parts", id, len(parts))
+		}
+		ms, node, step := parts[0].(*reply.IntReply).Code, parts[1].(*reply.IntReply).Code, parts[2].(*reply.IntReply).Code
+		if ms < before || ms > after {
+			t.Errorf("idparse %d: time %d not in [%d, %d]", id, ms, before, after)
+		}
+		if (ms-snowflake.Epoch)<<(snowflake.NodeBits+snowflake.StepBits)|node<<snowflake.StepBits|step != id {
+			t.Errorf("idparse %d: [%d %d %d]", id, ms, node, step)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"IDGEN", "0"},
+		{"IDGEN", "10001"},
+		{"IDGEN", "x"},
+		{"IDPARSE", "-1"},
+		{"IDPARSE", "x"},
+	} {
+		if r := execCmd(s, c, args...); !reply.IsErrorReply(r) {
+			t.Errorf("%v: %q", args, r.ToBytes())
+		}
+	}
+}
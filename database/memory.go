@@ -0,0 +1,201 @@
+package database
+
+import (
+	"github.com/dawnzzz/simple-redis/config"
+	"github.com/dawnzzz/simple-redis/database/engine"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMemorySamples 估算 key 占用的内存时，集合类型默认采样的元素数量
+const defaultMemorySamples = 5
+
+// memStatsInterval 读取 runtime.MemStats 的最小间隔，ReadMemStats 会暂停所有的 goroutine
+const memStatsInterval = 100 * time.Millisecond
+
+var oomReply = reply.MakeErrReply("OOM command not allowed when used memory > 'maxmemory'.")
+
+// memoryTracker 统计已经使用的内存，被淘汰的 key 在下一次 GC 之后才会真正释放，
+// 在此之前从堆内存中减去估算的已淘汰字节数，避免重复淘汰
+type memoryTracker struct {
+	mu        sync.Mutex // 同时只有一个写命令在淘汰 key
+	heapAlloc int64
+	numGC     uint32
+	evicted   int64 // 上一次 GC 之后淘汰的字节数
+
+	evictedKeys int64 // 累计淘汰的 key 数量
+
+	// 最近一次估算的已使用内存，以及读取 runtime.MemStats 的时间（纳秒），原子访问，
+	// 没有超过 maxmemory 时写命令不需要加锁
+	lastUsed int64
+	readAt   int64
+}
+
+// used 返回估算的已使用内存字节数，需要持有 mu
+func (t *memoryTracker) used() int64 {
+	now := time.Now().UnixNano()
+	refresh := now-atomic.LoadInt64(&t.readAt) >= int64(memStatsInterval)
+	if refresh {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if stats.NumGC != t.numGC {
+			t.numGC, t.evicted = stats.NumGC, 0
+		}
+		t.heapAlloc = int64(stats.HeapAlloc)
+	}
+	used := t.heapAlloc - t.evicted
+	if used < 0 {
+		used = 0
+	}
+	atomic.StoreInt64(&t.lastUsed, used)
+	if refresh {
+		atomic.StoreInt64(&t.readAt, now)
+	}
+	return used
+}
+
+// cachedUsed 不加锁返回最近一次估算的已使用内存字节数，距离上一次读取 runtime.MemStats 超过 memStatsInterval 时返回 false
+func (t *memoryTracker) cachedUsed() (int64, bool) {
+	if time.Now().UnixNano()-atomic.LoadInt64(&t.readAt) >= int64(memStatsInterval) {
+		return 0, false
+	}
+	return atomic.LoadInt64(&t.lastUsed), true
+}
+
+// UsedMemory 返回估算的已使用内存字节数
+func (s *Server) UsedMemory() int64 {
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+	return s.memory.used()
+}
+
+// freeMemoryIfNeeded 已使用的内存超过 maxmemory 时按照淘汰策略淘汰 key，
+// 策略为 noeviction 或者没有可以淘汰的 key 时返回 OOM 错误
+func (s *Server) freeMemoryIfNeeded() redis.Reply {
+	maxmemory := config.Properties.Maxmemory
+	if maxmemory <= 0 {
+		return nil
+	}
+	if used, ok := s.memory.cachedUsed(); ok && used <= maxmemory {
+		return nil
+	}
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+
+	used := s.memory.used()
+	if used <= maxmemory {
+		return nil
+	}
+	policy := config.Properties.MaxmemoryPolicy
+	if policy == engine.PolicyNoEviction {
+		return oomReply
+	}
+	samples := config.Properties.MaxmemorySamples
+	if samples <= 0 {
+		samples = 5
+	}
+
+	for used > maxmemory {
+		// 在所有数据库的候选 key 中选出最应该被淘汰的
+		var bestDB *engine.DB
+		var bestKey string
+		var bestScore float64
+		for _, holder := range s.dbSet {
+			db := holder.Load().(*engine.DB)
+			key, score, ok := db.EvictionCandidate(policy, samples)
+			if ok && (bestDB == nil || score > bestScore) {
+				bestDB, bestKey, bestScore = db, key, score
+			}
+		}
+		if bestDB == nil {
+			return oomReply
+		}
+		freed := bestDB.Evict(bestKey)
+		s.memory.evicted += freed
+		s.memory.evictedKeys++
+		used = s.memory.used()
+	}
+	return nil
+}
+
+// bindMemoryGuard 开启 maxmemory 时在写命令执行之前检查内存
+func (s *Server) bindMemoryGuard() {
+	if config.Properties.Maxmemory <= 0 {
+		return
+	}
+	for _, holder := range s.dbSet {
+		holder.Load().(*engine.DB).SetMemoryGuard(s.freeMemoryIfNeeded)
+	}
+}
+
+// isMemoryStats 判断是否是需要由服务器处理的 MEMORY STATS 命令，MEMORY USAGE 由数据库处理
+func isMemoryStats(cmdLine [][]byte) bool {
+	return len(cmdLine) >= 2 && strings.ToLower(string(cmdLine[1])) == "stats"
+}
+
+// MemoryStats MEMORY STATS，返回 Go 运行时的内存统计、内存淘汰的配置以及每个非空数据库的 key 数量、
+// 设置了过期时间的 key 数量和估算的内存字节数，需要遍历所有的 key
+func MemoryStats(s *Server, args [][]byte) redis.Reply {
+	if len(args) != 1 {
+		return reply.MakeArgNumErrReply("memory stats")
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	s.memory.mu.Lock()
+	used, evictedKeys := s.memory.used(), s.memory.evictedKeys
+	s.memory.mu.Unlock()
+
+	var result []redis.Reply
+	appendStat := func(name string, value redis.Reply) {
+		result = append(result, reply.MakeBulkStringReply([]byte(name)), value)
+	}
+	appendInt := func(name string, value int64) {
+		appendStat(name, reply.MakeIntReply(value))
+	}
+	appendInt("used.memory", used)
+	appendInt("heap.alloc", int64(stats.HeapAlloc))
+	appendInt("heap.inuse", int64(stats.HeapInuse))
+	appendInt("heap.sys", int64(stats.HeapSys))
+	appendInt("heap.objects", int64(stats.HeapObjects))
+	appendInt("sys", int64(stats.Sys))
+	appendInt("gc.count", int64(stats.NumGC))
+	appendInt("gc.pause.total.ms", int64(stats.PauseTotalNs/uint64(time.Millisecond)))
+	appendInt("goroutines", int64(runtime.NumGoroutine()))
+	appendInt("maxmemory", config.Properties.Maxmemory)
+	appendStat("maxmemory.policy", reply.MakeBulkStringReply([]byte(config.Properties.MaxmemoryPolicy)))
+	appendInt("evicted.keys", evictedKeys)
+
+	var totalKeys, totalBytes int64
+	for i, holder := range s.dbSet {
+		db := holder.Load().(*engine.DB)
+		keys, expires := db.GetDBSize()
+		if keys == 0 {
+			continue
+		}
+		var bytes int64
+		db.ForEach(func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			bytes += utils.EntitySize(key, entity, defaultMemorySamples)
+			return true
+		})
+		totalKeys += int64(keys)
+		totalBytes += bytes
+		appendStat("db."+strconv.Itoa(i), reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkStringReply([]byte("keys")), reply.MakeIntReply(int64(keys)),
+			reply.MakeBulkStringReply([]byte("expires")), reply.MakeIntReply(int64(expires)),
+			reply.MakeBulkStringReply([]byte("bytes")), reply.MakeIntReply(bytes),
+		}))
+	}
+	appendInt("keys.count", totalKeys)
+	appendInt("keys.bytes", totalBytes)
+
+	return reply.MakeMultiRawReply(result)
+}
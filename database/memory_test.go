@@ -0,0 +1,59 @@
+package database
+
+import (
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/connection"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"testing"
+)
+
+// statsMap 将 MEMORY STATS 的 [name, value, ...] 回复转换为 map
+func statsMap(t *testing.T, r redis.Reply) map[string]redis.Reply {
+	t.Helper()
+	replies := r.(*reply.MultiRawReply).Replies
+	if len(replies)%2 != 0 {
+		t.Fatalf("odd number of stats: %d", len(replies))
+	}
+	stats := make(map[string]redis.Reply, len(replies)/2)
+	for i := 0; i < len(replies); i += 2 {
+		stats[string(replies[i].(*reply.BulkStringReply).Arg)] = replies[i+1]
+	}
+	return stats
+}
+
+func TestMemoryStats(t *testing.T) {
+	useAof(t, false)
+	s := NewStandaloneServer()
+	defer s.Close()
+	c := connection.NewFakeConn()
+	execCmd(s, c, "SET", "a", "1")
+	execCmd(s, c, "SETEX", "b", "100", "v")
+	execCmd(s, c, "SELECT", "2")
+	execCmd(s, c, "RPUSH", "list", "a", "b", "c")
+
+	stats := statsMap(t, execCmd(s, c, "MEMORY", "STATS"))
+	for _, name := range []string{"used.memory", "heap.alloc", "sys", "goroutines", "keys.bytes"} {
+		if v, ok := stats[name].(*reply.IntReply); !ok || v.Code <= 0 {
+			t.Errorf("%s: %v", name, stats[name])
+		}
+	}
+	if v := stats["keys.count"].(*reply.IntReply).Code; v != 3 {
+		t.Errorf("keys.count: %d", v)
+	}
+	// 只返回非空的数据库
+	if _, ok := stats["db.1"]; ok {
+		t.Error("empty db.1 in stats")
+	}
+	db0 := statsMap(t, stats["db.0"])
+	if db0["keys"].(*reply.IntReply).Code != 2 || db0["expires"].(*reply.IntReply).Code != 1 || db0["bytes"].(*reply.IntReply).Code <= 0 {
+		t.Errorf("db.0: %q", stats["db.0"].(*reply.MultiRawReply).ToBytes())
+	}
+	db2 := statsMap(t, stats["db.2"])
+	if db2["keys"].(*reply.IntReply).Code != 1 || db2["expires"].(*reply.IntReply).Code != 0 {
+		t.Errorf("db.2: %q", stats["db.2"].(*reply.MultiRawReply).ToBytes())
+	}
+
+	if r := execCmd(s, c, "MEMORY", "STATS", "x"); !reply.IsErrorReply(r) {
+		t.Errorf("MEMORY STATS x: %q", r.ToBytes())
+	}
+}
@@ -14,6 +14,7 @@ func MakeAuxiliaryServer() database.DBEngine {
 	mdb.dbSet = make([]*atomic.Value, config.Properties.Databases)
 	for i := range mdb.dbSet {
 		db := engine.MakeBasicDB()
+		db.SetLoading(true) // 只用于 AOF 重写时加载 AOF
 		holder := &atomic.Value{}
 		holder.Store(db)
 		mdb.dbSet[i] = holder
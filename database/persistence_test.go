@@ -0,0 +1,87 @@
+package database
+
+import (
+	"github.com/dawnzzz/simple-redis/config"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/lib/utils"
+	"github.com/dawnzzz/simple-redis/redis/connection"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"path/filepath"
+	"testing"
+)
+
+// useAof 让测试使用临时目录中的 AOF 文件，appendOnly 为 false 时关闭 AOF，测试结束之后恢复配置
+func useAof(t *testing.T, appendOnly bool) {
+	appendOnlyBefore, filenameBefore, autoRewriteBefore := config.Properties.AppendOnly, config.Properties.AofFilename, config.Properties.AutoAofRewrite
+	config.Properties.AppendOnly = appendOnly
+	config.Properties.AofFilename = filepath.Join(t.TempDir(), "test.aof")
+	config.Properties.AutoAofRewrite = false
+	t.Cleanup(func() {
+		config.Properties.AppendOnly, config.Properties.AofFilename, config.Properties.AutoAofRewrite = appendOnlyBefore, filenameBefore, autoRewriteBefore
+	})
+}
+
+func execCmd(s *Server, c redis.Connection, args ...string) redis.Reply {
+	return s.Exec(c, utils.StringsToCmdLine(args...))
+}
+
+func keyVersions(s *Server, keys ...string) []int64 {
+	c := connection.NewFakeConn()
+	versions := make([]int64, len(keys))
+	for i, key := range keys {
+		versions[i] = execCmd(s, c, "KEYVERSION", key).(*reply.IntReply).Code
+	}
+	return versions
+}
+
+func TestVersionAfterReplay(t *testing.T) {
+	useAof(t, true)
+	s := NewStandaloneServer()
+	c := connection.NewFakeConn()
+	// 重放时写入的命令数量与增加版本号的次数不同的写入
+	for _, cmdLine := range [][]string{
+		{"SET", "str", "1"},
+		{"SETEX", "ex", "100", "v"},
+		{"DEL", "missing"},
+		{"ZADD", "zset", "1", "m"},
+		{"ZADD", "zset", "NX", "2", "m"},
+		{"HISTORY.ENABLE", "str", "3"},
+		{"SET", "str", "2"},
+		{"MULTI"},
+	} {
+		if r := execCmd(s, c, cmdLine...); reply.IsErrorReply(r) {
+			t.Fatalf("%v: %s", cmdLine, r.ToBytes())
+		}
+	}
+	execCmd(s, c, "SET", "str", "3")
+	execCmd(s, c, "INCR", "counter")
+	execCmd(s, c, "EXEC")
+
+	keys := []string{"str", "ex", "missing", "zset", "counter"}
+	expected := keyVersions(s, keys...)
+	if expected[0] != 3 || expected[1] != 1 || expected[2] != 1 || expected[3] != 2 {
+		t.Fatalf("versions before replay: %v", expected)
+	}
+	s.Close()
+
+	check := func(stage string) {
+		s = NewStandaloneServer()
+		versions := keyVersions(s, keys...)
+		for i := range keys {
+			if versions[i] != expected[i] {
+				t.Errorf("%s: version of %s is %d, expected %d", stage, keys[i], versions[i], expected[i])
+			}
+		}
+		// 历史记录以恢复之后的版本号保存
+		if r := execCmd(s, c, "GETVERSION", "str", "3"); string(r.ToBytes()) != "$1\r\n3\r\n" {
+			t.Errorf("%s: GETVERSION str 3: %q", stage, r.ToBytes())
+		}
+	}
+	check("replay")
+	if r := execCmd(s, c, "REWRITEAOF"); reply.IsErrorReply(r) {
+		t.Fatalf("rewrite: %s", r.ToBytes())
+	}
+	s.Close()
+	check("rewrite")
+	s.Close()
+}
@@ -2,6 +2,7 @@ package aof
 
 import (
 	"github.com/dawnzzz/simple-redis/config"
+	"github.com/dawnzzz/simple-redis/datastruct/search"
 	"github.com/dawnzzz/simple-redis/interface/database"
 	"github.com/dawnzzz/simple-redis/lib/utils"
 	"github.com/dawnzzz/simple-redis/logger"
@@ -108,6 +109,12 @@ func (persister *Persister) DoRewrite(rewriteCtx *RewriteCtx) error {
 			return err
 		}
 
+		// 写入二级索引的定义，之后写入的 hash 会自动加入索引
+		rewritePersister.db.ForEachIndex(i, func(idx *search.Index) bool {
+			_, _ = tmpFile.Write(utils.IndexToBytes(idx))
+			return true
+		})
+
 		// 调用 foreach 函数，遍历数据库中的每一个 key，将每一个键值对写入到临时文件中。
 		rewritePersister.db.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
 			bytes := utils.EntityToBytes(key, entity)
@@ -124,6 +131,18 @@ func (persister *Persister) DoRewrite(rewriteCtx *RewriteCtx) error {
 
 			return true
 		})
+
+		// 最后写入版本号，覆盖写入数据时增加的版本号
+		rewritePersister.db.ForEachVersion(i, func(key string, version uint32) bool {
+			_, _ = tmpFile.Write(utils.VersionToBytes(key, version))
+			return true
+		})
+
+		// 开启历史记录时保存 key 当前的版本，需要在恢复版本号之后写入
+		rewritePersister.db.ForEachHistory(i, func(key string, capacity int) bool {
+			_, _ = tmpFile.Write(utils.HistoryToBytes(key, capacity))
+			return true
+		})
 	}
 
 	return nil
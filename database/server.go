@@ -1,19 +1,20 @@
 package database
 
 import (
+	"github.com/bwmarrin/snowflake"
 	"github.com/dawnzzz/simple-redis/config"
 	"github.com/dawnzzz/simple-redis/database/cluster"
 	_ "github.com/dawnzzz/simple-redis/database/commands"
 	"github.com/dawnzzz/simple-redis/database/engine"
 	"github.com/dawnzzz/simple-redis/database/publish"
 	"github.com/dawnzzz/simple-redis/database/rdb/aof"
+	"github.com/dawnzzz/simple-redis/datastruct/search"
 	"github.com/dawnzzz/simple-redis/interface/database"
 	"github.com/dawnzzz/simple-redis/interface/redis"
 	"github.com/dawnzzz/simple-redis/lib/utils"
 	"github.com/dawnzzz/simple-redis/logger"
 	"github.com/dawnzzz/simple-redis/redis/connection"
 	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
-	"github.com/sirupsen/logrus"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -30,6 +31,8 @@ type Server struct {
 	closed       chan struct{}
 	cluster      *cluster.Cluster
 	publish      publish.Publish
+	idGenerator  *snowflake.Node // 集群模式下与分布式事务共用同一个生成器
+	memory       memoryTracker
 }
 
 // NewStandaloneServer creates a standalone redis server
@@ -44,7 +47,7 @@ func NewClusterServer(peers []string) *Server {
 	server := initServer()
 
 	// 加入集群
-	cluster := cluster.NewCluster(config.Properties.Self)
+	cluster := cluster.NewCluster(config.Properties.Self, server.idGenerator)
 	cluster.AddPeers(peers...)
 	if cluster == nil {
 		logger.Fatalf("please set 'self'(self ip:port) in conf file")
@@ -78,6 +81,9 @@ func (s *Server) execStandalone(client redis.Connection, cmdLine [][]byte) redis
 		if !isAuthenticated(client) {
 			return reply.MakeErrReply("NOAUTH Authentication required")
 		}
+		if engine.IsInternalCommand(cmdName) {
+			return reply.MakeErrReply("ERR command '" + cmdName + "' can only be used when loading AOF")
+		}
 	}
 	switch cmdName {
 	case "select":
@@ -104,6 +110,16 @@ func (s *Server) execStandalone(client redis.Connection, cmdLine [][]byte) redis
 		return UnSubscribe(s, client, cmdLine[1:])
 	case "pubsub":
 		return PubSub(s, cmdLine[1:])
+	case "idgen":
+		return IDGen(s, cmdLine[1:])
+	case "idparse":
+		return IDParse(cmdLine[1:])
+	case "memory":
+		if isMemoryStats(cmdLine) {
+			return MemoryStats(s, cmdLine[1:])
+		}
+	case "analyze":
+		return Analyze(s, cmdLine[1:])
 	}
 
 	// normal commands
@@ -131,6 +147,9 @@ func (s *Server) execCluster(client redis.Connection, cmdLine [][]byte) redis.Re
 		if !isAuthenticated(client) {
 			return reply.MakeErrReply("NOAUTH Authentication required")
 		}
+		if engine.IsInternalCommand(cmdName) {
+			return reply.MakeErrReply("ERR command '" + cmdName + "' can only be used when loading AOF")
+		}
 	}
 
 	switch cmdName {
@@ -180,6 +199,16 @@ func (s *Server) execCluster(client redis.Connection, cmdLine [][]byte) redis.Re
 		return PublishCluster(s, cmdLine[1:])
 	case "pubsub":
 		return PubSubCluster(s, cmdLine[1:])
+	case "idgen":
+		return IDGen(s, cmdLine[1:])
+	case "idparse":
+		return IDParse(cmdLine[1:])
+	case "memory":
+		if isMemoryStats(cmdLine) {
+			return MemoryStats(s, cmdLine[1:])
+		}
+	case "analyze":
+		return Analyze(s, cmdLine[1:])
 	}
 
 	// normal commands
@@ -201,6 +230,11 @@ func initServer() *Server {
 	if config.Properties.Databases <= 0 {
 		config.Properties.Databases = 16 // default is 16
 	}
+	idGenerator, err := cluster.NewSnowflakeNode(config.Properties.Self)
+	if err != nil {
+		logger.Fatalf("invalid node_id: %v", err)
+	}
+	server.idGenerator = idGenerator
 	server.dbSet = make([]*atomic.Value, config.Properties.Databases)
 	for i := range server.dbSet {
 		singleDB := engine.MakeDB()
@@ -219,13 +253,25 @@ func initServer() *Server {
 		// 获取初始AOF文件大小
 		server.AofFileSize = utils.GetFileSizeByName(config.Properties.AofFilename)
 
-		// 开启 AOF 持久化
+		// 开启 AOF 持久化，加载 AOF 时版本号由 KEYVERSION.SET 恢复
+		for _, holder := range server.dbSet {
+			holder.Load().(*engine.DB).SetLoading(true)
+		}
 		AofPersister, err := aof.NewPersister(server, config.Properties.AofFilename, true, config.Properties.AofFsync, MakeAuxiliaryServer)
 		if err != nil {
-			logrus.Fatal(err)
+			logger.Fatalf("open aof file failed: %v", err)
+		}
+		for _, holder := range server.dbSet {
+			holder.Load().(*engine.DB).SetLoading(false)
 		}
 		server.bindPersister(AofPersister)
 
+		// 加载 AOF 之后根据数据重建二级索引，重放命令的访问不计入热点 key
+		for _, holder := range server.dbSet {
+			holder.Load().(*engine.DB).RebuildIndexes()
+			holder.Load().(*engine.DB).ResetHotKeys()
+		}
+
 		// 自动 AOF 重写
 		if config.Properties.AutoAofRewrite {
 			if config.Properties.AutoAofRewritePercentage <= 0 {
@@ -240,6 +286,12 @@ func initServer() *Server {
 		}
 	}
 
+	// 加载 AOF 之后开启内存淘汰
+	if !engine.IsEvictionPolicy(config.Properties.MaxmemoryPolicy) {
+		logger.Fatalf("unknown maxmemory_policy '%s'", config.Properties.MaxmemoryPolicy)
+	}
+	server.bindMemoryGuard()
+
 	return server
 }
 
@@ -285,6 +337,24 @@ func (s *Server) ForEach(dbIndex int, cb func(key string, data *database.DataEnt
 	db.ForEach(cb)
 }
 
+// ForEachIndex 遍历数据库中所有的二级索引
+func (s *Server) ForEachIndex(dbIndex int, cb func(idx *search.Index) bool) {
+	db := s.mustSelectDB(dbIndex)
+	db.Indexes().ForEach(cb)
+}
+
+// ForEachVersion 遍历数据库中所有 key 的版本号
+func (s *Server) ForEachVersion(dbIndex int, cb func(key string, version uint32) bool) {
+	db := s.mustSelectDB(dbIndex)
+	db.ForEachVersion(cb)
+}
+
+// ForEachHistory 遍历数据库中所有开启历史记录的 key
+func (s *Server) ForEachHistory(dbIndex int, cb func(key string, capacity int) bool) {
+	db := s.mustSelectDB(dbIndex)
+	db.ForEachHistory(cb)
+}
+
 func (s *Server) autoAofRewrite() {
 	ticker := time.NewTicker(10 * time.Second)
 	for {
@@ -0,0 +1,290 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	DefaultErrorRate = 0.01
+	DefaultCapacity  = 100
+	DefaultExpansion = 2
+
+	tighteningRatio = 0.5 // 每个新的子过滤器的误判率是上一个的一半，保证总的误判率不超过 errorRate
+)
+
+var (
+	ErrFull    = errors.New("ERR non scaling filter is full")
+	ErrBadDump = errors.New("ERR invalid bloom filter dump")
+)
+
+// filter 固定容量的布隆过滤器
+type filter struct {
+	capacity uint64
+	hashes   uint32 // 哈希函数的个数
+	items    uint64 // 已经添加的元素数量
+	bits     []byte
+}
+
+func makeFilter(capacity uint64, errorRate float64) *filter {
+	// m = -n * ln(p) / (ln2)^2，k = m / n * ln2
+	bitsPerItem := -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+	numBits := uint64(math.Ceil(float64(capacity) * bitsPerItem))
+	if numBits < 64 {
+		numBits = 64
+	}
+	hashes := uint32(math.Ceil(math.Ln2 * bitsPerItem))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &filter{
+		capacity: capacity,
+		hashes:   hashes,
+		bits:     make([]byte, (numBits+7)/8),
+	}
+}
+
+func (f *filter) numBits() uint64 {
+	return uint64(len(f.bits)) * 8
+}
+
+// add 设置元素对应的所有位，有位被修改时返回 true
+func (f *filter) add(h1, h2 uint64) bool {
+	added := false
+	m := f.numBits()
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		pos := (h1 + i*h2) % m
+		if f.bits[pos/8]&(1<<(pos%8)) == 0 {
+			f.bits[pos/8] |= 1 << (pos % 8)
+			added = true
+		}
+	}
+	return added
+}
+
+func (f *filter) exists(h1, h2 uint64) bool {
+	m := f.numBits()
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		pos := (h1 + i*h2) % m
+		if f.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ScalableBloomFilter 可扩容的布隆过滤器，最后一个子过滤器满了之后创建一个容量为 expansion 倍的新的子过滤器
+type ScalableBloomFilter struct {
+	errorRate  float64
+	expansion  uint32
+	nonScaling bool
+	filters    []*filter
+}
+
+func MakeScalableBloomFilter(errorRate float64, capacity uint64, expansion uint32, nonScaling bool) *ScalableBloomFilter {
+	return &ScalableBloomFilter{
+		errorRate:  errorRate,
+		expansion:  expansion,
+		nonScaling: nonScaling,
+		filters:    []*filter{makeFilter(capacity, errorRate*tighteningRatio)},
+	}
+}
+
+// hash 使用 128 位的 FNV-1a 得到两个 64 位的哈希值，通过 h1 + i*h2 模拟 k 个哈希函数
+func hash(item []byte) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write(item)
+	sum := h.Sum(nil)
+	h1 := mix64(binary.BigEndian.Uint64(sum[:8]))
+	h2 := mix64(binary.BigEndian.Uint64(sum[8:])) | 1 // 保证 h2 不为 0
+	return h1, h2
+}
+
+// mix64 MurmurHash3 的 fmix64，FNV 对较短的输入扩散不够充分，需要再混合一次
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// Add 添加元素，元素可能已经存在时返回 false
+func (bf *ScalableBloomFilter) Add(item []byte) (bool, error) {
+	h1, h2 := hash(item)
+	if bf.exists(h1, h2) {
+		return false, nil
+	}
+
+	last := bf.filters[len(bf.filters)-1]
+	if last.items >= last.capacity {
+		if bf.nonScaling {
+			return false, ErrFull
+		}
+		errorRate := bf.errorRate * math.Pow(tighteningRatio, float64(len(bf.filters)+1))
+		last = makeFilter(last.capacity*uint64(bf.expansion), errorRate)
+		bf.filters = append(bf.filters, last)
+	}
+	last.add(h1, h2)
+	last.items++
+	return true, nil
+}
+
+// Exists 判断元素是否可能存在
+func (bf *ScalableBloomFilter) Exists(item []byte) bool {
+	h1, h2 := hash(item)
+	return bf.exists(h1, h2)
+}
+
+func (bf *ScalableBloomFilter) exists(h1, h2 uint64) bool {
+	for i := len(bf.filters) - 1; i >= 0; i-- {
+		if bf.filters[i].exists(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Capacity 返回所有子过滤器的容量之和
+func (bf *ScalableBloomFilter) Capacity() uint64 {
+	var capacity uint64
+	for _, f := range bf.filters {
+		capacity += f.capacity
+	}
+	return capacity
+}
+
+// Size 返回占用的字节数
+func (bf *ScalableBloomFilter) Size() uint64 {
+	var size uint64
+	for _, f := range bf.filters {
+		size += uint64(len(f.bits))
+	}
+	return size
+}
+
+func (bf *ScalableBloomFilter) NumFilters() int {
+	return len(bf.filters)
+}
+
+// Items 返回添加的元素数量
+func (bf *ScalableBloomFilter) Items() uint64 {
+	var items uint64
+	for _, f := range bf.filters {
+		items += f.items
+	}
+	return items
+}
+
+// Expansion 返回扩容倍数，不可扩容时返回 0
+func (bf *ScalableBloomFilter) Expansion() uint32 {
+	if bf.nonScaling {
+		return 0
+	}
+	return bf.expansion
+}
+
+// Dump 将布隆过滤器序列化为紧凑的二进制格式，用于 AOF 重写
+func (bf *ScalableBloomFilter) Dump() []byte {
+	buf := make([]byte, 0, 32+bf.Size()+uint64(len(bf.filters))*24)
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(bf.errorRate))
+	buf = binary.LittleEndian.AppendUint32(buf, bf.expansion)
+	if bf.nonScaling {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(bf.filters)))
+	for _, f := range bf.filters {
+		buf = binary.LittleEndian.AppendUint64(buf, f.capacity)
+		buf = binary.LittleEndian.AppendUint32(buf, f.hashes)
+		buf = binary.LittleEndian.AppendUint64(buf, f.items)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(f.bits)))
+		buf = append(buf, f.bits...)
+	}
+	return buf
+}
+
+// Restore 从 Dump 的结果中恢复布隆过滤器
+func Restore(data []byte) (*ScalableBloomFilter, error) {
+	r := &reader{data: data}
+	bf := &ScalableBloomFilter{
+		errorRate: math.Float64frombits(r.uint64()),
+		expansion: r.uint32(),
+	}
+	bf.nonScaling = r.byte() == 1
+	numFilters := r.uint32()
+	if r.err != nil || numFilters == 0 || uint64(numFilters) > uint64(len(data)) {
+		return nil, ErrBadDump
+	}
+	bf.filters = make([]*filter, 0, numFilters)
+	for i := uint32(0); i < numFilters && r.err == nil; i++ {
+		f := &filter{
+			capacity: r.uint64(),
+			hashes:   r.uint32(),
+			items:    r.uint64(),
+		}
+		size := r.uint64()
+		f.bits = append([]byte(nil), r.bytes(size)...)
+		if r.err == nil && (f.hashes == 0 || size == 0) {
+			return nil, ErrBadDump
+		}
+		bf.filters = append(bf.filters, f)
+	}
+	if r.err != nil || r.pos != len(data) {
+		return nil, ErrBadDump
+	}
+	return bf, nil
+}
+
+// reader 按顺序读取 Dump 的结果
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) bytes(n uint64) []byte {
+	if r.err != nil || n > uint64(len(r.data)-r.pos) {
+		r.err = ErrBadDump
+		return nil
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if r.err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint16() uint16 {
+	b := r.bytes(2)
+	if r.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.bytes(4)
+	if r.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *reader) uint64() uint64 {
+	b := r.bytes(8)
+	if r.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
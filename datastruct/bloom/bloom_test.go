@@ -0,0 +1,221 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+func TestScalableBloomFilter(t *testing.T) {
+	bf := MakeScalableBloomFilter(0.01, 100, 2, false)
+	for i := 0; i < 1000; i++ {
+		if _, err := bf.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if !bf.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("false negative: %d", i)
+		}
+	}
+	if bf.NumFilters() <= 1 {
+		t.Error("filter should scale")
+	}
+
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		if bf.Exists([]byte(strconv.Itoa(i))) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("too many false positives: %d", falsePositives)
+	}
+
+	if added, _ := bf.Add([]byte("1")); added {
+		t.Error("Add existing item error")
+	}
+
+	restored, err := Restore(bf.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Items() != bf.Items() || restored.Capacity() != bf.Capacity() || !restored.Exists([]byte("999")) {
+		t.Error("Restore error")
+	}
+	if _, err := Restore(bf.Dump()[1:]); err == nil {
+		t.Error("Restore bad dump should fail")
+	}
+
+	nonScaling := MakeScalableBloomFilter(0.01, 10, 2, true)
+	var err2 error
+	for i := 0; i < 100 && err2 == nil; i++ {
+		_, err2 = nonScaling.Add([]byte(strconv.Itoa(i)))
+	}
+	if err2 != ErrFull {
+		t.Error("non scaling filter should be full")
+	}
+}
+
+func TestCuckooFilter(t *testing.T) {
+	cf := MakeCuckooFilter(64, DefaultCuckooBucketSize, DefaultCuckooMaxIterations, DefaultCuckooExpansion)
+	for i := 0; i < 500; i++ {
+		if err := cf.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 500; i++ {
+		if !cf.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("false negative: %d", i)
+		}
+	}
+	if cf.NumFilters() <= 1 || cf.Items() != 500 {
+		t.Error("filter should scale")
+	}
+
+	_ = cf.Add([]byte("1"))
+	if cf.Count([]byte("1")) < 2 {
+		t.Error("Count error")
+	}
+	if !cf.Delete([]byte("1")) || !cf.Delete([]byte("1")) {
+		t.Error("Delete error")
+	}
+	if cf.Items() != 499 || cf.Deleted() != 2 {
+		t.Error("Items error")
+	}
+
+	restored, err := RestoreCuckooFilter(cf.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Items() != cf.Items() || !restored.Exists([]byte("42")) {
+		t.Error("Restore error")
+	}
+
+	nonScaling := MakeCuckooFilter(8, 2, 20, 0)
+	var addErr error
+	for i := 0; i < 100 && addErr == nil; i++ {
+		addErr = nonScaling.Add([]byte(strconv.Itoa(i)))
+	}
+	if addErr != ErrCuckooFull {
+		t.Error("non scaling filter should be full")
+	}
+	for i := 0; i < int(nonScaling.Items()); i++ {
+		if !nonScaling.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("false negative after failed insert: %d", i)
+		}
+	}
+}
+
+func TestCountMinSketch(t *testing.T) {
+	cms := MakeCountMinSketchByProb(0.001, 0.01)
+	if cms.Width() != 2000 || cms.Depth() != 7 {
+		t.Errorf("dimension error: %d %d", cms.Width(), cms.Depth())
+	}
+	for i := 0; i < 1000; i++ {
+		cms.IncrBy([]byte(strconv.Itoa(i)), uint64(i%10+1))
+	}
+	for i := 0; i < 1000; i++ {
+		if v := cms.Query([]byte(strconv.Itoa(i))); v < uint64(i%10+1) {
+			t.Fatalf("estimation smaller than real count: %d", i)
+		}
+	}
+
+	other := MakeCountMinSketch(cms.Width(), cms.Depth())
+	other.IncrBy([]byte("1"), 100)
+	merged := MakeCountMinSketch(cms.Width(), cms.Depth())
+	if err := merged.Merge([]*CountMinSketch{cms, other}, []int64{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if v := merged.Query([]byte("1")); v < 202 {
+		t.Errorf("Merge error: %d", v)
+	}
+	if err := merged.Merge([]*CountMinSketch{MakeCountMinSketch(1, 1)}, []int64{1}); err != ErrCMSDimension {
+		t.Error("Merge with different dimension should fail")
+	}
+
+	restored, err := RestoreCountMinSketch(merged.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Count() != merged.Count() || restored.Query([]byte("1")) != merged.Query([]byte("1")) {
+		t.Error("Restore error")
+	}
+}
+
+func TestTopK(t *testing.T) {
+	topK := MakeTopK(3, 100, DefaultTopKDepth, DefaultTopKDecay)
+	// 元素 i 出现 i 次
+	for i := 1; i <= 20; i++ {
+		for j := 0; j < i; j++ {
+			topK.IncrBy([]byte(strconv.Itoa(i)), 1)
+		}
+	}
+	list := topK.List()
+	if len(list) != 3 || list[0].Item != "20" {
+		t.Errorf("List error: %s %d", list[0].Item, list[0].Count)
+	}
+	if !topK.Query([]byte("20")) || topK.Query([]byte("1")) {
+		t.Error("Query error")
+	}
+
+	restored, err := RestoreTopK(topK.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 相同的操作在恢复之后得到相同的结果
+	expelled1, ok1 := topK.IncrBy([]byte("new"), 50)
+	expelled2, ok2 := restored.IncrBy([]byte("new"), 50)
+	if expelled1 != expelled2 || ok1 != ok2 || !restored.Query([]byte("new")) {
+		t.Error("Restore error")
+	}
+}
+
+// 短的连续整数以及二进制整数作为元素时，实际的误判率不能明显超过预期的误判率
+func TestFalsePositiveRate(t *testing.T) {
+	keys := map[string]func(i int) []byte{
+		"decimal": func(i int) []byte { return []byte(strconv.Itoa(i)) },
+		"binary": func(i int) []byte {
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, uint32(i))
+			return b
+		},
+	}
+	for name, key := range keys {
+		for _, errorRate := range []float64{0.01, 0.001} {
+			bf := MakeScalableBloomFilter(errorRate, 10000, 2, true)
+			for i := 0; i < 10000; i++ {
+				if _, err := bf.Add(key(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			falsePositives := 0
+			for i := 10000; i < 110000; i++ {
+				if bf.Exists(key(i)) {
+					falsePositives++
+				}
+			}
+			if rate := float64(falsePositives) / 100000; rate > errorRate*1.5 {
+				t.Errorf("%s: bloom false positive rate %f, expected %f", name, rate, errorRate)
+			}
+		}
+
+		// 每个元素在两个桶中比较指纹，指纹有 255 种取值，误判率约为 2*bucketSize/255
+		cf := MakeCuckooFilter(10000, DefaultCuckooBucketSize, DefaultCuckooMaxIterations, 0)
+		for i := 0; i < 9000; i++ {
+			if err := cf.Add(key(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		falsePositives := 0
+		for i := 10000; i < 110000; i++ {
+			if cf.Exists(key(i)) {
+				falsePositives++
+			}
+		}
+		expected := 2 * float64(DefaultCuckooBucketSize) / 255
+		if rate := float64(falsePositives) / 100000; rate > expected {
+			t.Errorf("%s: cuckoo false positive rate %f, expected %f", name, rate, expected)
+		}
+	}
+}
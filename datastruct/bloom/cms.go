@@ -0,0 +1,150 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var ErrCMSDimension = errors.New("ERR CMS: width/depth is not equal")
+
+// CountMinSketch 使用 depth 行、每行 width 个计数器估计元素出现的次数，估计值不会小于真实值
+type CountMinSketch struct {
+	width    uint32
+	depth    uint32
+	count    uint64 // 所有元素增加的次数之和
+	counters []uint64
+}
+
+func MakeCountMinSketch(width, depth uint32) *CountMinSketch {
+	return &CountMinSketch{
+		width:    width,
+		depth:    depth,
+		counters: make([]uint64, uint64(width)*uint64(depth)),
+	}
+}
+
+// MakeCountMinSketchByProb 根据误差与概率创建，估计值超过真实值 error * count 的概率不超过 probability
+func MakeCountMinSketchByProb(error, probability float64) *CountMinSketch {
+	width := uint32(math.Ceil(2 / error))
+	depth := uint32(math.Ceil(math.Log(probability) / math.Log(0.5)))
+	if depth < 1 {
+		depth = 1
+	}
+	return MakeCountMinSketch(width, depth)
+}
+
+func (cms *CountMinSketch) index(row uint32, h1, h2 uint64) uint64 {
+	return uint64(row)*uint64(cms.width) + (h1+uint64(row)*h2)%uint64(cms.width)
+}
+
+// IncrBy 增加元素的计数，返回增加之后的估计值
+func (cms *CountMinSketch) IncrBy(item []byte, increment uint64) uint64 {
+	h1, h2 := hash(item)
+	min := uint64(math.MaxUint64)
+	for row := uint32(0); row < cms.depth; row++ {
+		i := cms.index(row, h1, h2)
+		cms.counters[i] = saturatingAdd(cms.counters[i], increment)
+		if cms.counters[i] < min {
+			min = cms.counters[i]
+		}
+	}
+	cms.count = saturatingAdd(cms.count, increment)
+	return min
+}
+
+// Query 估计元素出现的次数
+func (cms *CountMinSketch) Query(item []byte) uint64 {
+	h1, h2 := hash(item)
+	min := uint64(math.MaxUint64)
+	for row := uint32(0); row < cms.depth; row++ {
+		if v := cms.counters[cms.index(row, h1, h2)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Merge 将多个 sketch 按照权重合并，结果覆盖当前 sketch，所有 sketch 的维度必须相同
+func (cms *CountMinSketch) Merge(sources []*CountMinSketch, weights []int64) error {
+	for _, src := range sources {
+		if src.width != cms.width || src.depth != cms.depth {
+			return ErrCMSDimension
+		}
+	}
+
+	counters := make([]uint64, len(cms.counters))
+	for i := range counters {
+		var sum float64
+		for j, src := range sources {
+			sum += float64(src.counters[i]) * float64(weights[j])
+		}
+		counters[i] = clampToUint64(sum)
+	}
+	var count float64
+	for j, src := range sources {
+		count += float64(src.count) * float64(weights[j])
+	}
+
+	cms.counters = counters
+	cms.count = clampToUint64(count)
+	return nil
+}
+
+func (cms *CountMinSketch) Width() uint32 {
+	return cms.width
+}
+
+func (cms *CountMinSketch) Depth() uint32 {
+	return cms.depth
+}
+
+func (cms *CountMinSketch) Count() uint64 {
+	return cms.count
+}
+
+// Dump 将 sketch 序列化为紧凑的二进制格式，用于 AOF 重写
+func (cms *CountMinSketch) Dump() []byte {
+	buf := make([]byte, 0, 16+8*len(cms.counters))
+	buf = binary.LittleEndian.AppendUint32(buf, cms.width)
+	buf = binary.LittleEndian.AppendUint32(buf, cms.depth)
+	buf = binary.LittleEndian.AppendUint64(buf, cms.count)
+	for _, v := range cms.counters {
+		buf = binary.LittleEndian.AppendUint64(buf, v)
+	}
+	return buf
+}
+
+// RestoreCountMinSketch 从 Dump 的结果中恢复 sketch
+func RestoreCountMinSketch(data []byte) (*CountMinSketch, error) {
+	r := &reader{data: data}
+	width, depth := r.uint32(), r.uint32()
+	count := r.uint64()
+	size := uint64(width) * uint64(depth)
+	if r.err != nil || size == 0 || size*8 != uint64(len(data)-r.pos) {
+		return nil, ErrBadDump
+	}
+	cms := MakeCountMinSketch(width, depth)
+	cms.count = count
+	for i := range cms.counters {
+		cms.counters[i] = r.uint64()
+	}
+	return cms, nil
+}
+
+func saturatingAdd(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+func clampToUint64(v float64) uint64 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(v)
+}
@@ -0,0 +1,295 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+const (
+	DefaultCuckooCapacity      = 1024
+	DefaultCuckooBucketSize    = 2
+	DefaultCuckooMaxIterations = 20
+	DefaultCuckooExpansion     = 1
+)
+
+var ErrCuckooFull = errors.New("ERR Filter is full")
+
+// cuckooFilter 固定容量的布谷鸟过滤器，每个桶中保存 bucketSize 个 8 位的指纹，指纹为 0 表示空位
+type cuckooFilter struct {
+	numBuckets uint64 // 桶的数量，为 2 的幂
+	items      uint64
+	buckets    []byte // numBuckets * bucketSize
+}
+
+func makeCuckooFilter(capacity uint64, bucketSize uint16) *cuckooFilter {
+	numBuckets := uint64(1)
+	for numBuckets*uint64(bucketSize) < capacity {
+		numBuckets <<= 1
+	}
+	return &cuckooFilter{
+		numBuckets: numBuckets,
+		buckets:    make([]byte, numBuckets*uint64(bucketSize)),
+	}
+}
+
+// CuckooFilter 可扩容的布谷鸟过滤器，支持删除与计数
+// 所有子过滤器都满了之后创建一个容量为 expansion 倍的新的子过滤器，expansion 为 0 时不可扩容
+type CuckooFilter struct {
+	capacity      uint64
+	bucketSize    uint16
+	maxIterations uint16
+	expansion     uint16
+	deleted       uint64 // 删除的元素数量
+	filters       []*cuckooFilter
+}
+
+func MakeCuckooFilter(capacity uint64, bucketSize, maxIterations, expansion uint16) *CuckooFilter {
+	return &CuckooFilter{
+		capacity:      capacity,
+		bucketSize:    bucketSize,
+		maxIterations: maxIterations,
+		expansion:     expansion,
+		filters:       []*cuckooFilter{makeCuckooFilter(capacity, bucketSize)},
+	}
+}
+
+// cuckooHash 计算元素的指纹与哈希值
+func cuckooHash(item []byte) (fp byte, h uint64) {
+	hash := fnv.New64a()
+	_, _ = hash.Write(item)
+	h = mix64(hash.Sum64())
+	fp = byte(h>>32%255 + 1) // 指纹不能为 0
+	return fp, h
+}
+
+// altIndex 计算指纹的另一个候选桶，altIndex(altIndex(i)) == i
+func (cf *cuckooFilter) altIndex(index uint64, fp byte) uint64 {
+	return (index ^ (uint64(fp) * 0x5bd1e995)) & (cf.numBuckets - 1)
+}
+
+func (cf *CuckooFilter) bucket(f *cuckooFilter, index uint64) []byte {
+	size := uint64(cf.bucketSize)
+	return f.buckets[index*size : (index+1)*size]
+}
+
+// insert 将指纹插入子过滤器，失败时子过滤器保持不变
+func (cf *CuckooFilter) insert(f *cuckooFilter, fp byte, h uint64) bool {
+	i1 := h & (f.numBuckets - 1)
+	i2 := f.altIndex(i1, fp)
+	for _, index := range []uint64{i1, i2} {
+		bucket := cf.bucket(f, index)
+		for slot, v := range bucket {
+			if v == 0 {
+				bucket[slot] = fp
+				f.items++
+				return true
+			}
+		}
+	}
+
+	// 两个候选桶都满了，踢出桶中的指纹放到它的另一个候选桶中
+	// 踢出的位置是确定的，保证 AOF 重放之后得到相同的结果
+	type kick struct {
+		index uint64
+		slot  int
+	}
+	kicks := make([]kick, 0, cf.maxIterations)
+	index := i2
+	for i := 0; i < int(cf.maxIterations); i++ {
+		bucket := cf.bucket(f, index)
+		slot := i % int(cf.bucketSize)
+		fp, bucket[slot] = bucket[slot], fp
+		kicks = append(kicks, kick{index: index, slot: slot})
+
+		index = f.altIndex(index, fp)
+		bucket = cf.bucket(f, index)
+		for s, v := range bucket {
+			if v == 0 {
+				bucket[s] = fp
+				f.items++
+				return true
+			}
+		}
+	}
+
+	// 插入失败，撤销所有的踢出操作
+	for i := len(kicks) - 1; i >= 0; i-- {
+		bucket := cf.bucket(f, kicks[i].index)
+		fp, bucket[kicks[i].slot] = bucket[kicks[i].slot], fp
+	}
+	return false
+}
+
+// Add 添加元素，允许重复添加
+func (cf *CuckooFilter) Add(item []byte) error {
+	fp, h := cuckooHash(item)
+	// 从最新的子过滤器开始尝试
+	for i := len(cf.filters) - 1; i >= 0; i-- {
+		if cf.insert(cf.filters[i], fp, h) {
+			return nil
+		}
+	}
+	if cf.expansion == 0 {
+		return ErrCuckooFull
+	}
+
+	last := cf.filters[len(cf.filters)-1]
+	capacity := last.numBuckets * uint64(cf.bucketSize) * uint64(cf.expansion)
+	f := makeCuckooFilter(capacity, cf.bucketSize)
+	cf.filters = append(cf.filters, f)
+	if !cf.insert(f, fp, h) {
+		return ErrCuckooFull
+	}
+	return nil
+}
+
+// Count 返回元素可能出现的次数
+func (cf *CuckooFilter) Count(item []byte) int {
+	fp, h := cuckooHash(item)
+	count := 0
+	for _, f := range cf.filters {
+		i1 := h & (f.numBuckets - 1)
+		i2 := f.altIndex(i1, fp)
+		for _, v := range cf.bucket(f, i1) {
+			if v == fp {
+				count++
+			}
+		}
+		if i2 == i1 {
+			continue
+		}
+		for _, v := range cf.bucket(f, i2) {
+			if v == fp {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Exists 判断元素是否可能存在
+func (cf *CuckooFilter) Exists(item []byte) bool {
+	return cf.Count(item) > 0
+}
+
+// Delete 删除元素的一次出现，元素不存在时返回 false
+func (cf *CuckooFilter) Delete(item []byte) bool {
+	fp, h := cuckooHash(item)
+	for i := len(cf.filters) - 1; i >= 0; i-- {
+		f := cf.filters[i]
+		i1 := h & (f.numBuckets - 1)
+		for _, index := range []uint64{i1, f.altIndex(i1, fp)} {
+			bucket := cf.bucket(f, index)
+			for slot, v := range bucket {
+				if v == fp {
+					bucket[slot] = 0
+					f.items--
+					cf.deleted++
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Items 返回过滤器中的元素数量
+func (cf *CuckooFilter) Items() uint64 {
+	var items uint64
+	for _, f := range cf.filters {
+		items += f.items
+	}
+	return items
+}
+
+func (cf *CuckooFilter) Deleted() uint64 {
+	return cf.deleted
+}
+
+// NumBuckets 返回所有子过滤器的桶数量之和
+func (cf *CuckooFilter) NumBuckets() uint64 {
+	var numBuckets uint64
+	for _, f := range cf.filters {
+		numBuckets += f.numBuckets
+	}
+	return numBuckets
+}
+
+func (cf *CuckooFilter) NumFilters() int {
+	return len(cf.filters)
+}
+
+// Size 返回占用的字节数
+func (cf *CuckooFilter) Size() uint64 {
+	var size uint64
+	for _, f := range cf.filters {
+		size += uint64(len(f.buckets))
+	}
+	return size
+}
+
+func (cf *CuckooFilter) BucketSize() uint16 {
+	return cf.bucketSize
+}
+
+func (cf *CuckooFilter) MaxIterations() uint16 {
+	return cf.maxIterations
+}
+
+func (cf *CuckooFilter) Expansion() uint16 {
+	return cf.expansion
+}
+
+// Dump 将布谷鸟过滤器序列化为紧凑的二进制格式，用于 AOF 重写
+func (cf *CuckooFilter) Dump() []byte {
+	buf := make([]byte, 0, 32+cf.Size()+uint64(len(cf.filters))*16)
+	buf = binary.LittleEndian.AppendUint64(buf, cf.capacity)
+	buf = binary.LittleEndian.AppendUint16(buf, cf.bucketSize)
+	buf = binary.LittleEndian.AppendUint16(buf, cf.maxIterations)
+	buf = binary.LittleEndian.AppendUint16(buf, cf.expansion)
+	buf = binary.LittleEndian.AppendUint64(buf, cf.deleted)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(cf.filters)))
+	for _, f := range cf.filters {
+		buf = binary.LittleEndian.AppendUint64(buf, f.numBuckets)
+		buf = binary.LittleEndian.AppendUint64(buf, f.items)
+		buf = append(buf, f.buckets...)
+	}
+	return buf
+}
+
+// RestoreCuckooFilter 从 Dump 的结果中恢复布谷鸟过滤器
+func RestoreCuckooFilter(data []byte) (*CuckooFilter, error) {
+	r := &reader{data: data}
+	cf := &CuckooFilter{
+		capacity:      r.uint64(),
+		bucketSize:    r.uint16(),
+		maxIterations: r.uint16(),
+		expansion:     r.uint16(),
+		deleted:       r.uint64(),
+	}
+	numFilters := r.uint32()
+	if r.err != nil || numFilters == 0 || cf.bucketSize == 0 || uint64(numFilters) > uint64(len(data)) {
+		return nil, ErrBadDump
+	}
+	cf.filters = make([]*cuckooFilter, 0, numFilters)
+	for i := uint32(0); i < numFilters && r.err == nil; i++ {
+		f := &cuckooFilter{
+			numBuckets: r.uint64(),
+			items:      r.uint64(),
+		}
+		// 桶的数量必须是 2 的幂
+		if r.err != nil || f.numBuckets == 0 || f.numBuckets&(f.numBuckets-1) != 0 {
+			return nil, ErrBadDump
+		}
+		if f.numBuckets > uint64(len(data)) {
+			return nil, ErrBadDump
+		}
+		f.buckets = append([]byte(nil), r.bytes(f.numBuckets*uint64(cf.bucketSize))...)
+		cf.filters = append(cf.filters, f)
+	}
+	if r.err != nil || r.pos != len(data) {
+		return nil, ErrBadDump
+	}
+	return cf, nil
+}
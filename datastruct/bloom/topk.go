@@ -0,0 +1,280 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+const (
+	DefaultTopKWidth = 8
+	DefaultTopKDepth = 7
+	DefaultTopKDecay = 0.9
+)
+
+// heavyKeeperBucket HeavyKeeper 中的一个桶，保存指纹以及计数
+type heavyKeeperBucket struct {
+	fp    uint32
+	count uint32
+}
+
+// TopKItem Top-K 中的一个元素
+type TopKItem struct {
+	Item  string
+	Count uint32
+	fp    uint32
+}
+
+// TopK 使用 HeavyKeeper 算法统计出现次数最多的 k 个元素
+// 计数器衰减使用的随机数由保存在结构体中的种子生成，保证 AOF 重放之后得到相同的结果
+type TopK struct {
+	k       uint32
+	width   uint32
+	depth   uint32
+	decay   float64
+	seed    uint64
+	buckets []heavyKeeperBucket // depth * width
+	heap    []*TopKItem         // 按照计数排序的小顶堆
+}
+
+func MakeTopK(k, width, depth uint32, decay float64) *TopK {
+	return &TopK{
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		seed:    0x9e3779b97f4a7c15,
+		buckets: make([]heavyKeeperBucket, uint64(width)*uint64(depth)),
+		heap:    make([]*TopKItem, 0, k),
+	}
+}
+
+// random 返回 [0, 1) 之间的伪随机数（xorshift64*）
+func (t *TopK) random() float64 {
+	t.seed ^= t.seed >> 12
+	t.seed ^= t.seed << 25
+	t.seed ^= t.seed >> 27
+	return float64((t.seed*0x2545f4914f6cdd1d)>>11) / (1 << 53)
+}
+
+func fingerprint(item []byte) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write(item)
+	return h.Sum32()
+}
+
+// IncrBy 增加元素的计数，元素进入 Top-K 时返回被挤出的元素
+func (t *TopK) IncrBy(item []byte, increment uint32) (expelled string, hasExpelled bool) {
+	fp := fingerprint(item)
+	h1, h2 := hash(item)
+
+	var maxCount uint32
+	for row := uint32(0); row < t.depth; row++ {
+		b := &t.buckets[uint64(row)*uint64(t.width)+(h1+uint64(row)*h2)%uint64(t.width)]
+		if b.count == 0 {
+			b.fp = fp
+			b.count = increment
+		} else if b.fp == fp {
+			b.count = saturatingAdd32(b.count, increment)
+		} else {
+			// 指纹不同时以 decay^count 的概率衰减，计数衰减到 0 时替换为当前元素
+			for i := uint32(0); i < increment; i++ {
+				if t.random() < math.Pow(t.decay, float64(b.count)) {
+					b.count--
+					if b.count == 0 {
+						b.fp = fp
+						b.count = increment - i
+						break
+					}
+				}
+			}
+		}
+		if b.fp == fp && b.count > maxCount {
+			maxCount = b.count
+		}
+	}
+
+	name := string(item)
+	if i := t.find(name, fp); i >= 0 {
+		if maxCount > t.heap[i].Count {
+			t.heap[i].Count = maxCount
+		}
+		t.fix(i)
+		return "", false
+	}
+	if maxCount == 0 {
+		return "", false
+	}
+
+	entry := &TopKItem{Item: name, Count: maxCount, fp: fp}
+	if uint32(len(t.heap)) < t.k {
+		t.heap = append(t.heap, entry)
+		t.up(len(t.heap) - 1)
+		return "", false
+	}
+	if maxCount > t.heap[0].Count {
+		expelled = t.heap[0].Item
+		t.heap[0] = entry
+		t.down(0)
+		return expelled, true
+	}
+	return "", false
+}
+
+// Query 判断元素是否在 Top-K 中
+func (t *TopK) Query(item []byte) bool {
+	return t.find(string(item), fingerprint(item)) >= 0
+}
+
+// Count 估计元素的计数
+func (t *TopK) Count(item []byte) uint32 {
+	fp := fingerprint(item)
+	h1, h2 := hash(item)
+	var maxCount uint32
+	for row := uint32(0); row < t.depth; row++ {
+		b := t.buckets[uint64(row)*uint64(t.width)+(h1+uint64(row)*h2)%uint64(t.width)]
+		if b.fp == fp && b.count > maxCount {
+			maxCount = b.count
+		}
+	}
+	return maxCount
+}
+
+// List 返回 Top-K 中的元素，按照计数从大到小排序
+func (t *TopK) List() []*TopKItem {
+	items := make([]*TopKItem, len(t.heap))
+	copy(items, t.heap)
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Item < items[j].Item
+	})
+	return items
+}
+
+func (t *TopK) K() uint32 {
+	return t.k
+}
+
+func (t *TopK) Width() uint32 {
+	return t.width
+}
+
+func (t *TopK) Depth() uint32 {
+	return t.depth
+}
+
+func (t *TopK) Decay() float64 {
+	return t.decay
+}
+
+func (t *TopK) find(item string, fp uint32) int {
+	for i, entry := range t.heap {
+		if entry.fp == fp && entry.Item == item {
+			return i
+		}
+	}
+	return -1
+}
+
+/* ---- 小顶堆 ---- */
+
+func (t *TopK) less(i, j int) bool {
+	return t.heap[i].Count < t.heap[j].Count
+}
+
+func (t *TopK) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !t.less(i, parent) {
+			break
+		}
+		t.heap[i], t.heap[parent] = t.heap[parent], t.heap[i]
+		i = parent
+	}
+}
+
+func (t *TopK) down(i int) {
+	n := len(t.heap)
+	for {
+		smallest := i
+		if l := 2*i + 1; l < n && t.less(l, smallest) {
+			smallest = l
+		}
+		if r := 2*i + 2; r < n && t.less(r, smallest) {
+			smallest = r
+		}
+		if smallest == i {
+			return
+		}
+		t.heap[i], t.heap[smallest] = t.heap[smallest], t.heap[i]
+		i = smallest
+	}
+}
+
+func (t *TopK) fix(i int) {
+	t.down(i)
+	t.up(i)
+}
+
+// Dump 将 Top-K 序列化为紧凑的二进制格式，用于 AOF 重写
+func (t *TopK) Dump() []byte {
+	buf := make([]byte, 0, 40+8*len(t.buckets))
+	buf = binary.LittleEndian.AppendUint32(buf, t.k)
+	buf = binary.LittleEndian.AppendUint32(buf, t.width)
+	buf = binary.LittleEndian.AppendUint32(buf, t.depth)
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(t.decay))
+	buf = binary.LittleEndian.AppendUint64(buf, t.seed)
+	for _, b := range t.buckets {
+		buf = binary.LittleEndian.AppendUint32(buf, b.fp)
+		buf = binary.LittleEndian.AppendUint32(buf, b.count)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.heap)))
+	for _, entry := range t.heap {
+		buf = binary.LittleEndian.AppendUint32(buf, entry.Count)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(entry.Item)))
+		buf = append(buf, entry.Item...)
+	}
+	return buf
+}
+
+// RestoreTopK 从 Dump 的结果中恢复 Top-K
+func RestoreTopK(data []byte) (*TopK, error) {
+	r := &reader{data: data}
+	k, width, depth := r.uint32(), r.uint32(), r.uint32()
+	decay := math.Float64frombits(r.uint64())
+	seed := r.uint64()
+	size := uint64(width) * uint64(depth)
+	if r.err != nil || k == 0 || size == 0 || size*8 > uint64(len(data)-r.pos) {
+		return nil, ErrBadDump
+	}
+
+	t := MakeTopK(k, width, depth, decay)
+	t.seed = seed
+	for i := range t.buckets {
+		t.buckets[i].fp = r.uint32()
+		t.buckets[i].count = r.uint32()
+	}
+	n := r.uint32()
+	if r.err != nil || n > k {
+		return nil, ErrBadDump
+	}
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		count := r.uint32()
+		item := r.bytes(uint64(r.uint32()))
+		t.heap = append(t.heap, &TopKItem{Item: string(item), Count: count, fp: fingerprint(item)})
+	}
+	if r.err != nil || r.pos != len(data) {
+		return nil, ErrBadDump
+	}
+	return t, nil
+}
+
+func saturatingAdd32(a, b uint32) uint32 {
+	if a > math.MaxUint32-b {
+		return math.MaxUint32
+	}
+	return a + b
+}
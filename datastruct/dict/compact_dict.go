@@ -0,0 +1,196 @@
+package dict
+
+import (
+	"github.com/dawnzzz/simple-redis/datastruct/listpack"
+	"math/rand"
+)
+
+// 编码方式
+const (
+	EncodingListPack  = "listpack"
+	EncodingHashTable = "hashtable"
+)
+
+// CompactDict 元素较少时使用 listpack 编码，field 和 value 交替保存在一段连续的内存中；
+// 元素数量超过 maxEntries、field 或者 value 的长度超过 maxValue，或者 value 不是 []byte 时
+// 自动转为哈希表编码，之后不再转回。非线程安全，用于保存 hash
+type CompactDict struct {
+	listpack   *listpack.ListPack // 转为哈希表之后为 nil
+	table      *SimpleDict
+	maxEntries int
+	maxValue   int
+}
+
+func MakeCompactDict(maxEntries, maxValue int) *CompactDict {
+	d := &CompactDict{
+		listpack:   listpack.New(),
+		maxEntries: maxEntries,
+		maxValue:   maxValue,
+	}
+	if maxEntries <= 0 {
+		d.convert()
+	}
+	return d
+}
+
+// Encoding 返回当前的编码方式
+func (d *CompactDict) Encoding() string {
+	if d.listpack != nil {
+		return EncodingListPack
+	}
+	return EncodingHashTable
+}
+
+// CompactBytes 返回 listpack 编码占用的字节数，不是 listpack 编码时返回 false
+func (d *CompactDict) CompactBytes() (int, bool) {
+	if d.listpack == nil {
+		return 0, false
+	}
+	return d.listpack.Bytes(), true
+}
+
+// convert 转为哈希表编码
+func (d *CompactDict) convert() {
+	table := MakeSimpleDict()
+	d.ForEach(func(key string, val interface{}) bool {
+		table.Put(key, val)
+		return true
+	})
+	d.table, d.listpack = table, nil
+}
+
+// fits 判断添加之后是否仍然可以使用 listpack 编码
+func (d *CompactDict) fits(key string, val interface{}, entries int) bool {
+	value, ok := val.([]byte)
+	return ok && entries <= d.maxEntries && len(key) <= d.maxValue && len(value) <= d.maxValue
+}
+
+func (d *CompactDict) Get(key string) (val interface{}, exists bool) {
+	if d.listpack == nil {
+		return d.table.Get(key)
+	}
+	i := d.listpack.Find([]byte(key), 2)
+	if i < 0 {
+		return nil, false
+	}
+	return d.listpack.Get(i + 1), true
+}
+
+func (d *CompactDict) Len() int {
+	if d.listpack == nil {
+		return d.table.Len()
+	}
+	return d.listpack.Len() / 2
+}
+
+// Put 添加或者更新，新增时返回 1，更新时返回 0
+func (d *CompactDict) Put(key string, val interface{}) (result int) {
+	if d.listpack == nil {
+		_, exists := d.table.Get(key)
+		d.table.Put(key, val)
+		if exists {
+			return 0
+		}
+		return 1
+	}
+
+	i := d.listpack.Find([]byte(key), 2)
+	entries := d.Len()
+	if i < 0 {
+		entries++
+	}
+	if !d.fits(key, val, entries) {
+		d.convert()
+		return d.Put(key, val)
+	}
+	if i >= 0 {
+		d.listpack.Replace(i+1, val.([]byte))
+		return 0
+	}
+	d.listpack.Append([]byte(key), val.([]byte))
+	return 1
+}
+
+func (d *CompactDict) PutIfAbsent(key string, val interface{}) (result int) {
+	if _, exists := d.Get(key); exists {
+		return 0
+	}
+	return d.Put(key, val)
+}
+
+func (d *CompactDict) PutIfExists(key string, val interface{}) (result int) {
+	if _, exists := d.Get(key); !exists {
+		return 0
+	}
+	d.Put(key, val)
+	return 1
+}
+
+func (d *CompactDict) Remove(key string) (result int) {
+	if d.listpack == nil {
+		return d.table.Remove(key)
+	}
+	i := d.listpack.Find([]byte(key), 2)
+	if i < 0 {
+		return 0
+	}
+	d.listpack.Delete(i, 2)
+	return 1
+}
+
+func (d *CompactDict) ForEach(consumer Consumer) {
+	if d.listpack == nil {
+		d.table.ForEach(consumer)
+		return
+	}
+	var key []byte
+	d.listpack.ForEach(func(i int, entry []byte) bool {
+		if i%2 == 0 {
+			key = entry
+			return true
+		}
+		return consumer(string(key), entry)
+	})
+}
+
+func (d *CompactDict) Keys() []string {
+	keys := make([]string, 0, d.Len())
+	d.ForEach(func(key string, val interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (d *CompactDict) RandomKeys(limit int) []string {
+	if d.listpack == nil {
+		return d.table.RandomKeys(limit)
+	}
+	size := d.Len()
+	if size == 0 {
+		return make([]string, 0)
+	}
+	keys := make([]string, limit)
+	for i := range keys {
+		keys[i] = string(d.listpack.Get(2 * rand.Intn(size)))
+	}
+	return keys
+}
+
+func (d *CompactDict) RandomDistinctKeys(limit int) []string {
+	if d.listpack == nil {
+		return d.table.RandomDistinctKeys(limit)
+	}
+	keys := d.Keys()
+	rand.Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+	if limit < len(keys) {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+func (d *CompactDict) Clear() {
+	*d = *MakeCompactDict(d.maxEntries, d.maxValue)
+}
@@ -0,0 +1,65 @@
+package dict
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCompactDict(t *testing.T) {
+	d := MakeCompactDict(4, 8)
+	if d.Put("k1", []byte("v1")) != 1 || d.Put("k1", []byte("new v1")) != 0 {
+		t.Error("Put k1 error")
+	}
+	if v, exists := d.Get("k1"); !exists || string(v.([]byte)) != "new v1" {
+		t.Error("Get k1 error")
+	}
+	if d.PutIfExists("k2", []byte("v2")) != 0 || d.PutIfAbsent("k2", []byte("v2")) != 1 || d.PutIfAbsent("k2", []byte("v3")) != 0 {
+		t.Error("PutIfExists or PutIfAbsent error")
+	}
+	if d.Remove("k1") != 1 || d.Remove("k1") != 0 || d.Len() != 1 {
+		t.Error("Remove error")
+	}
+	if d.Encoding() != EncodingListPack {
+		t.Errorf("encoding: %s", d.Encoding())
+	}
+
+	// value 过长时转为哈希表
+	d.Put("k3", []byte("too long value"))
+	if d.Encoding() != EncodingHashTable {
+		t.Errorf("encoding after long value: %s", d.Encoding())
+	}
+	if v, exists := d.Get("k2"); !exists || string(v.([]byte)) != "v2" || d.Len() != 2 {
+		t.Error("convert error")
+	}
+
+	// 元素数量过多时转为哈希表
+	d = MakeCompactDict(4, 8)
+	for i := 0; i < 4; i++ {
+		d.Put("k"+strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+	if d.Encoding() != EncodingListPack {
+		t.Errorf("encoding: %s", d.Encoding())
+	}
+	if len(d.RandomDistinctKeys(10)) != 4 || len(d.RandomKeys(10)) != 10 {
+		t.Error("random keys error")
+	}
+	d.Put("k4", []byte("4"))
+	if d.Encoding() != EncodingHashTable || d.Len() != 5 {
+		t.Errorf("encoding after too many entries: %s", d.Encoding())
+	}
+	count := 0
+	d.ForEach(func(key string, val interface{}) bool {
+		if key != "k"+string(val.([]byte)) {
+			t.Errorf("%s: %s", key, val)
+		}
+		count++
+		return true
+	})
+	if count != 5 {
+		t.Errorf("ForEach count: %d", count)
+	}
+	d.Clear()
+	if d.Len() != 0 || d.Encoding() != EncodingListPack {
+		t.Error("Clear error")
+	}
+}
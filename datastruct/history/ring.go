@@ -0,0 +1,101 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// Entry key 在某个版本的值
+type Entry struct {
+	Version uint32
+	Time    time.Time
+	Value   interface{} // 为 nil 并且 Omitted 为 false 时表示 key 在该版本被删除
+	Omitted bool        // 值过大没有保存
+}
+
+// Ring 按照版本从旧到新保存最近的 capacity 个版本，写满之后覆盖最旧的版本，
+// 版本号需要单调递增，并发控制由调用方负责
+type Ring struct {
+	entries []*Entry
+	start   int // 最旧的版本在 entries 中的位置
+	size    int
+}
+
+func MakeRing(capacity int) *Ring {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Ring{entries: make([]*Entry, capacity)}
+}
+
+// Cap 返回最多保存的版本数量
+func (r *Ring) Cap() int {
+	return len(r.entries)
+}
+
+// Len 返回保存的版本数量
+func (r *Ring) Len() int {
+	return r.size
+}
+
+// at 返回从旧到新第 i 个版本
+func (r *Ring) at(i int) *Entry {
+	return r.entries[(r.start+i)%len(r.entries)]
+}
+
+// Add 添加一个新的版本，版本号不大于最新的版本时替换最新的版本
+func (r *Ring) Add(entry *Entry) {
+	if r.size > 0 {
+		last := (r.start + r.size - 1) % len(r.entries)
+		if r.entries[last].Version >= entry.Version {
+			r.entries[last] = entry
+			return
+		}
+	}
+	if r.size < len(r.entries) {
+		r.entries[(r.start+r.size)%len(r.entries)] = entry
+		r.size++
+		return
+	}
+	r.entries[r.start] = entry
+	r.start = (r.start + 1) % len(r.entries)
+}
+
+// Get 返回指定版本的值，版本不存在或者已经被覆盖时返回 false
+func (r *Ring) Get(version uint32) (*Entry, bool) {
+	i := sort.Search(r.size, func(i int) bool {
+		return r.at(i).Version >= version
+	})
+	if i == r.size || r.at(i).Version != version {
+		return nil, false
+	}
+	return r.at(i), true
+}
+
+// Latest 返回最新的 count 个版本，按照从新到旧排列，count 为负数时返回所有的版本
+func (r *Ring) Latest(count int) []*Entry {
+	if count < 0 || count > r.size {
+		count = r.size
+	}
+	result := make([]*Entry, count)
+	for i := 0; i < count; i++ {
+		result[i] = r.at(r.size - 1 - i)
+	}
+	return result
+}
+
+// Resize 修改最多保存的版本数量，容量变小时只保留最新的版本
+func (r *Ring) Resize(capacity int) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	keep := r.size
+	if keep > capacity {
+		keep = capacity
+	}
+	entries := make([]*Entry, capacity)
+	for i := 0; i < keep; i++ {
+		entries[i] = r.at(r.size - keep + i)
+	}
+	r.entries, r.start, r.size = entries, 0, keep
+}
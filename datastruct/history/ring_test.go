@@ -0,0 +1,74 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func versions(entries []*Entry) []uint32 {
+	result := make([]uint32, len(entries))
+	for i, e := range entries {
+		result[i] = e.Version
+	}
+	return result
+}
+
+func equal(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRing(t *testing.T) {
+	r := MakeRing(3)
+	if r.Len() != 0 || r.Cap() != 3 || len(r.Latest(-1)) != 0 {
+		t.Fatal("empty ring error")
+	}
+	if _, ok := r.Get(1); ok {
+		t.Error("get from empty ring")
+	}
+
+	now := time.Now()
+	for v := uint32(1); v <= 5; v++ {
+		r.Add(&Entry{Version: v, Time: now, Value: []byte{byte('a' + v)}})
+	}
+	if r.Len() != 3 || !equal(versions(r.Latest(-1)), []uint32{5, 4, 3}) {
+		t.Fatalf("after overwrite: %v", versions(r.Latest(-1)))
+	}
+	if !equal(versions(r.Latest(2)), []uint32{5, 4}) {
+		t.Errorf("latest 2: %v", versions(r.Latest(2)))
+	}
+	if _, ok := r.Get(2); ok {
+		t.Error("overwritten version should not exist")
+	}
+	if e, ok := r.Get(4); !ok || string(e.Value.([]byte)) != "e" {
+		t.Errorf("get 4: %v", e)
+	}
+
+	// 版本号没有增加时替换最新的版本
+	r.Add(&Entry{Version: 5, Time: now})
+	if e, _ := r.Get(5); e.Value != nil || r.Len() != 3 {
+		t.Error("replace latest error")
+	}
+
+	r.Resize(2)
+	if r.Cap() != 2 || !equal(versions(r.Latest(-1)), []uint32{5, 4}) {
+		t.Errorf("shrink: %v", versions(r.Latest(-1)))
+	}
+	r.Resize(4)
+	r.Add(&Entry{Version: 9, Time: now})
+	r.Add(&Entry{Version: 10, Time: now})
+	if !equal(versions(r.Latest(-1)), []uint32{10, 9, 5, 4}) {
+		t.Errorf("grow: %v", versions(r.Latest(-1)))
+	}
+	r.Add(&Entry{Version: 11, Time: now})
+	if _, ok := r.Get(4); ok || !equal(versions(r.Latest(-1)), []uint32{11, 10, 9, 5}) {
+		t.Errorf("after grow: %v", versions(r.Latest(-1)))
+	}
+}
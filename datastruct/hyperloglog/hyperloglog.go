@@ -0,0 +1,379 @@
+package hyperloglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+/*
+	HyperLogLog 的存储格式与 Redis 保持一致，以字符串的形式保存，因此 GET/SET 可以直接读写：
+	+------+---+-----+----------+
+	| HYLL | E | N/U | Cardin.  |
+	+------+---+-----+----------+
+	4 字节的魔数 HYLL，1 字节的编码方式（0 为 dense，1 为 sparse），3 字节未使用，
+	8 字节小端序的基数缓存，最高字节的最高位为 1 表示缓存失效。
+	header 之后是寄存器：
+		dense 编码下每个寄存器占 6 位，共 16384 个寄存器
+		sparse 编码下使用 ZERO、XZERO、VAL 三种操作码对寄存器进行游程编码
+*/
+
+const (
+	P         = 14          // 寄存器下标占用的位数
+	Registers = 1 << P      // 寄存器数量
+	q         = 64 - P      // 用于计算前导零的位数
+	bits      = 6           // dense 编码下每个寄存器占用的位数
+	regMax    = 1<<bits - 1 // 寄存器的最大值
+	hdrSize   = 16          // header 的长度
+	denseSize = hdrSize + (Registers*bits+7)/8
+	alphaInf  = 0.721347520444481703680 // 2 * ln(2) 的倒数
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	sparseValMax    = 32    // sparse 编码下 VAL 操作码能表示的最大值
+	sparseValMaxLen = 4     // VAL 操作码最多表示的连续寄存器数量
+	sparseZeroMax   = 64    // ZERO 操作码最多表示的连续寄存器数量
+	sparseXZeroMax  = 16384 // XZERO 操作码最多表示的连续寄存器数量
+
+	hashSeed = 0xadc83b19
+)
+
+var (
+	ErrInvalid   = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+var magic = []byte("HYLL")
+
+// HyperLogLog 基数估计，底层为 Redis 格式的字节数组
+type HyperLogLog struct {
+	data []byte
+}
+
+// Make 创建一个空的 HyperLogLog，使用 sparse 编码
+func Make() *HyperLogLog {
+	data := make([]byte, hdrSize, hdrSize+2)
+	copy(data, magic)
+	data[4] = encodingSparse
+	// 一个 XZERO 操作码表示所有寄存器均为 0
+	data = append(data, 0x40|byte((sparseXZeroMax-1)>>8), byte((sparseXZeroMax-1)&0xff))
+	return &HyperLogLog{data: data}
+}
+
+// FromBytes 从 Redis 格式的字节数组中得到 HyperLogLog，修改会直接作用在 data 上
+func FromBytes(data []byte) (*HyperLogLog, error) {
+	if len(data) < hdrSize || string(data[:4]) != string(magic) {
+		return nil, ErrInvalid
+	}
+	switch data[4] {
+	case encodingDense:
+		if len(data) != denseSize {
+			return nil, ErrInvalid
+		}
+	case encodingSparse:
+	default:
+		return nil, ErrInvalid
+	}
+	return &HyperLogLog{data: data}, nil
+}
+
+// Bytes 返回 Redis 格式的字节数组，修改之后可能与 FromBytes 传入的不是同一个数组
+func (h *HyperLogLog) Bytes() []byte {
+	return h.data
+}
+
+func (h *HyperLogLog) IsSparse() bool {
+	return h.data[4] == encodingSparse
+}
+
+// Add 添加元素，有寄存器被修改时返回 true
+// sparse 编码下寄存器的值超过 32 或者长度超过 sparseMaxBytes 时转为 dense 编码
+func (h *HyperLogLog) Add(elements [][]byte, sparseMaxBytes int) (bool, error) {
+	if len(elements) == 0 {
+		return false, nil
+	}
+
+	if !h.IsSparse() {
+		changed := false
+		registers := h.data[hdrSize:]
+		for _, element := range elements {
+			index, count := hashElement(element)
+			if count > getDense(registers, index) {
+				setDense(registers, index, count)
+				changed = true
+			}
+		}
+		if changed {
+			h.invalidateCache()
+		}
+		return changed, nil
+	}
+
+	registers, err := h.registers()
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	for _, element := range elements {
+		index, count := hashElement(element)
+		if count > registers[index] {
+			registers[index] = count
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	h.setRegisters(registers, sparseMaxBytes)
+	return true, nil
+}
+
+// Count 估计基数
+func (h *HyperLogLog) Count() (uint64, error) {
+	if h.data[15]&(1<<7) == 0 {
+		// 缓存有效
+		return binary.LittleEndian.Uint64(h.data[8:16]), nil
+	}
+	registers, err := h.registers()
+	if err != nil {
+		return 0, err
+	}
+	return Count(registers), nil
+}
+
+// MergeInto 将寄存器按照最大值合并到 registers 中
+func (h *HyperLogLog) MergeInto(registers []uint8) error {
+	own, err := h.registers()
+	if err != nil {
+		return err
+	}
+	for i, v := range own {
+		if v > registers[i] {
+			registers[i] = v
+		}
+	}
+	return nil
+}
+
+// SetRegisters 使用 registers 覆盖所有寄存器，保持 sparse 编码时遵循与 Add 相同的转换规则
+func (h *HyperLogLog) SetRegisters(registers []uint8, sparseMaxBytes int) {
+	h.setRegisters(registers, sparseMaxBytes)
+}
+
+func (h *HyperLogLog) setRegisters(registers []uint8, sparseMaxBytes int) {
+	if h.IsSparse() {
+		if encoded, ok := encodeSparse(registers, sparseMaxBytes); ok {
+			h.data = append(h.data[:hdrSize], encoded...)
+			h.invalidateCache()
+			return
+		}
+	}
+
+	// 使用 dense 编码
+	data := make([]byte, denseSize)
+	copy(data, h.data[:hdrSize])
+	data[4] = encodingDense
+	for i, v := range registers {
+		setDense(data[hdrSize:], i, v)
+	}
+	h.data = data
+	h.invalidateCache()
+}
+
+func (h *HyperLogLog) invalidateCache() {
+	h.data[15] |= 1 << 7
+}
+
+// registers 解码得到所有寄存器的值
+func (h *HyperLogLog) registers() ([]uint8, error) {
+	registers := make([]uint8, Registers)
+	if !h.IsSparse() {
+		for i := range registers {
+			registers[i] = getDense(h.data[hdrSize:], i)
+		}
+		return registers, nil
+	}
+
+	index := 0
+	for _, op := range sparseOps(h.data[hdrSize:]) {
+		if op.length < 0 || index+op.length > Registers {
+			return nil, ErrCorrupted
+		}
+		for i := 0; i < op.length; i++ {
+			registers[index+i] = op.value
+		}
+		index += op.length
+	}
+	if index != Registers {
+		return nil, ErrCorrupted
+	}
+	return registers, nil
+}
+
+// hashElement 计算元素对应的寄存器下标，以及哈希值中从低位开始第一个 1 的位置
+func hashElement(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, hashSeed)
+	index := int(hash & (Registers - 1))
+	hash >>= P
+	hash |= 1 << q // 保证循环能够结束
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+/* ---- dense 编码 ---- */
+
+func getDense(registers []byte, index int) uint8 {
+	b := index * bits / 8
+	fb := uint(index * bits & 7)
+	v := uint(registers[b]) >> fb
+	if b+1 < len(registers) {
+		v |= uint(registers[b+1]) << (8 - fb)
+	}
+	return uint8(v & regMax)
+}
+
+func setDense(registers []byte, index int, value uint8) {
+	b := index * bits / 8
+	fb := uint(index * bits & 7)
+	v := uint(value)
+	registers[b] &= ^byte(regMax << fb)
+	registers[b] |= byte(v << fb)
+	if b+1 < len(registers) {
+		registers[b+1] &= ^byte(regMax >> (8 - fb))
+		registers[b+1] |= byte(v >> (8 - fb))
+	}
+}
+
+/* ---- sparse 编码 ----
+ZERO:  00xxxxxx，表示 xxxxxx + 1 个寄存器为 0
+XZERO: 01xxxxxx yyyyyyyy，表示 xxxxxxyyyyyyyy + 1 个寄存器为 0
+VAL:   1vvvvvxx，表示 xx + 1 个寄存器的值为 vvvvv + 1
+*/
+
+type sparseOp struct {
+	value  uint8
+	length int
+}
+
+func sparseOps(data []byte) []sparseOp {
+	ops := make([]sparseOp, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b&0xc0 == 0x00:
+			ops = append(ops, sparseOp{length: int(b&0x3f) + 1})
+		case b&0xc0 == 0x40:
+			if i+1 >= len(data) {
+				return append(ops, sparseOp{length: -1})
+			}
+			ops = append(ops, sparseOp{length: (int(b&0x3f)<<8 | int(data[i+1])) + 1})
+			i++
+		default:
+			ops = append(ops, sparseOp{value: (b>>2)&0x1f + 1, length: int(b&0x03) + 1})
+		}
+	}
+	return ops
+}
+
+// encodeSparse 使用 sparse 编码寄存器，值超过 32 或者长度超过 maxBytes 时 ok 为 false
+func encodeSparse(registers []uint8, maxBytes int) ([]byte, bool) {
+	encoded := make([]byte, 0)
+	for i := 0; i < len(registers); {
+		value := registers[i]
+		runLen := 1
+		for i+runLen < len(registers) && registers[i+runLen] == value {
+			runLen++
+		}
+		i += runLen
+
+		if value == 0 {
+			for runLen > 0 {
+				n := runLen
+				if n > sparseZeroMax {
+					if n > sparseXZeroMax {
+						n = sparseXZeroMax
+					}
+					encoded = append(encoded, 0x40|byte((n-1)>>8), byte((n-1)&0xff))
+				} else {
+					encoded = append(encoded, byte(n-1))
+				}
+				runLen -= n
+			}
+		} else {
+			if value > sparseValMax {
+				return nil, false
+			}
+			for runLen > 0 {
+				n := runLen
+				if n > sparseValMaxLen {
+					n = sparseValMaxLen
+				}
+				encoded = append(encoded, 0x80|(value-1)<<2|byte(n-1))
+				runLen -= n
+			}
+		}
+
+		if hdrSize+len(encoded) > maxBytes {
+			return nil, false
+		}
+	}
+	return encoded, true
+}
+
+/* ---- 基数估计 ---- */
+
+// Count 根据寄存器的值估计基数，使用 Otmar Ertl 提出的改进算法（与 Redis 相同）
+func Count(registers []uint8) uint64 {
+	m := float64(Registers)
+	histogram := make([]int, 64)
+	for _, v := range registers {
+		histogram[v]++
+	}
+
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package hyperloglog
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	sparse := Make()
+	dense := Make()
+	if count, _ := sparse.Count(); count != 0 {
+		t.Error("empty count error")
+	}
+
+	for i := 0; i < 100000; i += 100 {
+		elements := make([][]byte, 100)
+		for j := range elements {
+			elements[j] = []byte("element:" + strconv.Itoa(i+j))
+		}
+		if _, err := sparse.Add(elements, 1<<20); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dense.Add(elements, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !sparse.IsSparse() || dense.IsSparse() {
+		t.Error("encoding error")
+	}
+	if len(dense.Bytes()) != denseSize {
+		t.Error("dense size error")
+	}
+
+	sparseCount, _ := sparse.Count()
+	denseCount, _ := dense.Count()
+	if sparseCount != denseCount {
+		t.Errorf("sparse count %d != dense count %d", sparseCount, denseCount)
+	}
+	if math.Abs(float64(denseCount)-100000)/100000 > 0.02 {
+		t.Errorf("count error too large: %d", denseCount)
+	}
+
+	// 重复添加不会修改寄存器
+	if changed, _ := dense.Add([][]byte{[]byte("element:1")}, 0); changed {
+		t.Error("Add duplicated element error")
+	}
+
+	// 从字节数组恢复
+	restored, err := FromBytes(sparse.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registers := make([]uint8, Registers)
+	if err := restored.MergeInto(registers); err != nil {
+		t.Fatal(err)
+	}
+	if Count(registers) != sparseCount {
+		t.Error("MergeInto error")
+	}
+}
+
+func TestInvalidHyperLogLog(t *testing.T) {
+	if _, err := FromBytes([]byte("not a hll")); err != ErrInvalid {
+		t.Error("FromBytes should fail")
+	}
+
+	data := Make().Bytes()
+	hll, err := FromBytes(data[:len(data)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hll.Add([][]byte{[]byte("a")}, 3000); err != ErrCorrupted {
+		t.Error("corrupted sparse encoding should be detected")
+	}
+}
@@ -0,0 +1,192 @@
+package jsondoc
+
+import (
+	"sort"
+)
+
+// Document JSON 文档
+type Document struct {
+	root interface{}
+}
+
+func MakeDocument(root interface{}) *Document {
+	return &Document{root: root}
+}
+
+func (d *Document) Root() interface{} {
+	return d.root
+}
+
+// Dump 紧凑格式的 JSON，用于 AOF 重写
+func (d *Document) Dump() []byte {
+	return Marshal(d.root)
+}
+
+// Ref 路径匹配到的值，可以通过 Set 原地修改
+type Ref struct {
+	doc    *Document
+	value  interface{}
+	parent interface{} // nil 表示根节点
+	key    string
+	index  int
+}
+
+func (r *Ref) Value() interface{} {
+	return r.value
+}
+
+// Set 替换匹配到的值
+func (r *Ref) Set(value interface{}) {
+	switch p := r.parent.(type) {
+	case nil:
+		r.doc.root = value
+	case *Object:
+		p.Set(r.key, value)
+	case *Array:
+		p.items[r.index] = value
+	}
+	r.value = value
+}
+
+// Find 返回路径匹配到的所有值，旧版路径最多返回一个
+func (d *Document) Find(path *Path) []*Ref {
+	refs := d.find(path.segments)
+	if path.legacy && len(refs) > 1 {
+		refs = refs[:1]
+	}
+	return refs
+}
+
+func (d *Document) find(segments []segment) []*Ref {
+	refs := []*Ref{{doc: d, value: d.root}}
+	for _, seg := range segments {
+		next := make([]*Ref, 0, len(refs))
+		for _, ref := range refs {
+			if seg.recursive {
+				for _, node := range descendants(ref) {
+					next = append(next, children(node, seg)...)
+				}
+			} else {
+				next = append(next, children(ref, seg)...)
+			}
+		}
+		refs = next
+	}
+	return refs
+}
+
+// descendants 先序遍历返回节点本身以及所有的子孙节点
+func descendants(ref *Ref) []*Ref {
+	result := []*Ref{ref}
+	for _, child := range children(ref, segment{kind: segWildcard}) {
+		result = append(result, descendants(child)...)
+	}
+	return result
+}
+
+// children 返回节点中与 seg 匹配的子节点
+func children(ref *Ref, seg segment) []*Ref {
+	switch v := ref.value.(type) {
+	case *Object:
+		switch seg.kind {
+		case segKey:
+			if child, ok := v.Get(seg.key); ok {
+				return []*Ref{{doc: ref.doc, value: child, parent: v, key: seg.key}}
+			}
+		case segWildcard:
+			result := make([]*Ref, 0, v.Len())
+			for _, key := range v.keys {
+				result = append(result, &Ref{doc: ref.doc, value: v.values[key], parent: v, key: key})
+			}
+			return result
+		}
+	case *Array:
+		switch seg.kind {
+		case segIndex:
+			index := seg.index
+			if index < 0 {
+				index += v.Len()
+			}
+			if index >= 0 && index < v.Len() {
+				return []*Ref{{doc: ref.doc, value: v.items[index], parent: v, index: index}}
+			}
+		case segWildcard:
+			result := make([]*Ref, 0, v.Len())
+			for i, item := range v.items {
+				result = append(result, &Ref{doc: ref.doc, value: item, parent: v, index: i})
+			}
+			return result
+		}
+	}
+	return nil
+}
+
+// Set 将路径匹配到的值设置为 value，路径的最后一段是 key 且父节点是对象时，不存在的 key 会被创建
+// nx 为 true 时只创建，xx 为 true 时只修改，返回是否有值被设置
+func (d *Document) Set(path *Path, value interface{}, nx, xx bool) bool {
+	updated := false
+	if !nx {
+		for _, ref := range d.Find(path) {
+			ref.Set(Copy(value))
+			updated = true
+		}
+	}
+	if xx || path.IsRoot() {
+		return updated
+	}
+
+	parentPath, last := path.parent()
+	if last.kind != segKey || last.recursive {
+		return updated
+	}
+	for _, ref := range d.Find(parentPath) {
+		obj, ok := ref.value.(*Object)
+		if !ok {
+			continue
+		}
+		if _, exists := obj.Get(last.key); exists {
+			continue
+		}
+		obj.Set(last.key, Copy(value))
+		updated = true
+	}
+	return updated
+}
+
+// Delete 删除路径匹配到的值，返回删除的数量，路径为根路径时不做处理
+func (d *Document) Delete(path *Path) int {
+	if path.IsRoot() {
+		return 0
+	}
+
+	deleted := 0
+	arrayIndices := make(map[*Array][]int)
+	arrays := make([]*Array, 0)
+	for _, ref := range d.Find(path) {
+		switch p := ref.parent.(type) {
+		case *Object:
+			if p.Delete(ref.key) {
+				deleted++
+			}
+		case *Array:
+			if _, ok := arrayIndices[p]; !ok {
+				arrays = append(arrays, p)
+			}
+			arrayIndices[p] = append(arrayIndices[p], ref.index)
+		}
+	}
+
+	// 数组中的元素从后往前删除，避免下标变化
+	for _, arr := range arrays {
+		indices := arrayIndices[arr]
+		sort.Sort(sort.Reverse(sort.IntSlice(indices)))
+		for i, index := range indices {
+			if i > 0 && index == indices[i-1] {
+				continue
+			}
+			arr.items = append(arr.items[:index], arr.items[index+1:]...)
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,125 @@
+package jsondoc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustParse(t *testing.T, s string) interface{} {
+	v, err := Parse([]byte(s))
+	if err != nil {
+		t.Fatalf("parse %s: %v", s, err)
+	}
+	return v
+}
+
+func mustPath(t *testing.T, s string) *Path {
+	p, err := ParsePath(s)
+	if err != nil {
+		t.Fatalf("parse path %s: %v", s, err)
+	}
+	return p
+}
+
+func TestParseAndMarshal(t *testing.T) {
+	raw := `{"b":1,"a":[true,null,"x<y",1.5,{}],"c":{"d":[]}}`
+	v := mustParse(t, raw)
+	if got := string(Marshal(v)); got != raw {
+		t.Errorf("marshal: %s", got)
+	}
+	indented := string(MarshalIndent(mustParse(t, `{"a":[1]}`), "  ", "\n", " "))
+	if indented != "{\n  \"a\": [\n    1\n  ]\n}" {
+		t.Errorf("marshal indent: %q", indented)
+	}
+	for _, bad := range []string{``, `{`, `{"a":1}x`, `[1,]`, `1 2`} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("parse %q should fail", bad)
+		}
+	}
+	if TypeOf(mustParse(t, "1")) != "integer" || TypeOf(mustParse(t, "1.0")) != "number" {
+		t.Error("type error")
+	}
+}
+
+func TestPath(t *testing.T) {
+	doc := MakeDocument(mustParse(t, `{"a":{"b":1,"c":[1,2,3]},"b":2,"d":[{"b":3}]}`))
+	tests := map[string]string{
+		"$":           `[{"a":{"b":1,"c":[1,2,3]},"b":2,"d":[{"b":3}]}]`,
+		"$.a.b":       `[1]`,
+		"$['a']['c']": `[[1,2,3]]`,
+		"$.a.c[-1]":   `[3]`,
+		"$.a.c[*]":    `[1,2,3]`,
+		"$.*":         `[{"b":1,"c":[1,2,3]},2,[{"b":3}]]`,
+		"$..b":        `[2,1,3]`,
+		"$..[0]":      `[1,{"b":3}]`,
+		"$.x":         `[]`,
+		".a.b":        `[1]`,
+		"a.c[0]":      `[1]`,
+		".":           `[{"a":{"b":1,"c":[1,2,3]},"b":2,"d":[{"b":3}]}]`,
+		"..b":         `[2]`,
+	}
+	for raw, expected := range tests {
+		arr := MakeArray()
+		for _, ref := range doc.Find(mustPath(t, raw)) {
+			arr.Append(ref.Value())
+		}
+		if got := string(Marshal(arr)); got != expected {
+			t.Errorf("%s: %s, expected %s", raw, got, expected)
+		}
+	}
+	for _, bad := range []string{"$.", "$[", "$[a]", "$x", "$.a[1"} {
+		if _, err := ParsePath(bad); err == nil {
+			t.Errorf("path %q should fail", bad)
+		}
+	}
+}
+
+func TestSetAndDelete(t *testing.T) {
+	doc := MakeDocument(mustParse(t, `{"a":{"b":1},"c":[1,2,3,4]}`))
+	if !doc.Set(mustPath(t, "$.a.b"), json.Number("2"), false, false) {
+		t.Error("set existing error")
+	}
+	if doc.Set(mustPath(t, "$.a.x"), json.Number("3"), false, true) {
+		t.Error("XX should not create")
+	}
+	if doc.Set(mustPath(t, "$.a.b"), json.Number("3"), true, false) {
+		t.Error("NX should not update")
+	}
+	if !doc.Set(mustPath(t, "$.a.x"), mustParse(t, `{"y":[]}`), true, false) {
+		t.Error("create error")
+	}
+	if doc.Set(mustPath(t, "$.z.x"), json.Number("1"), false, false) {
+		t.Error("missing parent should not be created")
+	}
+	if got := string(doc.Dump()); got != `{"a":{"b":2,"x":{"y":[]}},"c":[1,2,3,4]}` {
+		t.Errorf("after set: %s", got)
+	}
+
+	if n := doc.Delete(mustPath(t, "$.c[0]")); n != 1 {
+		t.Errorf("delete: %d", n)
+	}
+	if n := doc.Delete(mustPath(t, "$.c[*]")); n != 3 {
+		t.Errorf("delete all: %d", n)
+	}
+	if n := doc.Delete(mustPath(t, "$..x")); n != 1 {
+		t.Errorf("delete recursive: %d", n)
+	}
+	if got := string(doc.Dump()); got != `{"a":{"b":2},"c":[]}` {
+		t.Errorf("after delete: %s", got)
+	}
+}
+
+func TestNumIncrBy(t *testing.T) {
+	tests := []struct{ n, delta, expected string }{
+		{"1", "2", "3"},
+		{"1", "1.5", "2.5"},
+		{"1.5", "0.5", "2.0"},
+		{"9223372036854775807", "1", "9223372036854776000.0"},
+	}
+	for _, tt := range tests {
+		got, err := NumIncrBy(json.Number(tt.n), json.Number(tt.delta))
+		if err != nil || string(got) != tt.expected {
+			t.Errorf("%s + %s = %s, %v", tt.n, tt.delta, got, err)
+		}
+	}
+}
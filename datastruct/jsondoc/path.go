@@ -0,0 +1,150 @@
+package jsondoc
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPath = errors.New("ERR invalid JSONPath")
+
+type segmentKind int
+
+const (
+	segKey segmentKind = iota
+	segIndex
+	segWildcard
+)
+
+// segment 路径中的一段，recursive 为 true 时表示 ..，匹配当前节点以及所有的子孙节点
+type segment struct {
+	kind      segmentKind
+	key       string
+	index     int
+	recursive bool
+}
+
+// Path 支持 JSONPath 的子集：$、.key、['key']、[index]（支持负数）、.*、[*]、..key、..*
+// 不以 $ 开头的路径为旧版路径（如 .a.b、a.b、.），旧版路径只返回第一个匹配的值
+type Path struct {
+	raw      string
+	legacy   bool
+	segments []segment
+}
+
+func ParsePath(raw string) (*Path, error) {
+	p := &Path{raw: raw}
+	s := raw
+	if !strings.HasPrefix(s, "$") {
+		p.legacy = true
+		switch {
+		case s == "" || s == ".":
+			s = "$"
+		case s[0] == '.' || s[0] == '[':
+			s = "$" + s
+		default:
+			s = "$." + s
+		}
+	}
+
+	for i := 1; i < len(s); {
+		recursive := false
+		switch s[i] {
+		case '.':
+			i++
+			if i < len(s) && s[i] == '.' {
+				recursive = true
+				i++
+			}
+			if i >= len(s) {
+				return nil, ErrInvalidPath
+			}
+			if s[i] == '[' {
+				if !recursive {
+					return nil, ErrInvalidPath
+				}
+				continue
+			}
+			if s[i] == '*' {
+				p.segments = append(p.segments, segment{kind: segWildcard, recursive: recursive})
+				i++
+				continue
+			}
+			end := i
+			for end < len(s) && s[end] != '.' && s[end] != '[' {
+				end++
+			}
+			if end == i {
+				return nil, ErrInvalidPath
+			}
+			p.segments = append(p.segments, segment{kind: segKey, key: s[i:end], recursive: recursive})
+			i = end
+		case '[':
+			seg, end, err := parseBracket(s, i)
+			if err != nil {
+				return nil, err
+			}
+			seg.recursive = strings.HasSuffix(s[:i], "..") // ..[...] 的情况
+			p.segments = append(p.segments, seg)
+			i = end
+		default:
+			return nil, ErrInvalidPath
+		}
+	}
+	return p, nil
+}
+
+// parseBracket 解析 [*]、[index]、['key']、["key"]，返回下一个字符的位置
+func parseBracket(s string, start int) (segment, int, error) {
+	i := start + 1
+	if i >= len(s) {
+		return segment{}, 0, ErrInvalidPath
+	}
+	if quote := s[i]; quote == '\'' || quote == '"' {
+		var key strings.Builder
+		for i++; i < len(s) && s[i] != quote; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			key.WriteByte(s[i])
+		}
+		if i+1 >= len(s) || s[i+1] != ']' {
+			return segment{}, 0, ErrInvalidPath
+		}
+		return segment{kind: segKey, key: key.String()}, i + 2, nil
+	}
+
+	end := strings.IndexByte(s[i:], ']')
+	if end < 0 {
+		return segment{}, 0, ErrInvalidPath
+	}
+	content := strings.TrimSpace(s[i : i+end])
+	next := i + end + 1
+	if content == "*" {
+		return segment{kind: segWildcard}, next, nil
+	}
+	index, err := strconv.Atoi(content)
+	if err != nil {
+		return segment{}, 0, ErrInvalidPath
+	}
+	return segment{kind: segIndex, index: index}, next, nil
+}
+
+func (p *Path) String() string {
+	return p.raw
+}
+
+// IsLegacy 是否为旧版路径
+func (p *Path) IsLegacy() bool {
+	return p.legacy
+}
+
+// IsRoot 是否为根路径
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// parent 返回去掉最后一段之后的路径，以及最后一段
+func (p *Path) parent() (*Path, segment) {
+	return &Path{raw: p.raw, legacy: p.legacy, segments: p.segments[:len(p.segments)-1]}, p.segments[len(p.segments)-1]
+}
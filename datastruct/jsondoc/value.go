@@ -0,0 +1,305 @@
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidJSON = errors.New("ERR invalid JSON value")
+
+// JSON 值的类型为 nil、bool、json.Number、string、*Array 或者 *Object
+
+// Object 保持插入顺序的 JSON 对象
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func MakeObject() *Object {
+	return &Object{values: make(map[string]interface{})}
+}
+
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Keys 按照插入顺序返回所有的 key
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+func (o *Object) Get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set 设置 key 的值，key 不存在时追加到末尾
+func (o *Object) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *Object) Delete(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Array JSON 数组，使用指针保存以便原地修改
+type Array struct {
+	items []interface{}
+}
+
+func MakeArray(items ...interface{}) *Array {
+	return &Array{items: items}
+}
+
+func (a *Array) Len() int {
+	return len(a.items)
+}
+
+func (a *Array) Items() []interface{} {
+	return a.items
+}
+
+func (a *Array) Append(values ...interface{}) {
+	a.items = append(a.items, values...)
+}
+
+/* ---- 解析与序列化 ---- */
+
+// Parse 解析 JSON，对象保持 key 的顺序，数字保存为 json.Number
+func Parse(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := parseValue(dec)
+	if err != nil {
+		return nil, ErrInvalidJSON
+	}
+	// 只能有一个值
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, ErrInvalidJSON
+	}
+	return v, nil
+}
+
+func parseValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			obj := MakeObject()
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				value, err := parseValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj.Set(key, value)
+			}
+			_, err = dec.Token() // }
+			return obj, err
+		case '[':
+			arr := MakeArray()
+			for dec.More() {
+				value, err := parseValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr.Append(value)
+			}
+			_, err = dec.Token() // ]
+			return arr, err
+		}
+		return nil, ErrInvalidJSON
+	default:
+		return tok, nil
+	}
+}
+
+// Marshal 紧凑格式的序列化
+func Marshal(v interface{}) []byte {
+	return MarshalIndent(v, "", "", "")
+}
+
+// MarshalIndent 使用 indent 缩进，newline 换行，space 作为 key 与值之间的分隔
+func MarshalIndent(v interface{}, indent, newline, space string) []byte {
+	w := &writer{indent: indent, newline: newline, space: space}
+	w.write(v, 0)
+	return w.buf.Bytes()
+}
+
+type writer struct {
+	buf     bytes.Buffer
+	indent  string
+	newline string
+	space   string
+}
+
+func (w *writer) writeIndent(level int) {
+	w.buf.WriteString(w.newline)
+	for i := 0; i < level; i++ {
+		w.buf.WriteString(w.indent)
+	}
+}
+
+func (w *writer) write(v interface{}, level int) {
+	switch v := v.(type) {
+	case nil:
+		w.buf.WriteString("null")
+	case bool:
+		w.buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		w.buf.WriteString(string(v))
+	case string:
+		writeString(&w.buf, v)
+	case *Array:
+		if v.Len() == 0 {
+			w.buf.WriteString("[]")
+			return
+		}
+		w.buf.WriteByte('[')
+		for i, item := range v.items {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.writeIndent(level + 1)
+			w.write(item, level+1)
+		}
+		w.writeIndent(level)
+		w.buf.WriteByte(']')
+	case *Object:
+		if v.Len() == 0 {
+			w.buf.WriteString("{}")
+			return
+		}
+		w.buf.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.writeIndent(level + 1)
+			writeString(&w.buf, key)
+			w.buf.WriteByte(':')
+			w.buf.WriteString(w.space)
+			w.write(v.values[key], level+1)
+		}
+		w.writeIndent(level)
+		w.buf.WriteByte('}')
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // Encode 会在末尾添加换行
+}
+
+// TypeOf 返回 JSON 值的类型名称
+func TypeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if isInteger(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case *Array:
+		return "array"
+	case *Object:
+		return "object"
+	}
+	return ""
+}
+
+func isInteger(n json.Number) bool {
+	return !strings.ContainsAny(string(n), ".eE")
+}
+
+// Copy 深拷贝 JSON 值
+func Copy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *Array:
+		items := make([]interface{}, len(v.items))
+		for i, item := range v.items {
+			items[i] = Copy(item)
+		}
+		return &Array{items: items}
+	case *Object:
+		obj := &Object{
+			keys:   append([]string(nil), v.keys...),
+			values: make(map[string]interface{}, len(v.values)),
+		}
+		for key, value := range v.values {
+			obj.values[key] = Copy(value)
+		}
+		return obj
+	}
+	return v
+}
+
+// NumIncrBy 数字加法，两个整数相加的结果仍然是整数，否则结果是浮点数
+func NumIncrBy(n json.Number, delta json.Number) (json.Number, error) {
+	if isInteger(n) && isInteger(delta) {
+		a, err1 := strconv.ParseInt(string(n), 10, 64)
+		b, err2 := strconv.ParseInt(string(delta), 10, 64)
+		if err1 == nil && err2 == nil {
+			sum := a + b
+			// 没有溢出时返回整数
+			if (sum > a) == (b > 0) || b == 0 {
+				return json.Number(strconv.FormatInt(sum, 10)), nil
+			}
+		}
+	}
+	a, err := n.Float64()
+	if err != nil {
+		return "", err
+	}
+	b, err := delta.Float64()
+	if err != nil {
+		return "", err
+	}
+	sum := a + b
+	if math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return "", errors.New("ERR result is not a number")
+	}
+	format := byte('f')
+	if abs := math.Abs(sum); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(sum, format, -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		// 保持浮点数类型
+		s += ".0"
+	}
+	return json.Number(s), nil
+}
@@ -0,0 +1,136 @@
+package list
+
+import (
+	"bytes"
+	"compress/flate"
+	"container/list"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// compressedPage 压缩之后的 page，元素依次编码为 uvarint 长度加内容之后使用 flate 压缩，
+// 只有元素全部为 []byte 并且压缩之后更小的 page 才会被压缩
+type compressedPage struct {
+	data []byte
+	n    int // 元素数量
+}
+
+var flateWriterPool = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// compressPage 压缩 page，不能压缩或者压缩之后没有变小时返回 nil
+func compressPage(page []interface{}) *compressedPage {
+	raw := make([]byte, 0, len(page)*16)
+	for _, val := range page {
+		b, ok := val.([]byte)
+		if !ok {
+			return nil
+		}
+		raw = binary.AppendUvarint(raw, uint64(len(b)))
+		raw = append(raw, b...)
+	}
+
+	var buf bytes.Buffer
+	w := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(raw); err != nil || w.Close() != nil || buf.Len() >= len(raw) {
+		return nil
+	}
+	return &compressedPage{
+		data: append([]byte{}, buf.Bytes()...),
+		n:    len(page),
+	}
+}
+
+// decompress 解压得到 page，page 的容量为 pageSize
+func (c *compressedPage) decompress() []interface{} {
+	r := flate.NewReader(bytes.NewReader(c.data))
+	raw, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		panic("quicklist: corrupted compressed page")
+	}
+
+	page := make([]interface{}, 0, pageSize)
+	for len(raw) > 0 {
+		size, n := binary.Uvarint(raw)
+		raw = raw[n:]
+		page = append(page, raw[:size:size])
+		raw = raw[size:]
+	}
+	return page
+}
+
+// pageLen 返回节点上 page 的元素数量，不需要解压
+func pageLen(node *list.Element) int {
+	if c, ok := node.Value.(*compressedPage); ok {
+		return c.n
+	}
+	return len(node.Value.([]interface{}))
+}
+
+// plainPage 返回节点上可以修改的 page，压缩的 page 解压之后保存在节点上，在修改操作结束之后重新压缩
+func (ql *QuickList) plainPage(node *list.Element) []interface{} {
+	if c, ok := node.Value.(*compressedPage); ok {
+		node.Value = c.decompress()
+		ql.dirty = append(ql.dirty, node)
+	}
+	return node.Value.([]interface{})
+}
+
+// interior 判断节点与头尾之间是否都至少有 compressDepth 个节点
+func (ql *QuickList) interior(node *list.Element) bool {
+	prev, next := node, node
+	for i := 0; i < ql.compressDepth; i++ {
+		prev, next = prev.Prev(), next.Next()
+		if prev == nil || next == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// compressNode 节点在中间时压缩节点上的 page
+func (ql *QuickList) compressNode(node *list.Element) {
+	page, ok := node.Value.([]interface{})
+	if !ok || !ql.interior(node) {
+		return
+	}
+	if c := compressPage(page); c != nil {
+		node.Value = c
+	}
+}
+
+// recompress 在修改操作结束之后调用，保证头尾各 compressDepth 个 page 不压缩，
+// 重新压缩被解压的 page 以及因为增删 page 而进入中间的 page
+func (ql *QuickList) recompress() {
+	if ql.compressDepth <= 0 || (len(ql.dirty) == 0 && ql.data.Len() == ql.pages) {
+		return
+	}
+	for _, node := range ql.dirty {
+		ql.compressNode(node) // 已经从链表中删除的节点不在中间，不会被压缩
+	}
+	ql.dirty = nil
+
+	front, back := ql.data.Front(), ql.data.Back()
+	for i := 0; i < ql.compressDepth && front != nil; i++ {
+		if c, ok := front.Value.(*compressedPage); ok {
+			front.Value = c.decompress()
+		}
+		if c, ok := back.Value.(*compressedPage); ok {
+			back.Value = c.decompress()
+		}
+		front, back = front.Next(), back.Prev()
+	}
+	if front != nil {
+		ql.compressNode(front)
+		ql.compressNode(back)
+	}
+	ql.pages = ql.data.Len()
+}
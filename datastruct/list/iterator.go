@@ -7,6 +7,10 @@ type iterator struct {
 	node   *list.Element
 	offset int
 	ql     *QuickList
+
+	// 读取压缩的 page 时解压的结果，不修改节点，可以被多个读操作并发使用
+	cache     []interface{}
+	cacheNode *list.Element
 }
 
 // 获取 index 位置上的迭代器
@@ -19,12 +23,12 @@ func (ql *QuickList) find(index int) *iterator {
 		node = ql.data.Front()
 		pageBeg = 0
 		for {
-			page := node.Value.([]interface{})
-			if pageBeg+len(page) > index {
+			size := pageLen(node)
+			if pageBeg+size > index {
 				break
 			}
 
-			pageBeg += len(page)
+			pageBeg += size
 			node = node.Next()
 		}
 	} else {
@@ -32,13 +36,13 @@ func (ql *QuickList) find(index int) *iterator {
 		node = ql.data.Back()
 		pageBeg = ql.size
 		for {
-			page := node.Value.([]interface{})
-			if pageBeg-len(page) <= index {
-				pageBeg -= len(page)
+			size := pageLen(node)
+			if pageBeg-size <= index {
+				pageBeg -= size
 				break
 			}
 
-			pageBeg -= len(page)
+			pageBeg -= size
 			node = node.Prev()
 		}
 	}
@@ -57,13 +61,20 @@ func (iter *iterator) get() interface{} {
 }
 
 func (iter *iterator) page() []interface{} {
-	return iter.node.Value.([]interface{})
+	c, ok := iter.node.Value.(*compressedPage)
+	if !ok {
+		return iter.node.Value.([]interface{})
+	}
+	if iter.cacheNode != iter.node {
+		iter.cache, iter.cacheNode = c.decompress(), iter.node
+	}
+	return iter.cache
 }
 
 func (iter *iterator) next() bool {
 	// 首先获取所在 page，若当前迭代器的元素不是 page 的最后一个元素，直接 offset + 1即可返回。
-	page := iter.page()
-	if iter.offset < len(page)-1 {
+	size := pageLen(iter.node)
+	if iter.offset < size-1 {
 		iter.offset += 1
 		return true
 	}
@@ -71,7 +82,7 @@ func (iter *iterator) next() bool {
 	// 是page的最后一个元素，则移动到下一个 page 上
 	// 移动之前首先看看当前 page 是不是最后一个 page，若是则说明迭代器当前指向的元素是整个快速链表的最后一个元素。此时将迭代器移动到 ql.Len() 位置上。
 	if iter.node == iter.ql.data.Back() {
-		iter.offset = len(page)
+		iter.offset = size
 		return false
 	}
 	// 不是最后一个 page，就移动到下一个 page 的第一个数据上。
@@ -97,7 +108,7 @@ func (iter *iterator) prev() bool {
 
 	// 不是第一个page，移动到上一个page的最后一个元素上
 	iter.node = iter.node.Prev()
-	iter.offset = len(iter.page()) - 1
+	iter.offset = pageLen(iter.node) - 1
 
 	return true
 }
@@ -111,8 +122,7 @@ func (iter *iterator) atEnd() bool {
 		return false
 	}
 
-	page := iter.page()
-	return iter.offset == len(page)
+	return iter.offset == pageLen(iter.node)
 }
 
 // 是否在 -1 位置上
@@ -127,13 +137,13 @@ func (iter *iterator) atBegin() bool {
 }
 
 func (iter *iterator) set(val interface{}) {
-	page := iter.page()
+	page := iter.ql.plainPage(iter.node)
 	page[iter.offset] = val
 }
 
 func (iter *iterator) remove() interface{} {
-	page := iter.page()
-	val := iter.get()
+	page := iter.ql.plainPage(iter.node)
+	val := page[iter.offset]
 	page = append(page[:iter.offset], page[iter.offset+1:]...) // 在page上删除元素
 	// 整理页面
 	if len(page) > 0 {
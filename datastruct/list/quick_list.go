@@ -12,6 +12,11 @@ const (
 type QuickList struct {
 	data *list.List
 	size int
+
+	// 头尾各 compressDepth 个 page 不压缩，中间的 page 使用 flate 压缩，为 0 时不压缩
+	compressDepth int
+	pages         int             // 上一次调整压缩时 page 的数量
+	dirty         []*list.Element // 修改操作中被解压或者新增的节点，操作结束之后重新压缩
 }
 
 func MakeQuickList() *QuickList {
@@ -20,7 +25,16 @@ func MakeQuickList() *QuickList {
 	}
 }
 
+// MakeCompressedQuickList 创建压缩中间 page 的快速链表，头尾各 compressDepth 个 page 不压缩
+func MakeCompressedQuickList(compressDepth int) *QuickList {
+	return &QuickList{
+		data:          list.New(),
+		compressDepth: compressDepth,
+	}
+}
+
 func (ql *QuickList) Add(val interface{}) {
+	defer ql.recompress()
 	ql.size++
 	if ql.data.Len() == 0 {
 		// list 为空，插入一个page
@@ -33,7 +47,7 @@ func (ql *QuickList) Add(val interface{}) {
 
 	// list不为空，找到最后一个 page，**检查最后一个 page 是否已满**。
 	backNode := ql.data.Back()
-	backPage := backNode.Value.([]interface{})
+	backPage := ql.plainPage(backNode)
 
 	if len(backPage) == pageSize {
 		// 若**最后一个 page 满了则新增一个 page 到后面**，插入数据到新增 page 的第一个位置。
@@ -60,6 +74,7 @@ func (ql *QuickList) Set(index int, val interface{}) {
 		panic("`index` out of range")
 	}
 
+	defer ql.recompress()
 	iter := ql.find(index)
 	iter.set(val)
 }
@@ -74,8 +89,9 @@ func (ql *QuickList) Insert(index int, val interface{}) {
 		return
 	}
 
+	defer ql.recompress()
 	iter := ql.find(index)
-	page := iter.page()
+	page := ql.plainPage(iter.node)
 
 	// 若 page 没有满，则**直接插入**到 page 的相应位置上并返回。
 	if len(page) < pageSize {
@@ -104,7 +120,7 @@ func (ql *QuickList) Insert(index int, val interface{}) {
 	}
 
 	iter.node.Value = page
-	ql.data.InsertAfter(nextPage, iter.node)
+	ql.dirty = append(ql.dirty, ql.data.InsertAfter(nextPage, iter.node))
 	ql.size++
 }
 
@@ -113,6 +129,7 @@ func (ql *QuickList) Remove(index int) (val interface{}) {
 		panic("`index` out of range")
 	}
 
+	defer ql.recompress()
 	iter := ql.find(index)
 
 	return iter.remove()
@@ -123,6 +140,7 @@ func (ql *QuickList) RemoveLast() (val interface{}) {
 		return nil
 	}
 
+	defer ql.recompress()
 	iter := ql.find(ql.size - 1) // 最后一个元素
 
 	return iter.remove()
@@ -133,6 +151,7 @@ func (ql *QuickList) RemoveAllByVal(expected Expected) int {
 		return 0
 	}
 
+	defer ql.recompress()
 	iter := ql.find(0)
 	removed := 0
 	for !iter.atEnd() {
@@ -152,6 +171,7 @@ func (ql *QuickList) RemoveByVal(expected Expected, count int) int {
 		return 0
 	}
 
+	defer ql.recompress()
 	iter := ql.find(0)
 	removed := 0
 	for !iter.atEnd() {
@@ -172,6 +192,7 @@ func (ql *QuickList) ReverseRemoveByVal(expected Expected, count int) int {
 	if ql.size == 0 {
 		return 0
 	}
+	defer ql.recompress()
 	iter := ql.find(ql.size - 1)
 	removed := 0
 	for !iter.atBegin() {
@@ -0,0 +1,114 @@
+package list
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func makeValue(i int) []byte {
+	return []byte("value-" + strconv.Itoa(i%64))
+}
+
+// checkQuickList 检查 quicklist 的内容与参照的切片一致，并且头尾各 compressDepth 个 page 不压缩，中间的 page 压缩
+func checkQuickList(t *testing.T, ql *QuickList, expected [][]byte) {
+	t.Helper()
+	if ql.Len() != len(expected) {
+		t.Fatalf("len: %d, expected %d", ql.Len(), len(expected))
+	}
+	ql.ForEach(func(i int, v interface{}) bool {
+		if !bytes.Equal(v.([]byte), expected[i]) {
+			t.Fatalf("index %d: %s, expected %s", i, v, expected[i])
+		}
+		return true
+	})
+
+	pages, size := ql.data.Len(), 0
+	i := 0
+	for node := ql.data.Front(); node != nil; node = node.Next() {
+		size += pageLen(node)
+		_, compressed := node.Value.(*compressedPage)
+		edge := i < ql.compressDepth || i >= pages-ql.compressDepth
+		if edge && compressed {
+			t.Fatalf("page %d/%d near head or tail is compressed", i, pages)
+		}
+		if !edge && !compressed {
+			t.Fatalf("interior page %d/%d is not compressed", i, pages)
+		}
+		i++
+	}
+	if size != len(expected) {
+		t.Fatalf("pages size: %d, expected %d", size, len(expected))
+	}
+}
+
+func TestCompressedQuickList(t *testing.T) {
+	rand.Seed(1)
+	for _, depth := range []int{1, 2} {
+		ql := MakeCompressedQuickList(depth)
+		var expected [][]byte
+		for i := 0; i < pageSize*8; i++ {
+			ql.Add(makeValue(i))
+			expected = append(expected, makeValue(i))
+		}
+		checkQuickList(t, ql, expected)
+
+		for round := 0; round < 2000; round++ {
+			switch op := rand.Intn(3); {
+			case op == 0:
+				index, val := rand.Intn(len(expected)+1), makeValue(rand.Int())
+				ql.Insert(index, val)
+				expected = append(expected[:index], append([][]byte{val}, expected[index:]...)...)
+			case op == 1 && len(expected) > 0:
+				index := rand.Intn(len(expected))
+				if v := ql.Remove(index); !bytes.Equal(v.([]byte), expected[index]) {
+					t.Fatalf("remove %d: %s, expected %s", index, v, expected[index])
+				}
+				expected = append(expected[:index], expected[index+1:]...)
+			case op == 2 && len(expected) > 0:
+				index, val := rand.Intn(len(expected)), makeValue(rand.Int())
+				ql.Set(index, val)
+				expected[index] = val
+			}
+			if round%50 == 0 {
+				// 在头部集中插入，使得新的 page 出现在头部，原来头部的 page 进入中间
+				head := make([][]byte, 0, pageSize/2)
+				for i := 0; i < pageSize/2; i++ {
+					ql.Insert(0, makeValue(i))
+					head = append([][]byte{makeValue(i)}, head...)
+				}
+				expected = append(head, expected...)
+			}
+			if round%100 == 0 {
+				checkQuickList(t, ql, expected)
+			}
+		}
+		checkQuickList(t, ql, expected)
+
+		// 删除大量元素，使得 page 数量减少，中间的 page 移动到头尾
+		for _, target := range []int{0, 1, 2, 3, 5, 7, 11} {
+			val := makeValue(target)
+			removed := ql.RemoveAllByVal(func(a interface{}) bool {
+				return bytes.Equal(a.([]byte), val)
+			})
+			n := 0
+			for _, v := range expected {
+				if !bytes.Equal(v, val) {
+					expected[n] = v
+					n++
+				}
+			}
+			if removed != len(expected)-n {
+				t.Fatalf("remove all %s: %d, expected %d", val, removed, len(expected)-n)
+			}
+			expected = expected[:n]
+			checkQuickList(t, ql, expected)
+		}
+		for len(expected) > pageSize {
+			ql.RemoveLast()
+			expected = expected[:len(expected)-1]
+		}
+		checkQuickList(t, ql, expected)
+	}
+}
@@ -0,0 +1,137 @@
+package listpack
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// ListPack 将多个元素紧凑地保存在一段连续的内存中，每个元素依次为 uvarint 编码的长度以及内容。
+// 没有指针和哈希表的开销，查找需要顺序遍历，只用于保存元素较少的集合类型，并发控制由调用方负责。
+// 修改时总是分配新的内存，之前返回的元素在修改之后仍然有效，调用方不能修改返回的元素
+type ListPack struct {
+	buf []byte
+	n   int // 元素数量
+}
+
+func New() *ListPack {
+	return &ListPack{}
+}
+
+// Len 返回元素数量
+func (lp *ListPack) Len() int {
+	return lp.n
+}
+
+// Bytes 返回占用的字节数
+func (lp *ListPack) Bytes() int {
+	return cap(lp.buf)
+}
+
+// next 返回从 offset 开始的元素的内容以及下一个元素的位置
+func (lp *ListPack) next(offset int) ([]byte, int) {
+	size, n := binary.Uvarint(lp.buf[offset:])
+	start := offset + n
+	end := start + int(size)
+	return lp.buf[start:end:end], end
+}
+
+// offset 返回第 i 个元素的起始位置，i 等于 Len 时返回末尾
+func (lp *ListPack) offset(i int) int {
+	if i < 0 || i > lp.n {
+		panic("listpack: index out of range")
+	}
+	offset := 0
+	for ; i > 0; i-- {
+		_, offset = lp.next(offset)
+	}
+	return offset
+}
+
+// Get 返回第 i 个元素
+func (lp *ListPack) Get(i int) []byte {
+	entry, _ := lp.next(lp.offset(i))
+	return entry
+}
+
+// ForEach 依次遍历元素，consumer 返回 false 时停止
+func (lp *ListPack) ForEach(consumer func(i int, entry []byte) bool) {
+	offset := 0
+	for i := 0; i < lp.n; i++ {
+		var entry []byte
+		entry, offset = lp.next(offset)
+		if !consumer(i, entry) {
+			return
+		}
+	}
+}
+
+// Find 从第 0 个元素开始每隔 step 个元素查找等于 entry 的元素，返回其位置，不存在时返回 -1。
+// 保存键值对时 step 为 2，只比较键
+func (lp *ListPack) Find(entry []byte, step int) int {
+	index := -1
+	lp.ForEach(func(i int, e []byte) bool {
+		if i%step == 0 && bytes.Equal(e, entry) {
+			index = i
+			return false
+		}
+		return true
+	})
+	return index
+}
+
+// encode 编码若干个元素
+func encode(entries [][]byte) []byte {
+	size := 0
+	for _, entry := range entries {
+		size += binary.MaxVarintLen64 + len(entry)
+	}
+	buf := make([]byte, 0, size)
+	for _, entry := range entries {
+		buf = binary.AppendUvarint(buf, uint64(len(entry)))
+		buf = append(buf, entry...)
+	}
+	return buf
+}
+
+// Insert 在第 i 个元素之前插入若干个元素，i 等于 Len 时追加在末尾
+func (lp *ListPack) Insert(i int, entries ...[]byte) {
+	offset := lp.offset(i)
+	encoded := encode(entries)
+	buf := make([]byte, len(lp.buf)+len(encoded))
+	copy(buf, lp.buf[:offset])
+	copy(buf[offset:], encoded)
+	copy(buf[offset+len(encoded):], lp.buf[offset:])
+	lp.buf = buf
+	lp.n += len(entries)
+}
+
+// Append 在末尾追加若干个元素
+func (lp *ListPack) Append(entries ...[]byte) {
+	lp.Insert(lp.n, entries...)
+}
+
+// Replace 将第 i 个元素替换为 entry
+func (lp *ListPack) Replace(i int, entry []byte) {
+	lp.Delete(i, 1)
+	lp.Insert(i, entry)
+}
+
+// Delete 从第 i 个元素开始删除 count 个元素
+func (lp *ListPack) Delete(i, count int) {
+	if count <= 0 {
+		return
+	}
+	if i+count > lp.n {
+		count = lp.n - i
+	}
+	start := lp.offset(i)
+	end := start
+	for j := 0; j < count; j++ {
+		_, end = lp.next(end)
+	}
+	buf := make([]byte, len(lp.buf)-(end-start))
+	copy(buf, lp.buf[:start])
+	copy(buf[start:], lp.buf[end:])
+	lp.buf = buf
+	lp.n -= count
+}
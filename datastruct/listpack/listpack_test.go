@@ -0,0 +1,43 @@
+package listpack
+
+import (
+	"strings"
+	"testing"
+)
+
+func entries(lp *ListPack) string {
+	var result []string
+	lp.ForEach(func(i int, entry []byte) bool {
+		result = append(result, string(entry))
+		return true
+	})
+	return strings.Join(result, ",")
+}
+
+func TestListPack(t *testing.T) {
+	lp := New()
+	lp.Append([]byte("a"), []byte("1"), []byte("b"), []byte("2"))
+	lp.Insert(0, []byte(""), []byte(strings.Repeat("x", 200)))
+	if lp.Len() != 6 || string(lp.Get(1)) != strings.Repeat("x", 200) || string(lp.Get(5)) != "2" {
+		t.Fatalf("insert: %s", entries(lp))
+	}
+	lp.Delete(0, 2)
+	if got := entries(lp); got != "a,1,b,2" {
+		t.Errorf("delete: %s", got)
+	}
+	// step 为 2 时只比较键
+	if i := lp.Find([]byte("b"), 2); i != 2 {
+		t.Errorf("find b: %d", i)
+	}
+	if i := lp.Find([]byte("1"), 2); i != -1 {
+		t.Errorf("find value: %d", i)
+	}
+	lp.Replace(3, []byte("22"))
+	lp.Delete(2, 10)
+	if got := entries(lp); got != "a,1" || lp.Len() != 2 {
+		t.Errorf("replace and delete: %s", got)
+	}
+	if lp.Bytes() != 4 {
+		t.Errorf("bytes: %d", lp.Bytes())
+	}
+}
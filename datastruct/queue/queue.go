@@ -0,0 +1,339 @@
+package queue
+
+import (
+	"container/heap"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrBadDump = errors.New("ERR queue: invalid dump data")
+
+const (
+	stateReady   byte = iota // 在就绪队列中等待被取出
+	stateDelayed             // 延迟投递，到期后进入就绪队列
+	stateLeased              // 已经被取出，可见性超时之前需要确认
+	stateDead                // 投递次数达到上限，进入死信队列
+)
+
+// Message 队列中的消息
+type Message struct {
+	ID         int64
+	Payload    []byte
+	Deliveries int       // 已经被取出的次数
+	VisibleAt  time.Time // 延迟投递的时间或者租约到期的时间
+	state      byte
+	index      int // 在 pending 堆中的位置
+}
+
+// LeaseID 返回本次投递的租约 ID，由消息 ID 和投递次数组成，重新投递之后旧的租约失效
+func (m *Message) LeaseID() string {
+	return strconv.FormatInt(m.ID, 10) + "-" + strconv.Itoa(m.Deliveries)
+}
+
+// pending 按照可见时间排列的延迟消息和租约中的消息
+type pending []*Message
+
+func (h pending) Len() int { return len(h) }
+
+func (h pending) Less(i, j int) bool {
+	if h[i].VisibleAt.Equal(h[j].VisibleAt) {
+		return h[i].ID < h[j].ID
+	}
+	return h[i].VisibleAt.Before(h[j].VisibleAt)
+}
+
+func (h pending) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *pending) Push(x interface{}) {
+	m := x.(*Message)
+	m.index = len(*h)
+	*h = append(*h, m)
+}
+
+func (h *pending) Pop() interface{} {
+	old := *h
+	m := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	m.index = -1
+	return m
+}
+
+// Stats 队列的统计信息
+type Stats struct {
+	Ready         int
+	Delayed       int
+	Leased        int
+	Dead          int
+	Pushed        int64
+	Acked         int64
+	MaxDeliveries int
+}
+
+// Queue 可靠队列，取出的消息在可见性超时之前没有被确认时重新进入就绪队列，
+// 投递次数达到上限的消息进入死信队列。所有的状态变化只依赖传入的时间，
+// 使用相同的时间重放相同的操作可以得到相同的状态，并发控制由调用方负责
+type Queue struct {
+	maxDeliveries int // 为 0 时不限制投递次数
+	nextID        int64
+	ready         *list.List // 元素为 *Message
+	pending       pending
+	leased        map[int64]*Message
+	dead          []*Message
+	pushed        int64
+	acked         int64
+}
+
+func MakeQueue(maxDeliveries int) *Queue {
+	if maxDeliveries < 0 {
+		maxDeliveries = 0
+	}
+	return &Queue{
+		maxDeliveries: maxDeliveries,
+		ready:         list.New(),
+		leased:        make(map[int64]*Message),
+	}
+}
+
+// MaxDeliveries 返回最多投递的次数，为 0 时不限制
+func (q *Queue) MaxDeliveries() int {
+	return q.maxDeliveries
+}
+
+// Stats 返回统计信息
+func (q *Queue) Stats() Stats {
+	return Stats{
+		Ready:         q.ready.Len(),
+		Delayed:       len(q.pending) - len(q.leased),
+		Leased:        len(q.leased),
+		Dead:          len(q.dead),
+		Pushed:        q.pushed,
+		Acked:         q.acked,
+		MaxDeliveries: q.maxDeliveries,
+	}
+}
+
+// Dead 返回死信队列中最早的 count 条消息，count 为负数时返回全部
+func (q *Queue) Dead(count int) []*Message {
+	if count < 0 || count > len(q.dead) {
+		count = len(q.dead)
+	}
+	result := make([]*Message, count)
+	copy(result, q.dead)
+	return result
+}
+
+// Push 添加一条消息，delay 大于 0 时延迟投递，返回消息 ID
+func (q *Queue) Push(payload []byte, delay time.Duration, now time.Time) int64 {
+	q.Tick(now)
+	q.nextID++
+	q.pushed++
+	m := &Message{ID: q.nextID, Payload: payload, index: -1}
+	if delay > 0 {
+		m.state, m.VisibleAt = stateDelayed, now.Add(delay)
+		heap.Push(&q.pending, m)
+	} else {
+		m.state = stateReady
+		q.ready.PushBack(m)
+	}
+	return m.ID
+}
+
+// Pop 取出最早就绪的消息，在 visibility 时间之内需要确认，否则重新投递，队列为空时返回 false
+func (q *Queue) Pop(visibility time.Duration, now time.Time) (*Message, bool) {
+	q.Tick(now)
+	front := q.ready.Front()
+	if front == nil {
+		return nil, false
+	}
+	m := q.ready.Remove(front).(*Message)
+	m.Deliveries++
+	m.state, m.VisibleAt = stateLeased, now.Add(visibility)
+	q.leased[m.ID] = m
+	heap.Push(&q.pending, m)
+	return m, true
+}
+
+// lease 返回租约对应的消息，租约不存在或者已经失效时返回 nil
+func (q *Queue) lease(leaseID string) *Message {
+	i := strings.IndexByte(leaseID, '-')
+	if i < 0 {
+		return nil
+	}
+	id, err := strconv.ParseInt(leaseID[:i], 10, 64)
+	if err != nil {
+		return nil
+	}
+	m, ok := q.leased[id]
+	if !ok || m.LeaseID() != leaseID {
+		return nil
+	}
+	return m
+}
+
+// Ack 确认消息已经被处理并删除，租约不存在或者已经超时时返回 false
+func (q *Queue) Ack(leaseID string, now time.Time) bool {
+	q.Tick(now)
+	m := q.lease(leaseID)
+	if m == nil {
+		return false
+	}
+	heap.Remove(&q.pending, m.index)
+	delete(q.leased, m.ID)
+	q.acked++
+	return true
+}
+
+// Nack 放弃处理消息，消息立即（delay 为 0）或者延迟之后重新投递，投递次数达到上限时进入死信队列，
+// 租约不存在或者已经超时时返回 false
+func (q *Queue) Nack(leaseID string, delay time.Duration, now time.Time) bool {
+	q.Tick(now)
+	m := q.lease(leaseID)
+	if m == nil {
+		return false
+	}
+	heap.Remove(&q.pending, m.index)
+	delete(q.leased, m.ID)
+	q.redeliver(m, delay, now)
+	return true
+}
+
+// redeliver 将租约结束的消息重新投递或者放入死信队列
+func (q *Queue) redeliver(m *Message, delay time.Duration, now time.Time) {
+	if q.maxDeliveries > 0 && m.Deliveries >= q.maxDeliveries {
+		m.state = stateDead
+		q.dead = append(q.dead, m)
+		return
+	}
+	if delay > 0 {
+		m.state, m.VisibleAt = stateDelayed, now.Add(delay)
+		heap.Push(&q.pending, m)
+		return
+	}
+	m.state = stateReady
+	q.ready.PushBack(m)
+}
+
+// Tick 将到期的延迟消息放入就绪队列，将租约超时的消息重新投递，返回处理的消息数量
+func (q *Queue) Tick(now time.Time) int {
+	count := 0
+	for len(q.pending) > 0 && !now.Before(q.pending[0].VisibleAt) {
+		m := heap.Pop(&q.pending).(*Message)
+		if m.state == stateLeased {
+			delete(q.leased, m.ID)
+			q.redeliver(m, 0, now)
+		} else {
+			m.state = stateReady
+			q.ready.PushBack(m)
+		}
+		count++
+	}
+	return count
+}
+
+// NextDeadline 返回最早的延迟消息到期或者租约超时的时间，没有时返回 false
+func (q *Queue) NextDeadline() (time.Time, bool) {
+	if len(q.pending) == 0 {
+		return time.Time{}, false
+	}
+	return q.pending[0].VisibleAt, true
+}
+
+// ForEach 依次遍历就绪队列、延迟和租约中的消息以及死信队列中的消息
+func (q *Queue) ForEach(consumer func(m *Message) bool) {
+	for e := q.ready.Front(); e != nil; e = e.Next() {
+		if !consumer(e.Value.(*Message)) {
+			return
+		}
+	}
+	for _, m := range q.pending {
+		if !consumer(m) {
+			return
+		}
+	}
+	for _, m := range q.dead {
+		if !consumer(m) {
+			return
+		}
+	}
+}
+
+// Dump 序列化队列，依次为就绪队列、延迟和租约中的消息以及死信队列
+func (q *Queue) Dump() []byte {
+	buf := make([]byte, 0, 32)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(q.maxDeliveries))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(q.nextID))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(q.pushed))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(q.acked))
+	appendMessage := func(m *Message) {
+		buf = append(buf, m.state)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(m.ID))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Deliveries))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(m.VisibleAt.UnixMilli()))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(m.Payload)))
+		buf = append(buf, m.Payload...)
+	}
+	for e := q.ready.Front(); e != nil; e = e.Next() {
+		appendMessage(e.Value.(*Message))
+	}
+	for _, m := range q.pending {
+		appendMessage(m)
+	}
+	for _, m := range q.dead {
+		appendMessage(m)
+	}
+	return buf
+}
+
+// Restore 从 Dump 的结果中恢复队列
+func Restore(data []byte) (*Queue, error) {
+	if len(data) < 28 {
+		return nil, ErrBadDump
+	}
+	q := MakeQueue(int(binary.LittleEndian.Uint32(data)))
+	q.nextID = int64(binary.LittleEndian.Uint64(data[4:]))
+	q.pushed = int64(binary.LittleEndian.Uint64(data[12:]))
+	q.acked = int64(binary.LittleEndian.Uint64(data[20:]))
+	for pos := 28; pos < len(data); {
+		if len(data)-pos < 25 {
+			return nil, ErrBadDump
+		}
+		m := &Message{
+			state:      data[pos],
+			ID:         int64(binary.LittleEndian.Uint64(data[pos+1:])),
+			Deliveries: int(binary.LittleEndian.Uint32(data[pos+9:])),
+			VisibleAt:  time.UnixMilli(int64(binary.LittleEndian.Uint64(data[pos+13:]))),
+			index:      -1,
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+21:]))
+		pos += 25
+		if size > len(data)-pos || m.ID <= 0 || m.ID > q.nextID {
+			return nil, ErrBadDump
+		}
+		m.Payload = append([]byte{}, data[pos:pos+size]...)
+		pos += size
+
+		switch m.state {
+		case stateReady:
+			q.ready.PushBack(m)
+		case stateDelayed:
+			heap.Push(&q.pending, m)
+		case stateLeased:
+			q.leased[m.ID] = m
+			heap.Push(&q.pending, m)
+		case stateDead:
+			q.dead = append(q.dead, m)
+		default:
+			return nil, ErrBadDump
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	q := MakeQueue(2)
+	now := time.UnixMilli(1_000_000)
+	q.Push([]byte("a"), 0, now)
+	q.Push([]byte("b"), time.Second, now)
+	q.Push([]byte("c"), 0, now)
+
+	m, ok := q.Pop(time.Second, now)
+	if !ok || string(m.Payload) != "a" || m.LeaseID() != "1-1" {
+		t.Fatalf("pop a: %+v", m)
+	}
+	if m, _ := q.Pop(time.Second, now); string(m.Payload) != "c" {
+		t.Fatalf("pop c: %+v", m)
+	}
+	if _, ok := q.Pop(time.Second, now); ok {
+		t.Fatal("delayed message popped early")
+	}
+	if !q.Ack("1-1", now) || q.Ack("1-1", now) {
+		t.Error("ack error")
+	}
+	if stats := q.Stats(); stats.Ready != 0 || stats.Delayed != 1 || stats.Leased != 1 || stats.Acked != 1 {
+		t.Errorf("stats: %+v", stats)
+	}
+
+	// 延迟消息到期，c 的租约同时超时重新投递，b 的 ID 更小排在前面
+	later := now.Add(time.Second)
+	if n := q.Tick(later); n != 2 {
+		t.Fatalf("tick: %d", n)
+	}
+	if m, _ := q.Pop(time.Second, later); string(m.Payload) != "b" {
+		t.Errorf("pop b: %+v", m)
+	}
+	m, _ = q.Pop(time.Second, later)
+	if string(m.Payload) != "c" || m.LeaseID() != "3-2" {
+		t.Fatalf("redeliver c: %+v", m)
+	}
+	// 旧的租约已经失效
+	if q.Ack("3-1", later) {
+		t.Error("ack stale lease")
+	}
+	// 达到最多投递次数之后进入死信队列
+	if !q.Nack("3-2", 0, later) {
+		t.Fatal("nack error")
+	}
+	if dead := q.Dead(-1); len(dead) != 1 || string(dead[0].Payload) != "c" {
+		t.Errorf("dead: %v", dead)
+	}
+	if !q.Nack("2-1", time.Minute, later) {
+		t.Fatal("nack with delay error")
+	}
+	if next, ok := q.NextDeadline(); !ok || !next.Equal(later.Add(time.Minute)) {
+		t.Errorf("next deadline: %v", next)
+	}
+
+	restored, err := Restore(q.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Stats() != q.Stats() {
+		t.Errorf("restored stats: %+v, expected %+v", restored.Stats(), q.Stats())
+	}
+	if id := restored.Push([]byte("d"), 0, later); id != 4 {
+		t.Errorf("restored next id: %d", id)
+	}
+	if m, _ := restored.Pop(time.Second, later.Add(time.Minute)); string(m.Payload) != "d" || m.Deliveries != 1 {
+		t.Errorf("restored pop: %+v", m)
+	}
+	if m, _ := restored.Pop(time.Second, later.Add(time.Minute)); string(m.Payload) != "b" || m.Deliveries != 2 {
+		t.Errorf("restored pop delayed: %+v", m)
+	}
+	if _, err := Restore(q.Dump()[:30]); err == nil {
+		t.Error("restore truncated dump")
+	}
+}
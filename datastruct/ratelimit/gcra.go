@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrOutOfRange = errors.New("ERR rate limit parameters out of range")
+
+// Result 限流的判断结果
+type Result struct {
+	Allowed    bool
+	Remaining  int64         // 还可以立即通过的请求数量
+	RetryAfter time.Duration // 被拒绝时距离可以重试的时间，被允许或者永远不会被允许时为 -1
+	ResetAfter time.Duration // 距离恢复到满额的时间
+}
+
+// GCRA 使用通用信元速率算法（Generic Cell Rate Algorithm）判断 quantity 个请求是否可以通过，
+// 每 period 时间允许 count 个请求，最多允许 maxBurst+1 个请求同时通过。
+// tat 为上一次计算得到的理论到达时间，没有时为零值，返回判断结果以及新的理论到达时间，
+// 理论到达时间早于当前时间时等价于没有记录，可以在该时间之后删除
+func GCRA(tat, now time.Time, maxBurst, count int64, period time.Duration, quantity int64) (*Result, time.Time, error) {
+	if maxBurst < 0 || count <= 0 || period <= 0 || quantity < 0 {
+		return nil, tat, ErrOutOfRange
+	}
+	emission := period / time.Duration(count)
+	if emission <= 0 {
+		emission = 1
+	}
+	tolerance, ok := mulDuration(emission, maxBurst+1)
+	if !ok {
+		return nil, tat, ErrOutOfRange
+	}
+	increment, ok := mulDuration(emission, quantity)
+	if !ok {
+		return nil, tat, ErrOutOfRange
+	}
+
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(increment)
+	allowAt := newTat.Add(-tolerance)
+	if now.Before(allowAt) {
+		retryAfter := allowAt.Sub(now)
+		if increment > tolerance {
+			retryAfter = -1
+		}
+		resetAfter := tat.Sub(now)
+		return &Result{
+			Remaining:  remaining(tolerance-resetAfter, emission),
+			RetryAfter: retryAfter,
+			ResetAfter: resetAfter,
+		}, tat, nil
+	}
+
+	resetAfter := newTat.Sub(now)
+	return &Result{
+		Allowed:    true,
+		Remaining:  remaining(tolerance-resetAfter, emission),
+		RetryAfter: -1,
+		ResetAfter: resetAfter,
+	}, newTat, nil
+}
+
+func remaining(next, emission time.Duration) int64 {
+	if next < 0 {
+		return 0
+	}
+	return int64(next / emission)
+}
+
+// mulDuration 返回 d*n，溢出时返回 false
+func mulDuration(d time.Duration, n int64) (time.Duration, bool) {
+	if n == 0 {
+		return 0, true
+	}
+	result := d * time.Duration(n)
+	if result/time.Duration(n) != d {
+		return 0, false
+	}
+	return result, true
+}
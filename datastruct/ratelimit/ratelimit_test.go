@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGCRA(t *testing.T) {
+	now := time.Now()
+	var tat time.Time
+	// 每秒 10 个请求，最多突发 5 个（同时通过 6 个）
+	for i := 0; i < 6; i++ {
+		r, next, err := GCRA(tat, now, 5, 10, time.Second, 1)
+		if err != nil || !r.Allowed || r.Remaining != int64(5-i) {
+			t.Fatalf("request %d: %+v %v", i, r, err)
+		}
+		tat = next
+	}
+	r, next, _ := GCRA(tat, now, 5, 10, time.Second, 1)
+	if r.Allowed || r.Remaining != 0 || r.RetryAfter != 100*time.Millisecond || r.ResetAfter != 600*time.Millisecond {
+		t.Fatalf("limited: %+v", r)
+	}
+	if !next.Equal(tat) {
+		t.Error("limited request changed tat")
+	}
+
+	// 一个发射间隔之后可以再通过一个
+	r, tat, _ = GCRA(tat, now.Add(100*time.Millisecond), 5, 10, time.Second, 1)
+	if !r.Allowed || r.Remaining != 0 {
+		t.Errorf("after emission interval: %+v", r)
+	}
+	// 超过突发上限的请求永远不会通过
+	r, _, _ = GCRA(time.Time{}, now, 5, 10, time.Second, 7)
+	if r.Allowed || r.RetryAfter != -1 {
+		t.Errorf("quantity over burst: %+v", r)
+	}
+	// quantity 为 0 时只查询
+	r, next, _ = GCRA(tat, now.Add(time.Second), 5, 10, time.Second, 0)
+	if !r.Allowed || r.Remaining != 6 || !next.Equal(now.Add(time.Second)) {
+		t.Errorf("query: %+v", r)
+	}
+
+	if _, _, err := GCRA(tat, now, 1<<62, 1, time.Hour, 1); err != ErrOutOfRange {
+		t.Error("overflow not detected")
+	}
+}
+
+func TestSlidingLog(t *testing.T) {
+	l := MakeSlidingLog()
+	now := time.UnixMilli(1_000_000)
+	for i := 0; i < 3; i++ {
+		r, err := l.Allow(now.Add(time.Duration(i)*100*time.Millisecond), 5, time.Second, 1)
+		if err != nil || !r.Allowed {
+			t.Fatalf("request %d: %+v %v", i, r, err)
+		}
+	}
+	r, _ := l.Allow(now.Add(300*time.Millisecond), 5, time.Second, 2)
+	if !r.Allowed || r.Remaining != 0 || r.ResetAfter != time.Second {
+		t.Fatalf("fill: %+v", r)
+	}
+	// 需要等待最旧的两条记录滑出窗口
+	r, _ = l.Allow(now.Add(500*time.Millisecond), 5, time.Second, 2)
+	if r.Allowed || r.RetryAfter != 600*time.Millisecond || r.ResetAfter != 800*time.Millisecond {
+		t.Fatalf("limited: %+v", r)
+	}
+	r, _ = l.Allow(now.Add(1100*time.Millisecond), 5, time.Second, 2)
+	if !r.Allowed || r.Remaining != 0 || l.Len() != 3 || l.Total() != 5 {
+		t.Errorf("after slide: %+v len=%d total=%d", r, l.Len(), l.Total())
+	}
+	r, _ = l.Allow(now, 5, time.Second, 6)
+	if r.Allowed || r.RetryAfter != -1 {
+		t.Errorf("quantity over limit: %+v", r)
+	}
+
+	restored, err := RestoreSlidingLog(l.Dump())
+	if err != nil || restored.Len() != l.Len() || restored.Total() != l.Total() {
+		t.Fatalf("restore: %v", err)
+	}
+	if newest, _ := restored.Newest(); !newest.Equal(now.Add(1100 * time.Millisecond)) {
+		t.Errorf("newest: %v", newest)
+	}
+	if _, err := RestoreSlidingLog(l.Dump()[:8]); err == nil {
+		t.Error("restore truncated dump")
+	}
+}
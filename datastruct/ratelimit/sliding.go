@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var ErrBadDump = errors.New("ERR rate limit: invalid dump data")
+
+type logEntry struct {
+	at       int64 // 毫秒时间戳
+	quantity int64
+}
+
+// SlidingLog 滑动窗口日志，记录窗口内每次通过的请求的时间和数量，
+// 与固定窗口计数相比在窗口边界处不会允许两倍的请求通过，并发控制由调用方负责
+type SlidingLog struct {
+	entries []logEntry // 按照时间从旧到新排列
+	total   int64      // 窗口内通过的请求数量
+}
+
+func MakeSlidingLog() *SlidingLog {
+	return &SlidingLog{}
+}
+
+// Len 返回记录的条数
+func (l *SlidingLog) Len() int {
+	return len(l.entries)
+}
+
+// Total 返回记录的请求数量，包括已经滑出窗口但是还没有被清理的请求
+func (l *SlidingLog) Total() int64 {
+	return l.total
+}
+
+// Newest 返回最新的记录的时间，没有记录时返回 false
+func (l *SlidingLog) Newest() (time.Time, bool) {
+	if len(l.entries) == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(l.entries[len(l.entries)-1].at), true
+}
+
+// trim 清理在 now 时已经滑出窗口的记录
+func (l *SlidingLog) trim(now int64, window int64) {
+	i := 0
+	for ; i < len(l.entries) && l.entries[i].at+window <= now; i++ {
+		l.total -= l.entries[i].quantity
+	}
+	l.entries = l.entries[i:]
+}
+
+// Allow 判断在 window 时间内最多允许 limit 个请求时，quantity 个请求是否可以通过，通过时记录到日志中。
+// now 早于最新的记录时按照最新的记录的时间计算，保证记录有序
+func (l *SlidingLog) Allow(now time.Time, limit int64, window time.Duration, quantity int64) (*Result, error) {
+	if limit <= 0 || window < time.Millisecond || quantity < 0 {
+		return nil, ErrOutOfRange
+	}
+	nowMs, windowMs := now.UnixMilli(), window.Milliseconds()
+	if n := len(l.entries); n > 0 && l.entries[n-1].at > nowMs {
+		nowMs = l.entries[n-1].at
+	}
+	l.trim(nowMs, windowMs)
+
+	result := &Result{RetryAfter: -1}
+	if l.total+quantity <= limit {
+		result.Allowed = true
+		if quantity > 0 {
+			if n := len(l.entries); n > 0 && l.entries[n-1].at == nowMs {
+				l.entries[n-1].quantity += quantity
+			} else {
+				l.entries = append(l.entries, logEntry{at: nowMs, quantity: quantity})
+			}
+			l.total += quantity
+		}
+	} else if quantity <= limit {
+		// 最旧的记录依次滑出窗口，直到空出 quantity 个位置
+		need := l.total + quantity - limit
+		for _, e := range l.entries {
+			need -= e.quantity
+			if need <= 0 {
+				result.RetryAfter = time.Duration(e.at+windowMs-nowMs) * time.Millisecond
+				break
+			}
+		}
+	}
+	result.Remaining = limit - l.total
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if n := len(l.entries); n > 0 {
+		result.ResetAfter = time.Duration(l.entries[n-1].at+windowMs-nowMs) * time.Millisecond
+	}
+	return result, nil
+}
+
+// Dump 序列化所有的记录
+func (l *SlidingLog) Dump() []byte {
+	buf := make([]byte, 0, 16*len(l.entries))
+	for _, e := range l.entries {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.at))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.quantity))
+	}
+	return buf
+}
+
+// RestoreSlidingLog 从 Dump 的结果中恢复滑动窗口日志
+func RestoreSlidingLog(data []byte) (*SlidingLog, error) {
+	if len(data)%16 != 0 {
+		return nil, ErrBadDump
+	}
+	l := MakeSlidingLog()
+	for pos := 0; pos < len(data); pos += 16 {
+		e := logEntry{
+			at:       int64(binary.LittleEndian.Uint64(data[pos:])),
+			quantity: int64(binary.LittleEndian.Uint64(data[pos+8:])),
+		}
+		if e.quantity <= 0 || (len(l.entries) > 0 && l.entries[len(l.entries)-1].at >= e.at) {
+			return nil, ErrBadDump
+		}
+		l.entries = append(l.entries, e)
+		l.total += e.quantity
+	}
+	return l, nil
+}
@@ -0,0 +1,187 @@
+package search
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Row FT.AGGREGATE 中的一行，保持字段的顺序
+type Row struct {
+	fields []string
+	values map[string]string
+}
+
+func MakeRow() *Row {
+	return &Row{values: make(map[string]string)}
+}
+
+func (r *Row) Set(field, value string) {
+	if _, ok := r.values[field]; !ok {
+		r.fields = append(r.fields, field)
+	}
+	r.values[field] = value
+}
+
+func (r *Row) Get(field string) (string, bool) {
+	value, ok := r.values[field]
+	return value, ok
+}
+
+// Fields 按照写入的顺序返回所有的字段
+func (r *Row) Fields() []string {
+	return r.fields
+}
+
+// Reducer GROUPBY 中的聚合函数
+type Reducer struct {
+	fn    string
+	field string
+	alias string
+}
+
+// MakeReducer 创建聚合函数，支持 COUNT、COUNT_DISTINCT、SUM、AVG、MIN、MAX，
+// 除 COUNT 外都需要一个字段作为参数，alias 为空时使用函数名与字段名作为结果的字段名
+func MakeReducer(fn string, args []string, alias string) (*Reducer, error) {
+	fn = strings.ToLower(fn)
+	r := &Reducer{fn: fn, alias: alias}
+	switch fn {
+	case "count":
+		if len(args) != 0 {
+			return nil, errors.New("ERR Count accepts 0 values only")
+		}
+		if alias == "" {
+			r.alias = "count"
+		}
+		return r, nil
+	case "count_distinct", "sum", "avg", "min", "max":
+		if len(args) != 1 {
+			return nil, errors.New("ERR Bad arguments for " + strings.ToUpper(fn) + ": Need exactly one argument")
+		}
+		r.field = strings.TrimPrefix(args[0], "@")
+		if alias == "" {
+			r.alias = fn + "_" + r.field
+		}
+		return r, nil
+	}
+	return nil, errors.New("ERR No such reducer: " + fn)
+}
+
+func (r *Reducer) reduce(rows []*Row) string {
+	if r.fn == "count" {
+		return strconv.Itoa(len(rows))
+	}
+	if r.fn == "count_distinct" {
+		distinct := make(map[string]struct{})
+		for _, row := range rows {
+			if v, ok := row.Get(r.field); ok {
+				distinct[v] = struct{}{}
+			}
+		}
+		return strconv.Itoa(len(distinct))
+	}
+
+	sum, n := 0.0, 0
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, row := range rows {
+		v, ok := row.Get(r.field)
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+		sum += f
+		n++
+		min = math.Min(min, f)
+		max = math.Max(max, f)
+	}
+	switch r.fn {
+	case "sum":
+		return formatFloat(sum)
+	case "avg":
+		if n == 0 {
+			return "0"
+		}
+		return formatFloat(sum / float64(n))
+	case "min":
+		return formatFloat(min)
+	default:
+		return formatFloat(max)
+	}
+}
+
+// GroupBy 按照字段的值分组，每组输出分组字段以及聚合函数的结果，分组按照第一次出现的顺序排列
+func GroupBy(rows []*Row, fields []string, reducers []*Reducer) []*Row {
+	groups := make(map[string][]*Row)
+	order := make([]string, 0)
+	for _, row := range rows {
+		values := make([]string, len(fields))
+		for i, field := range fields {
+			values[i], _ = row.Get(field)
+		}
+		groupKey := strings.Join(values, "\x00")
+		if _, ok := groups[groupKey]; !ok {
+			order = append(order, groupKey)
+		}
+		groups[groupKey] = append(groups[groupKey], row)
+	}
+
+	result := make([]*Row, 0, len(order))
+	for _, groupKey := range order {
+		members := groups[groupKey]
+		row := MakeRow()
+		for _, field := range fields {
+			value, _ := members[0].Get(field)
+			row.Set(field, value)
+		}
+		for _, r := range reducers {
+			row.Set(r.alias, r.reduce(members))
+		}
+		result = append(result, row)
+	}
+	return result
+}
+
+// SortKey 排序的字段
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// SortRows 按照多个字段排序，两个值都是数字时按照数值比较，没有值的行排在最后
+func SortRows(rows []*Row, keys []SortKey) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, key := range keys {
+			a, aok := rows[i].Get(key.Field)
+			b, bok := rows[j].Get(key.Field)
+			if !aok || !bok {
+				if aok != bok {
+					return aok
+				}
+				continue
+			}
+			c := compareValues(a, b, true)
+			if c == 0 {
+				continue
+			}
+			if key.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "inf"
+	} else if math.IsInf(f, -1) {
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,400 @@
+package search
+
+import (
+	"errors"
+	"github.com/dawnzzz/simple-redis/datastruct/sortedset"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrDuplicateField = errors.New("ERR Duplicate field in schema")
+	ErrEmptySchema    = errors.New("ERR Schema must contain at least one field")
+)
+
+// FieldType 字段的类型
+type FieldType int
+
+const (
+	FieldNumeric FieldType = iota
+	FieldTag
+	FieldText
+	FieldVector
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldNumeric:
+		return "NUMERIC"
+	case FieldTag:
+		return "TAG"
+	case FieldText:
+		return "TEXT"
+	case FieldVector:
+		return "VECTOR"
+	}
+	return ""
+}
+
+// ParseFieldType 解析字段类型，不区分大小写
+func ParseFieldType(s string) (FieldType, bool) {
+	switch strings.ToUpper(s) {
+	case "NUMERIC":
+		return FieldNumeric, true
+	case "TAG":
+		return FieldTag, true
+	case "TEXT":
+		return FieldText, true
+	case "VECTOR":
+		return FieldVector, true
+	}
+	return 0, false
+}
+
+// Field schema 中的字段
+type Field struct {
+	Name      string
+	Type      FieldType
+	Separator byte           // TAG 字段多个值之间的分隔符，默认为 ,
+	Weight    float64        // TEXT 字段的权重，默认为 1
+	Vector    *VectorOptions // VECTOR 字段的参数
+	Sortable  bool
+}
+
+// Index hash 上的二级索引，前缀匹配的 hash 在写入时自动更新到索引中
+type Index struct {
+	mu              sync.RWMutex
+	name            string
+	prefixes        []string
+	fields          []*Field
+	fieldMap        map[string]*Field
+	stopwords       map[string]struct{}
+	customStopwords []string                                  // 创建索引时指定的停用词，nil 表示使用默认的停用词
+	docs            map[string]map[string]string              // key -> 字段 -> 原始值
+	numeric         map[string]*sortedset.SortedSet           // 字段 -> 有序集合（member 为 key）
+	tags            map[string]map[string]map[string]struct{} // 字段 -> tag -> keys
+	text            *textIndex                                // 所有 TEXT 字段共用的倒排索引
+	vectors         map[string]vectorIndex                    // 字段 -> 向量索引
+}
+
+// Result 查询结果，Score 为全文检索的得分，KNN 查询时为向量之间的距离
+type Result struct {
+	Key   string
+	Score float64
+}
+
+func MakeIndex(name string, prefixes []string, fields []*Field) (*Index, error) {
+	if len(fields) == 0 {
+		return nil, ErrEmptySchema
+	}
+	idx := &Index{
+		name:      name,
+		prefixes:  prefixes,
+		fields:    fields,
+		fieldMap:  make(map[string]*Field, len(fields)),
+		stopwords: makeStopwordSet(DefaultStopwords),
+		docs:      make(map[string]map[string]string),
+		numeric:   make(map[string]*sortedset.SortedSet),
+		tags:      make(map[string]map[string]map[string]struct{}),
+		text:      makeTextIndex(),
+		vectors:   make(map[string]vectorIndex),
+	}
+	for _, f := range fields {
+		if _, ok := idx.fieldMap[f.Name]; ok {
+			return nil, ErrDuplicateField
+		}
+		idx.fieldMap[f.Name] = f
+		switch f.Type {
+		case FieldNumeric:
+			idx.numeric[f.Name] = sortedset.MakeSortedSet()
+		case FieldTag:
+			if f.Separator == 0 {
+				f.Separator = ','
+			}
+			idx.tags[f.Name] = make(map[string]map[string]struct{})
+		case FieldText:
+			if f.Weight <= 0 {
+				f.Weight = 1
+			}
+		case FieldVector:
+			if f.Vector == nil {
+				return nil, errors.New("ERR Missing vector options for field `" + f.Name + "`")
+			}
+			idx.vectors[f.Name] = makeVectorIndex(f.Vector)
+		}
+	}
+	return idx, nil
+}
+
+// SetStopwords 使用自定义的停用词，需要在添加文档之前调用
+func (idx *Index) SetStopwords(words []string) {
+	idx.customStopwords = words
+	idx.stopwords = makeStopwordSet(words)
+}
+
+// Stopwords 返回创建索引时指定的停用词，没有指定时返回 false
+func (idx *Index) Stopwords() ([]string, bool) {
+	return idx.customStopwords, idx.customStopwords != nil
+}
+
+func (idx *Index) Name() string {
+	return idx.name
+}
+
+func (idx *Index) Prefixes() []string {
+	return idx.prefixes
+}
+
+func (idx *Index) Fields() []*Field {
+	return idx.fields
+}
+
+// Field 返回 schema 中的字段
+func (idx *Index) Field(name string) (*Field, bool) {
+	f, ok := idx.fieldMap[name]
+	return f, ok
+}
+
+// Len 返回索引中的文档数量
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Match key 是否匹配索引的前缀，没有前缀时匹配所有的 key
+func (idx *Index) Match(key string) bool {
+	if len(idx.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range idx.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add 添加或者更新文档，get 用于获取 hash 中字段的值
+func (idx *Index) Add(key string, get func(field string) ([]byte, bool)) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(key)
+	doc := make(map[string]string)
+	for _, f := range idx.fields {
+		raw, ok := get(f.Name)
+		if !ok {
+			continue
+		}
+		value := string(raw)
+		switch f.Type {
+		case FieldNumeric:
+			score, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(score) {
+				// 不是数字的值不进入索引
+				continue
+			}
+			idx.numeric[f.Name].Add(key, score)
+		case FieldTag:
+			for _, tag := range splitTags(value, f.Separator) {
+				keys, ok := idx.tags[f.Name][tag]
+				if !ok {
+					keys = make(map[string]struct{})
+					idx.tags[f.Name][tag] = keys
+				}
+				keys[key] = struct{}{}
+			}
+		case FieldText:
+			idx.text.add(key, f.Name, tokenize(value, idx.stopwords))
+		case FieldVector:
+			vec, err := ParseVector(raw, f.Vector.Dim)
+			if err != nil {
+				// 长度不匹配的向量不进入索引
+				continue
+			}
+			idx.vectors[f.Name].add(key, vec)
+		}
+		doc[f.Name] = value
+	}
+	idx.docs[key] = doc
+}
+
+// Remove 从索引中删除文档
+func (idx *Index) Remove(key string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.remove(key)
+}
+
+func (idx *Index) remove(key string) bool {
+	doc, ok := idx.docs[key]
+	if !ok {
+		return false
+	}
+	for name, value := range doc {
+		f := idx.fieldMap[name]
+		switch f.Type {
+		case FieldNumeric:
+			idx.numeric[name].Remove(key)
+		case FieldTag:
+			for _, tag := range splitTags(value, f.Separator) {
+				keys := idx.tags[name][tag]
+				delete(keys, key)
+				if len(keys) == 0 {
+					delete(idx.tags[name], tag)
+				}
+			}
+		case FieldVector:
+			idx.vectors[name].remove(key)
+		}
+	}
+	idx.text.remove(key)
+	delete(idx.docs, key)
+	return true
+}
+
+// Clear 删除所有的文档，保留索引的定义
+func (idx *Index) Clear() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs = make(map[string]map[string]string)
+	for name := range idx.numeric {
+		idx.numeric[name] = sortedset.MakeSortedSet()
+	}
+	for name := range idx.tags {
+		idx.tags[name] = make(map[string]map[string]struct{})
+	}
+	idx.text = makeTextIndex()
+	for name := range idx.vectors {
+		idx.vectors[name] = makeVectorIndex(idx.fieldMap[name].Vector)
+	}
+}
+
+// Keys 返回索引中所有的 key
+func (idx *Index) Keys() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	keys := make([]string, 0, len(idx.docs))
+	for key := range idx.docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Value 返回文档中被索引的字段值
+func (idx *Index) Value(key, field string) (string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	doc, ok := idx.docs[key]
+	if !ok {
+		return "", false
+	}
+	value, ok := doc[field]
+	return value, ok
+}
+
+// Search 返回与查询匹配的所有文档，按照得分从高到低排列，得分相同时按照 key 的字典序排列；
+// 向量查询返回满足条件且距离最近的 k 个文档，按照距离从小到大排列
+func (idx *Index) Search(q *Query, scorer Scorer) ([]*Result, error) {
+	if err := q.root.check(idx); err != nil {
+		return nil, err
+	}
+	var vec []float32
+	if q.knn != nil {
+		var err error
+		if vec, err = q.knn.check(idx); err != nil {
+			return nil, err
+		}
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ctx := &searchCtx{idx: idx, scorer: scorer}
+	if q.knn != nil {
+		var filter docSet
+		if _, ok := q.root.(allNode); !ok {
+			// 先过滤再查找最近的向量
+			filter = q.root.eval(ctx)
+		}
+		ef := q.knn.ef
+		if ef == 0 {
+			ef = idx.fieldMap[q.knn.field].Vector.EfRuntime
+		}
+		return idx.vectors[q.knn.field].search(vec, q.knn.k, ef, filter), nil
+	}
+	set := q.root.eval(ctx)
+	results := make([]*Result, 0, len(set))
+	for key, score := range set {
+		results = append(results, &Result{Key: key, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Key < results[j].Key
+	})
+	return results, nil
+}
+
+// SortBy 按照字段的值对 keys 排序，数字字段按照数值比较，没有值的文档排在最后
+func (idx *Index) SortBy(keys []string, field string, desc bool) error {
+	f, ok := idx.Field(field)
+	if !ok {
+		return makeUnknownFieldErr(field)
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	numeric := f.Type == FieldNumeric
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, aok := idx.docs[keys[i]][field]
+		b, bok := idx.docs[keys[j]][field]
+		if !aok || !bok {
+			return aok && !bok
+		}
+		c := compareValues(a, b, numeric)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return nil
+}
+
+// compareValues numeric 为 true 且两个值都是数字时按照数值比较，否则按照字典序比较
+func compareValues(a, b string, numeric bool) int {
+	if numeric {
+		x, err1 := strconv.ParseFloat(a, 64)
+		y, err2 := strconv.ParseFloat(b, 64)
+		if err1 == nil && err2 == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// splitTags 按照分隔符切分 tag，去掉首尾的空白并转换为小写
+func splitTags(value string, sep byte) []string {
+	parts := strings.Split(value, string(sep))
+	tags := make([]string, 0, len(parts))
+	for _, part := range parts {
+		tag := strings.ToLower(strings.TrimSpace(part))
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func makeUnknownFieldErr(field string) error {
+	return errors.New("ERR Unknown field '" + field + "'")
+}
@@ -0,0 +1,668 @@
+package search
+
+import (
+	"errors"
+	"github.com/dawnzzz/simple-redis/datastruct/sortedset"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrSyntax = errors.New("ERR Syntax error in query")
+
+// Query 解析后的查询，* 匹配所有的文档，此外支持的语法：
+//
+//	hello             全文检索，匹配所有 TEXT 字段中包含该词的文档
+//	"hello world"     短语，词在同一个字段中连续出现
+//	hel*              前缀
+//	@field:hello      只在指定的 TEXT 字段中检索，也可以是短语、前缀或者括号分组
+//	@field:[min max]  数字范围，支持 ( 表示开区间以及 -inf、+inf
+//	@field:{a|b}      tag 匹配其中任意一个
+//	a b               交集
+//	a | b             并集
+//	-a                取反
+//	(a b)             分组
+//
+// 查询之后可以加上向量查询，在满足前面条件的文档中查找距离最近的 k 个文档：
+//
+//	filter=>[KNN k @field $param [EF_RUNTIME ef] [AS alias]]
+type Query struct {
+	root node
+	knn  *knnClause
+}
+
+// knnClause 向量查询，vector 为小端序的 float32 数组
+type knnClause struct {
+	k      int
+	field  string
+	vector []byte
+	ef     int
+	alias  string
+}
+
+// docSet 查询匹配的文档，key -> 得分
+type docSet map[string]float64
+
+type searchCtx struct {
+	idx    *Index
+	scorer Scorer
+}
+
+func (ctx *searchCtx) isStopword(word string) bool {
+	_, ok := ctx.idx.stopwords[word]
+	return ok
+}
+
+type node interface {
+	// check 检查查询中的字段是否存在、类型是否正确
+	check(idx *Index) error
+	// eval 在持有索引读锁时执行，返回匹配的文档
+	eval(ctx *searchCtx) docSet
+}
+
+func ParseQuery(s string) (*Query, error) {
+	return ParseQueryWithParams(s, nil)
+}
+
+// ParseQueryWithParams 解析查询，查询中的 $name 使用 params 中的值替换
+func ParseQueryWithParams(s string, params map[string]string) (*Query, error) {
+	var knn *knnClause
+	if i := strings.LastIndex(s, "=>"); i >= 0 {
+		var err error
+		knn, err = parseKNN(strings.TrimSpace(s[i+2:]), params)
+		if err != nil {
+			return nil, err
+		}
+		s = s[:i]
+	}
+
+	p := &queryParser{s: s}
+	root, err := p.parseUnion()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if !p.eof() {
+		return nil, ErrSyntax
+	}
+	return &Query{root: root, knn: knn}, nil
+}
+
+// KNN 是否为向量查询，返回保存距离的字段名，默认为 __field_score
+func (q *Query) KNN() (string, bool) {
+	if q.knn == nil {
+		return "", false
+	}
+	return q.knn.alias, true
+}
+
+// parseKNN 解析 [KNN k @field $param [EF_RUNTIME ef] [AS alias]]
+func parseKNN(s string, params map[string]string) (*knnClause, error) {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, ErrSyntax
+	}
+	args := strings.Fields(s[1 : len(s)-1])
+	if len(args) < 4 || strings.ToUpper(args[0]) != "KNN" || !strings.HasPrefix(args[2], "@") {
+		return nil, ErrSyntax
+	}
+	for i, arg := range args {
+		value, err := resolveParam(arg, params)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	k, err := strconv.Atoi(args[1])
+	if err != nil || k < 0 {
+		return nil, errors.New("ERR Invalid K value for KNN: " + args[1])
+	}
+	knn := &knnClause{k: k, field: args[2][1:], vector: []byte(args[3])}
+	knn.alias = "__" + knn.field + "_score"
+	for i := 4; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, ErrSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "EF_RUNTIME":
+			knn.ef, err = strconv.Atoi(args[i+1])
+			if err != nil || knn.ef <= 0 {
+				return nil, errors.New("ERR Invalid EF_RUNTIME value: " + args[i+1])
+			}
+		case "AS":
+			knn.alias = args[i+1]
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	return knn, nil
+}
+
+// resolveParam 以 $ 开头的参数使用 params 中的值替换
+func resolveParam(arg string, params map[string]string) (string, error) {
+	if !strings.HasPrefix(arg, "$") {
+		return arg, nil
+	}
+	value, ok := params[arg[1:]]
+	if !ok {
+		return "", errors.New("ERR No such parameter `" + arg[1:] + "`")
+	}
+	return value, nil
+}
+
+// check 检查向量字段，返回解析后的查询向量
+func (knn *knnClause) check(idx *Index) ([]float32, error) {
+	if err := checkFieldType(idx, knn.field, FieldVector); err != nil {
+		return nil, err
+	}
+	f, _ := idx.Field(knn.field)
+	return ParseVector(knn.vector, f.Vector.Dim)
+}
+
+type queryParser struct {
+	s     string
+	pos   int
+	field string // 当前的全文检索限定在该字段中，为空表示所有的 TEXT 字段
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *queryParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *queryParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// parseUnion union := intersect ('|' intersect)*
+func (p *queryParser) parseUnion() (node, error) {
+	first, err := p.parseIntersect()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []node{first}
+	for {
+		p.skipSpaces()
+		if p.eof() || p.peek() != '|' {
+			break
+		}
+		p.pos++
+		n, err := p.parseIntersect()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return orNode(nodes), nil
+}
+
+// parseIntersect intersect := unary+
+func (p *queryParser) parseIntersect() (node, error) {
+	nodes := make([]node, 0, 1)
+	for {
+		p.skipSpaces()
+		if p.eof() || p.peek() == '|' || p.peek() == ')' {
+			break
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, ErrSyntax
+	case 1:
+		return nodes[0], nil
+	}
+	return andNode(nodes), nil
+}
+
+// parseUnary unary := '-' unary | atom
+func (p *queryParser) parseUnary() (node, error) {
+	if p.peek() == '-' {
+		p.pos++
+		if p.eof() {
+			return nil, ErrSyntax
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+	return p.parseAtom()
+}
+
+func (p *queryParser) parseAtom() (node, error) {
+	switch p.peek() {
+	case '(':
+		p.pos++
+		n, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.eof() || p.peek() != ')' {
+			return nil, ErrSyntax
+		}
+		p.pos++
+		return n, nil
+	case '*':
+		p.pos++
+		return allNode{}, nil
+	case '@':
+		return p.parseFieldAtom()
+	case '"':
+		return p.parsePhrase()
+	}
+	return p.parseTerm()
+}
+
+// parseFieldAtom @field:[min max]、@field:{tag|tag} 或者 @field:text
+func (p *queryParser) parseFieldAtom() (node, error) {
+	p.pos++ // @
+	colon := strings.IndexByte(p.s[p.pos:], ':')
+	if colon <= 0 {
+		return nil, ErrSyntax
+	}
+	field := p.s[p.pos : p.pos+colon]
+	p.pos += colon + 1
+	p.skipSpaces()
+	if p.eof() {
+		return nil, ErrSyntax
+	}
+
+	switch p.peek() {
+	case '[':
+		end := strings.IndexByte(p.s[p.pos:], ']')
+		if end < 0 {
+			return nil, ErrSyntax
+		}
+		bounds := strings.Fields(strings.ReplaceAll(p.s[p.pos+1:p.pos+end], ",", " "))
+		p.pos += end + 1
+		if len(bounds) != 2 {
+			return nil, ErrSyntax
+		}
+		min, err := sortedset.ParseScoreBorder(bounds[0])
+		if err != nil {
+			return nil, ErrSyntax
+		}
+		max, err := sortedset.ParseScoreBorder(bounds[1])
+		if err != nil {
+			return nil, ErrSyntax
+		}
+		return &numericNode{field: field, min: min, max: max}, nil
+	case '{':
+		p.pos++
+		tags := make([]string, 0, 1)
+		var tag strings.Builder
+		for {
+			if p.eof() {
+				return nil, ErrSyntax
+			}
+			c := p.peek()
+			p.pos++
+			if c == '\\' && !p.eof() {
+				tag.WriteByte(p.peek())
+				p.pos++
+				continue
+			}
+			if c == '|' || c == '}' {
+				if t := strings.ToLower(strings.TrimSpace(tag.String())); t != "" {
+					tags = append(tags, t)
+				}
+				tag.Reset()
+				if c == '}' {
+					break
+				}
+				continue
+			}
+			tag.WriteByte(c)
+		}
+		if len(tags) == 0 {
+			return nil, ErrSyntax
+		}
+		return &tagNode{field: field, tags: tags}, nil
+	}
+
+	// 全文检索限定在该字段中
+	outer := p.field
+	p.field = field
+	defer func() {
+		p.field = outer
+	}()
+	return p.parseAtom()
+}
+
+// parsePhrase "word word ..."
+func (p *queryParser) parsePhrase() (node, error) {
+	p.pos++ // "
+	end := strings.IndexByte(p.s[p.pos:], '"')
+	if end < 0 {
+		return nil, ErrSyntax
+	}
+	words := tokenize(p.s[p.pos:p.pos+end], nil)
+	p.pos += end + 1
+	if len(words) == 0 {
+		return nil, ErrSyntax
+	}
+	return &phraseNode{field: p.field, words: words}, nil
+}
+
+// parseTerm 由字母、数字组成的词，以 * 结尾时为前缀查询
+func (p *queryParser) parseTerm() (node, error) {
+	start := p.pos
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		p.pos += size
+	}
+	if p.pos == start {
+		return nil, ErrSyntax
+	}
+	word := strings.ToLower(p.s[start:p.pos])
+	if !p.eof() && p.peek() == '*' {
+		p.pos++
+		return &prefixNode{field: p.field, prefix: word}, nil
+	}
+	return &termNode{field: p.field, word: word}, nil
+}
+
+/* ---- 查询节点 ---- */
+
+type allNode struct{}
+
+func (allNode) check(*Index) error {
+	return nil
+}
+
+func (allNode) eval(ctx *searchCtx) docSet {
+	set := make(docSet, len(ctx.idx.docs))
+	for key := range ctx.idx.docs {
+		set[key] = 0
+	}
+	return set
+}
+
+type numericNode struct {
+	field    string
+	min, max *sortedset.ScoreBorder
+}
+
+func (n *numericNode) check(idx *Index) error {
+	return checkFieldType(idx, n.field, FieldNumeric)
+}
+
+func (n *numericNode) eval(ctx *searchCtx) docSet {
+	set := make(docSet)
+	ctx.idx.numeric[n.field].ForEachByScore(n.min, n.max, 0, -1, false, func(element *sortedset.Element) bool {
+		set[element.Member] = 0
+		return true
+	})
+	return set
+}
+
+type tagNode struct {
+	field string
+	tags  []string
+}
+
+func (n *tagNode) check(idx *Index) error {
+	return checkFieldType(idx, n.field, FieldTag)
+}
+
+func (n *tagNode) eval(ctx *searchCtx) docSet {
+	set := make(docSet)
+	for _, tag := range n.tags {
+		for key := range ctx.idx.tags[n.field][tag] {
+			set[key] = 0
+		}
+	}
+	return set
+}
+
+// termNode 全文检索一个词，field 为空时检索所有的 TEXT 字段，停用词在交集中被忽略
+type termNode struct {
+	field string
+	word  string
+}
+
+func (n *termNode) check(idx *Index) error {
+	return checkTextField(idx, n.field)
+}
+
+func (n *termNode) eval(ctx *searchCtx) docSet {
+	set := make(docSet)
+	evalTerm(ctx, n.field, n.word, set)
+	return set
+}
+
+// evalTerm 将包含 word 的文档以及得分累加到 set 中
+func evalTerm(ctx *searchCtx, field, word string, set docSet) {
+	postings := ctx.idx.text.terms[word]
+	for key, p := range postings {
+		tf := 0.0
+		for name, positions := range p.positions {
+			if field == "" || name == field {
+				tf += ctx.idx.fieldMap[name].Weight * float64(len(positions))
+			}
+		}
+		if tf > 0 {
+			set[key] += ctx.idx.text.score(ctx.scorer, key, tf, len(postings), len(ctx.idx.docs))
+		}
+	}
+}
+
+// prefixNode 前缀查询，最多展开 maxPrefixExpansions 个词
+type prefixNode struct {
+	field  string
+	prefix string
+}
+
+func (n *prefixNode) check(idx *Index) error {
+	return checkTextField(idx, n.field)
+}
+
+func (n *prefixNode) eval(ctx *searchCtx) docSet {
+	set := make(docSet)
+	expanded := 0
+	for word := range ctx.idx.text.terms {
+		if !strings.HasPrefix(word, n.prefix) {
+			continue
+		}
+		evalTerm(ctx, n.field, word, set)
+		expanded++
+		if expanded >= maxPrefixExpansions {
+			break
+		}
+	}
+	return set
+}
+
+// phraseNode 短语查询，所有的词在同一个字段中连续出现
+type phraseNode struct {
+	field string
+	words []string
+}
+
+func (n *phraseNode) check(idx *Index) error {
+	return checkTextField(idx, n.field)
+}
+
+func (n *phraseNode) eval(ctx *searchCtx) docSet {
+	// 与建立索引时一样去掉停用词
+	words := make([]string, 0, len(n.words))
+	for _, word := range n.words {
+		if !ctx.isStopword(word) {
+			words = append(words, word)
+		}
+	}
+	set := make(docSet)
+	if len(words) == 0 {
+		return set
+	}
+
+	postings := make([]map[string]*posting, len(words))
+	for i, word := range words {
+		postings[i] = ctx.idx.text.terms[word]
+	}
+	freqs := make(map[string]float64)
+	for key, first := range postings[0] {
+		freq := 0.0
+		for name, positions := range first.positions {
+			if n.field == "" || name == n.field {
+				count := countPhrase(key, name, positions, postings[1:])
+				freq += ctx.idx.fieldMap[name].Weight * float64(count)
+			}
+		}
+		if freq > 0 {
+			freqs[key] = freq
+		}
+	}
+	for key, freq := range freqs {
+		set[key] = ctx.idx.text.score(ctx.scorer, key, freq, len(freqs), len(ctx.idx.docs))
+	}
+	return set
+}
+
+// countPhrase 统计短语在文档的字段中出现的次数，positions 为第一个词的位置，rest 为其余词的倒排表
+func countPhrase(key, field string, positions []int, rest []map[string]*posting) int {
+	next := make([]map[int]struct{}, len(rest))
+	for i, postings := range rest {
+		p, ok := postings[key]
+		if !ok {
+			return 0
+		}
+		next[i] = make(map[int]struct{}, len(p.positions[field]))
+		for _, pos := range p.positions[field] {
+			next[i][pos] = struct{}{}
+		}
+	}
+	count := 0
+	for _, start := range positions {
+		matched := true
+		for i := range next {
+			if _, ok := next[i][start+i+1]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			count++
+		}
+	}
+	return count
+}
+
+// andNode 交集，得分为各个子查询得分的和
+type andNode []node
+
+func (n andNode) check(idx *Index) error {
+	return checkChildren(idx, n)
+}
+
+func (n andNode) eval(ctx *searchCtx) docSet {
+	// 忽略查询中的停用词
+	children := make([]node, 0, len(n))
+	for _, child := range n {
+		if term, ok := child.(*termNode); !ok || !ctx.isStopword(term.word) {
+			children = append(children, child)
+		}
+	}
+	if len(children) == 0 {
+		return make(docSet)
+	}
+
+	set := children[0].eval(ctx)
+	for _, child := range children[1:] {
+		if len(set) == 0 {
+			break
+		}
+		other := child.eval(ctx)
+		for key := range set {
+			score, ok := other[key]
+			if !ok {
+				delete(set, key)
+				continue
+			}
+			set[key] += score
+		}
+	}
+	return set
+}
+
+// orNode 并集，得分为各个子查询得分的和
+type orNode []node
+
+func (n orNode) check(idx *Index) error {
+	return checkChildren(idx, n)
+}
+
+func (n orNode) eval(ctx *searchCtx) docSet {
+	set := make(docSet)
+	for _, child := range n {
+		for key, score := range child.eval(ctx) {
+			set[key] += score
+		}
+	}
+	return set
+}
+
+type notNode struct {
+	child node
+}
+
+func (n *notNode) check(idx *Index) error {
+	return n.child.check(idx)
+}
+
+func (n *notNode) eval(ctx *searchCtx) docSet {
+	excluded := n.child.eval(ctx)
+	set := make(docSet)
+	for key := range ctx.idx.docs {
+		if _, ok := excluded[key]; !ok {
+			set[key] = 0
+		}
+	}
+	return set
+}
+
+func checkChildren(idx *Index, children []node) error {
+	for _, child := range children {
+		if err := child.check(idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFieldType(idx *Index, name string, t FieldType) error {
+	f, ok := idx.Field(name)
+	if !ok {
+		return makeUnknownFieldErr(name)
+	}
+	if f.Type != t {
+		return errors.New("ERR Field '" + name + "' is not a " + t.String() + " field")
+	}
+	return nil
+}
+
+// checkTextField 全文检索限定的字段必须是 TEXT 字段
+func checkTextField(idx *Index, name string) error {
+	if name == "" {
+		return nil
+	}
+	return checkFieldType(idx, name, FieldText)
+}
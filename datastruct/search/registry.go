@@ -0,0 +1,104 @@
+package search
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrIndexExists = errors.New("ERR Index already exists")
+
+// Registry 一个数据库中所有的索引
+type Registry struct {
+	mu      sync.RWMutex
+	indexes map[string]*Index
+}
+
+func MakeRegistry() *Registry {
+	return &Registry{indexes: make(map[string]*Index)}
+}
+
+// Create 添加索引，同名的索引已经存在时返回错误
+func (r *Registry) Create(idx *Index) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.indexes[idx.name]; ok {
+		return ErrIndexExists
+	}
+	r.indexes[idx.name] = idx
+	return nil
+}
+
+func (r *Registry) Get(name string) (*Index, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	idx, ok := r.indexes[name]
+	return idx, ok
+}
+
+// Drop 删除索引，返回索引是否存在
+func (r *Registry) Drop(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.indexes[name]; !ok {
+		return false
+	}
+	delete(r.indexes, name)
+	return true
+}
+
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.indexes)
+}
+
+// ForEach 按照名称的顺序遍历所有的索引
+func (r *Registry) ForEach(cb func(idx *Index) bool) {
+	r.mu.RLock()
+	indexes := make([]*Index, 0, len(r.indexes))
+	for _, idx := range r.indexes {
+		indexes = append(indexes, idx)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].name < indexes[j].name
+	})
+	for _, idx := range indexes {
+		if !cb(idx) {
+			return
+		}
+	}
+}
+
+// Update 更新 key 在所有前缀匹配的索引中的文档
+func (r *Registry) Update(key string, get func(field string) ([]byte, bool)) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, idx := range r.indexes {
+		if idx.Match(key) {
+			idx.Add(key, get)
+		}
+	}
+}
+
+// Remove 从所有的索引中删除 key
+func (r *Registry) Remove(key string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, idx := range r.indexes {
+		if idx.Match(key) {
+			idx.Remove(key)
+		}
+	}
+}
+
+// Clear 清空所有索引中的文档
+func (r *Registry) Clear() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, idx := range r.indexes {
+		idx.Clear()
+	}
+}
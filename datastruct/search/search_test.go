@@ -0,0 +1,452 @@
+package search
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func hashGetter(hash map[string]string) func(field string) ([]byte, bool) {
+	return func(field string) ([]byte, bool) {
+		v, ok := hash[field]
+		return []byte(v), ok
+	}
+}
+
+// searchKeys 返回按照字典序排列的 key
+func searchKeys(idx *Index, q *Query) ([]string, error) {
+	results, err := idx.Search(q, ScorerBM25)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(results))
+	for i, r := range results {
+		keys[i] = r.Key
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func makeTestIndex(t *testing.T) *Index {
+	idx, err := MakeIndex("idx", []string{"user:"}, []*Field{
+		{Name: "age", Type: FieldNumeric},
+		{Name: "city", Type: FieldTag},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Add("user:1", hashGetter(map[string]string{"age": "20", "city": "Beijing"}))
+	idx.Add("user:2", hashGetter(map[string]string{"age": "30", "city": "Shanghai, Beijing"}))
+	idx.Add("user:3", hashGetter(map[string]string{"age": "40", "city": "Shenzhen"}))
+	idx.Add("user:4", hashGetter(map[string]string{"age": "abc"}))
+	return idx
+}
+
+func TestSearch(t *testing.T) {
+	idx := makeTestIndex(t)
+	tests := map[string][]string{
+		"*":                              {"user:1", "user:2", "user:3", "user:4"},
+		"@age:[20 30]":                   {"user:1", "user:2"},
+		"@age:[(20 +inf]":                {"user:2", "user:3"},
+		"@city:{beijing}":                {"user:1", "user:2"},
+		"@city:{shenzhen | shanghai}":    {"user:2", "user:3"},
+		"@age:[-inf 30] @city:{Beijing}": {"user:1", "user:2"},
+		"@age:[40 40] | @age:[20 20]":    {"user:1", "user:3"},
+		"-@city:{beijing}":               {"user:3", "user:4"},
+		"(@age:[0 100] -@age:[30 30])":   {"user:1", "user:3"},
+	}
+	for raw, expected := range tests {
+		q, err := ParseQuery(raw)
+		if err != nil {
+			t.Errorf("parse %s: %v", raw, err)
+			continue
+		}
+		keys, err := searchKeys(idx, q)
+		if err != nil || !reflect.DeepEqual(keys, expected) {
+			t.Errorf("%s: %v %v, expected %v", raw, keys, err, expected)
+		}
+	}
+
+	for _, bad := range []string{"", "@age", "@age:[1]", "@city:{}", "(*", "a | ", `"unclosed`} {
+		if _, err := ParseQuery(bad); err == nil {
+			t.Errorf("query %q should fail", bad)
+		}
+	}
+	for _, raw := range []string{"@unknown:[1 2]", "@city:[1 2]", "@age:{a}", "@age:hello"} {
+		q, _ := ParseQuery(raw)
+		if _, err := idx.Search(q, ScorerBM25); err == nil {
+			t.Errorf("search %q should fail", raw)
+		}
+	}
+}
+
+func TestUpdateAndRemove(t *testing.T) {
+	idx := makeTestIndex(t)
+	idx.Add("user:1", hashGetter(map[string]string{"age": "50", "city": "Shenzhen"}))
+	idx.Remove("user:3")
+	q, _ := ParseQuery("@city:{shenzhen}")
+	if keys, _ := searchKeys(idx, q); !reflect.DeepEqual(keys, []string{"user:1"}) {
+		t.Errorf("after update: %v", keys)
+	}
+	q, _ = ParseQuery("@age:[40 +inf]")
+	if keys, _ := searchKeys(idx, q); !reflect.DeepEqual(keys, []string{"user:1"}) {
+		t.Errorf("after update: %v", keys)
+	}
+	if idx.Len() != 3 {
+		t.Errorf("len: %d", idx.Len())
+	}
+
+	keys := idx.Keys()
+	if err := idx.SortBy(keys, "age", true); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"user:1", "user:2", "user:4"}) {
+		t.Errorf("sort by age: %v", keys)
+	}
+
+	idx.Clear()
+	if idx.Len() != 0 {
+		t.Errorf("len after clear: %d", idx.Len())
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := MakeRegistry()
+	idx := makeTestIndex(t)
+	if err := r.Create(idx); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create(idx); err != ErrIndexExists {
+		t.Errorf("duplicate create: %v", err)
+	}
+	r.Update("other:1", hashGetter(map[string]string{"age": "1"}))
+	r.Update("user:5", hashGetter(map[string]string{"age": "1"}))
+	if idx.Len() != 5 {
+		t.Errorf("len: %d", idx.Len())
+	}
+	r.Remove("user:5")
+	if idx.Len() != 4 {
+		t.Errorf("len after remove: %d", idx.Len())
+	}
+	if !r.Drop("idx") || r.Drop("idx") || r.Len() != 0 {
+		t.Error("drop error")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	data := []map[string]string{
+		{"city": "a", "age": "10"},
+		{"city": "b", "age": "20"},
+		{"city": "a", "age": "30"},
+		{"city": "b", "age": "5"},
+		{"city": "c"},
+	}
+	rows := make([]*Row, 0, len(data))
+	for _, d := range data {
+		row := MakeRow()
+		for _, f := range []string{"city", "age"} {
+			if v, ok := d[f]; ok {
+				row.Set(f, v)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	count, _ := MakeReducer("COUNT", nil, "")
+	sum, _ := MakeReducer("SUM", []string{"@age"}, "total")
+	max, _ := MakeReducer("MAX", []string{"@age"}, "")
+	groups := GroupBy(rows, []string{"city"}, []*Reducer{count, sum, max})
+	SortRows(groups, []SortKey{{Field: "total", Desc: true}})
+
+	expected := [][]string{
+		{"a", "2", "40", "30"},
+		{"b", "2", "25", "20"},
+		{"c", "1", "0", "-inf"},
+	}
+	for i, row := range groups {
+		if !reflect.DeepEqual(row.Fields(), []string{"city", "count", "total", "max_age"}) {
+			t.Fatalf("fields: %v", row.Fields())
+		}
+		for j, f := range row.Fields() {
+			if v, _ := row.Get(f); v != expected[i][j] {
+				t.Errorf("row %d field %s: %s, expected %s", i, f, v, expected[i][j])
+			}
+		}
+	}
+
+	if _, err := MakeReducer("COUNT", []string{"x"}, ""); err == nil {
+		t.Error("count with args should fail")
+	}
+	if _, err := MakeReducer("FOO", nil, ""); err == nil {
+		t.Error("unknown reducer should fail")
+	}
+}
+
+func makeArticleIndex(t *testing.T) *Index {
+	idx, err := MakeIndex("articles", nil, []*Field{
+		{Name: "title", Type: FieldText, Weight: 2},
+		{Name: "body", Type: FieldText},
+		{Name: "year", Type: FieldNumeric},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Add("a1", hashGetter(map[string]string{"title": "Hello World", "body": "the quick brown fox", "year": "2020"}))
+	idx.Add("a2", hashGetter(map[string]string{"title": "Redis", "body": "hello redis, hello search. World of data", "year": "2021"}))
+	idx.Add("a3", hashGetter(map[string]string{"title": "Searching", "body": "a brown dog and the quick fox", "year": "2022"}))
+	return idx
+}
+
+func TestFullText(t *testing.T) {
+	idx := makeArticleIndex(t)
+	tests := map[string][]string{
+		"hello":                    {"a1", "a2"},
+		"HELLO world":              {"a1", "a2"},
+		`"hello world"`:            {"a1"},
+		`"quick brown"`:            {"a1"},
+		`"brown the fox"`:          {"a1"},
+		`"fox brown"`:              {},
+		`"dog and the quick"`:      {"a3"},
+		"search*":                  {"a2", "a3"},
+		"@title:hello":             {"a1"},
+		"@body:(hello | dog)":      {"a2", "a3"},
+		"@title:search*":           {"a3"},
+		"fox -@year:[2022 2022]":   {"a1"},
+		"the fox":                  {"a1", "a3"},
+		"missing":                  {},
+		"@year:[2021 +inf] brown*": {"a3"},
+	}
+	for raw, expected := range tests {
+		q, err := ParseQuery(raw)
+		if err != nil {
+			t.Errorf("parse %s: %v", raw, err)
+			continue
+		}
+		keys, err := searchKeys(idx, q)
+		if err != nil || !reflect.DeepEqual(keys, expected) {
+			t.Errorf("%s: %v %v, expected %v", raw, keys, err, expected)
+		}
+	}
+
+	// title 的权重更高，并且 a1 更短
+	q, _ := ParseQuery("hello")
+	if results, _ := idx.Search(q, ScorerBM25); results[0].Score <= results[1].Score {
+		t.Errorf("bm25 should prefer shorter document: %v %v", results[0].Score, results[1].Score)
+	}
+	for _, scorer := range []Scorer{ScorerBM25, ScorerTFIDF} {
+		results, _ := idx.Search(q, scorer)
+		if len(results) != 2 || results[0].Key != "a1" || results[0].Score < results[1].Score || results[1].Score <= 0 {
+			t.Errorf("scorer %d: %+v %+v", scorer, results[0], results[1])
+		}
+	}
+
+	idx.Remove("a1")
+	idx.Add("a2", hashGetter(map[string]string{"title": "Other"}))
+	q, _ = ParseQuery("hello | quick")
+	if keys, _ := searchKeys(idx, q); !reflect.DeepEqual(keys, []string{"a3"}) {
+		t.Errorf("after remove: %v", keys)
+	}
+	if len(idx.text.terms["hello"]) != 0 || idx.text.totalLen != 6 {
+		t.Errorf("inverted index not cleaned: %v %d", idx.text.terms["hello"], idx.text.totalLen)
+	}
+}
+
+func TestStopwords(t *testing.T) {
+	idx, _ := MakeIndex("idx", nil, []*Field{{Name: "body", Type: FieldText}})
+	idx.SetStopwords([]string{})
+	idx.Add("d1", hashGetter(map[string]string{"body": "to be or not to be"}))
+	q, _ := ParseQuery(`"not to be"`)
+	if keys, _ := searchKeys(idx, q); !reflect.DeepEqual(keys, []string{"d1"}) {
+		t.Errorf("without stopwords: %v", keys)
+	}
+	if words, ok := idx.Stopwords(); !ok || len(words) != 0 {
+		t.Error("custom stopwords error")
+	}
+}
+
+func vectorBlob(vec ...float32) string {
+	buf := make([]byte, 0, 4*len(vec))
+	for _, v := range vec {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+	}
+	return string(buf)
+}
+
+func makeKNNIndex(t *testing.T, algorithm, metric string, dim int) *Index {
+	opts, err := ParseVectorOptions(algorithm, []string{"TYPE", "FLOAT32", "DIM", strconv.Itoa(dim), "DISTANCE_METRIC", metric})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := MakeIndex("vec", nil, []*Field{
+		{Name: "color", Type: FieldTag},
+		{Name: "embedding", Type: FieldVector, Vector: opts},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func knnKeys(t *testing.T, idx *Index, raw string, params map[string]string) []string {
+	q, err := ParseQueryWithParams(raw, params)
+	if err != nil {
+		t.Fatalf("parse %s: %v", raw, err)
+	}
+	results, err := idx.Search(q, ScorerBM25)
+	if err != nil {
+		t.Fatalf("search %s: %v", raw, err)
+	}
+	keys := make([]string, len(results))
+	for i, r := range results {
+		keys[i] = r.Key
+	}
+	return keys
+}
+
+func TestVectorOptions(t *testing.T) {
+	for _, attributes := range [][]string{
+		{"TYPE", "FLOAT32", "DIM", "4"},
+		{"TYPE", "FLOAT64", "DIM", "4", "DISTANCE_METRIC", "L2"},
+		{"TYPE", "FLOAT32", "DIM", "0", "DISTANCE_METRIC", "L2"},
+		{"TYPE", "FLOAT32", "DIM", "4", "DISTANCE_METRIC", "HAMMING"},
+		{"TYPE", "FLOAT32", "DIM", "4", "DISTANCE_METRIC", "L2", "M", "8"},
+		{"TYPE", "FLOAT32", "DIM"},
+	} {
+		if _, err := ParseVectorOptions("FLAT", attributes); err == nil {
+			t.Errorf("expected error: %v", attributes)
+		}
+	}
+	if _, err := ParseVectorOptions("IVF", []string{"TYPE", "FLOAT32", "DIM", "4", "DISTANCE_METRIC", "L2"}); err == nil {
+		t.Error("expected error for unknown algorithm")
+	}
+	attributes := []string{"TYPE", "FLOAT32", "DIM", "4", "DISTANCE_METRIC", "COSINE", "M", "8", "EF_CONSTRUCTION", "100", "EF_RUNTIME", "20"}
+	opts, err := ParseVectorOptions("hnsw", attributes)
+	if err != nil || opts.Algorithm != VectorHNSW || opts.M != 8 || opts.EfRuntime != 20 || opts.Metric != MetricCosine {
+		t.Fatalf("%+v %v", opts, err)
+	}
+	if !reflect.DeepEqual(opts.Attributes(), attributes) {
+		t.Errorf("attributes: %v", opts.Attributes())
+	}
+}
+
+func TestVectorMetrics(t *testing.T) {
+	a, b := []float32{1, 0}, []float32{3, 4}
+	if d := distance(MetricL2, a, b); d != 20 {
+		t.Errorf("L2: %v", d)
+	}
+	if d := distance(MetricIP, a, b); d != -2 {
+		t.Errorf("IP: %v", d)
+	}
+	if d := distance(MetricCosine, a, b); math.Abs(d-0.4) > 1e-9 {
+		t.Errorf("COSINE: %v", d)
+	}
+	if d := distance(MetricCosine, a, []float32{0, 0}); d != 1 {
+		t.Errorf("COSINE zero vector: %v", d)
+	}
+}
+
+func TestKNN(t *testing.T) {
+	for _, algorithm := range []string{"FLAT", "HNSW"} {
+		idx := makeKNNIndex(t, algorithm, "L2", 2)
+		idx.Add("v1", hashGetter(map[string]string{"color": "red", "embedding": vectorBlob(0, 0)}))
+		idx.Add("v2", hashGetter(map[string]string{"color": "blue", "embedding": vectorBlob(1, 1)}))
+		idx.Add("v3", hashGetter(map[string]string{"color": "red", "embedding": vectorBlob(2, 2)}))
+		idx.Add("v4", hashGetter(map[string]string{"color": "blue", "embedding": vectorBlob(3, 3)}))
+		idx.Add("bad", hashGetter(map[string]string{"color": "red", "embedding": "short"}))
+		params := map[string]string{"BLOB": vectorBlob(2.9, 2.9), "K": "2"}
+
+		if keys := knnKeys(t, idx, "*=>[KNN 2 @embedding $BLOB]", params); !reflect.DeepEqual(keys, []string{"v4", "v3"}) {
+			t.Errorf("%s knn: %v", algorithm, keys)
+		}
+		if keys := knnKeys(t, idx, "@color:{red}=>[KNN $K @embedding $BLOB AS dist]", params); !reflect.DeepEqual(keys, []string{"v3", "v1"}) {
+			t.Errorf("%s knn with filter: %v", algorithm, keys)
+		}
+		if keys := knnKeys(t, idx, "*=>[KNN 10 @embedding $BLOB EF_RUNTIME 50]", params); len(keys) != 4 {
+			t.Errorf("%s knn all: %v", algorithm, keys)
+		}
+		idx.Remove("v4")
+		idx.Add("v3", hashGetter(map[string]string{"color": "red"}))
+		if keys := knnKeys(t, idx, "*=>[KNN 1 @embedding $BLOB]", params); !reflect.DeepEqual(keys, []string{"v2"}) {
+			t.Errorf("%s knn after remove: %v", algorithm, keys)
+		}
+	}
+
+	q, _ := ParseQueryWithParams("*=>[KNN 2 @embedding $BLOB AS dist]", map[string]string{"BLOB": vectorBlob(1, 2)})
+	if alias, ok := q.KNN(); !ok || alias != "dist" {
+		t.Errorf("alias: %s", alias)
+	}
+	idx := makeKNNIndex(t, "FLAT", "L2", 2)
+	for _, raw := range []string{"*=>[KNN 2 @embedding $MISSING]", "*=>[KNN -1 @embedding $BLOB]", "*=>[KNN 2 embedding $BLOB]", "*=>KNN 2 @embedding $BLOB", "=>[KNN 2 @embedding $BLOB]"} {
+		if _, err := ParseQueryWithParams(raw, map[string]string{"BLOB": vectorBlob(1, 2)}); err == nil {
+			t.Errorf("expected parse error: %s", raw)
+		}
+	}
+	for _, raw := range []string{"*=>[KNN 2 @embedding $BLOB]", "*=>[KNN 2 @color $SMALL]"} {
+		q, _ := ParseQueryWithParams(raw, map[string]string{"BLOB": vectorBlob(1, 2, 3), "SMALL": vectorBlob(1, 2)})
+		if _, err := idx.Search(q, ScorerBM25); err == nil {
+			t.Errorf("expected search error: %s", raw)
+		}
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const dim, n, k = 8, 2000, 10
+	r := rand.New(rand.NewSource(42))
+	randomVector := func() []float32 {
+		vec := make([]float32, dim)
+		for i := range vec {
+			vec[i] = r.Float32()
+		}
+		return vec
+	}
+	for _, metric := range []string{"L2", "IP", "COSINE"} {
+		flat := makeKNNIndex(t, "FLAT", metric, dim)
+		hnsw := makeKNNIndex(t, "HNSW", metric, dim)
+		for i := 0; i < n; i++ {
+			doc := hashGetter(map[string]string{"color": strconv.Itoa(i % 3), "embedding": vectorBlob(randomVector()...)})
+			key := "doc:" + strconv.Itoa(i)
+			flat.Add(key, doc)
+			hnsw.Add(key, doc)
+		}
+		// 删除一部分文档，检查图的连通性
+		for i := 0; i < n; i += 5 {
+			flat.Remove("doc:" + strconv.Itoa(i))
+			hnsw.Remove("doc:" + strconv.Itoa(i))
+		}
+
+		hits, total := 0, 0
+		for i := 0; i < 50; i++ {
+			params := map[string]string{"BLOB": vectorBlob(randomVector()...)}
+			expected := knnKeys(t, flat, "*=>[KNN 10 @embedding $BLOB]", params)
+			actual := knnKeys(t, hnsw, "*=>[KNN 10 @embedding $BLOB EF_RUNTIME 50]", params)
+			set := make(map[string]struct{})
+			for _, key := range expected {
+				set[key] = struct{}{}
+			}
+			for _, key := range actual {
+				if _, ok := set[key]; ok {
+					hits++
+				}
+			}
+			total += len(expected)
+
+			// 过滤之后的候选文档数量超过暴力计算的阈值，仍然需要返回 k 个结果
+			filtered := knnKeys(t, hnsw, "@color:{1|2}=>[KNN 10 @embedding $BLOB]", params)
+			if len(filtered) != k {
+				t.Fatalf("%s filtered: %v", metric, filtered)
+			}
+			for _, key := range filtered {
+				if value, _ := hnsw.Value(key, "color"); value == "0" {
+					t.Fatalf("%s filter not applied: %s", metric, key)
+				}
+			}
+		}
+		if recall := float64(hits) / float64(total); recall < 0.9 {
+			t.Errorf("%s recall too low: %v", metric, recall)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package search
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultStopwords 默认的停用词，不会进入索引，查询时也会被忽略
+var DefaultStopwords = []string{
+	"a", "is", "the", "an", "and", "are", "as", "at", "be", "but", "by", "for",
+	"if", "in", "into", "it", "no", "not", "of", "on", "or", "such", "that", "their",
+	"then", "there", "these", "they", "this", "to", "was", "will", "with",
+}
+
+// maxPrefixExpansions 前缀查询最多展开的词的数量
+const maxPrefixExpansions = 200
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Scorer 全文检索的打分方式
+type Scorer int
+
+const (
+	ScorerBM25 Scorer = iota
+	ScorerTFIDF
+)
+
+// ParseScorer 解析打分方式，不区分大小写
+func ParseScorer(s string) (Scorer, bool) {
+	switch strings.ToUpper(s) {
+	case "BM25":
+		return ScorerBM25, true
+	case "TFIDF":
+		return ScorerTFIDF, true
+	}
+	return 0, false
+}
+
+// tokenize 将文本切分为小写的词，字母与数字以外的字符都作为分隔符，停用词被丢弃且不占用位置
+func tokenize(text string, stopwords map[string]struct{}) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	tokens := words[:0]
+	for _, word := range words {
+		if _, ok := stopwords[word]; !ok {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+func makeStopwordSet(words []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		set[strings.ToLower(word)] = struct{}{}
+	}
+	return set
+}
+
+// posting 倒排表中的一项，记录词在文档各个字段中出现的位置
+type posting struct {
+	positions map[string][]int
+}
+
+// textIndex TEXT 字段的倒排索引
+type textIndex struct {
+	terms    map[string]map[string]*posting // 词 -> key -> posting
+	docTerms map[string][]string            // key -> 文档中的词，用于删除
+	docLen   map[string]int                 // key -> 文档中词的数量
+	totalLen int
+}
+
+func makeTextIndex() *textIndex {
+	return &textIndex{
+		terms:    make(map[string]map[string]*posting),
+		docTerms: make(map[string][]string),
+		docLen:   make(map[string]int),
+	}
+}
+
+func (t *textIndex) add(key, field string, tokens []string) {
+	for pos, term := range tokens {
+		postings, ok := t.terms[term]
+		if !ok {
+			postings = make(map[string]*posting)
+			t.terms[term] = postings
+		}
+		p, ok := postings[key]
+		if !ok {
+			p = &posting{positions: make(map[string][]int)}
+			postings[key] = p
+			t.docTerms[key] = append(t.docTerms[key], term)
+		}
+		p.positions[field] = append(p.positions[field], pos)
+	}
+	t.docLen[key] += len(tokens)
+	t.totalLen += len(tokens)
+}
+
+func (t *textIndex) remove(key string) {
+	for _, term := range t.docTerms[key] {
+		postings := t.terms[term]
+		delete(postings, key)
+		if len(postings) == 0 {
+			delete(t.terms, term)
+		}
+	}
+	t.totalLen -= t.docLen[key]
+	delete(t.docTerms, key)
+	delete(t.docLen, key)
+}
+
+// score 计算文档的得分，tf 为按照字段权重加权后的词频，n 为包含该词的文档数量
+func (t *textIndex) score(scorer Scorer, key string, tf float64, n, numDocs int) float64 {
+	if scorer == ScorerTFIDF {
+		return tf * math.Log(1+float64(numDocs)/float64(n))
+	}
+	idf := math.Log(1 + (float64(numDocs)-float64(n)+0.5)/(float64(n)+0.5))
+	avgLen := 1.0
+	if numDocs > 0 && t.totalLen > 0 {
+		avgLen = float64(t.totalLen) / float64(numDocs)
+	}
+	norm := 1 - bm25B + bm25B*float64(t.docLen[key])/avgLen
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
@@ -0,0 +1,537 @@
+package search
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 200
+	defaultHNSWEfRuntime      = 10
+	// hnswBruteForceLimit 预过滤之后的候选文档不超过该数量时直接暴力计算距离
+	hnswBruteForceLimit = 1024
+)
+
+// VectorAlgorithm 向量索引的算法
+type VectorAlgorithm int
+
+const (
+	VectorFlat VectorAlgorithm = iota
+	VectorHNSW
+)
+
+func (a VectorAlgorithm) String() string {
+	if a == VectorHNSW {
+		return "HNSW"
+	}
+	return "FLAT"
+}
+
+// DistanceMetric 向量之间距离的计算方式，距离越小越相似
+type DistanceMetric int
+
+const (
+	MetricL2     DistanceMetric = iota // 欧氏距离的平方
+	MetricIP                           // 1 - 内积
+	MetricCosine                       // 1 - 余弦相似度
+)
+
+func (m DistanceMetric) String() string {
+	switch m {
+	case MetricIP:
+		return "IP"
+	case MetricCosine:
+		return "COSINE"
+	}
+	return "L2"
+}
+
+// VectorOptions VECTOR 字段的参数
+type VectorOptions struct {
+	Algorithm      VectorAlgorithm
+	Dim            int
+	Metric         DistanceMetric
+	M              int // HNSW 每个节点的最大邻居数
+	EfConstruction int // HNSW 建图时候选集合的大小
+	EfRuntime      int // HNSW 查询时候选集合的大小
+}
+
+// ParseVectorOptions 解析 VECTOR 字段的算法以及属性，属性为 name value 的列表，
+// 必须指定 TYPE FLOAT32、DIM 以及 DISTANCE_METRIC，HNSW 还可以指定 M、EF_CONSTRUCTION、EF_RUNTIME
+func ParseVectorOptions(algorithm string, attributes []string) (*VectorOptions, error) {
+	opts := &VectorOptions{
+		M:              defaultHNSWM,
+		EfConstruction: defaultHNSWEfConstruction,
+		EfRuntime:      defaultHNSWEfRuntime,
+	}
+	switch strings.ToUpper(algorithm) {
+	case "FLAT":
+		opts.Algorithm = VectorFlat
+	case "HNSW":
+		opts.Algorithm = VectorHNSW
+	default:
+		return nil, errors.New("ERR Bad arguments for vector similarity algorithm: " + algorithm)
+	}
+	if len(attributes)%2 != 0 {
+		return nil, errors.New("ERR Bad arguments for vector similarity: odd number of attributes")
+	}
+
+	hasType, hasMetric := false, false
+	for i := 0; i < len(attributes); i += 2 {
+		name, value := strings.ToUpper(attributes[i]), attributes[i+1]
+		switch name {
+		case "TYPE":
+			if strings.ToUpper(value) != "FLOAT32" {
+				return nil, errors.New("ERR Bad arguments for vector similarity: only FLOAT32 is supported")
+			}
+			hasType = true
+		case "DISTANCE_METRIC":
+			switch strings.ToUpper(value) {
+			case "L2":
+				opts.Metric = MetricL2
+			case "IP":
+				opts.Metric = MetricIP
+			case "COSINE":
+				opts.Metric = MetricCosine
+			default:
+				return nil, errors.New("ERR Bad arguments for vector similarity DISTANCE_METRIC: " + value)
+			}
+			hasMetric = true
+		case "DIM", "M", "EF_CONSTRUCTION", "EF_RUNTIME":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, errors.New("ERR Bad arguments for vector similarity " + name + ": " + value)
+			}
+			if name != "DIM" && opts.Algorithm != VectorHNSW {
+				return nil, errors.New("ERR Bad arguments for vector similarity: " + name + " is only supported by HNSW")
+			}
+			switch name {
+			case "DIM":
+				opts.Dim = n
+			case "M":
+				opts.M = n
+			case "EF_CONSTRUCTION":
+				opts.EfConstruction = n
+			default:
+				opts.EfRuntime = n
+			}
+		default:
+			return nil, errors.New("ERR Bad arguments for vector similarity: unknown attribute " + attributes[i])
+		}
+	}
+	if !hasType || !hasMetric || opts.Dim == 0 {
+		return nil, errors.New("ERR Missing mandatory parameter: cannot create vector index without TYPE, DIM and DISTANCE_METRIC")
+	}
+	return opts, nil
+}
+
+// Attributes 返回创建字段时使用的属性列表，与 ParseVectorOptions 对应
+func (opts *VectorOptions) Attributes() []string {
+	attributes := []string{
+		"TYPE", "FLOAT32",
+		"DIM", strconv.Itoa(opts.Dim),
+		"DISTANCE_METRIC", opts.Metric.String(),
+	}
+	if opts.Algorithm == VectorHNSW {
+		attributes = append(attributes,
+			"M", strconv.Itoa(opts.M),
+			"EF_CONSTRUCTION", strconv.Itoa(opts.EfConstruction),
+			"EF_RUNTIME", strconv.Itoa(opts.EfRuntime),
+		)
+	}
+	return attributes
+}
+
+// ParseVector 将小端序的 float32 数组解析为向量
+func ParseVector(blob []byte, dim int) ([]float32, error) {
+	if len(blob) != 4*dim {
+		return nil, errors.New("ERR Error parsing vector similarity query: query vector blob size (" +
+			strconv.Itoa(len(blob)) + ") does not match index's expected size (" + strconv.Itoa(4*dim) + ")")
+	}
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+	}
+	return vec, nil
+}
+
+// distance 计算两个向量之间的距离
+func distance(metric DistanceMetric, a, b []float32) float64 {
+	switch metric {
+	case MetricIP:
+		dot := 0.0
+		for i := range a {
+			dot += float64(a[i]) * float64(b[i])
+		}
+		return 1 - dot
+	case MetricCosine:
+		dot, na, nb := 0.0, 0.0, 0.0
+		for i := range a {
+			dot += float64(a[i]) * float64(b[i])
+			na += float64(a[i]) * float64(a[i])
+			nb += float64(b[i]) * float64(b[i])
+		}
+		if na == 0 || nb == 0 {
+			return 1
+		}
+		return 1 - dot/math.Sqrt(na*nb)
+	default:
+		sum := 0.0
+		for i := range a {
+			d := float64(a[i]) - float64(b[i])
+			sum += d * d
+		}
+		return sum
+	}
+}
+
+// vectorIndex VECTOR 字段的索引，查询返回距离最近的 k 个文档，Score 为距离
+type vectorIndex interface {
+	add(key string, vec []float32)
+	remove(key string)
+	// search filter 不为 nil 时只返回 filter 中的文档
+	search(query []float32, k, ef int, filter docSet) []*Result
+}
+
+func makeVectorIndex(opts *VectorOptions) vectorIndex {
+	if opts.Algorithm == VectorHNSW {
+		return makeHNSWIndex(opts)
+	}
+	return &flatIndex{metric: opts.Metric, vectors: make(map[string][]float32)}
+}
+
+// nearest 维护距离最近的 k 个结果，按照距离从小到大、key 的字典序排列
+type nearest struct {
+	k       int
+	results []*Result
+}
+
+func (n *nearest) push(key string, dist float64) {
+	if n.k <= 0 || len(n.results) == n.k && !lessResult(dist, key, n.results[n.k-1]) {
+		return
+	}
+	i := sort.Search(len(n.results), func(i int) bool {
+		return lessResult(dist, key, n.results[i])
+	})
+	n.results = append(n.results, nil)
+	copy(n.results[i+1:], n.results[i:])
+	n.results[i] = &Result{Key: key, Score: dist}
+	if len(n.results) > n.k {
+		n.results = n.results[:n.k]
+	}
+}
+
+func lessResult(dist float64, key string, r *Result) bool {
+	if dist != r.Score {
+		return dist < r.Score
+	}
+	return key < r.Key
+}
+
+// flatIndex 暴力计算与所有向量的距离
+type flatIndex struct {
+	metric  DistanceMetric
+	vectors map[string][]float32
+}
+
+func (f *flatIndex) add(key string, vec []float32) {
+	f.vectors[key] = vec
+}
+
+func (f *flatIndex) remove(key string) {
+	delete(f.vectors, key)
+}
+
+func (f *flatIndex) search(query []float32, k, _ int, filter docSet) []*Result {
+	top := &nearest{k: k}
+	if filter != nil && len(filter) < len(f.vectors) {
+		for key := range filter {
+			if vec, ok := f.vectors[key]; ok {
+				top.push(key, distance(f.metric, query, vec))
+			}
+		}
+		return top.results
+	}
+	for key, vec := range f.vectors {
+		if filter == nil || hasKey(filter, key) {
+			top.push(key, distance(f.metric, query, vec))
+		}
+	}
+	return top.results
+}
+
+func hasKey(set docSet, key string) bool {
+	_, ok := set[key]
+	return ok
+}
+
+/* ---- HNSW ---- */
+
+type hnswNode struct {
+	key       string
+	vec       []float32
+	neighbors [][]*hnswNode // 每一层的邻居
+	deleted   bool
+}
+
+// hnswIndex 分层的可导航小世界图，近似地查找最近的 k 个向量
+type hnswIndex struct {
+	metric         DistanceMetric
+	m              int
+	efConstruction int
+	levelMult      float64
+	nodes          map[string]*hnswNode
+	entry          *hnswNode
+	random         *rand.Rand
+}
+
+// candidate 查询过程中的候选节点
+type candidate struct {
+	node *hnswNode
+	dist float64
+}
+
+func makeHNSWIndex(opts *VectorOptions) *hnswIndex {
+	m := opts.M
+	if m < 2 {
+		m = 2
+	}
+	return &hnswIndex{
+		metric:         opts.Metric,
+		m:              m,
+		efConstruction: opts.EfConstruction,
+		levelMult:      1 / math.Log(float64(m)),
+		nodes:          make(map[string]*hnswNode),
+		random:         rand.New(rand.NewSource(1)),
+	}
+}
+
+// maxNeighbors 第 0 层的邻居数为 2M，其余层为 M
+func (h *hnswIndex) maxNeighbors(level int) int {
+	if level == 0 {
+		return 2 * h.m
+	}
+	return h.m
+}
+
+func (h *hnswIndex) randomLevel() int {
+	return int(-math.Log(1-h.random.Float64()) * h.levelMult)
+}
+
+func (h *hnswIndex) add(key string, vec []float32) {
+	if _, ok := h.nodes[key]; ok {
+		h.remove(key)
+	}
+	level := h.randomLevel()
+	node := &hnswNode{key: key, vec: vec, neighbors: make([][]*hnswNode, level+1)}
+	h.nodes[key] = node
+	if h.entry == nil {
+		h.entry = node
+		return
+	}
+
+	entries := []candidate{{node: h.entry, dist: distance(h.metric, vec, h.entry.vec)}}
+	top := len(h.entry.neighbors) - 1
+	for l := top; l > level; l-- {
+		entries = h.searchLayer(vec, entries, 1, l)
+	}
+	for l := minInt(level, top); l >= 0; l-- {
+		entries = h.searchLayer(vec, entries, h.efConstruction, l)
+		neighbors := entries
+		if len(neighbors) > h.m {
+			neighbors = neighbors[:h.m]
+		}
+		for _, c := range neighbors {
+			node.neighbors[l] = append(node.neighbors[l], c.node)
+			c.node.neighbors[l] = append(c.node.neighbors[l], node)
+			h.shrink(c.node, l)
+		}
+	}
+	if level > top {
+		h.entry = node
+	}
+}
+
+// shrink 邻居过多时只保留距离最近的邻居
+func (h *hnswIndex) shrink(node *hnswNode, level int) {
+	neighbors := node.neighbors[level]
+	if len(neighbors) <= h.maxNeighbors(level) {
+		return
+	}
+	candidates := make([]candidate, 0, len(neighbors))
+	for _, n := range neighbors {
+		if !n.deleted {
+			candidates = append(candidates, candidate{node: n, dist: distance(h.metric, node.vec, n.vec)})
+		}
+	}
+	sortCandidates(candidates)
+	kept := make([]*hnswNode, minInt(len(candidates), h.maxNeighbors(level)))
+	for i := range kept {
+		kept[i] = candidates[i].node
+	}
+	node.neighbors[level] = kept
+}
+
+// remove 删除节点，并将它的邻居互相连接以保持图的连通
+func (h *hnswIndex) remove(key string) {
+	node, ok := h.nodes[key]
+	if !ok {
+		return
+	}
+	node.deleted = true
+	delete(h.nodes, key)
+
+	for l, neighbors := range node.neighbors {
+		for _, n := range neighbors {
+			if l >= len(n.neighbors) {
+				continue
+			}
+			kept := n.neighbors[l][:0]
+			for _, nn := range n.neighbors[l] {
+				if nn != node {
+					kept = append(kept, nn)
+				}
+			}
+			n.neighbors[l] = kept
+			for _, other := range neighbors {
+				if other != n && !containsNode(n.neighbors[l], other) {
+					n.neighbors[l] = append(n.neighbors[l], other)
+				}
+			}
+			h.shrink(n, l)
+		}
+	}
+
+	if h.entry == node {
+		// 选择层数最高的节点作为新的入口
+		h.entry = nil
+		for _, n := range h.nodes {
+			if h.entry == nil || len(n.neighbors) > len(h.entry.neighbors) {
+				h.entry = n
+			}
+		}
+	}
+}
+
+func (h *hnswIndex) search(query []float32, k, ef int, filter docSet) []*Result {
+	if h.entry == nil || k <= 0 {
+		return nil
+	}
+	if filter != nil && len(filter) <= hnswBruteForceLimit {
+		// 候选文档较少时直接计算距离，结果是精确的
+		top := &nearest{k: k}
+		for key := range filter {
+			if node, ok := h.nodes[key]; ok {
+				top.push(key, distance(h.metric, query, node.vec))
+			}
+		}
+		return top.results
+	}
+
+	entries := []candidate{{node: h.entry, dist: distance(h.metric, query, h.entry.vec)}}
+	for l := len(h.entry.neighbors) - 1; l > 0; l-- {
+		entries = h.searchLayer(query, entries, 1, l)
+	}
+	ef = maxInt(ef, k)
+	for {
+		// 过滤之后结果不足 k 个时扩大候选集合重新查询
+		top := &nearest{k: k}
+		for _, c := range h.searchLayer(query, entries, ef, 0) {
+			if filter == nil || hasKey(filter, c.node.key) {
+				top.push(c.node.key, c.dist)
+			}
+		}
+		if len(top.results) >= k || ef >= len(h.nodes) {
+			return top.results
+		}
+		ef *= 2
+	}
+}
+
+// searchLayer 在某一层中贪心地查找距离最近的 ef 个节点，结果按照距离从小到大排列
+func (h *hnswIndex) searchLayer(query []float32, entries []candidate, ef, level int) []candidate {
+	visited := make(map[*hnswNode]struct{}, ef)
+	queue := make([]candidate, 0, len(entries))   // 待扩展的节点，按照距离排列
+	results := make([]candidate, 0, len(entries)) // 距离最近的 ef 个节点
+	for _, c := range entries {
+		visited[c.node] = struct{}{}
+		queue = insertCandidate(queue, c)
+		results = insertCandidate(results, c)
+	}
+	if len(results) > ef {
+		results = results[:ef]
+	}
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		if len(results) >= ef && c.dist > results[len(results)-1].dist {
+			break
+		}
+		if level >= len(c.node.neighbors) {
+			continue
+		}
+		for _, n := range c.node.neighbors[level] {
+			if _, ok := visited[n]; ok || n.deleted {
+				continue
+			}
+			visited[n] = struct{}{}
+			d := distance(h.metric, query, n.vec)
+			if len(results) < ef || d < results[len(results)-1].dist {
+				next := candidate{node: n, dist: d}
+				queue = insertCandidate(queue, next)
+				results = insertCandidate(results, next)
+				if len(results) > ef {
+					results = results[:ef]
+				}
+			}
+		}
+	}
+	return results
+}
+
+// insertCandidate 按照距离插入到有序的候选列表中
+func insertCandidate(list []candidate, c candidate) []candidate {
+	i := sort.Search(len(list), func(i int) bool {
+		return list[i].dist > c.dist
+	})
+	list = append(list, candidate{})
+	copy(list[i+1:], list[i:])
+	list[i] = c
+	return list
+}
+
+func sortCandidates(list []candidate) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].dist < list[j].dist
+	})
+}
+
+func containsNode(nodes []*hnswNode, node *hnswNode) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
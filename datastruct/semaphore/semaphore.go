@@ -0,0 +1,264 @@
+package semaphore
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var ErrBadDump = errors.New("ERR semaphore: invalid dump data")
+
+// Holder 持有锁或者信号量的客户端
+type Holder struct {
+	Owner    string
+	Token    int64 // 获取时分配的 fencing token
+	ExpireAt time.Time
+}
+
+// waiter 排队等待获取的客户端，超过 deadline 之后不再等待
+type waiter struct {
+	owner    string
+	deadline time.Time
+}
+
+// Semaphore 带有 fencing token 的计数信号量，互斥锁是容量为 1 的信号量。
+// 每次成功获取都会分配一个单调递增的 token，持有者到期后自动释放，
+// 等待者按照排队的顺序获取，并发控制由调用方负责
+type Semaphore struct {
+	mutex   bool
+	limit   int
+	token   int64     // 最后一次分配的 token
+	holders []*Holder // 按照获取的顺序排列
+	waiters []*waiter // 按照排队的顺序排列
+}
+
+// MakeLock 创建互斥锁
+func MakeLock() *Semaphore {
+	return &Semaphore{mutex: true, limit: 1}
+}
+
+// Make 创建最多被 limit 个客户端同时持有的信号量
+func Make(limit int) *Semaphore {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Semaphore{limit: limit}
+}
+
+// IsLock 返回是否为互斥锁
+func (s *Semaphore) IsLock() bool {
+	return s.mutex
+}
+
+// Limit 返回最多同时持有的客户端数量
+func (s *Semaphore) Limit() int {
+	return s.limit
+}
+
+// SetLimit 修改信号量的容量，容量变小时已经持有的客户端不受影响
+func (s *Semaphore) SetLimit(limit int) {
+	if s.mutex || limit < 1 {
+		return
+	}
+	s.limit = limit
+}
+
+// Token 返回最后一次分配的 token
+func (s *Semaphore) Token() int64 {
+	return s.token
+}
+
+// Holders 返回当前的持有者，包括已经到期但是还没有被清理的持有者
+func (s *Semaphore) Holders() []*Holder {
+	result := make([]*Holder, len(s.holders))
+	copy(result, s.holders)
+	return result
+}
+
+// Waiting 返回排队等待的客户端数量
+func (s *Semaphore) Waiting() int {
+	return len(s.waiters)
+}
+
+func (s *Semaphore) holderIndex(owner string) int {
+	for i, h := range s.holders {
+		if h.Owner == owner {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Semaphore) waiterIndex(owner string) int {
+	for i, w := range s.waiters {
+		if w.owner == owner {
+			return i
+		}
+	}
+	return -1
+}
+
+// Acquire 尝试获取，成功时返回分配的 token，owner 已经持有时刷新过期时间并返回原来的 token。
+// 空闲的位置优先分配给排在前面的等待者，owner 排队的位置（没有排队时排在队尾）在空闲位置之内时才能获取
+func (s *Semaphore) Acquire(owner string, ttl time.Duration, now time.Time) (int64, bool) {
+	s.ExpireHolders(now)
+	s.ExpireWaiters(now)
+
+	if i := s.holderIndex(owner); i >= 0 {
+		s.holders[i].ExpireAt = now.Add(ttl)
+		return s.holders[i].Token, true
+	}
+
+	free := s.limit - len(s.holders)
+	pos := s.waiterIndex(owner)
+	if pos < 0 {
+		pos = len(s.waiters)
+	}
+	if pos >= free {
+		return 0, false
+	}
+	if pos < len(s.waiters) {
+		s.waiters = append(s.waiters[:pos], s.waiters[pos+1:]...)
+	}
+	s.token++
+	s.holders = append(s.holders, &Holder{Owner: owner, Token: s.token, ExpireAt: now.Add(ttl)})
+	return s.token, true
+}
+
+// Wait 将 owner 加入等待队列的队尾，已经在队列中时保持原来的位置和 deadline
+func (s *Semaphore) Wait(owner string, deadline time.Time) {
+	if s.waiterIndex(owner) >= 0 {
+		return
+	}
+	s.waiters = append(s.waiters, &waiter{owner: owner, deadline: deadline})
+}
+
+// CancelWait 将 owner 从等待队列中移除，owner 没有在等待时返回 false
+func (s *Semaphore) CancelWait(owner string) bool {
+	i := s.waiterIndex(owner)
+	if i < 0 {
+		return false
+	}
+	s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+	return true
+}
+
+// Release 释放 owner 持有的位置，owner 没有持有或者已经过期时返回 false
+func (s *Semaphore) Release(owner string, now time.Time) bool {
+	s.ExpireHolders(now)
+	i := s.holderIndex(owner)
+	if i < 0 {
+		return false
+	}
+	s.holders = append(s.holders[:i], s.holders[i+1:]...)
+	return true
+}
+
+// Extend 将 owner 的过期时间修改为 ttl 之后，owner 没有持有或者已经过期时返回 false
+func (s *Semaphore) Extend(owner string, ttl time.Duration, now time.Time) bool {
+	s.ExpireHolders(now)
+	i := s.holderIndex(owner)
+	if i < 0 {
+		return false
+	}
+	s.holders[i].ExpireAt = now.Add(ttl)
+	return true
+}
+
+// ExpireHolders 释放所有已经过期的持有者，返回释放的数量
+func (s *Semaphore) ExpireHolders(now time.Time) int {
+	holders := s.holders[:0]
+	for _, h := range s.holders {
+		if now.Before(h.ExpireAt) {
+			holders = append(holders, h)
+		}
+	}
+	expired := len(s.holders) - len(holders)
+	s.holders = holders
+	return expired
+}
+
+// ExpireWaiters 移除所有已经超时的等待者，返回移除的数量
+func (s *Semaphore) ExpireWaiters(now time.Time) int {
+	waiters := s.waiters[:0]
+	for _, w := range s.waiters {
+		if now.Before(w.deadline) {
+			waiters = append(waiters, w)
+		}
+	}
+	expired := len(s.waiters) - len(waiters)
+	s.waiters = waiters
+	return expired
+}
+
+// NextDeadline 返回最早的持有者过期时间或者等待者超时时间，没有持有者和等待者时返回 false
+func (s *Semaphore) NextDeadline() (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, h := range s.holders {
+		if !found || h.ExpireAt.Before(next) {
+			next, found = h.ExpireAt, true
+		}
+	}
+	for _, w := range s.waiters {
+		if !found || w.deadline.Before(next) {
+			next, found = w.deadline, true
+		}
+	}
+	return next, found
+}
+
+// Dump 序列化容量、token 和持有者，等待者与客户端连接相关，不会被序列化
+func (s *Semaphore) Dump() []byte {
+	buf := make([]byte, 0, 17+32*len(s.holders))
+	if s.mutex {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(s.limit))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(s.token))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s.holders)))
+	for _, h := range s.holders {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(h.Token))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(h.ExpireAt.UnixMilli()))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(h.Owner)))
+		buf = append(buf, h.Owner...)
+	}
+	return buf
+}
+
+// Restore 从 Dump 的结果中恢复，已经过期的持有者在下一次访问时释放
+func Restore(data []byte) (*Semaphore, error) {
+	if len(data) < 17 || data[0] > 1 {
+		return nil, ErrBadDump
+	}
+	s := &Semaphore{
+		mutex: data[0] == 1,
+		limit: int(binary.LittleEndian.Uint32(data[1:])),
+		token: int64(binary.LittleEndian.Uint64(data[5:])),
+	}
+	n := int(binary.LittleEndian.Uint32(data[13:]))
+	if s.limit < 1 || (s.mutex && s.limit != 1) {
+		return nil, ErrBadDump
+	}
+	pos := 17
+	for i := 0; i < n; i++ {
+		if len(data)-pos < 20 {
+			return nil, ErrBadDump
+		}
+		token := int64(binary.LittleEndian.Uint64(data[pos:]))
+		expireAt := time.UnixMilli(int64(binary.LittleEndian.Uint64(data[pos+8:])))
+		size := int(binary.LittleEndian.Uint32(data[pos+16:]))
+		pos += 20
+		if size > len(data)-pos || token > s.token {
+			return nil, ErrBadDump
+		}
+		s.holders = append(s.holders, &Holder{Owner: string(data[pos : pos+size]), Token: token, ExpireAt: expireAt})
+		pos += size
+	}
+	if pos != len(data) {
+		return nil, ErrBadDump
+	}
+	return s, nil
+}
@@ -0,0 +1,133 @@
+package semaphore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	l := MakeLock()
+	now := time.Now()
+	token, ok := l.Acquire("a", time.Second, now)
+	if !ok || token != 1 {
+		t.Fatalf("acquire: %d %v", token, ok)
+	}
+	if _, ok := l.Acquire("b", time.Second, now); ok {
+		t.Fatal("lock acquired twice")
+	}
+	// 重复获取返回原来的 token
+	if token, ok := l.Acquire("a", time.Second, now); !ok || token != 1 {
+		t.Errorf("reacquire: %d %v", token, ok)
+	}
+	if l.Release("b", now) {
+		t.Error("release by other owner")
+	}
+	if !l.Release("a", now) {
+		t.Error("release error")
+	}
+	if token, ok := l.Acquire("b", time.Second, now); !ok || token != 2 {
+		t.Errorf("acquire after release: %d %v", token, ok)
+	}
+
+	// 过期后自动释放
+	later := now.Add(2 * time.Second)
+	if l.Extend("b", time.Second, later) {
+		t.Error("extend expired holder")
+	}
+	if token, ok := l.Acquire("c", time.Second, later); !ok || token != 3 {
+		t.Errorf("acquire after expire: %d %v", token, ok)
+	}
+	if !l.Extend("c", 10*time.Second, later.Add(500*time.Millisecond)) {
+		t.Error("extend error")
+	}
+	if _, ok := l.Acquire("d", time.Second, later.Add(5*time.Second)); ok {
+		t.Error("acquire extended lock")
+	}
+}
+
+func TestWaiters(t *testing.T) {
+	s := Make(2)
+	now := time.Now()
+	s.Acquire("a", time.Second, now)
+	s.Acquire("b", time.Second, now)
+	s.Wait("c", now.Add(time.Minute))
+	s.Wait("d", now.Add(time.Minute))
+
+	s.Release("a", now)
+	// 只有一个空闲位置，排在后面的 d 和没有排队的 e 不能获取
+	if _, ok := s.Acquire("d", time.Second, now); ok {
+		t.Error("waiter d jumped the queue")
+	}
+	if _, ok := s.Acquire("e", time.Second, now); ok {
+		t.Error("e jumped the queue")
+	}
+	if token, ok := s.Acquire("c", time.Second, now); !ok || token != 3 || s.Waiting() != 1 {
+		t.Errorf("waiter c: %d %v %d", token, ok, s.Waiting())
+	}
+
+	// 超时的等待者不再占用队列
+	s.Wait("f", now.Add(time.Millisecond))
+	s.Release("b", now)
+	if next, ok := s.NextDeadline(); !ok || !next.Equal(now.Add(time.Millisecond)) {
+		t.Errorf("next deadline: %v", next)
+	}
+	later := now.Add(10 * time.Millisecond)
+	if token, ok := s.Acquire("d", time.Second, later); !ok || token != 4 {
+		t.Errorf("waiter d: %d %v", token, ok)
+	}
+	if s.Waiting() != 0 {
+		t.Errorf("waiting: %d", s.Waiting())
+	}
+}
+
+// 排在队首的等待者放弃等待之后，排在后面的等待者可以获取空闲的位置
+func TestCancelWait(t *testing.T) {
+	l := MakeLock()
+	now := time.Now()
+	l.Acquire("a", time.Second, now)
+	l.Wait("b", now.Add(time.Minute))
+	l.Wait("c", now.Add(time.Minute))
+	l.Release("a", now)
+	if _, ok := l.Acquire("c", time.Second, now); ok {
+		t.Fatal("waiter c jumped the queue")
+	}
+
+	if !l.CancelWait("b") || l.CancelWait("b") || l.Waiting() != 1 {
+		t.Fatalf("cancel wait: %d", l.Waiting())
+	}
+	if token, ok := l.Acquire("c", time.Second, now); !ok || token != 2 {
+		t.Errorf("waiter c after head left: %d %v", token, ok)
+	}
+	if l.Waiting() != 0 {
+		t.Errorf("waiting: %d", l.Waiting())
+	}
+}
+
+func TestDump(t *testing.T) {
+	s := Make(3)
+	now := time.Now()
+	s.Acquire("a", time.Second, now)
+	s.Acquire("bb", time.Minute, now)
+	s.Wait("c", now.Add(time.Minute))
+
+	restored, err := Restore(s.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.IsLock() || restored.Limit() != 3 || restored.Token() != 2 || restored.Waiting() != 0 {
+		t.Fatalf("restore: %+v", restored)
+	}
+	holders := restored.Holders()
+	if len(holders) != 2 || holders[1].Owner != "bb" || holders[1].Token != 2 ||
+		holders[1].ExpireAt.UnixMilli() != now.Add(time.Minute).UnixMilli() {
+		t.Errorf("holders: %+v", holders)
+	}
+
+	lock, err := Restore(MakeLock().Dump())
+	if err != nil || !lock.IsLock() || lock.Limit() != 1 {
+		t.Errorf("restore lock: %v", err)
+	}
+	if _, err := Restore(s.Dump()[:20]); err == nil {
+		t.Error("restore truncated dump")
+	}
+}
@@ -0,0 +1,268 @@
+package set
+
+import (
+	"github.com/dawnzzz/simple-redis/datastruct/listpack"
+	"math/rand"
+	"strconv"
+)
+
+// 编码方式
+const (
+	EncodingIntSet    = "intset"
+	EncodingListPack  = "listpack"
+	EncodingHashTable = "hashtable"
+)
+
+// CompactSet 只包含整数并且元素数量不超过 maxIntSetEntries 时使用 intset 编码，
+// 元素数量不超过 maxListPackEntries 并且长度不超过 maxListPackValue 时使用 listpack 编码，
+// 否则自动转为哈希表编码，之后不再转回。非线程安全，用于保存 set
+type CompactSet struct {
+	intset   *intSet            // 不是 intset 编码时为 nil
+	listpack *listpack.ListPack // 不是 listpack 编码时为 nil
+	table    Set
+
+	maxIntSetEntries   int
+	maxListPackEntries int
+	maxListPackValue   int
+}
+
+func MakeCompactSet(maxIntSetEntries, maxListPackEntries, maxListPackValue int) *CompactSet {
+	set := &CompactSet{
+		maxIntSetEntries:   maxIntSetEntries,
+		maxListPackEntries: maxListPackEntries,
+		maxListPackValue:   maxListPackValue,
+	}
+	switch {
+	case maxIntSetEntries > 0:
+		set.intset = makeIntSet()
+	case maxListPackEntries > 0:
+		set.listpack = listpack.New()
+	default:
+		set.table = MakeSimpleSet()
+	}
+	return set
+}
+
+// Encoding 返回当前的编码方式
+func (set *CompactSet) Encoding() string {
+	switch {
+	case set.intset != nil:
+		return EncodingIntSet
+	case set.listpack != nil:
+		return EncodingListPack
+	}
+	return EncodingHashTable
+}
+
+// CompactBytes 返回 intset 或者 listpack 编码占用的字节数，哈希表编码时返回 false
+func (set *CompactSet) CompactBytes() (int, bool) {
+	switch {
+	case set.intset != nil:
+		return len(set.intset.buf), true
+	case set.listpack != nil:
+		return set.listpack.Bytes(), true
+	}
+	return 0, false
+}
+
+// parseInt 判断成员是否是可以使用 intset 保存的整数，"01"、"+1" 等不是
+func parseInt(val string) (int64, bool) {
+	v, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != val {
+		return 0, false
+	}
+	return v, true
+}
+
+// fitsListPack 判断 entries 个元素、新增元素的长度为 size 时是否可以使用 listpack 编码
+func (set *CompactSet) fitsListPack(entries, size int) bool {
+	return entries <= set.maxListPackEntries && size <= set.maxListPackValue
+}
+
+// convert 转为 listpack 编码或者哈希表编码
+func (set *CompactSet) convert(toListPack bool) {
+	members := set.ToSlice()
+	set.intset, set.listpack, set.table = nil, nil, nil
+	if toListPack {
+		set.listpack = listpack.New()
+		entries := make([][]byte, len(members))
+		for i, member := range members {
+			entries[i] = []byte(member)
+		}
+		set.listpack.Append(entries...)
+		return
+	}
+	set.table = MakeSimpleSet(members...)
+}
+
+func (set *CompactSet) Add(val string) int {
+	switch {
+	case set.intset != nil:
+		v, isInt := parseInt(val)
+		if isInt && set.intset.len() < set.maxIntSetEntries {
+			if set.intset.add(v) {
+				return 1
+			}
+			return 0
+		}
+		if isInt {
+			if _, found := set.intset.search(v); found {
+				return 0
+			}
+		}
+		// intset 中的整数最长为 20 个字节
+		set.convert(set.fitsListPack(set.intset.len()+1, len(val)) && set.maxListPackValue >= 20)
+		return set.Add(val)
+	case set.listpack != nil:
+		if set.listpack.Find([]byte(val), 1) >= 0 {
+			return 0
+		}
+		if !set.fitsListPack(set.listpack.Len()+1, len(val)) {
+			set.convert(false)
+			return set.Add(val)
+		}
+		set.listpack.Append([]byte(val))
+		return 1
+	}
+	return set.table.Add(val)
+}
+
+func (set *CompactSet) Remove(val string) int {
+	switch {
+	case set.intset != nil:
+		if v, isInt := parseInt(val); isInt && set.intset.remove(v) {
+			return 1
+		}
+		return 0
+	case set.listpack != nil:
+		i := set.listpack.Find([]byte(val), 1)
+		if i < 0 {
+			return 0
+		}
+		set.listpack.Delete(i, 1)
+		return 1
+	}
+	return set.table.Remove(val)
+}
+
+func (set *CompactSet) Has(val string) bool {
+	switch {
+	case set.intset != nil:
+		v, isInt := parseInt(val)
+		if !isInt {
+			return false
+		}
+		_, found := set.intset.search(v)
+		return found
+	case set.listpack != nil:
+		return set.listpack.Find([]byte(val), 1) >= 0
+	}
+	return set.table.Has(val)
+}
+
+func (set *CompactSet) Len() int {
+	switch {
+	case set.intset != nil:
+		return set.intset.len()
+	case set.listpack != nil:
+		return set.listpack.Len()
+	}
+	return set.table.Len()
+}
+
+func (set *CompactSet) ToSlice() []string {
+	slice := make([]string, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		slice = append(slice, member)
+		return true
+	})
+	return slice
+}
+
+func (set *CompactSet) ForEach(consumer func(member string) bool) {
+	switch {
+	case set.intset != nil:
+		for i := 0; i < set.intset.len(); i++ {
+			if !consumer(strconv.FormatInt(set.intset.get(i), 10)) {
+				return
+			}
+		}
+	case set.listpack != nil:
+		set.listpack.ForEach(func(i int, entry []byte) bool {
+			return consumer(string(entry))
+		})
+	default:
+		set.table.ForEach(consumer)
+	}
+}
+
+// get 返回第 i 个成员，只用于 intset 和 listpack 编码
+func (set *CompactSet) get(i int) string {
+	if set.intset != nil {
+		return strconv.FormatInt(set.intset.get(i), 10)
+	}
+	return string(set.listpack.Get(i))
+}
+
+// Intersect 返回交集
+func (set *CompactSet) Intersect(another Set) Set {
+	result := MakeSimpleSet()
+	another.ForEach(func(member string) bool {
+		if set.Has(member) {
+			result.Add(member)
+		}
+		return true
+	})
+	return result
+}
+
+// Union 合并两个集合
+func (set *CompactSet) Union(another Set) Set {
+	result := MakeSimpleSet(set.ToSlice()...)
+	another.ForEach(func(member string) bool {
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// Diff 返回差集，当前集合-another
+func (set *CompactSet) Diff(another Set) Set {
+	result := MakeSimpleSet()
+	set.ForEach(func(member string) bool {
+		if !another.Has(member) {
+			result.Add(member)
+		}
+		return true
+	})
+	return result
+}
+
+func (set *CompactSet) RandomMembers(limit int) []string {
+	if set.table != nil {
+		return set.table.RandomMembers(limit)
+	}
+	size := set.Len()
+	if size == 0 {
+		return make([]string, 0)
+	}
+	members := make([]string, limit)
+	for i := range members {
+		members[i] = set.get(rand.Intn(size))
+	}
+	return members
+}
+
+func (set *CompactSet) RandomDistinctMembers(limit int) []string {
+	if set.table != nil {
+		return set.table.RandomDistinctMembers(limit)
+	}
+	members := set.ToSlice()
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if limit < len(members) {
+		members = members[:limit]
+	}
+	return members
+}
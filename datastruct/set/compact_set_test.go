@@ -0,0 +1,157 @@
+package set
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestIntSet(t *testing.T) {
+	s := makeIntSet()
+	values := []int64{5, -3, 100, 0}
+	for _, v := range values {
+		if !s.add(v) {
+			t.Errorf("add %d error", v)
+		}
+	}
+	if s.add(5) || s.width != 2 {
+		t.Error("add existing value error")
+	}
+
+	// 添加超出范围的整数时整体升级
+	s.add(math.MaxInt16 + 1)
+	if s.width != 4 {
+		t.Errorf("width: %d", s.width)
+	}
+	s.add(math.MinInt64)
+	if s.width != 8 {
+		t.Errorf("width: %d", s.width)
+	}
+	expected := []int64{math.MinInt64, -3, 0, 5, 100, math.MaxInt16 + 1}
+	if s.len() != len(expected) {
+		t.Fatalf("len: %d", s.len())
+	}
+	for i, v := range expected {
+		if s.get(i) != v {
+			t.Errorf("get(%d): %d, expected %d", i, s.get(i), v)
+		}
+	}
+
+	if !s.remove(0) || s.remove(0) || s.len() != len(expected)-1 {
+		t.Error("remove error")
+	}
+	if _, found := s.search(5); !found {
+		t.Error("search error")
+	}
+}
+
+func sortedMembers(set Set) []string {
+	members := set.ToSlice()
+	sort.Strings(members)
+	return members
+}
+
+func TestCompactSetIntSet(t *testing.T) {
+	set := MakeCompactSet(4, 8, 32)
+	for i := 3; i >= 0; i-- {
+		set.Add(strconv.Itoa(i))
+	}
+	if set.Encoding() != EncodingIntSet || set.Len() != 4 {
+		t.Fatalf("encoding: %s", set.Encoding())
+	}
+	// "01"、"+1" 不是整数，不能和 1 混淆
+	if !set.Has("1") || set.Has("01") || set.Has("+1") || set.Remove("01") != 0 {
+		t.Error("Has error")
+	}
+	if set.Add("3") != 0 || set.Encoding() != EncodingIntSet {
+		t.Error("Add existing member error")
+	}
+	// intset 中按照从小到大的顺序保存
+	if members := set.ToSlice(); members[0] != "0" || members[3] != "3" {
+		t.Errorf("ToSlice: %v", members)
+	}
+
+	// 整数数量超过 maxIntSetEntries 时转为 listpack
+	set.Add("4")
+	if set.Encoding() != EncodingListPack || set.Len() != 5 {
+		t.Fatalf("encoding: %s", set.Encoding())
+	}
+
+	// 添加非整数时转为 listpack
+	set = MakeCompactSet(4, 8, 32)
+	set.Add("1")
+	set.Add("a")
+	if set.Encoding() != EncodingListPack || !set.Has("1") || !set.Has("a") {
+		t.Errorf("encoding: %s", set.Encoding())
+	}
+}
+
+func TestCompactSetToHashTable(t *testing.T) {
+	// listpack 不能保存时 intset 直接转为哈希表
+	set := MakeCompactSet(2, 2, 32)
+	set.Add("1")
+	set.Add("2")
+	set.Add("3")
+	if set.Encoding() != EncodingHashTable {
+		t.Errorf("encoding: %s", set.Encoding())
+	}
+	set = MakeCompactSet(4, 8, 4)
+	set.Add("1")
+	set.Add("abcde")
+	if set.Encoding() != EncodingHashTable {
+		t.Errorf("encoding: %s", set.Encoding())
+	}
+	if members := sortedMembers(set); len(members) != 2 || members[0] != "1" || members[1] != "abcde" {
+		t.Errorf("members: %v", members)
+	}
+	// intset 中的整数最长为 20 个字节，maxListPackValue 小于 20 时不能转为 listpack
+	set = MakeCompactSet(2, 8, 10)
+	for i := 0; i < 3; i++ {
+		set.Add(strconv.Itoa(i))
+	}
+	if set.Encoding() != EncodingHashTable || set.Len() != 3 {
+		t.Errorf("encoding: %s", set.Encoding())
+	}
+
+	// listpack 中的元素数量超过限制，或者成员过长时转为哈希表
+	set = MakeCompactSet(0, 3, 4)
+	for _, member := range []string{"a", "b", "c"} {
+		set.Add(member)
+	}
+	if set.Encoding() != EncodingListPack {
+		t.Errorf("encoding: %s", set.Encoding())
+	}
+	set.Add("d")
+	if set.Encoding() != EncodingHashTable || set.Len() != 4 {
+		t.Errorf("encoding: %s", set.Encoding())
+	}
+	set = MakeCompactSet(0, 3, 4)
+	set.Add("a")
+	set.Add("abcde")
+	if set.Encoding() != EncodingHashTable || !set.Has("a") || !set.Has("abcde") {
+		t.Errorf("encoding: %s", set.Encoding())
+	}
+
+	// 转为哈希表之后不再转回
+	set.Remove("abcde")
+	if set.Encoding() != EncodingHashTable {
+		t.Errorf("encoding: %s", set.Encoding())
+	}
+}
+
+func TestCompactSetRandom(t *testing.T) {
+	for _, set := range []*CompactSet{MakeCompactSet(8, 8, 8), MakeCompactSet(0, 8, 8)} {
+		for i := 0; i < 5; i++ {
+			set.Add(strconv.Itoa(i))
+		}
+		if len(set.RandomMembers(10)) != 10 || len(set.RandomDistinctMembers(10)) != 5 || len(set.RandomDistinctMembers(3)) != 3 {
+			t.Errorf("%s: random members error", set.Encoding())
+		}
+		for _, member := range set.RandomMembers(10) {
+			if !set.Has(member) {
+				t.Errorf("%s: random member %s not in set", set.Encoding(), member)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package set
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// intSet 有序的整数数组，所有整数使用相同的字节数（2、4 或者 8）小端保存在一段连续的内存中，
+// 添加的整数超出当前的范围时整体升级为更大的字节数
+type intSet struct {
+	width int
+	buf   []byte
+}
+
+func makeIntSet() *intSet {
+	return &intSet{width: 2}
+}
+
+// intWidth 返回保存 v 需要的字节数
+func intWidth(v int64) int {
+	if v >= math.MinInt16 && v <= math.MaxInt16 {
+		return 2
+	}
+	if v >= math.MinInt32 && v <= math.MaxInt32 {
+		return 4
+	}
+	return 8
+}
+
+func (s *intSet) len() int {
+	return len(s.buf) / s.width
+}
+
+func (s *intSet) get(i int) int64 {
+	b := s.buf[i*s.width:]
+	switch s.width {
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b)))
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b)))
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+func (s *intSet) set(i int, v int64) {
+	b := s.buf[i*s.width:]
+	switch s.width {
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(b, uint64(v))
+	}
+}
+
+// search 返回 v 的位置，不存在时返回应该插入的位置
+func (s *intSet) search(v int64) (int, bool) {
+	n := s.len()
+	i := sort.Search(n, func(i int) bool {
+		return s.get(i) >= v
+	})
+	return i, i < n && s.get(i) == v
+}
+
+// add 添加整数，已经存在时返回 false
+func (s *intSet) add(v int64) bool {
+	i, found := s.search(v)
+	if found {
+		return false
+	}
+	n := s.len()
+	old := *s
+	if w := intWidth(v); w > s.width {
+		s.width = w
+	}
+	s.buf = make([]byte, (n+1)*s.width)
+	for j := 0; j < n; j++ {
+		if j < i {
+			s.set(j, old.get(j))
+		} else {
+			s.set(j+1, old.get(j))
+		}
+	}
+	s.set(i, v)
+	return true
+}
+
+// remove 删除整数，不存在时返回 false
+func (s *intSet) remove(v int64) bool {
+	i, found := s.search(v)
+	if !found {
+		return false
+	}
+	buf := make([]byte, len(s.buf)-s.width)
+	copy(buf, s.buf[:i*s.width])
+	copy(buf[i*s.width:], s.buf[(i+1)*s.width:])
+	s.buf = buf
+	return true
+}
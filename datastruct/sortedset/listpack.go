@@ -0,0 +1,169 @@
+package sortedset
+
+import (
+	"encoding/binary"
+	"github.com/dawnzzz/simple-redis/datastruct/listpack"
+	"math"
+	"math/rand"
+)
+
+// 编码方式
+const (
+	EncodingListPack = "listpack"
+	EncodingSkipList = "skiplist"
+)
+
+// MakeCompactSortedSet 创建有序集合，元素数量不超过 maxEntries 并且成员的长度不超过 maxValue 时使用 listpack 编码，
+// 成员和 8 字节的分值交替保存，按照分值、成员从小到大排列；超过之后自动转为跳表编码，之后不再转回
+func MakeCompactSortedSet(maxEntries, maxValue int) *SortedSet {
+	if maxEntries <= 0 {
+		return MakeSortedSet()
+	}
+	return &SortedSet{
+		listpack:   listpack.New(),
+		maxEntries: maxEntries,
+		maxValue:   maxValue,
+	}
+}
+
+// Encoding 返回当前的编码方式
+func (sortedSet *SortedSet) Encoding() string {
+	if sortedSet.listpack != nil {
+		return EncodingListPack
+	}
+	return EncodingSkipList
+}
+
+// CompactBytes 返回 listpack 编码占用的字节数，不是 listpack 编码时返回 false
+func (sortedSet *SortedSet) CompactBytes() (int, bool) {
+	if sortedSet.listpack == nil {
+		return 0, false
+	}
+	return sortedSet.listpack.Bytes(), true
+}
+
+func encodeScore(score float64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, math.Float64bits(score))
+}
+
+func decodeScore(b []byte) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+// lpElements 按照从小到大的顺序返回 listpack 中的所有元素
+func (sortedSet *SortedSet) lpElements() []*Element {
+	elements := make([]*Element, 0, sortedSet.listpack.Len()/2)
+	var member []byte
+	sortedSet.listpack.ForEach(func(i int, entry []byte) bool {
+		if i%2 == 0 {
+			member = entry
+		} else {
+			elements = append(elements, &Element{Member: string(member), Score: decodeScore(entry)})
+		}
+		return true
+	})
+	return elements
+}
+
+// lpFind 返回成员在 listpack 中的排名，不存在时返回 -1
+func (sortedSet *SortedSet) lpFind(member string) int {
+	i := sortedSet.listpack.Find([]byte(member), 2)
+	if i < 0 {
+		return -1
+	}
+	return i / 2
+}
+
+// lpInsert 按照分值、成员的顺序插入元素
+func (sortedSet *SortedSet) lpInsert(member string, score float64) {
+	rank := 0
+	for _, element := range sortedSet.lpElements() {
+		if element.Score > score || (element.Score == score && element.Member > member) {
+			break
+		}
+		rank++
+	}
+	sortedSet.listpack.Insert(2*rank, []byte(member), encodeScore(score))
+}
+
+// lpRemove 删除 listpack 中满足条件的元素，返回被删除的元素
+func (sortedSet *SortedSet) lpRemove(shouldRemove func(rank int, element *Element) bool) []*Element {
+	var removed []*Element
+	elements := sortedSet.lpElements()
+	for rank := len(elements) - 1; rank >= 0; rank-- {
+		if shouldRemove(rank, elements[rank]) {
+			sortedSet.listpack.Delete(2*rank, 2)
+			removed = append(removed, elements[rank])
+		}
+	}
+	// 按照从小到大的顺序返回
+	for i, j := 0, len(removed)-1; i < j; i, j = i+1, j-1 {
+		removed[i], removed[j] = removed[j], removed[i]
+	}
+	return removed
+}
+
+// toSkipList 转为跳表编码
+func (sortedSet *SortedSet) toSkipList() {
+	elements := sortedSet.lpElements()
+	sortedSet.listpack = nil
+	sortedSet.dict = make(map[string]*Element, len(elements))
+	sortedSet.skiplist = makeSkipList()
+	for _, element := range elements {
+		sortedSet.Add(element.Member, element.Score)
+	}
+}
+
+func (sortedSet *SortedSet) lpAdd(member string, score float64) bool {
+	if rank := sortedSet.lpFind(member); rank >= 0 {
+		if decodeScore(sortedSet.listpack.Get(2*rank+1)) != score {
+			sortedSet.listpack.Delete(2*rank, 2)
+			sortedSet.lpInsert(member, score)
+		}
+		return false
+	}
+	if sortedSet.listpack.Len()/2+1 > sortedSet.maxEntries || len(member) > sortedSet.maxValue {
+		sortedSet.toSkipList()
+		return sortedSet.Add(member, score)
+	}
+	sortedSet.lpInsert(member, score)
+	return true
+}
+
+func (sortedSet *SortedSet) lpForEachByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	elements := sortedSet.lpElements()
+	for i := range elements {
+		element := elements[i]
+		if desc {
+			element = elements[len(elements)-1-i]
+		}
+		if !min.less(element.Score) || !max.greater(element.Score) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit == 0 || !consumer(element) {
+			return
+		}
+		limit--
+	}
+}
+
+func (sortedSet *SortedSet) lpRandomMembers(limit int) []*Element {
+	elements := sortedSet.lpElements()
+	result := make([]*Element, limit)
+	for i := range result {
+		result[i] = elements[rand.Intn(len(elements))]
+	}
+	return result
+}
+
+func (sortedSet *SortedSet) lpRandomDistinctMembers(limit int) []*Element {
+	elements := sortedSet.lpElements()
+	rand.Shuffle(len(elements), func(i, j int) {
+		elements[i], elements[j] = elements[j], elements[i]
+	})
+	return elements[:limit]
+}
@@ -0,0 +1,124 @@
+package sortedset
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func elementsEqual(a, b []*Element) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Member != b[i].Member || a[i].Score != b[i].Score {
+			return false
+		}
+	}
+	return true
+}
+
+func TestListPackThreshold(t *testing.T) {
+	// 元素数量超过 maxEntries 时转为跳表
+	zset := MakeCompactSortedSet(4, 8)
+	for i := 0; i < 4; i++ {
+		zset.Add("m"+strconv.Itoa(i), float64(4-i))
+	}
+	if zset.Encoding() != EncodingListPack || zset.Len() != 4 {
+		t.Fatalf("encoding: %s", zset.Encoding())
+	}
+	if _, ok := zset.CompactBytes(); !ok {
+		t.Error("CompactBytes error")
+	}
+	// 更新已经存在的成员不会转换编码
+	if zset.Add("m0", 0) || zset.Encoding() != EncodingListPack {
+		t.Error("update existing member error")
+	}
+	if zset.Range(0, 1, false)[0].Member != "m0" {
+		t.Error("order after update error")
+	}
+	zset.Add("m4", 10)
+	if zset.Encoding() != EncodingSkipList || zset.Len() != 5 {
+		t.Fatalf("encoding: %s", zset.Encoding())
+	}
+	if _, ok := zset.CompactBytes(); ok {
+		t.Error("CompactBytes of skiplist should return false")
+	}
+	if e, ok := zset.Get("m1"); !ok || e.Score != 3 || zset.GetRank("m4", false) != 4 {
+		t.Error("elements after convert error")
+	}
+	// 转为跳表之后不再转回
+	zset.Remove("m4")
+	zset.Remove("m3")
+	if zset.Encoding() != EncodingSkipList {
+		t.Errorf("encoding: %s", zset.Encoding())
+	}
+
+	// 成员长度超过 maxValue 时转为跳表
+	zset = MakeCompactSortedSet(4, 8)
+	zset.Add("short", 1)
+	zset.Add("a long member", 2)
+	if zset.Encoding() != EncodingSkipList || zset.Len() != 2 {
+		t.Errorf("encoding: %s", zset.Encoding())
+	}
+
+	if MakeCompactSortedSet(0, 8).Encoding() != EncodingSkipList {
+		t.Error("maxEntries 0 should use skiplist")
+	}
+}
+
+// 随机操作之后 listpack 编码与跳表编码的结果相同
+func TestListPackEquivalence(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lp := MakeCompactSortedSet(1000, 64)
+	sl := MakeSortedSet()
+	border := func(v int) *ScoreBorder {
+		return &ScoreBorder{Value: float64(v), Exclude: r.Intn(2) == 0}
+	}
+	for i := 0; i < 2000; i++ {
+		member := "m" + strconv.Itoa(r.Intn(50))
+		score := float64(r.Intn(20))
+		switch r.Intn(6) {
+		case 0, 1, 2:
+			if lp.Add(member, score) != sl.Add(member, score) {
+				t.Fatal("Add error")
+			}
+		case 3:
+			if lp.Remove(member) != sl.Remove(member) {
+				t.Fatal("Remove error")
+			}
+		case 4:
+			min, max := border(r.Intn(20)), border(r.Intn(20))
+			if lp.RemoveByScore(min, max) != sl.RemoveByScore(min, max) {
+				t.Fatal("RemoveByScore error")
+			}
+		case 5:
+			if r.Intn(2) == 0 {
+				if !elementsEqual(lp.PopMin(2), sl.PopMin(2)) {
+					t.Fatal("PopMin error")
+				}
+			} else if !elementsEqual(lp.PopMax(2), sl.PopMax(2)) {
+				t.Fatal("PopMax error")
+			}
+		}
+
+		size := sl.Len()
+		if lp.Len() != size || lp.GetRank(member, true) != sl.GetRank(member, true) {
+			t.Fatal("Len or GetRank error")
+		}
+		if size > 0 && !elementsEqual(lp.Range(0, size, i%2 == 0), sl.Range(0, size, i%2 == 0)) {
+			t.Fatal("Range error")
+		}
+		min, max := border(r.Intn(20)), border(r.Intn(20))
+		offset, limit := int64(r.Intn(5)), int64(r.Intn(5)-1)
+		if size > 0 && lp.Count(min, max) != sl.Count(min, max) {
+			t.Fatal("Count error")
+		}
+		if !elementsEqual(lp.RangeByScore(min, max, offset, limit, i%2 == 0), sl.RangeByScore(min, max, offset, limit, i%2 == 0)) {
+			t.Fatal("RangeByScore error")
+		}
+	}
+	if lp.Encoding() != EncodingListPack {
+		t.Errorf("encoding: %s", lp.Encoding())
+	}
+}
@@ -56,7 +56,7 @@ func makeSkipList() *skipList {
 
 func randomLevel() int16 {
 	total := uint64(1)<<uint64(maxLevel) - 1
-	k := rand.Uint64() % total
+	k := rand.Uint64()%total + 1 // k 为 0 时层数会超过 maxLevel
 	return maxLevel - int16(bits.Len64(k)) + 1
 }
 
@@ -220,9 +220,22 @@ func (skiplist *skipList) getByRank(rank int64) *node {
 	return nil
 }
 
+// 返回分数最小的节点，跳表为空时返回 nil
+func (skiplist *skipList) first() *node {
+	return skiplist.header.level[0].forward
+}
+
+// 返回分数最大的节点，跳表为空时返回 nil
+func (skiplist *skipList) last() *node {
+	return skiplist.tail
+}
+
 func (skiplist *skipList) hasInRange(min *ScoreBorder, max *ScoreBorder) bool {
 	// min & max = empty
-	if min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude)) {
+	if min.Inf == positiveInf || max.Inf == negativeInf {
+		return false
+	}
+	if min.Inf == 0 && max.Inf == 0 && (min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude))) {
 		return false
 	}
 	// min > tail
@@ -0,0 +1,76 @@
+package sortedset
+
+import (
+	"strconv"
+	"testing"
+)
+
+// randomLevel 返回的层数必须在 [1, maxLevel] 之间，随机数为 0 时曾经返回 maxLevel+1
+func TestRandomLevel(t *testing.T) {
+	counts := make([]int, maxLevel+2)
+	for i := 0; i < 1<<20; i++ {
+		level := randomLevel()
+		if level < 1 || level > maxLevel {
+			t.Fatalf("illegal level %d", level)
+		}
+		counts[level]++
+	}
+	// 每一层的概率约为上一层的一半
+	if counts[1] < counts[2] || counts[2] < counts[3] {
+		t.Errorf("level distribution: %v", counts)
+	}
+}
+
+// offset 跳过的元素超出分数范围时不能返回范围之外的元素
+func TestForEachByScoreOffsetBorder(t *testing.T) {
+	zset := MakeSortedSet()
+	for i := 1; i <= 10; i++ {
+		zset.Add("m"+strconv.Itoa(i), float64(i))
+	}
+	min, max := &ScoreBorder{Value: 3}, &ScoreBorder{Value: 5}
+	for _, desc := range []bool{false, true} {
+		for offset := int64(0); offset < 6; offset++ {
+			elements := zset.RangeByScore(min, max, offset, -1, desc)
+			expected := 3 - offset
+			if expected < 0 {
+				expected = 0
+			}
+			if int64(len(elements)) != expected {
+				t.Fatalf("desc %v offset %d: %d elements", desc, offset, len(elements))
+			}
+			for _, element := range elements {
+				if element.Score < 3 || element.Score > 5 {
+					t.Errorf("desc %v offset %d: element %v out of range", desc, offset, element)
+				}
+			}
+		}
+	}
+}
+
+// 无穷的边界没有设置 Value，不能与另一个边界的 Value 比较，如 [-inf, -5] 曾经被判断为空范围
+func TestRangeByScoreInfBorder(t *testing.T) {
+	zset := MakeSortedSet()
+	for i := -10; i <= 10; i++ {
+		zset.Add("m"+strconv.Itoa(i), float64(i))
+	}
+	cases := []struct {
+		min, max *ScoreBorder
+		expected int64
+	}{
+		{negativeInfBorder, &ScoreBorder{Value: -5}, 6},
+		{negativeInfBorder, &ScoreBorder{Value: -5, Exclude: true}, 5},
+		{&ScoreBorder{Value: 5}, positiveInfBorder, 6},
+		{negativeInfBorder, positiveInfBorder, 21},
+		{positiveInfBorder, positiveInfBorder, 0},
+		{negativeInfBorder, negativeInfBorder, 0},
+		{positiveInfBorder, &ScoreBorder{Value: 5}, 0},
+		{&ScoreBorder{Value: 5}, negativeInfBorder, 0},
+	}
+	for i, c := range cases {
+		for _, desc := range []bool{false, true} {
+			if n := int64(len(zset.RangeByScore(c.min, c.max, 0, -1, desc))); n != c.expected {
+				t.Errorf("case %d desc %v: %d elements, expected %d", i, desc, n, c.expected)
+			}
+		}
+	}
+}
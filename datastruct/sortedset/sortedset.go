@@ -1,10 +1,19 @@
 package sortedset
 
-import "strconv"
+import (
+	"github.com/dawnzzz/simple-redis/datastruct/listpack"
+	"math/rand"
+	"strconv"
+)
 
 type SortedSet struct {
 	dict     map[string]*Element
 	skiplist *skipList
+
+	// listpack 编码时 dict 和 skiplist 为 nil
+	listpack   *listpack.ListPack
+	maxEntries int
+	maxValue   int
 }
 
 func MakeSortedSet() *SortedSet {
@@ -15,6 +24,9 @@ func MakeSortedSet() *SortedSet {
 }
 
 func (sortedSet *SortedSet) Add(member string, score float64) bool {
+	if sortedSet.listpack != nil {
+		return sortedSet.lpAdd(member, score)
+	}
 	element, ok := sortedSet.dict[member]
 	sortedSet.dict[member] = &Element{
 		Member: member,
@@ -33,10 +45,20 @@ func (sortedSet *SortedSet) Add(member string, score float64) bool {
 }
 
 func (sortedSet *SortedSet) Len() int64 {
+	if sortedSet.listpack != nil {
+		return int64(sortedSet.listpack.Len() / 2)
+	}
 	return int64(len(sortedSet.dict))
 }
 
 func (sortedSet *SortedSet) Get(member string) (element *Element, ok bool) {
+	if sortedSet.listpack != nil {
+		rank := sortedSet.lpFind(member)
+		if rank < 0 {
+			return nil, false
+		}
+		return &Element{Member: member, Score: decodeScore(sortedSet.listpack.Get(2*rank + 1))}, true
+	}
 	element, ok = sortedSet.dict[member]
 	if !ok {
 		return nil, false
@@ -45,6 +67,14 @@ func (sortedSet *SortedSet) Get(member string) (element *Element, ok bool) {
 }
 
 func (sortedSet *SortedSet) Remove(member string) bool {
+	if sortedSet.listpack != nil {
+		rank := sortedSet.lpFind(member)
+		if rank < 0 {
+			return false
+		}
+		sortedSet.listpack.Delete(2*rank, 2)
+		return true
+	}
 	v, ok := sortedSet.dict[member]
 	if ok {
 		sortedSet.skiplist.remove(member, v.Score)
@@ -55,6 +85,13 @@ func (sortedSet *SortedSet) Remove(member string) bool {
 }
 
 func (sortedSet *SortedSet) GetRank(member string, desc bool) (rank int64) {
+	if sortedSet.listpack != nil {
+		r := int64(sortedSet.lpFind(member))
+		if r >= 0 && desc {
+			r = sortedSet.Len() - 1 - r
+		}
+		return r
+	}
 	element, ok := sortedSet.dict[member]
 	if !ok {
 		return -1
@@ -77,6 +114,20 @@ func (sortedSet *SortedSet) ForEach(start int64, stop int64, desc bool, consumer
 		panic("illegal end " + strconv.FormatInt(stop, 10))
 	}
 
+	if sortedSet.listpack != nil {
+		elements := sortedSet.lpElements()
+		for i := start; i < stop; i++ {
+			element := elements[i]
+			if desc {
+				element = elements[size-1-i]
+			}
+			if !consumer(element) {
+				break
+			}
+		}
+		return
+	}
+
 	// find start node
 	var node *node
 	if desc {
@@ -141,6 +192,10 @@ func (sortedSet *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
 
 // ForEachByScore visits members which score within the given border
 func (sortedSet *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	if sortedSet.listpack != nil {
+		sortedSet.lpForEachByScore(min, max, offset, limit, desc, consumer)
+		return
+	}
 	// find start node
 	var node *node
 	if desc {
@@ -157,6 +212,10 @@ func (sortedSet *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, o
 		}
 		offset--
 	}
+	// skipping offset members may go beyond the score border
+	if node != nil && (!min.less(node.Element.Score) || !max.greater(node.Element.Score)) {
+		node = nil
+	}
 
 	// A negative limit returns all elements from the offset
 	for i := 0; (i < int(limit) || limit < 0) && node != nil; i++ {
@@ -195,6 +254,12 @@ func (sortedSet *SortedSet) RangeByScore(min *ScoreBorder, max *ScoreBorder, off
 
 // RemoveByScore removes members which score within the given border
 func (sortedSet *SortedSet) RemoveByScore(min *ScoreBorder, max *ScoreBorder) int64 {
+	if sortedSet.listpack != nil {
+		removed := sortedSet.lpRemove(func(rank int, element *Element) bool {
+			return min.less(element.Score) && max.greater(element.Score)
+		})
+		return int64(len(removed))
+	}
 	removed := sortedSet.skiplist.RemoveRangeByScore(min, max, 0)
 	for _, element := range removed {
 		delete(sortedSet.dict, element.Member)
@@ -202,25 +267,114 @@ func (sortedSet *SortedSet) RemoveByScore(min *ScoreBorder, max *ScoreBorder) in
 	return int64(len(removed))
 }
 
+// PopMin 弹出分数最小的 count 个元素，按分数从小到大返回
 func (sortedSet *SortedSet) PopMin(count int) []*Element {
-	first := sortedSet.skiplist.getFirstInScoreRange(negativeInfBorder, positiveInfBorder)
-	if first == nil {
+	return sortedSet.pop(count, false)
+}
+
+// PopMax 弹出分数最大的 count 个元素，按分数从大到小返回
+func (sortedSet *SortedSet) PopMax(count int) []*Element {
+	return sortedSet.pop(count, true)
+}
+
+func (sortedSet *SortedSet) pop(count int, max bool) []*Element {
+	if count <= 0 {
 		return nil
 	}
-	border := &ScoreBorder{
-		Value:   first.Score,
-		Exclude: false,
+	size := int(sortedSet.Len())
+	if count > size {
+		count = size
 	}
-	removed := sortedSet.skiplist.RemoveRangeByScore(border, positiveInfBorder, count)
-	for _, element := range removed {
+	if sortedSet.listpack != nil {
+		removed := sortedSet.lpRemove(func(rank int, element *Element) bool {
+			if max {
+				return rank >= size-count
+			}
+			return rank < count
+		})
+		if max {
+			// 按分数从大到小返回
+			for i, j := 0, len(removed)-1; i < j; i, j = i+1, j-1 {
+				removed[i], removed[j] = removed[j], removed[i]
+			}
+		}
+		return removed
+	}
+
+	removed := make([]*Element, 0, count)
+	for i := 0; i < count; i++ {
+		var n *node
+		if max {
+			n = sortedSet.skiplist.last()
+		} else {
+			n = sortedSet.skiplist.first()
+		}
+		if n == nil {
+			break
+		}
+		element := n.Element
+		sortedSet.skiplist.remove(element.Member, element.Score)
 		delete(sortedSet.dict, element.Member)
+		removed = append(removed, &element)
 	}
 	return removed
 }
 
+// RandomMembers 随机返回 limit 个元素，元素可能重复
+func (sortedSet *SortedSet) RandomMembers(limit int) []*Element {
+	size := sortedSet.Len()
+	if size == 0 || limit <= 0 {
+		return nil
+	}
+
+	if sortedSet.listpack != nil {
+		return sortedSet.lpRandomMembers(limit)
+	}
+
+	result := make([]*Element, limit)
+	for i := 0; i < limit; i++ {
+		n := sortedSet.skiplist.getByRank(rand.Int63n(size) + 1)
+		result[i] = &n.Element
+	}
+	return result
+}
+
+// RandomDistinctMembers 随机返回 limit 个不重复的元素，limit 大于集合长度时返回所有元素
+func (sortedSet *SortedSet) RandomDistinctMembers(limit int) []*Element {
+	size := sortedSet.Len()
+	if size == 0 || limit <= 0 {
+		return nil
+	}
+	if int64(limit) >= size {
+		return sortedSet.Range(0, size, false)
+	}
+	if sortedSet.listpack != nil {
+		return sortedSet.lpRandomDistinctMembers(limit)
+	}
+
+	ranks := make(map[int64]struct{}, limit)
+	result := make([]*Element, 0, limit)
+	for len(result) < limit {
+		rank := rand.Int63n(size) + 1
+		if _, ok := ranks[rank]; ok {
+			continue
+		}
+		ranks[rank] = struct{}{}
+		n := sortedSet.skiplist.getByRank(rank)
+		result = append(result, &n.Element)
+	}
+	return result
+}
+
 // RemoveByRank removes member ranking within [start, stop)
 // sort by ascending order and rank starts from 0
 func (sortedSet *SortedSet) RemoveByRank(start int64, stop int64) int64 {
+	if sortedSet.listpack != nil {
+		removed := sortedSet.lpRemove(func(rank int, element *Element) bool {
+			return int64(rank) >= start && int64(rank) < stop
+		})
+		return int64(len(removed))
+	}
 	removed := sortedSet.skiplist.RemoveRangeByRank(start+1, stop+1)
 	for _, element := range removed {
 		delete(sortedSet.dict, element.Member)
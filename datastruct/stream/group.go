@@ -0,0 +1,161 @@
+package stream
+
+import (
+	"sort"
+	"time"
+)
+
+// PendingEntry 已经投递给消费者但是还没有被确认的消息
+type PendingEntry struct {
+	ID            ID
+	Consumer      string
+	DeliveryTime  time.Time // 最后一次投递的时间
+	DeliveryCount int64     // 投递次数
+}
+
+// Consumer 消费者组中的消费者
+type Consumer struct {
+	Name    string
+	pending map[ID]*PendingEntry
+}
+
+// PendingLen 返回消费者未确认的消息数量
+func (c *Consumer) PendingLen() int {
+	return len(c.pending)
+}
+
+// Group 消费者组
+type Group struct {
+	Name      string
+	LastID    ID                   // 最后投递给消费者的消息 ID
+	pending   map[ID]*PendingEntry // 未确认的消息（PEL）
+	consumers map[string]*Consumer // 组内的消费者
+}
+
+func makeGroup(name string, lastID ID) *Group {
+	return &Group{
+		Name:      name,
+		LastID:    lastID,
+		pending:   make(map[ID]*PendingEntry),
+		consumers: make(map[string]*Consumer),
+	}
+}
+
+// CreateConsumer 创建消费者，消费者已经存在时 created 为 false
+func (g *Group) CreateConsumer(name string) (consumer *Consumer, created bool) {
+	if consumer, ok := g.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer = &Consumer{
+		Name:    name,
+		pending: make(map[ID]*PendingEntry),
+	}
+	g.consumers[name] = consumer
+	return consumer, true
+}
+
+func (g *Group) GetConsumer(name string) (*Consumer, bool) {
+	consumer, ok := g.consumers[name]
+	return consumer, ok
+}
+
+// DeleteConsumer 删除消费者以及它所有未确认的消息，返回未确认消息的数量
+func (g *Group) DeleteConsumer(name string) (int, bool) {
+	consumer, ok := g.consumers[name]
+	if !ok {
+		return 0, false
+	}
+	for id := range consumer.pending {
+		delete(g.pending, id)
+	}
+	delete(g.consumers, name)
+	return len(consumer.pending), true
+}
+
+// Consumers 返回所有消费者，按照名称排序
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+// PendingLen 返回组内未确认的消息数量
+func (g *Group) PendingLen() int {
+	return len(g.pending)
+}
+
+func (g *Group) GetPending(id ID) (*PendingEntry, bool) {
+	pe, ok := g.pending[id]
+	return pe, ok
+}
+
+// Pending 返回 ID 在 [start, end] 之间未确认的消息，按照 ID 从小到大排序
+// count <= 0 表示不限制数量，consumer 不为空时只返回该消费者的消息
+func (g *Group) Pending(start, end ID, count int, consumer string) []*PendingEntry {
+	pel := g.pending
+	if consumer != "" {
+		c, ok := g.consumers[consumer]
+		if !ok {
+			return nil
+		}
+		pel = c.pending
+	}
+
+	result := make([]*PendingEntry, 0)
+	for id, pe := range pel {
+		if id.Less(start) || end.Less(id) {
+			continue
+		}
+		result = append(result, pe)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID.Less(result[j].ID)
+	})
+	if count > 0 && len(result) > count {
+		result = result[:count]
+	}
+	return result
+}
+
+// Deliver 将消息投递给消费者：消息不在 PEL 中时加入 PEL，否则转移给该消费者，并增加投递次数
+func (g *Group) Deliver(id ID, consumer string, now time.Time) *PendingEntry {
+	pe, ok := g.pending[id]
+	if !ok {
+		pe = &PendingEntry{ID: id}
+		g.pending[id] = pe
+	}
+	g.Claim(pe, consumer, now, true)
+	return pe
+}
+
+// Claim 将未确认的消息转移给消费者，incr 为 true 时增加投递次数
+func (g *Group) Claim(pe *PendingEntry, consumer string, deliveryTime time.Time, incr bool) {
+	if old, ok := g.consumers[pe.Consumer]; ok {
+		delete(old.pending, pe.ID)
+	}
+	c, _ := g.CreateConsumer(consumer)
+	c.pending[pe.ID] = pe
+	pe.Consumer = consumer
+	pe.DeliveryTime = deliveryTime
+	if incr {
+		pe.DeliveryCount++
+	}
+}
+
+// Ack 确认消息，将消息从 PEL 中删除
+func (g *Group) Ack(id ID) bool {
+	pe, ok := g.pending[id]
+	if !ok {
+		return false
+	}
+	if c, ok := g.consumers[pe.Consumer]; ok {
+		delete(c.pending, id)
+	}
+	delete(g.pending, id)
+	return true
+}
@@ -0,0 +1,120 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var errInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+// ID 表示 stream 中一条消息的 ID，形如 ms-seq
+type ID struct {
+	Ms  uint64 // 毫秒时间戳
+	Seq uint64 // 同一毫秒内的序号
+}
+
+var (
+	MinID = ID{Ms: 0, Seq: 0}
+	MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare 比较两个 ID 的大小，小于返回 -1，相等返回 0，大于返回 1
+func (id ID) Compare(other ID) int {
+	if id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq) {
+		return -1
+	}
+	if id == other {
+		return 0
+	}
+	return 1
+}
+
+// Less 判断 id 是否小于 other
+func (id ID) Less(other ID) bool {
+	return id.Compare(other) < 0
+}
+
+// Next 返回比 id 大的最小 ID，id 已经是最大 ID 时 ok 为 false
+func (id ID) Next() (next ID, ok bool) {
+	if id.Seq < math.MaxUint64 {
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return ID{Ms: id.Ms + 1, Seq: 0}, true
+	}
+	return id, false
+}
+
+// Prev 返回比 id 小的最大 ID，id 已经是最小 ID 时 ok 为 false
+func (id ID) Prev() (prev ID, ok bool) {
+	if id.Seq > 0 {
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// ParseID 解析 ms-seq 格式的 ID，只有 ms 部分时 seq 使用 missingSeq
+func ParseID(s string, missingSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, errInvalidID
+	}
+	if !hasSeq {
+		return ID{Ms: ms, Seq: missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return ID{}, errInvalidID
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+// ParseRangeID 解析 XRANGE 等命令中的范围参数，支持 - + 以及以 ( 开头的开区间
+// isStart 表示是否为范围的起点，只有 ms 部分的起点 seq 为 0，终点 seq 为最大值
+func ParseRangeID(s string, isStart bool) (ID, error) {
+	if s == "-" {
+		return MinID, nil
+	}
+	if s == "+" {
+		return MaxID, nil
+	}
+
+	exclude := false
+	if strings.HasPrefix(s, "(") {
+		exclude = true
+		s = s[1:]
+	}
+
+	missingSeq := uint64(0)
+	if !isStart {
+		missingSeq = math.MaxUint64
+	}
+	id, err := ParseID(s, missingSeq)
+	if err != nil {
+		return ID{}, err
+	}
+
+	if exclude {
+		var ok bool
+		if isStart {
+			id, ok = id.Next()
+		} else {
+			id, ok = id.Prev()
+		}
+		if !ok {
+			return ID{}, errors.New("ERR invalid start ID for the interval")
+		}
+	}
+
+	return id, nil
+}
@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+var errBadDump = errors.New("ERR invalid stream dump")
+
+// Dump 将 stream（包括消费者组）序列化为命令参数，用于 AOF 重写，格式为：
+// lastID numEntries [id numFields field value ...] numGroups [name lastID numConsumers consumer ... numPending [id consumer deliveryMs deliveryCount] ...]
+func (s *Stream) Dump() [][]byte {
+	args := make([][]byte, 0, 3+3*len(s.entries))
+	args = append(args, []byte(s.lastID.String()))
+
+	args = append(args, []byte(strconv.Itoa(len(s.entries))))
+	for _, entry := range s.entries {
+		args = append(args, []byte(entry.ID.String()))
+		args = append(args, []byte(strconv.Itoa(len(entry.Fields))))
+		args = append(args, entry.Fields...)
+	}
+
+	groups := s.Groups()
+	args = append(args, []byte(strconv.Itoa(len(groups))))
+	for _, group := range groups {
+		args = append(args, []byte(group.Name))
+		args = append(args, []byte(group.LastID.String()))
+
+		consumers := group.Consumers()
+		args = append(args, []byte(strconv.Itoa(len(consumers))))
+		for _, consumer := range consumers {
+			args = append(args, []byte(consumer.Name))
+		}
+
+		pending := group.Pending(MinID, MaxID, 0, "")
+		args = append(args, []byte(strconv.Itoa(len(pending))))
+		for _, pe := range pending {
+			args = append(args, []byte(pe.ID.String()))
+			args = append(args, []byte(pe.Consumer))
+			args = append(args, []byte(strconv.FormatInt(pe.DeliveryTime.UnixMilli(), 10)))
+			args = append(args, []byte(strconv.FormatInt(pe.DeliveryCount, 10)))
+		}
+	}
+
+	return args
+}
+
+// dumpReader 按顺序读取 Dump 生成的参数
+type dumpReader struct {
+	args [][]byte
+	pos  int
+	err  error
+}
+
+func (r *dumpReader) next() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.pos >= len(r.args) {
+		r.err = errBadDump
+		return nil
+	}
+	arg := r.args[r.pos]
+	r.pos++
+	return arg
+}
+
+func (r *dumpReader) nextInt() int {
+	arg := r.next()
+	if r.err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(string(arg))
+	if err != nil || n < 0 {
+		r.err = errBadDump
+		return 0
+	}
+	return n
+}
+
+func (r *dumpReader) nextInt64() int64 {
+	arg := r.next()
+	if r.err != nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		r.err = errBadDump
+	}
+	return n
+}
+
+func (r *dumpReader) nextID() ID {
+	arg := r.next()
+	if r.err != nil {
+		return ID{}
+	}
+	id, err := ParseID(string(arg), 0)
+	if err != nil {
+		r.err = errBadDump
+	}
+	return id
+}
+
+// Restore 从 Dump 生成的参数中恢复 stream
+func Restore(args [][]byte) (*Stream, error) {
+	r := &dumpReader{args: args}
+	s := MakeStream()
+
+	lastID := r.nextID()
+	numEntries := r.nextInt()
+	for i := 0; i < numEntries && r.err == nil; i++ {
+		id := r.nextID()
+		numFields := r.nextInt()
+		fields := make([][]byte, 0, numFields)
+		for j := 0; j < numFields && r.err == nil; j++ {
+			fields = append(fields, r.next())
+		}
+		if r.err == nil {
+			if err := s.Add(id, fields); err != nil {
+				return nil, errBadDump
+			}
+		}
+	}
+	if r.err == nil && s.lastID.Less(lastID) {
+		s.lastID = lastID
+	}
+
+	numGroups := r.nextInt()
+	for i := 0; i < numGroups && r.err == nil; i++ {
+		name := string(r.next())
+		group, ok := s.CreateGroup(name, r.nextID())
+		if !ok {
+			return nil, errBadDump
+		}
+		numConsumers := r.nextInt()
+		for j := 0; j < numConsumers && r.err == nil; j++ {
+			group.CreateConsumer(string(r.next()))
+		}
+		numPending := r.nextInt()
+		for j := 0; j < numPending && r.err == nil; j++ {
+			pe := &PendingEntry{ID: r.nextID()}
+			consumer := string(r.next())
+			deliveryTime := time.UnixMilli(r.nextInt64())
+			pe.DeliveryCount = r.nextInt64()
+			group.pending[pe.ID] = pe
+			group.Claim(pe, consumer, deliveryTime, false)
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.pos != len(args) {
+		return nil, errBadDump
+	}
+	return s, nil
+}
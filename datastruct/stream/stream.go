@@ -0,0 +1,228 @@
+package stream
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrIDZero     = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrExhausted  = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+)
+
+// Entry 是 stream 中的一条消息
+type Entry struct {
+	ID     ID
+	Fields [][]byte // field value field value ...
+}
+
+// Stream 只能追加的消息日志，消息按照 ID 递增有序存放
+type Stream struct {
+	entries []*Entry
+	lastID  ID // 最后生成的 ID，删除了最后的消息之后新消息的 ID 依然要比它大
+	groups  map[string]*Group
+}
+
+func MakeStream() *Stream {
+	return &Stream{
+		groups: make(map[string]*Group),
+	}
+}
+
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+// SetLastID 设置 lastID，用于恢复 stream
+func (s *Stream) SetLastID(id ID) {
+	s.lastID = id
+}
+
+// NextID 根据当前时间生成下一个自增 ID
+func (s *Stream) NextID(now time.Time) (ID, error) {
+	ms := uint64(now.UnixMilli())
+	if ms > s.lastID.Ms {
+		return ID{Ms: ms, Seq: 0}, nil
+	}
+	next, ok := s.lastID.Next()
+	if !ok {
+		return ID{}, ErrExhausted
+	}
+	return next, nil
+}
+
+// NextSeqID 指定了 ms，生成下一个自增 seq 的 ID
+func (s *Stream) NextSeqID(ms uint64) (ID, error) {
+	if ms > s.lastID.Ms {
+		return ID{Ms: ms, Seq: 0}, nil
+	}
+	if ms == s.lastID.Ms {
+		next, ok := s.lastID.Next()
+		if !ok || next.Ms != ms {
+			return ID{}, ErrIDTooSmall
+		}
+		return next, nil
+	}
+	return ID{}, ErrIDTooSmall
+}
+
+// Add 追加一条消息，id 必须大于 lastID
+func (s *Stream) Add(id ID, fields [][]byte) error {
+	if id == MinID {
+		return ErrIDZero
+	}
+	if !s.lastID.Less(id) {
+		return ErrIDTooSmall
+	}
+	s.entries = append(s.entries, &Entry{
+		ID:     id,
+		Fields: fields,
+	})
+	s.lastID = id
+	return nil
+}
+
+// search 返回第一个 ID 大于等于 id 的消息下标
+func (s *Stream) search(id ID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].ID.Less(id)
+	})
+}
+
+// Get 获取指定 ID 的消息
+func (s *Stream) Get(id ID) (*Entry, bool) {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		return s.entries[i], true
+	}
+	return nil, false
+}
+
+// Range 返回 ID 在 [start, end] 之间的消息，count <= 0 表示不限制数量，rev 为 true 时按 ID 从大到小返回
+func (s *Stream) Range(start, end ID, count int, rev bool) []*Entry {
+	if end.Less(start) {
+		return nil
+	}
+	from := s.search(start)
+	to := s.search(end)
+	if to < len(s.entries) && s.entries[to].ID == end {
+		to++
+	}
+	// [from, to) 之间的消息在范围内
+	size := to - from
+	if count > 0 && count < size {
+		size = count
+	}
+	if size <= 0 {
+		return nil
+	}
+
+	result := make([]*Entry, size)
+	for i := 0; i < size; i++ {
+		if rev {
+			result[i] = s.entries[to-1-i]
+		} else {
+			result[i] = s.entries[from+i]
+		}
+	}
+	return result
+}
+
+// After 返回 ID 大于 id 的 count 条消息，count <= 0 表示不限制数量
+func (s *Stream) After(id ID, count int) []*Entry {
+	next, ok := id.Next()
+	if !ok {
+		return nil
+	}
+	return s.Range(next, MaxID, count, false)
+}
+
+// Delete 删除指定 ID 的消息
+func (s *Stream) Delete(id ID) bool {
+	i := s.search(id)
+	if i >= len(s.entries) || s.entries[i].ID != id {
+		return false
+	}
+	copy(s.entries[i:], s.entries[i+1:])
+	s.entries[len(s.entries)-1] = nil
+	s.entries = s.entries[:len(s.entries)-1]
+	return true
+}
+
+// TrimByLen 删除最旧的消息使得长度不超过 maxLen，limit > 0 时最多删除 limit 条，返回删除的数量
+func (s *Stream) TrimByLen(maxLen int, limit int) int {
+	removed := len(s.entries) - maxLen
+	return s.trimHead(removed, limit)
+}
+
+// TrimByMinID 删除 ID 小于 minID 的消息，limit > 0 时最多删除 limit 条，返回删除的数量
+func (s *Stream) TrimByMinID(minID ID, limit int) int {
+	removed := s.search(minID)
+	return s.trimHead(removed, limit)
+}
+
+func (s *Stream) trimHead(removed int, limit int) int {
+	if limit > 0 && removed > limit {
+		removed = limit
+	}
+	if removed <= 0 {
+		return 0
+	}
+	for i := 0; i < removed; i++ {
+		s.entries[i] = nil
+	}
+	s.entries = s.entries[removed:]
+	return removed
+}
+
+// ForEach 按照 ID 从小到大遍历所有消息
+func (s *Stream) ForEach(consumer func(entry *Entry) bool) {
+	for _, entry := range s.entries {
+		if !consumer(entry) {
+			break
+		}
+	}
+}
+
+/* ---- Consumer Group ---- */
+
+// CreateGroup 创建消费者组，组已经存在时返回 false
+func (s *Stream) CreateGroup(name string, lastID ID) (*Group, bool) {
+	if _, ok := s.groups[name]; ok {
+		return nil, false
+	}
+	group := makeGroup(name, lastID)
+	s.groups[name] = group
+	return group, true
+}
+
+func (s *Stream) GetGroup(name string) (*Group, bool) {
+	group, ok := s.groups[name]
+	return group, ok
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Groups 返回所有消费者组，按照组名排序
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
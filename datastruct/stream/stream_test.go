@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	s := MakeStream()
+
+	// add
+	for i := uint64(1); i <= 5; i++ {
+		if err := s.Add(ID{Ms: i}, [][]byte{[]byte("f"), []byte("v")}); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := s.Add(ID{Ms: 3}, nil); err != ErrIDTooSmall {
+		t.Error("Add smaller id error")
+	}
+	if err := s.Add(MinID, nil); err != ErrIDZero {
+		t.Error("Add zero id error")
+	}
+	if id, _ := s.NextSeqID(5); id != (ID{Ms: 5, Seq: 1}) {
+		t.Errorf("NextSeqID error: %s", id)
+	}
+	if id, _ := s.NextID(time.UnixMilli(1)); id != (ID{Ms: 5, Seq: 1}) {
+		t.Errorf("NextID error: %s", id)
+	}
+
+	// range
+	if entries := s.Range(ID{Ms: 2}, ID{Ms: 4}, 0, false); len(entries) != 3 || entries[0].ID.Ms != 2 {
+		t.Error("Range error")
+	}
+	if entries := s.Range(MinID, MaxID, 2, true); len(entries) != 2 || entries[0].ID.Ms != 5 {
+		t.Error("Range rev error")
+	}
+	if entries := s.After(ID{Ms: 4}, 0); len(entries) != 1 || entries[0].ID.Ms != 5 {
+		t.Error("After error")
+	}
+
+	// delete and trim
+	if !s.Delete(ID{Ms: 3}) || s.Delete(ID{Ms: 3}) || s.Len() != 4 {
+		t.Error("Delete error")
+	}
+	if removed := s.TrimByLen(3, 0); removed != 1 || s.Len() != 3 {
+		t.Error("TrimByLen error")
+	}
+	if removed := s.TrimByMinID(ID{Ms: 5}, 0); removed != 2 || s.Len() != 1 {
+		t.Error("TrimByMinID error")
+	}
+	if s.LastID() != (ID{Ms: 5}) {
+		t.Error("LastID error")
+	}
+}
+
+func TestParseRangeID(t *testing.T) {
+	if id, _ := ParseRangeID("(1-1", true); id != (ID{Ms: 1, Seq: 2}) {
+		t.Errorf("ParseRangeID error: %s", id)
+	}
+	if id, _ := ParseRangeID("2", false); id.Ms != 2 || id.Seq != MaxID.Seq {
+		t.Errorf("ParseRangeID error: %s", id)
+	}
+	if _, err := ParseRangeID("a-1", true); err == nil {
+		t.Error("ParseRangeID should fail")
+	}
+}
+
+func TestGroupAndDump(t *testing.T) {
+	s := MakeStream()
+	for i := uint64(1); i <= 3; i++ {
+		_ = s.Add(ID{Ms: i}, [][]byte{[]byte("f"), []byte("v")})
+	}
+	group, ok := s.CreateGroup("g", MinID)
+	if !ok {
+		t.Fatal("CreateGroup error")
+	}
+	if _, ok := s.CreateGroup("g", MinID); ok {
+		t.Error("CreateGroup duplicate error")
+	}
+
+	now := time.UnixMilli(1000)
+	for _, entry := range s.After(group.LastID, 0) {
+		group.Deliver(entry.ID, "c1", now)
+		group.LastID = entry.ID
+	}
+	pe, _ := group.GetPending(ID{Ms: 2})
+	group.Claim(pe, "c2", now, true)
+	if pe.DeliveryCount != 2 || group.PendingLen() != 3 {
+		t.Error("Claim error")
+	}
+	if !group.Ack(ID{Ms: 1}) || group.Ack(ID{Ms: 1}) {
+		t.Error("Ack error")
+	}
+	if pending := group.Pending(MinID, MaxID, 0, "c1"); len(pending) != 1 || pending[0].ID.Ms != 3 {
+		t.Error("Pending error")
+	}
+
+	restored, err := Restore(s.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() != 3 || restored.LastID() != s.LastID() {
+		t.Error("Restore entries error")
+	}
+	g, ok := restored.GetGroup("g")
+	if !ok || g.LastID != group.LastID || g.PendingLen() != 2 || len(g.Consumers()) != 2 {
+		t.Error("Restore group error")
+	}
+	if pe, ok := g.GetPending(ID{Ms: 2}); !ok || pe.Consumer != "c2" || pe.DeliveryCount != 2 || !pe.DeliveryTime.Equal(now) {
+		t.Error("Restore pending error")
+	}
+	if _, err := Restore(s.Dump()[1:]); err == nil {
+		t.Error("Restore bad dump should fail")
+	}
+}
@@ -0,0 +1,339 @@
+package tdigest
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+const DefaultCompression = 100
+
+var ErrBadDump = errors.New("ERR T-Digest: invalid dump data")
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigest 使用 merging t-digest 估计分位数，两端的质心更小，因此极端分位数（p99、p999）的精度更高
+// 每次添加之后都会立即合并质心，查询时不需要修改结构，可以在读锁下进行
+type TDigest struct {
+	compression float64
+	min         float64
+	max         float64
+	total       float64 // 所有质心的权重之和，即观测值的数量
+	centroids   []centroid
+}
+
+func Make(compression float64) *TDigest {
+	return &TDigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// Add 添加多个观测值
+func (td *TDigest) Add(values ...float64) {
+	if len(values) == 0 {
+		return
+	}
+	items := make([]centroid, 0, len(td.centroids)+len(values))
+	items = append(items, td.centroids...)
+	for _, v := range values {
+		items = append(items, centroid{mean: v, weight: 1})
+		td.min = math.Min(td.min, v)
+		td.max = math.Max(td.max, v)
+	}
+	td.merge(items)
+}
+
+// Merge 将多个 t-digest 合并到当前 t-digest 中，不会修改 sources
+func (td *TDigest) Merge(sources ...*TDigest) {
+	items := append([]centroid(nil), td.centroids...)
+	for _, src := range sources {
+		items = append(items, src.centroids...)
+		td.min = math.Min(td.min, src.min)
+		td.max = math.Max(td.max, src.max)
+	}
+	td.merge(items)
+}
+
+// Reset 清空所有观测值
+func (td *TDigest) Reset() {
+	td.min = math.Inf(1)
+	td.max = math.Inf(-1)
+	td.total = 0
+	td.centroids = nil
+}
+
+// integratedLocation 尺度函数 k1，将分位数 q 映射到 k 空间
+func (td *TDigest) integratedLocation(q float64) float64 {
+	return td.compression * (math.Asin(2*q-1) + math.Pi/2) / math.Pi
+}
+
+// integratedQ integratedLocation 的反函数
+func (td *TDigest) integratedQ(k float64) float64 {
+	return (math.Sin(math.Min(k, td.compression)*math.Pi/td.compression-math.Pi/2) + 1) / 2
+}
+
+// merge 将质心按照均值排序后重新合并，每个质心在 k 空间中的跨度不超过 1
+func (td *TDigest) merge(items []centroid) {
+	if len(items) == 0 {
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].mean < items[j].mean
+	})
+	var total float64
+	for _, c := range items {
+		total += c.weight
+	}
+
+	merged := make([]centroid, 0, int(td.compression)+1)
+	cur := items[0]
+	var weightSoFar float64
+	limit := total * td.integratedQ(td.integratedLocation(0)+1)
+	for _, c := range items[1:] {
+		if weightSoFar+cur.weight+c.weight <= limit {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		weightSoFar += cur.weight
+		merged = append(merged, cur)
+		limit = total * td.integratedQ(td.integratedLocation(weightSoFar/total)+1)
+		cur = c
+	}
+	merged = append(merged, cur)
+
+	td.centroids = merged
+	td.total = total
+}
+
+// Quantile 估计分位数 q 对应的值，没有观测值时返回 NaN
+func (td *TDigest) Quantile(q float64) float64 {
+	n := len(td.centroids)
+	if n == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return td.min
+	}
+	if q >= 1 {
+		return td.max
+	}
+
+	index := q * td.total
+	if index < 1 {
+		return td.min
+	}
+	first, last := td.centroids[0], td.centroids[n-1]
+	// 位于第一个质心的左半部分，在最小值与质心均值之间插值
+	if first.weight > 1 && index < first.weight/2 {
+		return td.min + (index-1)/(first.weight/2-1)*(first.mean-td.min)
+	}
+	if index > td.total-1 {
+		return td.max
+	}
+	// 位于最后一个质心的右半部分
+	if last.weight > 1 && td.total-index <= last.weight/2 {
+		return td.max - (td.total-index-1)/(last.weight/2-1)*(td.max-last.mean)
+	}
+
+	weightSoFar := first.weight / 2
+	for i := 0; i < n-1; i++ {
+		left, right := td.centroids[i], td.centroids[i+1]
+		dw := (left.weight + right.weight) / 2
+		if weightSoFar+dw > index {
+			// 权重为 1 的质心就是观测值本身
+			var leftUnit, rightUnit float64
+			if left.weight == 1 {
+				if index-weightSoFar < 0.5 {
+					return left.mean
+				}
+				leftUnit = 0.5
+			}
+			if right.weight == 1 {
+				if weightSoFar+dw-index <= 0.5 {
+					return right.mean
+				}
+				rightUnit = 0.5
+			}
+			z1 := index - weightSoFar - leftUnit
+			z2 := weightSoFar + dw - index - rightUnit
+			return weightedAverage(left.mean, z2, right.mean, z1)
+		}
+		weightSoFar += dw
+	}
+	return td.max
+}
+
+// CDF 估计小于等于 value 的观测值所占的比例，没有观测值时返回 NaN
+func (td *TDigest) CDF(value float64) float64 {
+	n := len(td.centroids)
+	if n == 0 {
+		return math.NaN()
+	}
+	if value < td.min {
+		return 0
+	}
+	if value > td.max {
+		return 1
+	}
+	if n == 1 {
+		if td.max == td.min {
+			return 0.5
+		}
+		return (value - td.min) / (td.max - td.min)
+	}
+
+	first, last := td.centroids[0], td.centroids[n-1]
+	if value < first.mean {
+		if first.mean-td.min <= 0 {
+			return 0
+		}
+		if value == td.min {
+			return 0.5 / td.total
+		}
+		return (1 + (value-td.min)/(first.mean-td.min)*(first.weight/2-1)) / td.total
+	}
+	if value > last.mean {
+		if td.max-last.mean <= 0 {
+			return 1
+		}
+		if value == td.max {
+			return 1 - 0.5/td.total
+		}
+		return 1 - (1+(td.max-value)/(td.max-last.mean)*(last.weight/2-1))/td.total
+	}
+
+	var weightSoFar float64
+	for i := 0; i < n-1; i++ {
+		left, right := td.centroids[i], td.centroids[i+1]
+		if left.mean == value {
+			// 均值相等的质心各算一半
+			var dw float64
+			for ; i < n && td.centroids[i].mean == value; i++ {
+				dw += td.centroids[i].weight
+			}
+			return (weightSoFar + dw/2) / td.total
+		}
+		if left.mean <= value && value < right.mean {
+			dw := (left.weight + right.weight) / 2
+			if right.mean-left.mean <= 0 {
+				return (weightSoFar + dw) / td.total
+			}
+			var leftExcluded, rightExcluded float64
+			if left.weight == 1 {
+				if right.weight == 1 {
+					return (weightSoFar + 1) / td.total
+				}
+				leftExcluded = 0.5
+			} else if right.weight == 1 {
+				rightExcluded = 0.5
+			}
+			base := weightSoFar + left.weight/2 + leftExcluded
+			return (base + (dw-leftExcluded-rightExcluded)*(value-left.mean)/(right.mean-left.mean)) / td.total
+		}
+		weightSoFar += left.weight
+	}
+	if value == last.mean {
+		return 1 - 0.5/td.total
+	}
+	return 1
+}
+
+// Rank 估计小于 value 的观测值数量（等于 value 的观测值算一半），0.5 向下取整
+// value 小于最小值时返回 -1，大于最大值时返回观测值的数量，没有观测值时返回 -2
+func (td *TDigest) Rank(value float64) int64 {
+	if len(td.centroids) == 0 {
+		return -2
+	}
+	if value < td.min {
+		return -1
+	}
+	if value > td.max {
+		return int64(td.total)
+	}
+	return int64(math.Ceil(td.CDF(value)*td.total - 0.5))
+}
+
+// Min 返回最小的观测值，没有观测值时返回 NaN
+func (td *TDigest) Min() float64 {
+	if len(td.centroids) == 0 {
+		return math.NaN()
+	}
+	return td.min
+}
+
+// Max 返回最大的观测值，没有观测值时返回 NaN
+func (td *TDigest) Max() float64 {
+	if len(td.centroids) == 0 {
+		return math.NaN()
+	}
+	return td.max
+}
+
+func (td *TDigest) Compression() float64 {
+	return td.compression
+}
+
+// Observations 返回观测值的数量
+func (td *TDigest) Observations() float64 {
+	return td.total
+}
+
+// NumCentroids 返回质心的数量
+func (td *TDigest) NumCentroids() int {
+	return len(td.centroids)
+}
+
+// Dump 将 t-digest 序列化为紧凑的二进制格式，用于 AOF 重写
+func (td *TDigest) Dump() []byte {
+	buf := make([]byte, 0, 24+16*len(td.centroids))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(td.compression))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(td.min))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(td.max))
+	for _, c := range td.centroids {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(c.mean))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(c.weight))
+	}
+	return buf
+}
+
+// Restore 从 Dump 的结果中恢复 t-digest
+func Restore(data []byte) (*TDigest, error) {
+	if len(data) < 24 || (len(data)-24)%16 != 0 {
+		return nil, ErrBadDump
+	}
+	float := func(pos int) float64 {
+		return math.Float64frombits(binary.LittleEndian.Uint64(data[pos:]))
+	}
+	td := Make(float(0))
+	if !(td.compression >= 1) {
+		return nil, ErrBadDump
+	}
+	td.min, td.max = float(8), float(16)
+	for pos := 24; pos < len(data); pos += 16 {
+		c := centroid{mean: float(pos), weight: float(pos + 8)}
+		if !(c.weight > 0) {
+			return nil, ErrBadDump
+		}
+		td.centroids = append(td.centroids, c)
+		td.total += c.weight
+	}
+	return td, nil
+}
+
+func weightedAverage(x1, w1, x2, w2 float64) float64 {
+	if x1 > x2 {
+		x1, w1, x2, w2 = x2, w2, x1, w1
+	}
+	if w1+w2 <= 0 {
+		return x1
+	}
+	x := (x1*w1 + x2*w2) / (w1 + w2)
+	return math.Max(x1, math.Min(x, x2))
+}
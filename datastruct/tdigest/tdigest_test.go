@@ -0,0 +1,92 @@
+package tdigest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTDigest(t *testing.T) {
+	td := Make(DefaultCompression)
+	if !math.IsNaN(td.Quantile(0.5)) || !math.IsNaN(td.Min()) || td.Rank(1) != -2 {
+		t.Error("empty t-digest error")
+	}
+
+	// 逐批添加 1..100000
+	for i := 0; i < 100; i++ {
+		values := make([]float64, 1000)
+		for j := range values {
+			values[j] = float64(i*1000 + j + 1)
+		}
+		td.Add(values...)
+	}
+	if td.Observations() != 100000 || td.Min() != 1 || td.Max() != 100000 {
+		t.Fatal("observations/min/max error")
+	}
+	if td.NumCentroids() > 2*DefaultCompression {
+		t.Errorf("too many centroids: %d", td.NumCentroids())
+	}
+	for _, q := range []float64{0.01, 0.1, 0.5, 0.9, 0.99, 0.999} {
+		if got := td.Quantile(q); math.Abs(got-q*100000)/100000 > 0.005 {
+			t.Errorf("quantile %v: %v", q, got)
+		}
+		if got := td.CDF(q * 100000); math.Abs(got-q) > 0.005 {
+			t.Errorf("cdf %v: %v", q*100000, got)
+		}
+	}
+	if td.Quantile(0) != 1 || td.Quantile(1) != 100000 {
+		t.Error("quantile bound error")
+	}
+	if td.Rank(0) != -1 || td.Rank(200000) != 100000 {
+		t.Error("rank bound error")
+	}
+
+	// 合并
+	other := Make(DefaultCompression)
+	other.Add(-1, 200000)
+	merged := Make(DefaultCompression)
+	merged.Merge(td, other)
+	if merged.Observations() != 100002 || merged.Min() != -1 || merged.Max() != 200000 {
+		t.Error("merge error")
+	}
+	if math.Abs(merged.Quantile(0.5)-50000)/100000 > 0.005 {
+		t.Errorf("merged median: %v", merged.Quantile(0.5))
+	}
+
+	restored, err := Restore(merged.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Quantile(0.99) != merged.Quantile(0.99) || restored.Observations() != merged.Observations() {
+		t.Error("restore error")
+	}
+	if _, err := Restore([]byte("bad")); err == nil {
+		t.Error("restore bad dump error")
+	}
+
+	merged.Reset()
+	if merged.Observations() != 0 || !math.IsNaN(merged.Max()) {
+		t.Error("reset error")
+	}
+}
+
+func TestTDigestSmall(t *testing.T) {
+	td := Make(DefaultCompression)
+	td.Add(1, 2, 3, 4, 5)
+	if td.Quantile(0.5) != 3 {
+		t.Errorf("median: %v", td.Quantile(0.5))
+	}
+	if td.CDF(3) != 0.5 {
+		t.Errorf("cdf: %v", td.CDF(3))
+	}
+	if td.Rank(3) != 2 {
+		t.Errorf("rank: %v", td.Rank(3))
+	}
+
+	td = Make(1000)
+	td.Add(10, 20, 30, 40, 50, 60)
+	for i, expected := range []int64{-1, 0, 1, 2, 3, 4, 5, 6} {
+		if rank := td.Rank(float64(i * 10)); rank != expected {
+			t.Errorf("rank of %d: %d", i*10, rank)
+		}
+	}
+}
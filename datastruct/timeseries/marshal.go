@@ -0,0 +1,133 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Dump 将时间序列（包括标签与 compaction 规则）序列化为紧凑的二进制格式，用于 AOF 重写
+func (s *Series) Dump() []byte {
+	buf := make([]byte, 0, 32+16*len(s.samples))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(s.retention))
+	buf = appendString(buf, s.srcKey)
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s.labels)))
+	for _, l := range s.labels {
+		buf = appendString(buf, l.Name)
+		buf = appendString(buf, l.Value)
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s.rules)))
+	for _, rule := range s.rules {
+		buf = appendString(buf, rule.DestKey)
+		buf = appendString(buf, string(rule.Aggregation))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(rule.BucketDuration))
+		if rule.hasBucket {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(rule.currentBucket))
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s.samples)))
+	for _, sample := range s.samples {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(sample.Timestamp))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(sample.Value))
+	}
+	return buf
+}
+
+// Restore 从 Dump 的结果中恢复时间序列
+func Restore(data []byte) (*Series, error) {
+	r := &reader{data: data}
+	s := &Series{
+		retention: int64(r.uint64()),
+		srcKey:    r.string(),
+	}
+
+	numLabels := r.uint32()
+	for i := uint32(0); i < numLabels && r.err == nil; i++ {
+		s.labels = append(s.labels, Label{Name: r.string(), Value: r.string()})
+	}
+
+	numRules := r.uint32()
+	for i := uint32(0); i < numRules && r.err == nil; i++ {
+		rule := &Rule{DestKey: r.string()}
+		agg, ok := ParseAggregation(r.string())
+		rule.Aggregation = agg
+		rule.BucketDuration = int64(r.uint64())
+		rule.hasBucket = r.byte() == 1
+		rule.currentBucket = int64(r.uint64())
+		if r.err == nil && (!ok || rule.BucketDuration <= 0) {
+			return nil, ErrBadDump
+		}
+		s.rules = append(s.rules, rule)
+	}
+
+	numSamples := r.uint32()
+	if r.err != nil || uint64(numSamples)*16 != uint64(len(data)-r.pos) {
+		return nil, ErrBadDump
+	}
+	s.samples = make([]Sample, numSamples)
+	for i := range s.samples {
+		s.samples[i].Timestamp = int64(r.uint64())
+		s.samples[i].Value = math.Float64frombits(r.uint64())
+		if i > 0 && s.samples[i].Timestamp <= s.samples[i-1].Timestamp {
+			return nil, ErrBadDump
+		}
+	}
+	if s.retention < 0 || r.err != nil {
+		return nil, ErrBadDump
+	}
+	return s, nil
+}
+
+func appendString(buf []byte, str string) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(str)))
+	return append(buf, str...)
+}
+
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) bytes(n uint64) []byte {
+	if r.err != nil || n > uint64(len(r.data)-r.pos) {
+		r.err = ErrBadDump
+		return nil
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if r.err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.bytes(4)
+	if r.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *reader) uint64() uint64 {
+	b := r.bytes(8)
+	if r.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (r *reader) string() string {
+	return string(r.bytes(uint64(r.uint32())))
+}
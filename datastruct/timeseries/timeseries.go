@@ -0,0 +1,334 @@
+package timeseries
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrDuplicate = errors.New("ERR TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode")
+	ErrTooOld    = errors.New("ERR TSDB: Timestamp is older than retention")
+	ErrBadDump   = errors.New("ERR TSDB: invalid dump data")
+)
+
+type Sample struct {
+	Timestamp int64 // 毫秒时间戳
+	Value     float64
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Series 时间序列，样本按照时间戳从小到大排序
+// retention 不为 0 时，只保留时间戳不早于 最新时间戳 - retention 的样本
+type Series struct {
+	retention int64
+	labels    []Label
+	samples   []Sample
+	rules     []*Rule
+	srcKey    string // 作为 compaction 规则的目标时，记录源序列的 key
+}
+
+func Make(retention int64, labels []Label) *Series {
+	return &Series{
+		retention: retention,
+		labels:    labels,
+	}
+}
+
+func (s *Series) Retention() int64 {
+	return s.retention
+}
+
+func (s *Series) SetRetention(retention int64) {
+	s.retention = retention
+}
+
+func (s *Series) Labels() []Label {
+	return s.labels
+}
+
+func (s *Series) SetLabels(labels []Label) {
+	s.labels = labels
+}
+
+// Label 返回标签的值
+func (s *Series) Label(name string) (string, bool) {
+	for _, l := range s.labels {
+		if l.Name == name {
+			return l.Value, true
+		}
+	}
+	return "", false
+}
+
+func (s *Series) SrcKey() string {
+	return s.srcKey
+}
+
+func (s *Series) SetSrcKey(srcKey string) {
+	s.srcKey = srcKey
+}
+
+func (s *Series) Len() int {
+	return len(s.samples)
+}
+
+// Last 返回最新的样本
+func (s *Series) Last() (Sample, bool) {
+	if len(s.samples) == 0 {
+		return Sample{}, false
+	}
+	return s.samples[len(s.samples)-1], true
+}
+
+// First 返回保留期内最早的样本
+func (s *Series) First() (Sample, bool) {
+	i := s.retentionStart()
+	if i >= len(s.samples) {
+		return Sample{}, false
+	}
+	return s.samples[i], true
+}
+
+// search 返回第一个时间戳不小于 timestamp 的样本的下标
+func (s *Series) search(timestamp int64) int {
+	return sort.Search(len(s.samples), func(i int) bool {
+		return s.samples[i].Timestamp >= timestamp
+	})
+}
+
+// retentionStart 返回保留期内第一个样本的下标
+func (s *Series) retentionStart() int {
+	last, ok := s.Last()
+	if !ok || s.retention == 0 {
+		return 0
+	}
+	return s.search(last.Timestamp - s.retention)
+}
+
+func (s *Series) tooOld(timestamp int64) bool {
+	last, ok := s.Last()
+	return ok && s.retention > 0 && timestamp < last.Timestamp-s.retention
+}
+
+// Add 添加样本，时间戳已经存在时返回 ErrDuplicate
+func (s *Series) Add(timestamp int64, value float64) error {
+	if s.tooOld(timestamp) {
+		return ErrTooOld
+	}
+	i := s.search(timestamp)
+	if i < len(s.samples) && s.samples[i].Timestamp == timestamp {
+		return ErrDuplicate
+	}
+	s.insert(i, Sample{Timestamp: timestamp, Value: value})
+	return nil
+}
+
+// Upsert 添加样本，时间戳已经存在时覆盖原来的值
+func (s *Series) Upsert(timestamp int64, value float64) error {
+	if s.tooOld(timestamp) {
+		return ErrTooOld
+	}
+	i := s.search(timestamp)
+	if i < len(s.samples) && s.samples[i].Timestamp == timestamp {
+		s.samples[i].Value = value
+		return nil
+	}
+	s.insert(i, Sample{Timestamp: timestamp, Value: value})
+	return nil
+}
+
+func (s *Series) insert(i int, sample Sample) {
+	s.samples = append(s.samples, Sample{})
+	copy(s.samples[i+1:], s.samples[i:])
+	s.samples[i] = sample
+}
+
+// Range 返回保留期内时间戳在 [from, to] 之间的样本
+func (s *Series) Range(from, to int64) []Sample {
+	start := s.search(from)
+	if rs := s.retentionStart(); start < rs {
+		start = rs
+	}
+	end := sort.Search(len(s.samples), func(i int) bool {
+		return s.samples[i].Timestamp > to
+	})
+	if start >= end {
+		return nil
+	}
+	result := make([]Sample, end-start)
+	copy(result, s.samples[start:end])
+	return result
+}
+
+// Trim 删除超出保留期的样本，返回删除的数量
+func (s *Series) Trim() int {
+	n := s.retentionStart()
+	if n == 0 {
+		return 0
+	}
+	s.samples = append(s.samples[:0], s.samples[n:]...)
+	return n
+}
+
+/* ---- 聚合 ---- */
+
+// Aggregation 聚合类型
+type Aggregation string
+
+const (
+	AggAvg   Aggregation = "avg"
+	AggSum   Aggregation = "sum"
+	AggMin   Aggregation = "min"
+	AggMax   Aggregation = "max"
+	AggCount Aggregation = "count"
+)
+
+// ParseAggregation 解析聚合类型，不区分大小写
+func ParseAggregation(name string) (Aggregation, bool) {
+	agg := Aggregation(strings.ToLower(name))
+	switch agg {
+	case AggAvg, AggSum, AggMin, AggMax, AggCount:
+		return agg, true
+	}
+	return "", false
+}
+
+// bucketStart 返回时间戳所在桶的起始时间，桶与 0 对齐
+func bucketStart(timestamp, bucketDuration int64) int64 {
+	mod := timestamp % bucketDuration
+	if mod < 0 {
+		mod += bucketDuration
+	}
+	return timestamp - mod
+}
+
+func aggregate(samples []Sample, agg Aggregation) float64 {
+	var result float64
+	switch agg {
+	case AggMin:
+		result = math.Inf(1)
+		for _, sample := range samples {
+			result = math.Min(result, sample.Value)
+		}
+	case AggMax:
+		result = math.Inf(-1)
+		for _, sample := range samples {
+			result = math.Max(result, sample.Value)
+		}
+	case AggCount:
+		result = float64(len(samples))
+	case AggSum, AggAvg:
+		for _, sample := range samples {
+			result += sample.Value
+		}
+		if agg == AggAvg {
+			result /= float64(len(samples))
+		}
+	}
+	return result
+}
+
+// Aggregate 将有序的样本按照时间桶聚合，每个桶返回一个以桶的起始时间为时间戳的样本
+func Aggregate(samples []Sample, agg Aggregation, bucketDuration int64) []Sample {
+	result := make([]Sample, 0)
+	for start := 0; start < len(samples); {
+		bucket := bucketStart(samples[start].Timestamp, bucketDuration)
+		end := start + 1
+		for end < len(samples) && samples[end].Timestamp < bucket+bucketDuration {
+			end++
+		}
+		result = append(result, Sample{Timestamp: bucket, Value: aggregate(samples[start:end], agg)})
+		start = end
+	}
+	return result
+}
+
+/* ---- compaction 规则 ---- */
+
+// Rule compaction 规则，源序列每个时间桶结束之后，将聚合的结果写入目标序列
+type Rule struct {
+	DestKey        string
+	Aggregation    Aggregation
+	BucketDuration int64
+	hasBucket      bool
+	currentBucket  int64 // 当前还没有结束的时间桶
+}
+
+// Compaction 需要写入目标序列的样本
+type Compaction struct {
+	DestKey string
+	Sample  Sample
+}
+
+func (s *Series) Rules() []*Rule {
+	return s.rules
+}
+
+// Rule 返回写入 destKey 的规则
+func (s *Series) Rule(destKey string) *Rule {
+	for _, rule := range s.rules {
+		if rule.DestKey == destKey {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (s *Series) AddRule(destKey string, agg Aggregation, bucketDuration int64) {
+	s.rules = append(s.rules, &Rule{
+		DestKey:        destKey,
+		Aggregation:    agg,
+		BucketDuration: bucketDuration,
+	})
+}
+
+// DeleteRule 删除写入 destKey 的规则，规则不存在时返回 false
+func (s *Series) DeleteRule(destKey string) bool {
+	for i, rule := range s.rules {
+		if rule.DestKey == destKey {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Compact 在时间戳为 timestamp 的样本写入之后调用，返回需要写入目标序列的样本
+// 样本进入新的时间桶时，上一个时间桶的聚合结果写入目标序列；
+// 样本写入已经结束的时间桶时，重新计算该时间桶的聚合结果并覆盖目标序列中的值
+func (s *Series) Compact(timestamp int64) []Compaction {
+	var result []Compaction
+	for _, rule := range s.rules {
+		bucket := bucketStart(timestamp, rule.BucketDuration)
+		if !rule.hasBucket {
+			rule.hasBucket = true
+			rule.currentBucket = bucket
+			continue
+		}
+
+		var closed int64
+		if bucket > rule.currentBucket {
+			closed = rule.currentBucket
+			rule.currentBucket = bucket
+		} else if bucket < rule.currentBucket {
+			closed = bucket
+		} else {
+			continue
+		}
+		samples := s.Range(closed, closed+rule.BucketDuration-1)
+		if len(samples) == 0 {
+			continue
+		}
+		result = append(result, Compaction{
+			DestKey: rule.DestKey,
+			Sample:  Sample{Timestamp: closed, Value: aggregate(samples, rule.Aggregation)},
+		})
+	}
+	return result
+}
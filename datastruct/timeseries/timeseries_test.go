@@ -0,0 +1,110 @@
+package timeseries
+
+import (
+	"testing"
+)
+
+func TestSeries(t *testing.T) {
+	s := Make(100, []Label{{Name: "area", Value: "cn"}})
+	for _, ts := range []int64{10, 30, 20, 50, 40} {
+		if err := s.Add(ts, float64(ts)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Add(20, 1); err != ErrDuplicate {
+		t.Error("duplicate error")
+	}
+	if err := s.Upsert(20, 2); err != nil {
+		t.Fatal(err)
+	}
+	samples := s.Range(0, 100)
+	if len(samples) != 5 || samples[1].Timestamp != 20 || samples[1].Value != 2 {
+		t.Fatalf("range error: %v", samples)
+	}
+	if samples := s.Range(25, 45); len(samples) != 2 || samples[0].Timestamp != 30 {
+		t.Errorf("range error: %v", samples)
+	}
+
+	// 超出保留期的样本不能写入，也不会被查询到
+	if err := s.Add(130, 130); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(20, 1); err != ErrTooOld {
+		t.Error("retention error")
+	}
+	if samples := s.Range(0, 200); len(samples) != 4 || samples[0].Timestamp != 30 {
+		t.Errorf("range with retention error: %v", samples)
+	}
+	if s.Trim() != 2 || s.Len() != 4 {
+		t.Error("trim error")
+	}
+	if first, _ := s.First(); first.Timestamp != 30 {
+		t.Error("first error")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	samples := []Sample{{0, 1}, {5, 2}, {10, 3}, {12, 5}, {25, 4}}
+	expected := map[Aggregation][]Sample{
+		AggAvg:   {{0, 1.5}, {10, 4}, {20, 4}},
+		AggSum:   {{0, 3}, {10, 8}, {20, 4}},
+		AggMin:   {{0, 1}, {10, 3}, {20, 4}},
+		AggMax:   {{0, 2}, {10, 5}, {20, 4}},
+		AggCount: {{0, 2}, {10, 2}, {20, 1}},
+	}
+	for agg, want := range expected {
+		got := Aggregate(samples, agg, 10)
+		if len(got) != len(want) {
+			t.Fatalf("%s: %v", agg, got)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: %v", agg, got)
+				break
+			}
+		}
+	}
+	if _, ok := ParseAggregation("AVG"); !ok {
+		t.Error("parse aggregation error")
+	}
+}
+
+func TestCompactAndDump(t *testing.T) {
+	s := Make(0, []Label{{Name: "sensor", Value: "1"}})
+	s.AddRule("dest", AggSum, 10)
+
+	var compactions []Compaction
+	for _, ts := range []int64{1, 2, 11, 12, 25, 5} {
+		_ = s.Add(ts, 1)
+		compactions = append(compactions, s.Compact(ts)...)
+	}
+	want := []Compaction{
+		{DestKey: "dest", Sample: Sample{0, 2}},
+		{DestKey: "dest", Sample: Sample{10, 2}},
+		{DestKey: "dest", Sample: Sample{0, 3}}, // 写入已经结束的时间桶，重新计算
+	}
+	if len(compactions) != len(want) {
+		t.Fatalf("compactions: %v", compactions)
+	}
+	for i := range want {
+		if compactions[i] != want[i] {
+			t.Errorf("compactions: %v", compactions)
+		}
+	}
+
+	restored, err := Restore(s.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() != s.Len() || len(restored.Rules()) != 1 || restored.Labels()[0] != s.Labels()[0] {
+		t.Error("restore error")
+	}
+	// 恢复之后当前的时间桶保持不变
+	_ = restored.Add(31, 1)
+	if c := restored.Compact(31); len(c) != 1 || c[0].Sample != (Sample{20, 1}) {
+		t.Errorf("compact after restore: %v", c)
+	}
+	if _, err := Restore([]byte{1, 2, 3}); err == nil {
+		t.Error("restore bad dump error")
+	}
+}
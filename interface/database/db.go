@@ -1,6 +1,7 @@
 package database
 
 import (
+	"github.com/dawnzzz/simple-redis/datastruct/search"
 	"github.com/dawnzzz/simple-redis/interface/redis"
 	"time"
 )
@@ -22,6 +23,9 @@ type DBEngine interface {
 	//ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLines []CmdLine) redis.Reply
 	//GetUndoLogs(dbIndex int, cmdLine [][]byte) []CmdLine
 	ForEach(dbIndex int, cb func(key string, data *DataEntity, expiration *time.Time) bool)
+	ForEachIndex(dbIndex int, cb func(idx *search.Index) bool)
+	ForEachVersion(dbIndex int, cb func(key string, version uint32) bool)
+	ForEachHistory(dbIndex int, cb func(key string, capacity int) bool)
 	//RWLocks(dbIndex int, writeKeys []string, readKeys []string)
 	//RWUnLocks(dbIndex int, writeKeys []string, readKeys []string)
 	GetDBSize(dbIndex int) (int, int)
@@ -30,4 +34,8 @@ type DBEngine interface {
 // DataEntity stores data bound to a key, including a string, list, hash, set and so on
 type DataEntity struct {
 	Data interface{}
+
+	// 访问时钟，用于内存淘汰，由 Touch 更新
+	accessTime int64  // 最后一次访问的毫秒时间戳
+	lfu        uint32 // 高 24 位为最后一次衰减的分钟数，低 8 位为对数访问计数器
 }
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	lfuInitValue  = 5           // 新建 key 的访问计数器初始值，避免刚写入的 key 立即被淘汰
+	lfuLogFactor  = 10          // 计数器对数增长的因子，越大计数器增长越慢
+	lfuMaxCounter = 255         // 计数器的最大值
+	lfuDecayTime  = time.Minute // 每经过 lfuDecayTime 没有访问，计数器减一
+	lfuTimeMask   = 1<<24 - 1   // 衰减时间以分钟为单位，只保留低 24 位
+)
+
+// Touch 记录一次访问，更新最后访问时间和访问频率。
+// 并发访问时可能丢失部分计数，对于淘汰时的近似统计是可以接受的
+func (entity *DataEntity) Touch(now time.Time) {
+	atomic.StoreInt64(&entity.accessTime, now.UnixMilli())
+
+	counter := entity.Freq(now)
+	if counter < lfuMaxCounter {
+		base := float64(counter) - lfuInitValue
+		if base < 0 {
+			base = 0
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			counter++
+		}
+	}
+	atomic.StoreUint32(&entity.lfu, lfuMinutes(now)<<8|uint32(counter))
+}
+
+// IdleTime 返回距离最后一次访问的时间，没有访问过时返回 0
+func (entity *DataEntity) IdleTime(now time.Time) time.Duration {
+	accessTime := atomic.LoadInt64(&entity.accessTime)
+	if accessTime == 0 || now.UnixMilli() < accessTime {
+		return 0
+	}
+	return time.Duration(now.UnixMilli()-accessTime) * time.Millisecond
+}
+
+// Freq 返回经过衰减之后的对数访问计数器
+func (entity *DataEntity) Freq(now time.Time) uint8 {
+	lfu := atomic.LoadUint32(&entity.lfu)
+	if lfu == 0 {
+		return lfuInitValue
+	}
+	counter := lfu & 0xff
+	last, current := lfu>>8, lfuMinutes(now)
+	var elapsed uint32
+	if current >= last {
+		elapsed = current - last
+	} else { // 分钟数回绕
+		elapsed = lfuTimeMask + 1 - last + current
+	}
+	if elapsed >= counter {
+		return 0
+	}
+	return uint8(counter - elapsed)
+}
+
+func lfuMinutes(now time.Time) uint32 {
+	return uint32(now.Unix()/int64(lfuDecayTime/time.Second)) & lfuTimeMask
+}
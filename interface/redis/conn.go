@@ -14,6 +14,8 @@ type Connection interface {
 
 	Name() string
 
+	Disconnected() <-chan struct{}
+
 	GetMultiStatus() bool
 	SetMultiStatus(bool)
 	GetEnqueuedCmdLine() [][][]byte
@@ -0,0 +1,251 @@
+package geohash
+
+import (
+	"math"
+)
+
+/*
+	与 Redis 相同的 52 位 geohash：
+	经度范围 [-180, 180]，纬度范围 [-85.05112878, 85.05112878]（墨卡托投影的范围），
+	经纬度各自量化为 26 位整数之后交错排列，纬度占偶数位，经度占奇数位。
+*/
+
+const (
+	LongMin = -180.0
+	LongMax = 180.0
+	LatMin  = -85.05112878
+	LatMax  = 85.05112878
+
+	Step = 26 // 经度、纬度各自占用的位数
+	Bits = Step * 2
+
+	earthRadius = 6372797.560856 // 与 Redis 计算距离使用的地球半径相同，单位 m
+	mercatorMax = 20037726.37
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Area 是一个 geohash 所表示的矩形区域
+type Area struct {
+	LongMin, LongMax float64
+	LatMin, LatMax   float64
+}
+
+// Valid 检查经纬度是否在可以编码的范围内
+func Valid(longitude, latitude float64) bool {
+	return longitude >= LongMin && longitude <= LongMax && latitude >= LatMin && latitude <= LatMax
+}
+
+// Encode 将经纬度编码为 52 位的 geohash
+func Encode(longitude, latitude float64) uint64 {
+	return encode(longitude, latitude, LatMin, LatMax, Step)
+}
+
+func encode(longitude, latitude, latMin, latMax float64, step uint) uint64 {
+	latOffset := (latitude - latMin) / (latMax - latMin)
+	longOffset := (longitude - LongMin) / (LongMax - LongMin)
+	scale := float64(uint64(1) << step)
+	latBits := uint32(latOffset * scale)
+	longBits := uint32(longOffset * scale)
+	// 恰好等于最大值时会溢出
+	if uint64(latBits) >= uint64(1)<<step {
+		latBits = uint32(uint64(1)<<step - 1)
+	}
+	if uint64(longBits) >= uint64(1)<<step {
+		longBits = uint32(uint64(1)<<step - 1)
+	}
+	return interleave(latBits, longBits)
+}
+
+// Decode 将 52 位的 geohash 解码为区域中心点的经纬度
+func Decode(hash uint64) (longitude, latitude float64) {
+	area := decodeArea(hash, Step)
+	longitude = (area.LongMin + area.LongMax) / 2
+	latitude = (area.LatMin + area.LatMax) / 2
+	longitude = math.Max(LongMin, math.Min(LongMax, longitude))
+	latitude = math.Max(LatMin, math.Min(LatMax, latitude))
+	return longitude, latitude
+}
+
+// decodeArea 返回 step 精度的 geohash 表示的区域
+func decodeArea(hash uint64, step uint) Area {
+	latBits, longBits := deinterleave(hash)
+	latScale := LatMax - LatMin
+	longScale := LongMax - LongMin
+	scale := float64(uint64(1) << step)
+	return Area{
+		LatMin:  LatMin + float64(latBits)/scale*latScale,
+		LatMax:  LatMin + float64(uint64(latBits)+1)/scale*latScale,
+		LongMin: LongMin + float64(longBits)/scale*longScale,
+		LongMax: LongMin + float64(uint64(longBits)+1)/scale*longScale,
+	}
+}
+
+// ToString 返回标准的 11 位 geohash 字符串，与 Redis 的 GEOHASH 命令结果相同
+func ToString(hash uint64) string {
+	longitude, latitude := Decode(hash)
+	// 标准 geohash 的纬度范围为 [-90, 90]，需要重新编码
+	std := encode(longitude, latitude, -90, 90, Step)
+	buf := make([]byte, 11)
+	for i := 0; i < 11; i++ {
+		idx := 0
+		if i < 10 {
+			idx = int((std >> (Bits - uint((i+1)*5))) & 0x1f)
+		}
+		buf[i] = base32[idx]
+	}
+	return string(buf)
+}
+
+// Distance 计算两个经纬度之间的距离，单位 m
+func Distance(long1, lat1, long2, lat2 float64) float64 {
+	lat1r, long1r := degRad(lat1), degRad(long1)
+	lat2r, long2r := degRad(lat2), degRad(long2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((long2r - long1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// InRectangle 判断点是否在以 (centerLong, centerLat) 为中心、宽 width 高 height（单位 m）的矩形内
+func InRectangle(width, height, centerLong, centerLat, longitude, latitude float64) bool {
+	// 纬度方向的距离
+	if Distance(centerLong, centerLat, centerLong, latitude) > height/2 {
+		return false
+	}
+	// 经度方向的距离，在该点的纬度上计算
+	return Distance(centerLong, latitude, longitude, latitude) <= width/2
+}
+
+// Range 表示一段 geohash 的区间 [Min, Max)
+type Range struct {
+	Min, Max uint64
+}
+
+// SearchRanges 返回覆盖以 (longitude, latitude) 为中心、宽 width 高 height（单位 m）的矩形区域的 geohash 区间
+// 区间内的点还需要根据实际的距离进行过滤
+func SearchRanges(longitude, latitude, width, height float64) []Range {
+	box := boundingBox(longitude, latitude, width, height)
+	radius := math.Sqrt(width*width+height*height) / 2
+	step := estimateStep(radius, latitude)
+
+	// 中心点所在区域与周围 8 个区域需要覆盖整个矩形，否则降低精度
+	for step > 1 {
+		hash := encode(longitude, latitude, LatMin, LatMax, step)
+		area := decodeArea(hash, step)
+		latSize := area.LatMax - area.LatMin
+		longSize := area.LongMax - area.LongMin
+		if box.LatMin >= area.LatMin-latSize && box.LatMax <= area.LatMax+latSize &&
+			box.LongMin >= area.LongMin-longSize && box.LongMax <= area.LongMax+longSize {
+			break
+		}
+		step--
+	}
+
+	hash := encode(longitude, latitude, LatMin, LatMax, step)
+	latBits, longBits := deinterleave(hash)
+	cells := uint64(1) << step
+	shift := Bits - 2*step
+	ranges := make([]Range, 0, 9)
+	seen := make(map[uint64]struct{}, 9)
+	for dLat := -1; dLat <= 1; dLat++ {
+		lat := int64(latBits) + int64(dLat)
+		if lat < 0 || lat >= int64(cells) {
+			continue
+		}
+		for dLong := -1; dLong <= 1; dLong++ {
+			// 经度方向首尾相接
+			long := (int64(longBits) + int64(dLong) + int64(cells)) % int64(cells)
+			cell := interleave(uint32(lat), uint32(long))
+			if _, ok := seen[cell]; ok {
+				continue
+			}
+			seen[cell] = struct{}{}
+			ranges = append(ranges, Range{
+				Min: cell << shift,
+				Max: (cell + 1) << shift,
+			})
+		}
+	}
+	return ranges
+}
+
+// estimateStep 根据搜索半径估计 geohash 的精度
+func estimateStep(radius, latitude float64) uint {
+	if radius == 0 {
+		return Step
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	step -= 2
+	// 高纬度地区的区域更窄
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > Step {
+		step = Step
+	}
+	return uint(step)
+}
+
+// boundingBox 返回矩形区域的经纬度范围
+func boundingBox(longitude, latitude, width, height float64) Area {
+	latDelta := radDeg(height / 2 / earthRadius)
+	longDeltaTop := radDeg(width / 2 / earthRadius / math.Cos(degRad(latitude+latDelta)))
+	longDeltaBottom := radDeg(width / 2 / earthRadius / math.Cos(degRad(latitude-latDelta)))
+	longDelta := math.Max(longDeltaTop, longDeltaBottom)
+	return Area{
+		LatMin:  latitude - latDelta,
+		LatMax:  latitude + latDelta,
+		LongMin: longitude - longDelta,
+		LongMax: longitude + longDelta,
+	}
+}
+
+func degRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// interleave 交错排列 x 与 y 的低 32 位，x 占偶数位，y 占奇数位
+func interleave(x, y uint32) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+func deinterleave(hash uint64) (x, y uint32) {
+	return squash(hash), squash(hash >> 1)
+}
+
+// spread 将 v 的每一位之间插入一个 0
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000FFFF0000FFFF
+	x = (x | x<<8) & 0x00FF00FF00FF00FF
+	x = (x | x<<4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+// squash 是 spread 的逆操作，取出偶数位
+func squash(x uint64) uint32 {
+	x &= 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x>>4) & 0x00FF00FF00FF00FF
+	x = (x | x>>8) & 0x0000FFFF0000FFFF
+	x = (x | x>>16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
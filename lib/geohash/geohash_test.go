@@ -0,0 +1,56 @@
+package geohash
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGeoHash(t *testing.T) {
+	// 与 Redis 文档中的示例结果对比
+	palermo := Encode(13.361389, 38.115556)
+	if palermo != 3479099956230698 {
+		t.Errorf("Encode error: %d", palermo)
+	}
+	catania := Encode(15.087269, 37.502669)
+	if s := ToString(palermo); s != "sqc8b49rny0" {
+		t.Errorf("ToString error: %s", s)
+	}
+	if s := ToString(catania); s != "sqdtr74hyu0" {
+		t.Errorf("ToString error: %s", s)
+	}
+
+	longitude, latitude := Decode(palermo)
+	if math.Abs(longitude-13.36138933897018433) > 1e-9 || math.Abs(latitude-38.11555639549629859) > 1e-9 {
+		t.Errorf("Decode error: %f %f", longitude, latitude)
+	}
+
+	long2, lat2 := Decode(catania)
+	if d := Distance(longitude, latitude, long2, lat2); math.Abs(d-166274.1516) > 0.001 {
+		t.Errorf("Distance error: %f", d)
+	}
+}
+
+func TestSearchRanges(t *testing.T) {
+	points := [][2]float64{{13.361389, 38.115556}, {15.087269, 37.502669}, {12.758489, 38.788135}, {179.9, 0}, {-179.9, 0}}
+	centers := [][2]float64{{15, 37}, {179.99, 0.01}, {0, 85}}
+	for _, center := range centers {
+		for _, radius := range []float64{1000, 200000, 5000000} {
+			ranges := SearchRanges(center[0], center[1], radius*2, radius*2)
+			for _, point := range points {
+				if Distance(center[0], center[1], point[0], point[1]) > radius {
+					continue
+				}
+				hash := Encode(point[0], point[1])
+				found := false
+				for _, r := range ranges {
+					if hash >= r.Min && hash < r.Max {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("point %v not covered by search around %v with radius %f", point, center, radius)
+				}
+			}
+		}
+	}
+}
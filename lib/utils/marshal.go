@@ -1,10 +1,19 @@
 package utils
 
 import (
+	"github.com/dawnzzz/simple-redis/datastruct/bloom"
 	"github.com/dawnzzz/simple-redis/datastruct/dict"
+	"github.com/dawnzzz/simple-redis/datastruct/jsondoc"
 	List "github.com/dawnzzz/simple-redis/datastruct/list"
+	"github.com/dawnzzz/simple-redis/datastruct/queue"
+	"github.com/dawnzzz/simple-redis/datastruct/ratelimit"
+	"github.com/dawnzzz/simple-redis/datastruct/search"
+	"github.com/dawnzzz/simple-redis/datastruct/semaphore"
 	"github.com/dawnzzz/simple-redis/datastruct/set"
 	"github.com/dawnzzz/simple-redis/datastruct/sortedset"
+	"github.com/dawnzzz/simple-redis/datastruct/stream"
+	"github.com/dawnzzz/simple-redis/datastruct/tdigest"
+	"github.com/dawnzzz/simple-redis/datastruct/timeseries"
 	"github.com/dawnzzz/simple-redis/interface/database"
 	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
 	"strconv"
@@ -12,12 +21,26 @@ import (
 )
 
 var (
-	setCmd       = []byte("SET")
-	zAddCmd      = []byte("ZADD")
-	hSetCmd      = []byte("HSET")
-	sAddCmd      = []byte("SADD")
-	rPushCmd     = []byte("RPUSH")
-	pExpireAtCmd = []byte("PEXPIREAT")
+	setCmd              = []byte("SET")
+	zAddCmd             = []byte("ZADD")
+	hSetCmd             = []byte("HSET")
+	sAddCmd             = []byte("SADD")
+	rPushCmd            = []byte("RPUSH")
+	pExpireAtCmd        = []byte("PEXPIREAT")
+	xRestoreCmd         = []byte("XRESTORE")
+	bfRestoreCmd        = []byte("BF.RESTORE")
+	cfRestoreCmd        = []byte("CF.RESTORE")
+	cmsRestoreCmd       = []byte("CMS.RESTORE")
+	topKRestoreCmd      = []byte("TOPK.RESTORE")
+	tdigestRestoreCmd   = []byte("TDIGEST.RESTORE")
+	tsRestoreCmd        = []byte("TS.RESTORE")
+	semRestoreCmd       = []byte("SEM.RESTORE")
+	rateLimitRestoreCmd = []byte("RATELIMIT.RESTORE")
+	queueRestoreCmd     = []byte("Q.RESTORE")
+	jsonSetCmd          = []byte("JSON.SET")
+	ftCreateCmd         = []byte("FT.CREATE")
+	keyVersionSetCmd    = []byte("KEYVERSION.SET")
+	historyEnableCmd    = []byte("HISTORY.ENABLE")
 )
 
 // EntityToBytes serialize data entity to redis multi bulk bytes
@@ -46,6 +69,8 @@ func EntityToReply(key string, entity *database.DataEntity) *reply.MultiBulkStri
 	switch val := entity.Data.(type) {
 	case []byte:
 		cmd = stringToCmd(key, val)
+	case int64:
+		cmd = stringToCmd(key, []byte(strconv.FormatInt(val, 10)))
 	case List.List:
 		cmd = listToCmd(key, val)
 	case set.Set:
@@ -54,6 +79,28 @@ func EntityToReply(key string, entity *database.DataEntity) *reply.MultiBulkStri
 		cmd = hashToCmd(key, val)
 	case *sortedset.SortedSet:
 		cmd = zSetToCmd(key, val)
+	case *stream.Stream:
+		cmd = streamToCmd(key, val)
+	case *bloom.ScalableBloomFilter:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{bfRestoreCmd, []byte(key), val.Dump()})
+	case *bloom.CuckooFilter:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{cfRestoreCmd, []byte(key), val.Dump()})
+	case *bloom.CountMinSketch:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{cmsRestoreCmd, []byte(key), val.Dump()})
+	case *bloom.TopK:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{topKRestoreCmd, []byte(key), val.Dump()})
+	case *tdigest.TDigest:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{tdigestRestoreCmd, []byte(key), val.Dump()})
+	case *timeseries.Series:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{tsRestoreCmd, []byte(key), val.Dump()})
+	case *semaphore.Semaphore:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{semRestoreCmd, []byte(key), val.Dump()})
+	case *ratelimit.SlidingLog:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{rateLimitRestoreCmd, []byte(key), val.Dump()})
+	case *queue.Queue:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{queueRestoreCmd, []byte(key), val.Dump()})
+	case *jsondoc.Document:
+		cmd = reply.MakeMultiBulkStringReply([][]byte{jsonSetCmd, []byte(key), []byte("$"), val.Dump()})
 	}
 
 	if cmd == nil {
@@ -83,6 +130,69 @@ func ExpireToReply(key string, expireAt time.Time) *reply.MultiBulkStringReply {
 	return reply.MakeMultiBulkStringReply(args)
 }
 
+// VersionToBytes 将 key 的版本号转为 KEYVERSION.SET 命令的 []byte
+func VersionToBytes(key string, version uint32) []byte {
+	return reply.MakeMultiBulkStringReply(VersionsToCmdLine([]string{key}, []uint32{version})).ToBytes()
+}
+
+// VersionsToCmdLine 将多个 key 的版本号转为一条 KEYVERSION.SET key version [key version ...] 命令
+func VersionsToCmdLine(keys []string, versions []uint32) [][]byte {
+	args := make([][]byte, 1, 1+2*len(keys))
+	args[0] = keyVersionSetCmd
+	for i, key := range keys {
+		args = append(args, []byte(key), []byte(strconv.FormatUint(uint64(versions[i]), 10)))
+	}
+	return args
+}
+
+// HistoryToBytes 将 key 的历史记录设置转为 HISTORY.ENABLE 命令的 []byte
+func HistoryToBytes(key string, capacity int) []byte {
+	args := [][]byte{historyEnableCmd, []byte(key), []byte(strconv.Itoa(capacity))}
+	return reply.MakeMultiBulkStringReply(args).ToBytes()
+}
+
+// IndexToBytes 将二级索引的定义转为 FT.CREATE 命令的 []byte
+func IndexToBytes(idx *search.Index) []byte {
+	return IndexToReply(idx).ToBytes()
+}
+
+// IndexToReply 将二级索引的定义转为 FT.CREATE 命令
+func IndexToReply(idx *search.Index) *reply.MultiBulkStringReply {
+	args := [][]byte{ftCreateCmd, []byte(idx.Name()), []byte("ON"), []byte("HASH")}
+	if prefixes := idx.Prefixes(); len(prefixes) > 0 {
+		args = append(args, []byte("PREFIX"), []byte(strconv.Itoa(len(prefixes))))
+		for _, prefix := range prefixes {
+			args = append(args, []byte(prefix))
+		}
+	}
+	if words, ok := idx.Stopwords(); ok {
+		args = append(args, []byte("STOPWORDS"), []byte(strconv.Itoa(len(words))))
+		for _, word := range words {
+			args = append(args, []byte(word))
+		}
+	}
+	args = append(args, []byte("SCHEMA"))
+	for _, f := range idx.Fields() {
+		args = append(args, []byte(f.Name), []byte(f.Type.String()))
+		if f.Type == search.FieldTag {
+			args = append(args, []byte("SEPARATOR"), []byte{f.Separator})
+		} else if f.Type == search.FieldText {
+			args = append(args, []byte("WEIGHT"), []byte(strconv.FormatFloat(f.Weight, 'f', -1, 64)))
+		} else if f.Type == search.FieldVector {
+			attributes := f.Vector.Attributes()
+			args = append(args, []byte(f.Vector.Algorithm.String()), []byte(strconv.Itoa(len(attributes))))
+			for _, value := range attributes {
+				args = append(args, []byte(value))
+			}
+		}
+		if f.Sortable {
+			args = append(args, []byte("SORTABLE"))
+		}
+	}
+
+	return reply.MakeMultiBulkStringReply(args)
+}
+
 func stringToCmd(key string, bytes []byte) *reply.MultiBulkStringReply {
 	args := make([][]byte, 3)
 	args[0] = setCmd
@@ -149,3 +259,13 @@ func listToCmd(key string, list List.List) *reply.MultiBulkStringReply {
 
 	return reply.MakeMultiBulkStringReply(args)
 }
+
+func streamToCmd(key string, s *stream.Stream) *reply.MultiBulkStringReply {
+	dump := s.Dump()
+	args := make([][]byte, 2, 2+len(dump))
+	args[0] = xRestoreCmd
+	args[1] = []byte(key)
+	args = append(args, dump...)
+
+	return reply.MakeMultiBulkStringReply(args)
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"github.com/dawnzzz/simple-redis/datastruct/dict"
+	"github.com/dawnzzz/simple-redis/datastruct/set"
+	"github.com/dawnzzz/simple-redis/datastruct/sortedset"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// 重放 EntityToCmdLine 得到的 SADD 命令之后，成员和编码方式都不变
+func TestSetToCmdLine(t *testing.T) {
+	cases := []struct {
+		members  []string
+		encoding string
+	}{
+		{[]string{"3", "-1", "100000"}, set.EncodingIntSet},
+		{[]string{"1", "a", "b"}, set.EncodingListPack},
+		{[]string{"1", "a", "a member longer than thirty-two bytes"}, set.EncodingHashTable},
+	}
+	for _, c := range cases {
+		s := set.MakeCompactSet(4, 4, 32)
+		for _, member := range c.members {
+			s.Add(member)
+		}
+		if s.Encoding() != c.encoding {
+			t.Fatalf("encoding: %s, expected %s", s.Encoding(), c.encoding)
+		}
+
+		cmdLine := EntityToCmdLine("key", &database.DataEntity{Data: s})
+		if string(cmdLine[0]) != "SADD" || string(cmdLine[1]) != "key" {
+			t.Fatalf("cmdLine: %s", cmdLine)
+		}
+		restored := set.MakeCompactSet(4, 4, 32)
+		for _, arg := range cmdLine[2:] {
+			restored.Add(string(arg))
+		}
+		members, restoredMembers := s.ToSlice(), restored.ToSlice()
+		sort.Strings(members)
+		sort.Strings(restoredMembers)
+		if restored.Encoding() != c.encoding || len(members) != len(restoredMembers) {
+			t.Fatalf("restored encoding: %s", restored.Encoding())
+		}
+		for i := range members {
+			if members[i] != restoredMembers[i] {
+				t.Errorf("restored members: %v, expected %v", restoredMembers, members)
+			}
+		}
+	}
+}
+
+// 重放 EntityToCmdLine 得到的 ZADD 命令之后，元素和编码方式都不变
+func TestZSetToCmdLine(t *testing.T) {
+	for _, size := range []int{3, 5} {
+		zset := sortedset.MakeCompactSortedSet(4, 8)
+		for i := 0; i < size; i++ {
+			zset.Add("m"+strconv.Itoa(i), float64(size-i)/3)
+		}
+
+		cmdLine := EntityToCmdLine("key", &database.DataEntity{Data: zset})
+		if string(cmdLine[0]) != "ZADD" || len(cmdLine) != 2+2*size {
+			t.Fatalf("cmdLine: %s", cmdLine)
+		}
+		restored := sortedset.MakeCompactSortedSet(4, 8)
+		for i := 2; i < len(cmdLine); i += 2 {
+			score, err := strconv.ParseFloat(string(cmdLine[i]), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored.Add(string(cmdLine[i+1]), score)
+		}
+		if restored.Encoding() != zset.Encoding() || restored.Len() != zset.Len() {
+			t.Fatalf("restored encoding: %s, expected %s", restored.Encoding(), zset.Encoding())
+		}
+		expected, actual := zset.Range(0, zset.Len(), false), restored.Range(0, restored.Len(), false)
+		for i := range expected {
+			if expected[i].Member != actual[i].Member || expected[i].Score != actual[i].Score {
+				t.Errorf("restored element %d: %v, expected %v", i, actual[i], expected[i])
+			}
+		}
+	}
+}
+
+// 整数编码的字符串和 listpack 编码的哈希表
+func TestStringAndHashToCmdLine(t *testing.T) {
+	cmdLine := EntityToCmdLine("key", &database.DataEntity{Data: int64(-42)})
+	if len(cmdLine) != 3 || string(cmdLine[0]) != "SET" || string(cmdLine[2]) != "-42" {
+		t.Errorf("cmdLine: %s", cmdLine)
+	}
+
+	d := dict.MakeCompactDict(4, 8)
+	d.Put("f1", []byte("v1"))
+	d.Put("f2", []byte("v2"))
+	cmdLine = EntityToCmdLine("key", &database.DataEntity{Data: d})
+	if string(cmdLine[0]) != "HSET" || len(cmdLine) != 6 {
+		t.Fatalf("cmdLine: %s", cmdLine)
+	}
+	restored := dict.MakeCompactDict(4, 8)
+	for i := 2; i < len(cmdLine); i += 2 {
+		restored.Put(string(cmdLine[i]), cmdLine[i+1])
+	}
+	if restored.Encoding() != d.Encoding() || restored.Len() != 2 {
+		t.Errorf("restored encoding: %s", restored.Encoding())
+	}
+	if v, ok := restored.Get("f2"); !ok || string(v.([]byte)) != "v2" {
+		t.Error("restored value error")
+	}
+}
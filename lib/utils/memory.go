@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"encoding/json"
+	"github.com/dawnzzz/simple-redis/datastruct/bloom"
+	"github.com/dawnzzz/simple-redis/datastruct/dict"
+	"github.com/dawnzzz/simple-redis/datastruct/jsondoc"
+	List "github.com/dawnzzz/simple-redis/datastruct/list"
+	"github.com/dawnzzz/simple-redis/datastruct/queue"
+	"github.com/dawnzzz/simple-redis/datastruct/ratelimit"
+	"github.com/dawnzzz/simple-redis/datastruct/semaphore"
+	"github.com/dawnzzz/simple-redis/datastruct/set"
+	"github.com/dawnzzz/simple-redis/datastruct/sortedset"
+	"github.com/dawnzzz/simple-redis/datastruct/stream"
+	"github.com/dawnzzz/simple-redis/datastruct/tdigest"
+	"github.com/dawnzzz/simple-redis/datastruct/timeseries"
+	"github.com/dawnzzz/simple-redis/interface/database"
+	"strconv"
+)
+
+// 估算内存时使用的固定开销，只是大致的数值
+const (
+	keyOverhead     = 64 // key 在字典中的节点、DataEntity 等
+	elementOverhead = 16 // 列表、集合中每个元素的指针、长度等
+	fieldOverhead   = 48 // 哈希表中每个 field 的节点
+	zsetOverhead    = 64 // 有序集合中每个元素的跳表节点、分值以及字典节点
+	entryOverhead   = 48 // stream 中每条消息的 ID、指针，队列中每条消息的 ID、投递次数、时间等
+	sampleBytes     = 16 // 时间序列中的每个样本、t-digest 中的每个质心、滑动窗口中的每条记录
+)
+
+// EntitySize 估算 key 占用的内存字节数。紧凑编码的集合、哈希表和有序集合按照编码实际占用的字节数计算，
+// 否则列表、集合、哈希表、有序集合、stream、队列和 JSON 中的对象、数组只计算前 samples 个元素，
+// 按照平均大小乘以元素数量估算，samples 小于等于 0 时计算全部元素；概率数据结构等其他类型按照元素数量或者固定的大小估算，
+// 不需要遍历或者序列化
+func EntitySize(key string, entity *database.DataEntity, samples int) int64 {
+	size := int64(keyOverhead + len(key))
+	switch val := entity.Data.(type) {
+	case []byte:
+		return size + int64(len(val))
+	case int64:
+		return size + 8
+	case List.List:
+		return size + sampleSize(val.Len(), samples, func(consumer func(n int64) bool) {
+			val.ForEach(func(i int, v interface{}) bool {
+				b, _ := v.([]byte)
+				return consumer(int64(elementOverhead + len(b)))
+			})
+		})
+	case compactEncoding:
+		if n, ok := val.CompactBytes(); ok {
+			return size + int64(n)
+		}
+	}
+
+	switch val := entity.Data.(type) {
+	case set.Set:
+		return size + sampleSize(val.Len(), samples, func(consumer func(n int64) bool) {
+			val.ForEach(func(member string) bool {
+				return consumer(int64(elementOverhead + len(member)))
+			})
+		})
+	case dict.Dict:
+		return size + sampleSize(val.Len(), samples, func(consumer func(n int64) bool) {
+			val.ForEach(func(field string, v interface{}) bool {
+				b, _ := v.([]byte)
+				return consumer(int64(fieldOverhead + len(field) + len(b)))
+			})
+		})
+	case *sortedset.SortedSet:
+		n := int(val.Len())
+		return size + sampleSize(n, samples, func(consumer func(n int64) bool) {
+			if n > 0 {
+				val.ForEach(0, int64(n), false, func(element *sortedset.Element) bool {
+					return consumer(int64(zsetOverhead + len(element.Member)))
+				})
+			}
+		})
+	}
+
+	switch val := entity.Data.(type) {
+	case *stream.Stream:
+		return size + sampleSize(val.Len(), samples, func(consumer func(n int64) bool) {
+			val.ForEach(func(entry *stream.Entry) bool {
+				n := int64(entryOverhead)
+				for _, field := range entry.Fields {
+					n += int64(elementOverhead + len(field))
+				}
+				return consumer(n)
+			})
+		})
+	case *queue.Queue:
+		stats := val.Stats()
+		return size + sampleSize(stats.Ready+stats.Delayed+stats.Leased+stats.Dead, samples, func(consumer func(n int64) bool) {
+			val.ForEach(func(m *queue.Message) bool {
+				return consumer(int64(entryOverhead + len(m.Payload)))
+			})
+		})
+	case *jsondoc.Document:
+		sampler := &jsonSampler{samples: samples, budget: samples * samples}
+		return size + sampler.size(val.Root())
+	case *timeseries.Series:
+		size += int64(val.Len() * sampleBytes)
+		for _, label := range val.Labels() {
+			size += int64(fieldOverhead + len(label.Name) + len(label.Value))
+		}
+		return size
+	case *bloom.ScalableBloomFilter:
+		return size + int64(val.Size())
+	case *bloom.CuckooFilter:
+		return size + int64(val.Size())
+	case *bloom.CountMinSketch:
+		return size + int64(val.Width())*int64(val.Depth())*8
+	case *bloom.TopK:
+		return size + int64(val.Width())*int64(val.Depth())*8 + int64(val.K())*fieldOverhead
+	case *tdigest.TDigest:
+		return size + int64(val.NumCentroids()*sampleBytes)
+	case *ratelimit.SlidingLog:
+		return size + int64(val.Len()*sampleBytes)
+	case *semaphore.Semaphore:
+		for _, holder := range val.Holders() {
+			size += int64(entryOverhead + len(holder.Owner))
+		}
+		return size + int64(val.Waiting()*entryOverhead)
+	}
+
+	for _, arg := range EntityToCmdLine(key, entity) {
+		size += int64(len(arg))
+	}
+	return size
+}
+
+// jsonSampler 估算 JSON 值的大小，对象和数组只计算前 samples 个元素。
+// 嵌套的对象和数组最多展开 budget 个，超过之后按照元素数量估算，samples 小于等于 0 时计算全部元素
+type jsonSampler struct {
+	samples int
+	budget  int
+}
+
+func (s *jsonSampler) size(v interface{}) int64 {
+	switch val := v.(type) {
+	case *jsondoc.Object:
+		if s.samples > 0 && s.budget <= 0 {
+			return int64(val.Len() * fieldOverhead)
+		}
+		s.budget--
+		return sampleSize(val.Len(), s.samples, func(consumer func(n int64) bool) {
+			for _, key := range val.Keys() {
+				child, _ := val.Get(key)
+				if !consumer(int64(fieldOverhead+len(key)) + s.size(child)) {
+					return
+				}
+			}
+		})
+	case *jsondoc.Array:
+		if s.samples > 0 && s.budget <= 0 {
+			return int64(val.Len() * elementOverhead)
+		}
+		s.budget--
+		return sampleSize(val.Len(), s.samples, func(consumer func(n int64) bool) {
+			for _, item := range val.Items() {
+				if !consumer(int64(elementOverhead) + s.size(item)) {
+					return
+				}
+			}
+		})
+	case string:
+		return int64(elementOverhead + len(val))
+	case json.Number:
+		return int64(elementOverhead + len(val))
+	}
+	return elementOverhead
+}
+
+// sampleSize 遍历前 samples 个元素，按照平均大小估算 total 个元素的大小
+func sampleSize(total, samples int, forEach func(consumer func(n int64) bool)) int64 {
+	if total == 0 {
+		return 0
+	}
+	var sum int64
+	count := 0
+	forEach(func(n int64) bool {
+		sum += n
+		count++
+		return samples <= 0 || count < samples
+	})
+	if count == 0 {
+		return 0
+	}
+	return sum * int64(total) / int64(count)
+}
+
+// compactEncoding 元素较少时使用紧凑编码的 hash、set 和 zset
+type compactEncoding interface {
+	Encoding() string
+	CompactBytes() (int, bool)
+}
+
+// EntityEncoding 返回 key 底层使用的数据结构，用于 OBJECT ENCODING
+func EntityEncoding(entity *database.DataEntity) string {
+	switch val := entity.Data.(type) {
+	case []byte:
+		return "raw"
+	case int64:
+		return "int"
+	case compactEncoding:
+		return val.Encoding()
+	case *List.QuickList:
+		return "quicklist"
+	case set.Set, dict.Dict:
+		return "hashtable"
+	case *sortedset.SortedSet:
+		return "skiplist"
+	case *stream.Stream:
+		return "stream"
+	case *bloom.ScalableBloomFilter:
+		return "bloom"
+	case *bloom.CuckooFilter:
+		return "cuckoo"
+	case *bloom.CountMinSketch:
+		return "cms"
+	case *bloom.TopK:
+		return "topk"
+	case *tdigest.TDigest:
+		return "tdigest"
+	case *timeseries.Series:
+		return "timeseries"
+	case *semaphore.Semaphore:
+		return "semaphore"
+	case *ratelimit.SlidingLog:
+		return "slidinglog"
+	case *queue.Queue:
+		return "queue"
+	case *jsondoc.Document:
+		return "json"
+	}
+	return "unknown"
+}
+
+// EntityType 返回 key 的类型，如 string、list、set、hash、zset、stream，其他类型返回底层数据结构的名称
+func EntityType(entity *database.DataEntity) string {
+	switch entity.Data.(type) {
+	case []byte, int64:
+		return "string"
+	case List.List:
+		return "list"
+	case set.Set:
+		return "set"
+	case dict.Dict:
+		return "hash"
+	case *sortedset.SortedSet:
+		return "zset"
+	}
+	return EntityEncoding(entity)
+}
+
+// EntityLen 返回 key 的元素数量，字符串为字节数，队列为所有状态的消息数量，其他类型返回 0
+func EntityLen(entity *database.DataEntity) int64 {
+	switch val := entity.Data.(type) {
+	case []byte:
+		return int64(len(val))
+	case int64:
+		return int64(len(strconv.FormatInt(val, 10)))
+	case List.List:
+		return int64(val.Len())
+	case set.Set:
+		return int64(val.Len())
+	case dict.Dict:
+		return int64(val.Len())
+	case *sortedset.SortedSet:
+		return val.Len()
+	case *stream.Stream:
+		return int64(val.Len())
+	case *queue.Queue:
+		stats := val.Stats()
+		return int64(stats.Ready + stats.Delayed + stats.Leased + stats.Dead)
+	}
+	return 0
+}
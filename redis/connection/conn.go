@@ -34,6 +34,9 @@ type Connection struct {
 	TxID           string            // 事务ID，在分布式事务中用到
 
 	subscribeChannels map[string]struct{} // 订阅的频道
+
+	disconnected chan struct{} // 客户端断开连接时关闭，用于取消阻塞中的命令
+	disconnect   func()        // 关闭 disconnected，只执行一次
 }
 
 var connPool = sync.Pool{
@@ -52,11 +55,10 @@ func NewConn(conn net.Conn) *Connection {
 	c, ok := connPool.Get().(*Connection)
 	if !ok {
 		logger.Error("connection pool make wrong type")
-		return &Connection{
-			conn: conn,
-		}
+		c = &Connection{}
 	}
 	c.conn = conn
+	c.disconnected, c.disconnect = makeDisconnectSignal()
 	return c
 }
 
@@ -78,6 +80,7 @@ func (c *Connection) Write(bytes []byte) (int, error) {
 func (c *Connection) Close() error {
 	c.sendingData.WaitWithTimeout(10 * time.Second)
 	_ = c.conn.Close()
+	c.Disconnect()
 	c.sendingData = wait.Wait{}
 	c.password = ""
 	c.selectedDB = 0
@@ -114,3 +117,30 @@ func (c *Connection) Name() string {
 
 	return ""
 }
+
+func makeDisconnectSignal() (chan struct{}, func()) {
+	disconnected := make(chan struct{})
+	var once sync.Once
+	return disconnected, func() {
+		once.Do(func() {
+			close(disconnected)
+		})
+	}
+}
+
+// Disconnect 标记客户端已经断开连接，唤醒阻塞中的命令
+func (c *Connection) Disconnect() {
+	if c.disconnect != nil {
+		c.disconnect()
+	}
+}
+
+// DisconnectFunc 返回标记本次连接断开的函数，连接放回连接池之后再调用也不会影响复用的连接
+func (c *Connection) DisconnectFunc() func() {
+	return c.disconnect
+}
+
+// Disconnected 返回在客户端断开连接时关闭的 channel，FakeConn 返回 nil，永远不会关闭
+func (c *Connection) Disconnected() <-chan struct{} {
+	return c.disconnected
+}
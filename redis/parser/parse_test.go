@@ -1,7 +1,131 @@
 package parser
 
-import "testing"
+import (
+	"bytes"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"github.com/dawnzzz/simple-redis/redis/protocol/reply"
+	"io"
+	"strings"
+	"testing"
+)
+
+func parseAll(data string) []*Payload {
+	var payloads []*Payload
+	for payload := range ParseStream(strings.NewReader(data)) {
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
 
 func TestParseStream(t *testing.T) {
+	replies := []redis.Reply{
+		reply.MakeStatusReply("OK"),
+		reply.MakeIntReply(-42),
+		reply.MakeErrReply("ERR unknown"),
+		reply.MakeBulkStringReply([]byte("a\r\nb")),
+		reply.MakeNullBulkStringReply(),
+		reply.MakeEmptyMultiBulkStringReply(),
+		reply.MakeMultiBulkStringReply([][]byte{[]byte("set"), []byte("key"), []byte("")}),
+		reply.MakeNullMultiBulkStringReply(),
+	}
+	var buf bytes.Buffer
+	for _, r := range replies {
+		buf.Write(r.ToBytes())
+	}
+
+	payloads := parseAll(buf.String())
+	if len(payloads) != len(replies)+1 || payloads[len(payloads)-1].Err != io.EOF {
+		t.Fatalf("payloads: %d", len(payloads))
+	}
+	for i, r := range replies {
+		if payloads[i].Err != nil {
+			t.Fatalf("%d: %v", i, payloads[i].Err)
+		}
+		if !bytes.Equal(payloads[i].Data.ToBytes(), r.ToBytes()) {
+			t.Errorf("%d: %q, expected %q", i, payloads[i].Data.ToBytes(), r.ToBytes())
+		}
+	}
+	if _, ok := payloads[6].Data.(*reply.MultiBulkStringReply); !ok {
+		t.Error("array of bulk strings should be MultiBulkStringReply")
+	}
+	// 阻塞命令超时返回的空数组
+	if _, ok := payloads[7].Data.(*reply.NullMultiBulkStringReply); !ok {
+		t.Errorf("*-1 should be NullMultiBulkStringReply: %T", payloads[7].Data)
+	}
+}
+
+func TestParseNestedArray(t *testing.T) {
+	// 形如 XREAD 的回复：[[key, [[id, [field, value]]]]]
+	nested := reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkStringReply([]byte("stream")),
+			reply.MakeMultiRawReply([]redis.Reply{
+				reply.MakeMultiRawReply([]redis.Reply{
+					reply.MakeBulkStringReply([]byte("1-0")),
+					reply.MakeMultiBulkStringReply([][]byte{[]byte("field"), []byte("value")}),
+				}),
+			}),
+		}),
+		reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeIntReply(1),
+			reply.MakeStatusReply("OK"),
+			reply.MakeErrReply("ERR wrong"),
+			reply.MakeNullBulkStringReply(),
+			reply.MakeEmptyMultiBulkStringReply(),
+			reply.MakeNullMultiBulkStringReply(),
+		}),
+	})
+
+	payloads := parseAll(string(nested.ToBytes()))
+	if len(payloads) != 2 || payloads[0].Err != nil {
+		t.Fatalf("payloads: %d", len(payloads))
+	}
+	r, ok := payloads[0].Data.(*reply.MultiRawReply)
+	if !ok {
+		t.Fatalf("nested array should be MultiRawReply: %T", payloads[0].Data)
+	}
+	if !bytes.Equal(r.ToBytes(), nested.ToBytes()) {
+		t.Errorf("%q, expected %q", r.ToBytes(), nested.ToBytes())
+	}
+	if r.DataString() != nested.DataString() {
+		t.Errorf("%s, expected %s", r.DataString(), nested.DataString())
+	}
+	inner, ok := r.Replies[1].(*reply.MultiRawReply)
+	if !ok || len(inner.Replies) != 6 {
+		t.Fatal("mixed array error")
+	}
+	if v, ok := inner.Replies[0].(*reply.IntReply); !ok || v.Code != 1 {
+		t.Error("integer element error")
+	}
+	if !reply.IsErrorReply(inner.Replies[2]) {
+		t.Error("error element error")
+	}
+	if _, ok := inner.Replies[5].(*reply.NullMultiBulkStringReply); !ok {
+		t.Error("null array element error")
+	}
+}
+
+func TestParseArrayProtocolError(t *testing.T) {
+	// 数组中的元素格式错误时返回协议错误，之后的数据可以继续解析
+	payloads := parseAll("*2\r\n:abc\r\n+PONG\r\n*1\r\n$1\r\na\r\n")
+	if len(payloads) != 4 {
+		t.Fatalf("payloads: %d", len(payloads))
+	}
+	if payloads[0].Err == nil || !strings.Contains(payloads[0].Err.Error(), "protocol error") {
+		t.Errorf("expected protocol error: %v", payloads[0].Err)
+	}
+	if string(payloads[1].Data.ToBytes()) != "+PONG\r\n" || string(payloads[2].Data.ToBytes()) != "*1\r\n$1\r\na\r\n" {
+		t.Error("parse after protocol error failed")
+	}
+
+	payloads = parseAll("*-2\r\n")
+	if len(payloads) != 2 || payloads[0].Err == nil {
+		t.Error("negative array length should be a protocol error")
+	}
 
+	// 数组没有读取完时连接断开
+	payloads = parseAll("*2\r\n*1\r\n$3\r\nabc\r\n")
+	if len(payloads) != 1 || payloads[0].Err != io.EOF {
+		t.Error("truncated nested array should return io error")
+	}
 }
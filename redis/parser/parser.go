@@ -109,52 +109,104 @@ func parseBulkString(header []byte, reader *bufio.Reader, ch chan<- *Payload) er
 }
 
 func parseArray(header []byte, reader *bufio.Reader, ch chan<- *Payload) error {
+	r, err := readArray(header, reader)
+	if err != nil {
+		if pErr, ok := err.(protocolErr); ok {
+			protocolError(ch, string(pErr))
+			return nil
+		}
+		return err
+	}
+
+	ch <- &Payload{
+		Data: r,
+	}
+
+	return nil
+}
+
+// protocolErr 表示协议格式错误，与 io 错误不同，遇到协议错误时解析器可以继续工作
+type protocolErr string
+
+func (e protocolErr) Error() string {
+	return "protocol error: " + string(e)
+}
+
+// readArray 读取一个数组，数组中的元素可以是嵌套的数组
+// 若所有元素都是 bulk string 则返回 MultiBulkStringReply，否则返回 MultiRawReply，长度为 -1 时返回空数组（如阻塞命令超时）
+func readArray(header []byte, reader *bufio.Reader) (redis.Reply, error) {
 	// 解析出数组长度
 	nStrs, err := strconv.ParseInt(string(header[1:]), 10, 64)
-	if err != nil || nStrs < 0 {
-		protocolError(ch, "illegal array header "+string(header[1:]))
-		return nil
+	if err != nil || nStrs < -1 {
+		return nil, protocolErr("illegal array header " + string(header[1:]))
+	} else if nStrs == -1 {
+		return reply.MakeNullMultiBulkStringReply(), nil
 	} else if nStrs == 0 {
-		ch <- &Payload{
-			Data: reply.MakeEmptyMultiBulkStringReply(),
-		}
-		return nil
+		return reply.MakeEmptyMultiBulkStringReply(), nil
 	}
 
 	lines := make([][]byte, 0, nStrs)
+	replies := make([]redis.Reply, 0, nStrs)
+	allBulk := true
 	for i := int64(0); i < nStrs; i++ {
 		var line []byte
 		line, err = reader.ReadBytes('\n')
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		length := len(line)
-		if length < 4 || line[length-2] != '\r' || line[0] != '$' {
-			protocolError(ch, "illegal bulk string header "+string(line))
-			break
+		if length <= 2 || line[length-2] != '\r' {
+			return nil, protocolErr("illegal array element header " + string(line))
 		}
-		strLen, err := strconv.ParseInt(string(line[1:length-2]), 10, 64)
-		if err != nil || strLen < -1 {
-			protocolError(ch, "illegal bulk string length "+string(line))
-			break
-		} else if strLen == -1 {
-			lines = append(lines, []byte{})
-		} else {
-			body := make([]byte, strLen+2)
-			_, err := io.ReadFull(reader, body)
+		line = line[:length-2]
+		switch line[0] {
+		case '$':
+			strLen, err := strconv.ParseInt(string(line[1:]), 10, 64)
+			if err != nil || strLen < -1 {
+				return nil, protocolErr("illegal bulk string length " + string(line))
+			} else if strLen == -1 {
+				lines = append(lines, []byte{})
+				replies = append(replies, reply.MakeNullBulkStringReply())
+			} else {
+				body := make([]byte, strLen+2)
+				_, err := io.ReadFull(reader, body)
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, body[:len(body)-2])
+				replies = append(replies, reply.MakeBulkStringReply(body[:len(body)-2]))
+			}
+		case '*':
+			allBulk = false
+			element, err := readArray(line, reader)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			lines = append(lines, body[:len(body)-2])
+			replies = append(replies, element)
+		case ':':
+			allBulk = false
+			value, err := strconv.ParseInt(string(line[1:]), 10, 64)
+			if err != nil {
+				return nil, protocolErr("illegal number " + string(line[1:]))
+			}
+			replies = append(replies, reply.MakeIntReply(value))
+		case '+':
+			allBulk = false
+			replies = append(replies, reply.MakeStatusReply(string(line[1:])))
+		case '-':
+			allBulk = false
+			replies = append(replies, reply.MakeErrReply(string(line[1:])))
+		default:
+			return nil, protocolErr("illegal array element header " + string(line))
 		}
 	}
 
-	ch <- &Payload{
-		Data: reply.MakeMultiBulkStringReply(lines),
+	if allBulk {
+		return reply.MakeMultiBulkStringReply(lines), nil
 	}
 
-	return nil
+	return reply.MakeMultiRawReply(replies), nil
 }
 
 func protocolError(ch chan<- *Payload, msg string) {
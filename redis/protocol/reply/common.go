@@ -9,6 +9,8 @@ var (
 	nullBulkBytes = []byte("$-1\r\n")
 	// 空列表
 	emptyMultiBulkBytes = []byte("*0\r\n")
+	// 空数组（如阻塞命令超时）
+	nullMultiBulkBytes = []byte("*-1\r\n")
 	// ok 状态
 	okStatusDataString = "OK"
 	okStatusBytes      = []byte("+OK\r\n")
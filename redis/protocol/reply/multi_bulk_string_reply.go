@@ -59,3 +59,18 @@ func (r *EmptyMultiBulkStringReply) ToBytes() []byte {
 func (r *EmptyMultiBulkStringReply) DataString() string {
 	return "(empty list or set)"
 }
+
+type NullMultiBulkStringReply struct {
+}
+
+func MakeNullMultiBulkStringReply() *NullMultiBulkStringReply {
+	return &NullMultiBulkStringReply{}
+}
+
+func (r *NullMultiBulkStringReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
+func (r *NullMultiBulkStringReply) DataString() string {
+	return "(nil)"
+}
@@ -0,0 +1,57 @@
+package reply
+
+import (
+	"bytes"
+	"github.com/dawnzzz/simple-redis/interface/redis"
+	"strconv"
+	"strings"
+)
+
+// MultiRawReply 嵌套数组，数组中的每一个元素都可以是任意类型的 Reply
+type MultiRawReply struct {
+	Replies []redis.Reply
+}
+
+// MakeMultiRawReply creates MultiRawReply
+func MakeMultiRawReply(replies []redis.Reply) *MultiRawReply {
+	return &MultiRawReply{
+		Replies: replies,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *MultiRawReply) ToBytes() []byte {
+	argLen := len(r.Replies)
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(argLen) + CRLF)
+	for _, arg := range r.Replies {
+		buf.Write(arg.ToBytes())
+	}
+	return buf.Bytes()
+}
+
+func (r *MultiRawReply) DataString() string {
+	if len(r.Replies) == 0 {
+		return "(empty list or set)"
+	}
+
+	var builder strings.Builder
+	for i, arg := range r.Replies {
+		prefix := strconv.Itoa(i+1) + ") "
+		builder.WriteString(prefix)
+		// 嵌套的数组需要缩进
+		lines := strings.Split(arg.DataString(), "\n")
+		for j, line := range lines {
+			if j > 0 {
+				builder.WriteByte('\n')
+				builder.WriteString(strings.Repeat(" ", len(prefix)))
+			}
+			builder.WriteString(line)
+		}
+		if i != len(r.Replies)-1 {
+			builder.WriteByte('\n')
+		}
+	}
+
+	return builder.String()
+}
@@ -68,12 +68,12 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 	client := connection.NewConn(conn)
 	h.activeConn.Store(client, time.Now())
 
-	ch := parser.ParseStream(conn)
+	done := make(chan struct{})
+	defer close(done)
+	ch := parseClientStream(client, conn, done)
 	for payload := range ch {
 		if payload.Err != nil {
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
+			if isConnClosedErr(payload.Err) {
 				// connection closed
 				h.closeClient(client)
 				logger.Info("connection closed: " + client.RemoteAddr().String())
@@ -110,6 +110,37 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 	}
 }
 
+// parseClientStream 解析客户端发送的命令，读取到连接断开时立即标记客户端断开连接，
+// 不需要等待正在执行的命令（如阻塞命令）返回
+func parseClientStream(client *connection.Connection, conn net.Conn, done <-chan struct{}) <-chan *parser.Payload {
+	disconnect := client.DisconnectFunc()
+	payloads := parser.ParseStream(conn)
+	ch := make(chan *parser.Payload)
+	go func() {
+		defer close(ch)
+		for payload := range payloads {
+			if payload.Err != nil && isConnClosedErr(payload.Err) {
+				disconnect()
+			}
+			select {
+			case ch <- payload:
+			case <-done:
+				// 处理函数已经返回，丢弃剩余的数据直到连接关闭
+				for range payloads {
+				}
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func isConnClosedErr(err error) bool {
+	return err == io.EOF ||
+		err == io.ErrUnexpectedEOF ||
+		strings.Contains(err.Error(), "use of closed network connection")
+}
+
 func (h *Handler) Close() error {
 	logger.Info("handler shutting down...")
 	h.closing.Set(true)